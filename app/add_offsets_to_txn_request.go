@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+
+// AddOffsetsToTxnRequest represents a parsed AddOffsetsToTxn request
+type AddOffsetsToTxnRequest struct {
+	TransactionalID string
+	ProducerID      int64
+	ProducerEpoch   int16
+	GroupID         string
+}
+
+// ParseAddOffsetsToTxnRequest parses the body of an AddOffsetsToTxn request (v0-v3)
+func ParseAddOffsetsToTxnRequest(baseReq *SwiftQueueRequest) (*AddOffsetsToTxnRequest, error) {
+	version := baseReq.APIVersion
+	if version < AddOffsetsToTxnMinVersion || version > AddOffsetsToTxnMaxVersion {
+		return nil, fmt.Errorf("unsupported add offsets to txn version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &AddOffsetsToTxnRequest{}
+	req.TransactionalID = d.ReadString(flexible)
+	req.ProducerID = d.ReadInt64()
+	req.ProducerEpoch = d.ReadInt16()
+	req.GroupID = d.ReadString(flexible)
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse add offsets to txn request: %w", err)
+	}
+
+	return req, nil
+}
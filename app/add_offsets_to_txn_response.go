@@ -0,0 +1,30 @@
+package main
+
+// addOffsetsToTxnFencedVersion is the first AddOffsetsToTxn version answered with PRODUCER_FENCED
+const addOffsetsToTxnFencedVersion = 2
+
+// BuildAddOffsetsToTxnResponse adds the offsets log to the producer's transaction, so that
+// the producer can commit offsets for the group inside it, and builds the response
+func BuildAddOffsetsToTxnResponse(baseReq *SwiftQueueRequest, req *AddOffsetsToTxnRequest, broker *Broker) []byte {
+	errorCode := int16(ErrorCodeInvalidGroupID)
+	if req.GroupID != "" {
+		// Every group's offsets are kept in the same partition of the offsets topic
+		errorCode = broker.transactionCoordinator.AddPartitions(req.TransactionalID, req.ProducerID, req.ProducerEpoch,
+			baseReq.APIVersion >= addOffsetsToTxnFencedVersion, []TopicPartition{offsetsPartition})
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, baseReq.APIVersion)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Throttle time
+	rb.WriteInt32(0)
+	rb.WriteInt16(errorCode)
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
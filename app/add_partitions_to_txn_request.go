@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+
+// AddPartitionsToTxnRequest represents a parsed AddPartitionsToTxn request
+type AddPartitionsToTxnRequest struct {
+	TransactionalID string
+	ProducerID      int64
+	ProducerEpoch   int16
+	Topics          []AddPartitionsToTxnTopic
+}
+
+// AddPartitionsToTxnTopic lists the partitions of a topic to add to the transaction
+type AddPartitionsToTxnTopic struct {
+	Name       string
+	Partitions []int32
+}
+
+// ParseAddPartitionsToTxnRequest parses the body of an AddPartitionsToTxn request (v0-v3)
+func ParseAddPartitionsToTxnRequest(baseReq *SwiftQueueRequest) (*AddPartitionsToTxnRequest, error) {
+	version := baseReq.APIVersion
+	if version < AddPartitionsToTxnMinVersion || version > AddPartitionsToTxnMaxVersion {
+		return nil, fmt.Errorf("unsupported add partitions to txn version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &AddPartitionsToTxnRequest{}
+	req.TransactionalID = d.ReadString(flexible)
+	req.ProducerID = d.ReadInt64()
+	req.ProducerEpoch = d.ReadInt16()
+
+	topicCount := d.ReadArrayLength(flexible)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := AddPartitionsToTxnTopic{}
+		topic.Name = d.ReadString(flexible)
+		partitionCount := d.ReadArrayLength(flexible)
+		for j := 0; j < partitionCount && d.Err() == nil; j++ {
+			topic.Partitions = append(topic.Partitions, d.ReadInt32())
+		}
+		d.SkipTaggedFields(flexible)
+		req.Topics = append(req.Topics, topic)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse add partitions to txn request: %w", err)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+// addPartitionsToTxnFencedVersion is the first AddPartitionsToTxn version answered with PRODUCER_FENCED
+const addPartitionsToTxnFencedVersion = 2
+
+// AddPartitionsToTxnTopicResult holds the per-partition results for one topic of an
+// AddPartitionsToTxn request
+type AddPartitionsToTxnTopicResult struct {
+	Name       string
+	Partitions []AddPartitionsToTxnPartitionResult
+}
+
+// AddPartitionsToTxnPartitionResult is the outcome of adding one partition to the transaction
+type AddPartitionsToTxnPartitionResult struct {
+	Index     int32
+	ErrorCode int16
+}
+
+// BuildAddPartitionsToTxnResponse adds the requested partitions to the producer's transaction
+// and builds the response. Partitions are added all at once or not at all: if any partition
+// is unknown, the others fail with OPERATION_NOT_ATTEMPTED.
+func BuildAddPartitionsToTxnResponse(baseReq *SwiftQueueRequest, req *AddPartitionsToTxnRequest, broker *Broker) []byte {
+	topics, partitions := broker.TopicsAndPartitions()
+
+	var added []TopicPartition
+	unknown := false
+	results := make([]AddPartitionsToTxnTopicResult, 0, len(req.Topics))
+	for _, requestTopic := range req.Topics {
+		topicResult := AddPartitionsToTxnTopicResult{Name: requestTopic.Name}
+		topic := findTopicByName(topics, requestTopic.Name)
+
+		for _, index := range requestTopic.Partitions {
+			result := AddPartitionsToTxnPartitionResult{Index: index, ErrorCode: ErrorCodeNone}
+			if topic == nil || !hasPartition(partitions, topic.UUID, index) {
+				result.ErrorCode = ErrorCodeUnknownTopicOrPart
+				unknown = true
+			} else {
+				added = append(added, TopicPartition{Topic: requestTopic.Name, Partition: index})
+			}
+			topicResult.Partitions = append(topicResult.Partitions, result)
+		}
+
+		results = append(results, topicResult)
+	}
+
+	errorCode := int16(ErrorCodeOperationNotAttempted)
+	if !unknown {
+		errorCode = broker.transactionCoordinator.AddPartitions(req.TransactionalID, req.ProducerID, req.ProducerEpoch,
+			baseReq.APIVersion >= addPartitionsToTxnFencedVersion, added)
+	}
+	for _, topic := range results {
+		for i := range topic.Partitions {
+			if topic.Partitions[i].ErrorCode == ErrorCodeNone {
+				topic.Partitions[i].ErrorCode = errorCode
+			}
+		}
+	}
+
+	return encodeAddPartitionsToTxnResponse(baseReq, results)
+}
+
+// encodeAddPartitionsToTxnResponse serializes the AddPartitionsToTxn response for the request's version
+func encodeAddPartitionsToTxnResponse(baseReq *SwiftQueueRequest, results []AddPartitionsToTxnTopicResult) []byte {
+	flexible := IsFlexibleVersion(baseReq.APIKey, baseReq.APIVersion)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Throttle time
+	rb.WriteInt32(0)
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, topic := range results {
+		rb.WriteStringField(topic.Name, flexible)
+		rb.WriteArrayLength(len(topic.Partitions), flexible)
+		for _, partition := range topic.Partitions {
+			rb.WriteInt32(partition.Index)
+			rb.WriteInt16(partition.ErrorCode)
+			rb.WriteTaggedFields(flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
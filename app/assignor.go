@@ -0,0 +1,273 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+)
+
+// TopicIDPartition identifies a partition by topic ID, as the consumer rebalance protocol does
+type TopicIDPartition struct {
+	TopicID   string
+	Partition int32
+}
+
+// PartitionSet is a set of partitions identified by topic ID
+type PartitionSet map[TopicIDPartition]struct{}
+
+// Add adds a partition to the set
+func (s PartitionSet) Add(tp TopicIDPartition) {
+	s[tp] = struct{}{}
+}
+
+// Contains reports whether the set holds a partition
+func (s PartitionSet) Contains(tp TopicIDPartition) bool {
+	_, ok := s[tp]
+	return ok
+}
+
+// Minus returns the partitions of s that are not in other
+func (s PartitionSet) Minus(other PartitionSet) PartitionSet {
+	result := make(PartitionSet)
+	for tp := range s {
+		if !other.Contains(tp) {
+			result.Add(tp)
+		}
+	}
+	return result
+}
+
+// Intersect returns the partitions held by both s and other
+func (s PartitionSet) Intersect(other PartitionSet) PartitionSet {
+	result := make(PartitionSet)
+	for tp := range s {
+		if other.Contains(tp) {
+			result.Add(tp)
+		}
+	}
+	return result
+}
+
+// Union returns the partitions held by either s or other
+func (s PartitionSet) Union(other PartitionSet) PartitionSet {
+	result := make(PartitionSet, len(s)+len(other))
+	for tp := range s {
+		result.Add(tp)
+	}
+	for tp := range other {
+		result.Add(tp)
+	}
+	return result
+}
+
+// Equal reports whether both sets hold the same partitions
+func (s PartitionSet) Equal(other PartitionSet) bool {
+	return len(s) == len(other) && len(s.Minus(other)) == 0
+}
+
+// ByTopic groups the partitions by topic ID, with topics and partitions in ascending order
+func (s PartitionSet) ByTopic() ([]string, map[string][]int32) {
+	partitions := make(map[string][]int32)
+	for tp := range s {
+		partitions[tp.TopicID] = append(partitions[tp.TopicID], tp.Partition)
+	}
+	topicIDs := make([]string, 0, len(partitions))
+	for topicID, indexes := range partitions {
+		slices.Sort(indexes)
+		topicIDs = append(topicIDs, topicID)
+	}
+	slices.Sort(topicIDs)
+	return topicIDs, partitions
+}
+
+// AssignorMember describes a group member to a server assignor
+type AssignorMember struct {
+	ID         string
+	InstanceID *string
+	// Topics holds the IDs of the topics the member subscribes to
+	Topics []string
+	// Current holds the member's current target assignment, which assignors try to keep
+	Current PartitionSet
+}
+
+// AssignorTopic describes a subscribed topic to a server assignor
+type AssignorTopic struct {
+	ID         string
+	Name       string
+	Partitions int32
+}
+
+// ServerAssignor computes a group's target assignment on the coordinator.
+// Every partition of a subscribed topic is assigned to exactly one member subscribing to it.
+type ServerAssignor interface {
+	// Name is the name members select the assignor by
+	Name() string
+	// Assign maps each member ID to its target partitions
+	Assign(members []AssignorMember, topics map[string]AssignorTopic) map[string]PartitionSet
+}
+
+// ServerAssignors holds the server assignors that may be enabled with group.consumer.assignors
+var ServerAssignors = map[string]ServerAssignor{
+	RangeAssignor{}.Name():   RangeAssignor{},
+	UniformAssignor{}.Name(): UniformAssignor{},
+}
+
+// RangeAssignor assigns each topic's partitions in contiguous ranges to the members subscribing
+// to it, ordered by group instance ID or member ID. Members subscribing to the same topics get
+// the same partition indexes of each topic, which keeps co-partitioned topics together.
+type RangeAssignor struct{}
+
+// Name returns "range"
+func (RangeAssignor) Name() string {
+	return "range"
+}
+
+// Assign splits every topic's partitions into one range per subscribed member; the first
+// members get one extra partition when the partitions do not divide evenly
+func (RangeAssignor) Assign(members []AssignorMember, topics map[string]AssignorTopic) map[string]PartitionSet {
+	assignment := newAssignment(members)
+
+	for _, topic := range sortedAssignorTopics(topics) {
+		var subscribers []AssignorMember
+		for _, member := range members {
+			if slices.Contains(member.Topics, topic.ID) {
+				subscribers = append(subscribers, member)
+			}
+		}
+		if len(subscribers) == 0 {
+			continue
+		}
+		slices.SortFunc(subscribers, func(a, b AssignorMember) int {
+			return cmp.Compare(rangeSortKey(a), rangeSortKey(b))
+		})
+
+		quota, extra := int(topic.Partitions)/len(subscribers), int(topic.Partitions)%len(subscribers)
+		partition := int32(0)
+		for i, member := range subscribers {
+			count := quota
+			if i < extra {
+				count++
+			}
+			for range count {
+				assignment[member.ID].Add(TopicIDPartition{TopicID: topic.ID, Partition: partition})
+				partition++
+			}
+		}
+	}
+
+	return assignment
+}
+
+// rangeSortKey orders static members by instance ID so their ranges survive restarts
+func rangeSortKey(member AssignorMember) string {
+	if member.InstanceID != nil {
+		return *member.InstanceID
+	}
+	return member.ID
+}
+
+// UniformAssignor spreads partitions evenly across the members while moving as few of them as
+// possible. Members keep the partitions of their current assignment they still subscribe to,
+// unassigned partitions go to the least loaded subscribed member, and partitions then move from
+// the most to the least loaded members until no subscribed member holds two fewer partitions
+// than another.
+type UniformAssignor struct{}
+
+// Name returns "uniform"
+func (UniformAssignor) Name() string {
+	return "uniform"
+}
+
+// Assign computes a balanced, sticky assignment
+func (UniformAssignor) Assign(members []AssignorMember, topics map[string]AssignorTopic) map[string]PartitionSet {
+	assignment := newAssignment(members)
+	members = slices.Clone(members)
+	slices.SortFunc(members, func(a, b AssignorMember) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	subscribers := make(map[string][]string)
+	for _, member := range members {
+		for _, topicID := range member.Topics {
+			if _, ok := topics[topicID]; ok {
+				subscribers[topicID] = append(subscribers[topicID], member.ID)
+			}
+		}
+	}
+
+	// Keep current partitions that still exist and are still subscribed to
+	owners := make(map[TopicIDPartition]string)
+	for _, member := range members {
+		for tp := range member.Current {
+			topic, ok := topics[tp.TopicID]
+			if !ok || tp.Partition >= topic.Partitions || !slices.Contains(member.Topics, tp.TopicID) {
+				continue
+			}
+			if _, taken := owners[tp]; !taken {
+				owners[tp] = member.ID
+				assignment[member.ID].Add(tp)
+			}
+		}
+	}
+
+	leastLoaded := func(candidates []string) string {
+		return slices.MinFunc(candidates, func(a, b string) int {
+			return cmp.Or(cmp.Compare(len(assignment[a]), len(assignment[b])), cmp.Compare(a, b))
+		})
+	}
+
+	var all []TopicIDPartition
+	for _, topic := range sortedAssignorTopics(topics) {
+		if len(subscribers[topic.ID]) == 0 {
+			continue
+		}
+		for partition := range topic.Partitions {
+			all = append(all, TopicIDPartition{TopicID: topic.ID, Partition: partition})
+		}
+	}
+	for _, tp := range all {
+		if _, ok := owners[tp]; !ok {
+			owner := leastLoaded(subscribers[tp.TopicID])
+			owners[tp] = owner
+			assignment[owner].Add(tp)
+		}
+	}
+
+	// Move partitions to less loaded subscribers until the assignment is balanced
+	for moved := true; moved; {
+		moved = false
+		for _, tp := range all {
+			owner := owners[tp]
+			target := leastLoaded(subscribers[tp.TopicID])
+			if len(assignment[owner])-len(assignment[target]) < 2 {
+				continue
+			}
+			delete(assignment[owner], tp)
+			assignment[target].Add(tp)
+			owners[tp] = target
+			moved = true
+		}
+	}
+
+	return assignment
+}
+
+// newAssignment returns an empty assignment for every member
+func newAssignment(members []AssignorMember) map[string]PartitionSet {
+	assignment := make(map[string]PartitionSet, len(members))
+	for _, member := range members {
+		assignment[member.ID] = make(PartitionSet)
+	}
+	return assignment
+}
+
+// sortedAssignorTopics returns the topics ordered by name
+func sortedAssignorTopics(topics map[string]AssignorTopic) []AssignorTopic {
+	sorted := make([]AssignorTopic, 0, len(topics))
+	for _, topic := range topics {
+		sorted = append(sorted, topic)
+	}
+	slices.SortFunc(sorted, func(a, b AssignorTopic) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return sorted
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Broker holds the state shared by all client connections
+type Broker struct {
+	config           *Config
+	logger           *log.Logger
+	logManager       *LogManager
+	fetchPurgatory   *Purgatory
+	fetchSessions    *FetchSessionCache
+	metadataWriter   *MetadataWriter
+	producerIDs      *ProducerIDManager
+	groupCoordinator *GroupCoordinator
+	sharePartitions  *SharePartitionManager
+
+	transactionCoordinator *TransactionCoordinator
+
+	// topicsMu serializes changes to the set of topics
+	topicsMu sync.Mutex
+}
+
+// NewBroker creates the broker and opens its partition logs
+func NewBroker(config *Config, logger *log.Logger) (*Broker, error) {
+	MaxDecompressedRecordsBytes = config.MessageMaxBytes
+
+	metadataWriter := NewMetadataWriter(config)
+	if err := metadataWriter.Recover(logger); err != nil {
+		return nil, fmt.Errorf("failed to recover metadata log: %w", err)
+	}
+
+	logManager, err := NewLogManager(config, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open partition logs: %w", err)
+	}
+
+	sharePartitions, err := NewSharePartitionManager(config, logger, logManager)
+	if err != nil {
+		logManager.Close()
+		return nil, fmt.Errorf("failed to load share group state: %w", err)
+	}
+
+	groupCoordinator, err := NewGroupCoordinator(config, logger, logManager, sharePartitions)
+	if err != nil {
+		logManager.Close()
+		return nil, fmt.Errorf("failed to load committed offsets: %w", err)
+	}
+
+	broker := &Broker{
+		config:           config,
+		logger:           logger,
+		logManager:       logManager,
+		fetchPurgatory:   NewPurgatory(),
+		fetchSessions:    NewFetchSessionCache(config.FetchSessions),
+		metadataWriter:   metadataWriter,
+		producerIDs:      NewProducerIDManager(config, metadataWriter),
+		groupCoordinator: groupCoordinator,
+		sharePartitions:  sharePartitions,
+	}
+	// Released records wake share fetches waiting on their partition, as produced records do
+	sharePartitions.notify = func(tp TopicPartition) {
+		broker.fetchPurgatory.CheckAndComplete(tp.String())
+	}
+
+	broker.transactionCoordinator, err = NewTransactionCoordinator(config, logger, logManager, broker.producerIDs, broker.writeTxnMarkers)
+	if err != nil {
+		groupCoordinator.Shutdown()
+		sharePartitions.Shutdown()
+		logManager.Close()
+		return nil, fmt.Errorf("failed to load transaction state: %w", err)
+	}
+	return broker, nil
+}
+
+// TopicsAndPartitions returns the topics and partitions of the cluster metadata image kept
+// in memory. The slices are shared and must not be modified.
+func (b *Broker) TopicsAndPartitions() ([]Topic, []Partition) {
+	image := b.metadataWriter.Image()
+	return image.Topics, image.Partitions
+}
+
+// writeTxnMarkers writes the markers completing a producer's transaction to each of its
+// partitions. Partitions whose topic has since been deleted are skipped.
+func (b *Broker) writeTxnMarkers(producerID int64, producerEpoch int16, commit bool, partitions []TopicPartition) error {
+	var errs []error
+	for _, tp := range partitions {
+		if errorCode := b.writeTxnMarker(tp, producerID, producerEpoch, commit, 0); errorCode != ErrorCodeNone {
+			errs = append(errs, fmt.Errorf("failed to write marker to %s: error code %d", tp, errorCode))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeTxnMarker writes the marker completing a producer's transaction to one partition and
+// wakes the fetches waiting for the partition's last stable offset to move. Markers for the
+// offsets log also complete the offsets the transaction committed.
+func (b *Broker) writeTxnMarker(tp TopicPartition, producerID int64, producerEpoch int16, commit bool, coordinatorEpoch int32) int16 {
+	if tp == offsetsPartition {
+		if err := b.groupCoordinator.CompleteTransaction(producerID, producerEpoch, commit); err != nil {
+			b.logger.Printf("Failed to complete transactional offsets of producer %d: %v", producerID, err)
+			return ErrorCodeStorageError
+		}
+		return ErrorCodeNone
+	}
+
+	partitionLog, ok := b.logManager.GetLog(tp)
+	if !ok {
+		// Nothing was written to the partition, or its topic was deleted
+		return ErrorCodeNone
+	}
+	marker := BuildControlBatch(producerID, producerEpoch, commit, coordinatorEpoch, time.Now().UnixMilli())
+	if _, err := partitionLog.AppendAsLeader([]*RecordBatch{marker}); err != nil {
+		if errors.Is(err, ErrInvalidProducerEpoch) {
+			return ErrorCodeInvalidProducerEpoch
+		}
+		b.logger.Printf("Failed to write transaction marker to %s: %v", tp, err)
+		return ErrorCodeStorageError
+	}
+
+	b.fetchPurgatory.CheckAndComplete(tp.String())
+	return ErrorCodeNone
+}
+
+// Close releases the resources held by the broker
+func (b *Broker) Close() error {
+	b.transactionCoordinator.Shutdown()
+	b.groupCoordinator.Shutdown()
+	b.sharePartitions.Shutdown()
+	return b.logManager.Close()
+}
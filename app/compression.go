@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compression codec IDs stored in the low bits of the batch attributes
+const (
+	CompressionNone   = 0
+	CompressionGzip   = 1
+	CompressionSnappy = 2
+	CompressionLZ4    = 3
+	CompressionZstd   = 4
+)
+
+// CompressionTypeProducer is the compression.type that keeps batches compressed as the producer sent them
+const CompressionTypeProducer = "producer"
+
+// compressionTypeIDs maps the other compression.type values to the codec they select
+var compressionTypeIDs = map[string]int{
+	"uncompressed": CompressionNone,
+	"gzip":         CompressionGzip,
+	"snappy":       CompressionSnappy,
+	"lz4":          CompressionLZ4,
+	"zstd":         CompressionZstd,
+}
+
+// CompressionCodec compresses the records section of a batch, everything after the fixed header
+type CompressionCodec interface {
+	// ID is the codec ID stored in the batch attributes
+	ID() int
+	// Compress returns the compressed form of the encoded records
+	Compress(data []byte) ([]byte, error)
+	// Decompress returns the encoded records held by data, failing with ErrMessageTooLarge
+	// rather than expanding them past maxSize bytes
+	Decompress(data []byte, maxSize int) ([]byte, error)
+}
+
+// MaxDecompressedRecordsBytes bounds the size the records of a compressed batch may expand to,
+// so that a small batch cannot take up any amount of memory once decompressed. The broker sets
+// it to message.max.bytes before it starts serving requests.
+var MaxDecompressedRecordsBytes = DefaultConfig().MessageMaxBytes
+
+// CompressionCodecs holds the codecs batches can be decompressed and recompressed with, by ID.
+// Batches using any other codec are rejected with UNSUPPORTED_COMPRESSION_TYPE.
+var CompressionCodecs = map[int]CompressionCodec{
+	CompressionGzip: GzipCodec{},
+}
+
+// RegisterCompressionCodec adds a codec, replacing any registered under the same ID.
+// Codecs must be registered before the broker starts serving requests.
+func RegisterCompressionCodec(codec CompressionCodec) {
+	CompressionCodecs[codec.ID()] = codec
+}
+
+// LookupCompressionCodec returns the codec registered for a compression codec ID
+func LookupCompressionCodec(id int) (CompressionCodec, error) {
+	codec, ok := CompressionCodecs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedCompression, id)
+	}
+	return codec, nil
+}
+
+// compressionSupported reports whether the records of batches using a codec can be decoded
+func compressionSupported(id int) bool {
+	_, ok := CompressionCodecs[id]
+	return id == CompressionNone || ok
+}
+
+// compressionTypeID returns the codec ID a topic's compression.type recompresses batches with.
+// ok is false for "producer", which keeps the producer's codec.
+func compressionTypeID(compressionType string) (id int, ok bool) {
+	id, ok = compressionTypeIDs[compressionType]
+	return id, ok
+}
+
+// validateCompressionType accepts "producer" and the names of the codecs Kafka defines,
+// whether or not they are registered
+func validateCompressionType(value string) error {
+	if _, ok := compressionTypeID(value); !ok && value != CompressionTypeProducer {
+		return fmt.Errorf("must be one of producer, uncompressed, gzip, snappy, lz4, zstd")
+	}
+	return nil
+}
+
+// GzipCodec compresses records with gzip
+type GzipCodec struct{}
+
+// ID returns CompressionGzip
+func (GzipCodec) ID() int {
+	return CompressionGzip
+}
+
+// Compress gzips data
+func (GzipCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to gzip records: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to gzip records: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress gunzips data, reading at most one byte past maxSize to detect larger records
+func (GzipCodec) Decompress(data []byte, maxSize int) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to gunzip records: %w", err)
+	}
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(reader, int64(maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to gunzip records: %w", err)
+	}
+	if len(decompressed) > maxSize {
+		return nil, fmt.Errorf("%w: records exceed %d bytes once decompressed", ErrMessageTooLarge, maxSize)
+	}
+	return decompressed, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -17,7 +18,58 @@ type Config struct {
 	WriteTimeout    time.Duration
 	ShutdownTimeout time.Duration
 	MaxBufferSize   int
+	MaxRequestSize  int
 	LogDirectory    string
+	DataDirectory   string
+	MessageMaxBytes int
+	FetchSessions   int
+	NodeID          int
+	AdvertisedHost  string
+	ClusterID       string
+	AutoCreateTopic bool
+	NumPartitions   int
+	DeleteTopics    bool
+
+	LogSegmentBytes       int64
+	LogRollMs             int64
+	LogIndexIntervalBytes int64
+
+	LogCleanupPolicy            string
+	LogRetentionMs              int64
+	LogRetentionBytes           int64
+	LogRetentionCheckIntervalMs int
+
+	LogFlushOffsetCheckpointIntervalMs int
+
+	LogCleanerEnable            bool
+	LogCleanerBackoffMs         int
+	LogCleanerMinCleanableRatio float64
+	LogCleanerDeleteRetentionMs int64
+
+	CompressionType string
+
+	GroupMinSessionTimeoutMs     int
+	GroupMaxSessionTimeoutMs     int
+	GroupInitialRebalanceDelayMs int
+	GroupMaxSize                 int
+
+	GroupConsumerSessionTimeoutMs    int
+	GroupConsumerHeartbeatIntervalMs int
+	GroupConsumerAssignors           []string
+
+	GroupShareSessionTimeoutMs        int
+	GroupShareHeartbeatIntervalMs     int
+	GroupShareRecordLockDurationMs    int
+	GroupShareDeliveryCountLimit      int
+	GroupSharePartitionMaxRecordLocks int
+	ShareAutoOffsetReset              string
+
+	OffsetsRetentionMinutes         int
+	OffsetsRetentionCheckIntervalMs int
+	OffsetMetadataMaxBytes          int
+
+	TransactionMaxTimeoutMs                              int
+	TransactionAbortTimedOutTransactionCleanupIntervalMs int
 }
 
 // DefaultConfig returns the default server configuration
@@ -29,7 +81,55 @@ func DefaultConfig() *Config {
 		WriteTimeout:    30 * time.Second,
 		ShutdownTimeout: 30 * time.Second,
 		MaxBufferSize:   1024,
+		MaxRequestSize:  100 * 1024 * 1024,
 		LogDirectory:    "/tmp/kraft-combined-logs/__cluster_metadata-0/",
+		MessageMaxBytes: 1048588,
+		FetchSessions:   1000,
+		NodeID:          1,
+		AdvertisedHost:  "localhost",
+		NumPartitions:   1,
+		DeleteTopics:    true,
+
+		LogSegmentBytes:       1 << 30,
+		LogRollMs:             7 * 24 * 60 * 60 * 1000,
+		LogIndexIntervalBytes: 4096,
+
+		LogCleanupPolicy:            CleanupPolicyDelete,
+		LogRetentionMs:              7 * 24 * 60 * 60 * 1000,
+		LogRetentionBytes:           -1,
+		LogRetentionCheckIntervalMs: 300000,
+
+		LogFlushOffsetCheckpointIntervalMs: 60000,
+
+		LogCleanerEnable:            true,
+		LogCleanerBackoffMs:         15000,
+		LogCleanerMinCleanableRatio: 0.5,
+		LogCleanerDeleteRetentionMs: 24 * 60 * 60 * 1000,
+
+		CompressionType: CompressionTypeProducer,
+
+		GroupMinSessionTimeoutMs:     6000,
+		GroupMaxSessionTimeoutMs:     1800000,
+		GroupInitialRebalanceDelayMs: 3000,
+		GroupMaxSize:                 1<<31 - 1,
+
+		GroupConsumerSessionTimeoutMs:    45000,
+		GroupConsumerHeartbeatIntervalMs: 5000,
+		GroupConsumerAssignors:           []string{UniformAssignor{}.Name(), RangeAssignor{}.Name()},
+
+		GroupShareSessionTimeoutMs:        45000,
+		GroupShareHeartbeatIntervalMs:     5000,
+		GroupShareRecordLockDurationMs:    30000,
+		GroupShareDeliveryCountLimit:      5,
+		GroupSharePartitionMaxRecordLocks: 2000,
+		ShareAutoOffsetReset:              ShareAutoOffsetResetLatest,
+
+		OffsetsRetentionMinutes:         7 * 24 * 60,
+		OffsetsRetentionCheckIntervalMs: 600000,
+		OffsetMetadataMaxBytes:          4096,
+
+		TransactionMaxTimeoutMs:                              900000,
+		TransactionAbortTimedOutTransactionCleanupIntervalMs: 10000,
 	}
 }
 
@@ -38,6 +138,16 @@ func (c *Config) Address() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
 
+// DataDir returns the directory holding partition data.
+// Unless configured explicitly it is the parent of the metadata log directory,
+// so partition directories sit next to __cluster_metadata-0.
+func (c *Config) DataDir() string {
+	if c.DataDirectory != "" {
+		return c.DataDirectory
+	}
+	return filepath.Dir(filepath.Clean(c.LogDirectory))
+}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
 	if c.Port < 1 || c.Port > 65535 {
@@ -46,6 +156,107 @@ func (c *Config) Validate() error {
 	if c.MaxBufferSize < 1 {
 		return fmt.Errorf("invalid max buffer size: %d", c.MaxBufferSize)
 	}
+	if c.MaxRequestSize < 1 {
+		return fmt.Errorf("invalid max request size: %d", c.MaxRequestSize)
+	}
+	if c.MessageMaxBytes < RecordBatchHeaderSize {
+		return fmt.Errorf("invalid message max bytes: %d", c.MessageMaxBytes)
+	}
+	if c.FetchSessions < 0 {
+		return fmt.Errorf("invalid fetch session cache slots: %d", c.FetchSessions)
+	}
+	if c.NodeID < 0 {
+		return fmt.Errorf("invalid node id: %d", c.NodeID)
+	}
+	if c.NumPartitions < 1 {
+		return fmt.Errorf("invalid default partition count: %d", c.NumPartitions)
+	}
+	if c.LogSegmentBytes < RecordBatchHeaderSize {
+		return fmt.Errorf("invalid log segment bytes: %d", c.LogSegmentBytes)
+	}
+	if c.LogRollMs < 1 {
+		return fmt.Errorf("invalid log roll interval: %d", c.LogRollMs)
+	}
+	if c.LogIndexIntervalBytes < 0 {
+		return fmt.Errorf("invalid log index interval bytes: %d", c.LogIndexIntervalBytes)
+	}
+	if err := validateCleanupPolicy(c.LogCleanupPolicy); err != nil {
+		return fmt.Errorf("invalid log cleanup policy: %w", err)
+	}
+	if c.LogRetentionMs < -1 {
+		return fmt.Errorf("invalid log retention: %d ms", c.LogRetentionMs)
+	}
+	if c.LogRetentionBytes < -1 {
+		return fmt.Errorf("invalid log retention: %d bytes", c.LogRetentionBytes)
+	}
+	if c.LogRetentionCheckIntervalMs < 1 {
+		return fmt.Errorf("invalid log retention check interval: %d", c.LogRetentionCheckIntervalMs)
+	}
+	if c.LogFlushOffsetCheckpointIntervalMs < 1 {
+		return fmt.Errorf("invalid log flush offset checkpoint interval: %d", c.LogFlushOffsetCheckpointIntervalMs)
+	}
+	if c.LogCleanerBackoffMs < 1 {
+		return fmt.Errorf("invalid log cleaner backoff: %d", c.LogCleanerBackoffMs)
+	}
+	if c.LogCleanerMinCleanableRatio < 0 || c.LogCleanerMinCleanableRatio > 1 {
+		return fmt.Errorf("invalid log cleaner min cleanable ratio: %v", c.LogCleanerMinCleanableRatio)
+	}
+	if c.LogCleanerDeleteRetentionMs < 0 {
+		return fmt.Errorf("invalid log cleaner delete retention: %d ms", c.LogCleanerDeleteRetentionMs)
+	}
+	if err := validateCompressionType(c.CompressionType); err != nil {
+		return fmt.Errorf("invalid compression type: %w", err)
+	}
+	if c.GroupMinSessionTimeoutMs < 0 || c.GroupMaxSessionTimeoutMs < c.GroupMinSessionTimeoutMs {
+		return fmt.Errorf("invalid group session timeout range: %d-%d", c.GroupMinSessionTimeoutMs, c.GroupMaxSessionTimeoutMs)
+	}
+	if c.GroupInitialRebalanceDelayMs < 0 {
+		return fmt.Errorf("invalid group initial rebalance delay: %d", c.GroupInitialRebalanceDelayMs)
+	}
+	if c.GroupMaxSize < 1 {
+		return fmt.Errorf("invalid group max size: %d", c.GroupMaxSize)
+	}
+	if c.GroupConsumerHeartbeatIntervalMs < 1 || c.GroupConsumerSessionTimeoutMs <= c.GroupConsumerHeartbeatIntervalMs {
+		return fmt.Errorf("invalid consumer group heartbeat interval %d for session timeout %d", c.GroupConsumerHeartbeatIntervalMs, c.GroupConsumerSessionTimeoutMs)
+	}
+	if len(c.GroupConsumerAssignors) == 0 {
+		return fmt.Errorf("no consumer group assignors configured")
+	}
+	for _, name := range c.GroupConsumerAssignors {
+		if _, ok := ServerAssignors[name]; !ok {
+			return fmt.Errorf("unknown consumer group assignor: %s", name)
+		}
+	}
+	if c.GroupShareHeartbeatIntervalMs < 1 || c.GroupShareSessionTimeoutMs <= c.GroupShareHeartbeatIntervalMs {
+		return fmt.Errorf("invalid share group heartbeat interval %d for session timeout %d", c.GroupShareHeartbeatIntervalMs, c.GroupShareSessionTimeoutMs)
+	}
+	if c.GroupShareRecordLockDurationMs < 1 {
+		return fmt.Errorf("invalid share group record lock duration: %d", c.GroupShareRecordLockDurationMs)
+	}
+	if c.GroupShareDeliveryCountLimit < 1 || c.GroupShareDeliveryCountLimit > 1<<15-1 {
+		return fmt.Errorf("invalid share group delivery count limit: %d", c.GroupShareDeliveryCountLimit)
+	}
+	if c.GroupSharePartitionMaxRecordLocks < 1 {
+		return fmt.Errorf("invalid share partition max record locks: %d", c.GroupSharePartitionMaxRecordLocks)
+	}
+	if c.ShareAutoOffsetReset != ShareAutoOffsetResetEarliest && c.ShareAutoOffsetReset != ShareAutoOffsetResetLatest {
+		return fmt.Errorf("invalid share auto offset reset: %s", c.ShareAutoOffsetReset)
+	}
+	if c.OffsetsRetentionMinutes < 1 {
+		return fmt.Errorf("invalid offsets retention: %d minutes", c.OffsetsRetentionMinutes)
+	}
+	if c.OffsetsRetentionCheckIntervalMs < 1 {
+		return fmt.Errorf("invalid offsets retention check interval: %d", c.OffsetsRetentionCheckIntervalMs)
+	}
+	if c.OffsetMetadataMaxBytes < 0 {
+		return fmt.Errorf("invalid offset metadata max bytes: %d", c.OffsetMetadataMaxBytes)
+	}
+	if c.TransactionMaxTimeoutMs < 1 {
+		return fmt.Errorf("invalid transaction max timeout: %d", c.TransactionMaxTimeoutMs)
+	}
+	if c.TransactionAbortTimedOutTransactionCleanupIntervalMs < 1 {
+		return fmt.Errorf("invalid transaction timeout cleanup interval: %d", c.TransactionAbortTimedOutTransactionCleanupIntervalMs)
+	}
 	return nil
 }
 
@@ -98,8 +309,231 @@ func LoadConfigFromFile(filename string) (*Config, error) {
 				return nil, fmt.Errorf("invalid max.buffer.size value at line %d: %s", lineNum, value)
 			}
 			config.MaxBufferSize = size
+		case "max.request.size":
+			size, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid max.request.size value at line %d: %s", lineNum, value)
+			}
+			config.MaxRequestSize = size
 		case "log.directory":
 			config.LogDirectory = value
+		case "data.directory":
+			config.DataDirectory = value
+		case "message.max.bytes":
+			size, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid message.max.bytes value at line %d: %s", lineNum, value)
+			}
+			config.MessageMaxBytes = size
+		case "max.incremental.fetch.session.cache.slots":
+			slots, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid max.incremental.fetch.session.cache.slots value at line %d: %s", lineNum, value)
+			}
+			config.FetchSessions = slots
+		case "node.id":
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node.id value at line %d: %s", lineNum, value)
+			}
+			config.NodeID = id
+		case "advertised.host":
+			config.AdvertisedHost = value
+		case "cluster.id":
+			config.ClusterID = value
+		case "auto.create.topics.enable":
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auto.create.topics.enable value at line %d: %s", lineNum, value)
+			}
+			config.AutoCreateTopic = enabled
+		case "num.partitions":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid num.partitions value at line %d: %s", lineNum, value)
+			}
+			config.NumPartitions = count
+		case "delete.topic.enable":
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid delete.topic.enable value at line %d: %s", lineNum, value)
+			}
+			config.DeleteTopics = enabled
+		case "log.segment.bytes":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log.segment.bytes value at line %d: %s", lineNum, value)
+			}
+			config.LogSegmentBytes = n
+		case "log.roll.ms":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log.roll.ms value at line %d: %s", lineNum, value)
+			}
+			config.LogRollMs = n
+		case "log.index.interval.bytes":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log.index.interval.bytes value at line %d: %s", lineNum, value)
+			}
+			config.LogIndexIntervalBytes = n
+		case "log.cleanup.policy":
+			config.LogCleanupPolicy = value
+		case "compression.type":
+			config.CompressionType = value
+		case "log.retention.ms":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log.retention.ms value at line %d: %s", lineNum, value)
+			}
+			config.LogRetentionMs = n
+		case "log.retention.bytes":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log.retention.bytes value at line %d: %s", lineNum, value)
+			}
+			config.LogRetentionBytes = n
+		case "log.retention.check.interval.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log.retention.check.interval.ms value at line %d: %s", lineNum, value)
+			}
+			config.LogRetentionCheckIntervalMs = n
+		case "log.flush.offset.checkpoint.interval.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log.flush.offset.checkpoint.interval.ms value at line %d: %s", lineNum, value)
+			}
+			config.LogFlushOffsetCheckpointIntervalMs = n
+		case "log.cleaner.enable":
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log.cleaner.enable value at line %d: %s", lineNum, value)
+			}
+			config.LogCleanerEnable = enabled
+		case "log.cleaner.backoff.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log.cleaner.backoff.ms value at line %d: %s", lineNum, value)
+			}
+			config.LogCleanerBackoffMs = n
+		case "log.cleaner.min.cleanable.ratio":
+			ratio, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log.cleaner.min.cleanable.ratio value at line %d: %s", lineNum, value)
+			}
+			config.LogCleanerMinCleanableRatio = ratio
+		case "log.cleaner.delete.retention.ms":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log.cleaner.delete.retention.ms value at line %d: %s", lineNum, value)
+			}
+			config.LogCleanerDeleteRetentionMs = n
+		case "group.min.session.timeout.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group.min.session.timeout.ms value at line %d: %s", lineNum, value)
+			}
+			config.GroupMinSessionTimeoutMs = n
+		case "group.max.session.timeout.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group.max.session.timeout.ms value at line %d: %s", lineNum, value)
+			}
+			config.GroupMaxSessionTimeoutMs = n
+		case "group.initial.rebalance.delay.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group.initial.rebalance.delay.ms value at line %d: %s", lineNum, value)
+			}
+			config.GroupInitialRebalanceDelayMs = n
+		case "group.max.size":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group.max.size value at line %d: %s", lineNum, value)
+			}
+			config.GroupMaxSize = n
+		case "group.consumer.session.timeout.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group.consumer.session.timeout.ms value at line %d: %s", lineNum, value)
+			}
+			config.GroupConsumerSessionTimeoutMs = n
+		case "group.consumer.heartbeat.interval.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group.consumer.heartbeat.interval.ms value at line %d: %s", lineNum, value)
+			}
+			config.GroupConsumerHeartbeatIntervalMs = n
+		case "group.consumer.assignors":
+			config.GroupConsumerAssignors = nil
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					config.GroupConsumerAssignors = append(config.GroupConsumerAssignors, name)
+				}
+			}
+		case "group.share.session.timeout.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group.share.session.timeout.ms value at line %d: %s", lineNum, value)
+			}
+			config.GroupShareSessionTimeoutMs = n
+		case "group.share.heartbeat.interval.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group.share.heartbeat.interval.ms value at line %d: %s", lineNum, value)
+			}
+			config.GroupShareHeartbeatIntervalMs = n
+		case "group.share.record.lock.duration.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group.share.record.lock.duration.ms value at line %d: %s", lineNum, value)
+			}
+			config.GroupShareRecordLockDurationMs = n
+		case "group.share.delivery.count.limit":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group.share.delivery.count.limit value at line %d: %s", lineNum, value)
+			}
+			config.GroupShareDeliveryCountLimit = n
+		case "group.share.partition.max.record.locks":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group.share.partition.max.record.locks value at line %d: %s", lineNum, value)
+			}
+			config.GroupSharePartitionMaxRecordLocks = n
+		case "share.auto.offset.reset":
+			config.ShareAutoOffsetReset = value
+		case "offsets.retention.minutes":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid offsets.retention.minutes value at line %d: %s", lineNum, value)
+			}
+			config.OffsetsRetentionMinutes = n
+		case "offsets.retention.check.interval.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid offsets.retention.check.interval.ms value at line %d: %s", lineNum, value)
+			}
+			config.OffsetsRetentionCheckIntervalMs = n
+		case "offset.metadata.max.bytes":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid offset.metadata.max.bytes value at line %d: %s", lineNum, value)
+			}
+			config.OffsetMetadataMaxBytes = n
+		case "transaction.max.timeout.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transaction.max.timeout.ms value at line %d: %s", lineNum, value)
+			}
+			config.TransactionMaxTimeoutMs = n
+		case "transaction.abort.timed.out.transaction.cleanup.interval.ms":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transaction.abort.timed.out.transaction.cleanup.interval.ms value at line %d: %s", lineNum, value)
+			}
+			config.TransactionAbortTimedOutTransactionCleanupIntervalMs = n
 		// Add more properties as needed
 		default:
 			// Ignore unknown properties (for forward compatibility)
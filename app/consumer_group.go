@@ -0,0 +1,720 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Member epochs with a special meaning in ConsumerGroupHeartbeat requests
+const (
+	// JoinGroupMemberEpoch is sent by a member joining the group
+	JoinGroupMemberEpoch = 0
+	// LeaveGroupMemberEpoch is sent by a member leaving the group
+	LeaveGroupMemberEpoch = -1
+	// LeaveGroupStaticMemberEpoch is sent by a static member leaving temporarily; it keeps its
+	// assignment until it rejoins or its session times out
+	LeaveGroupStaticMemberEpoch = -2
+)
+
+// ConsumerMemberState is the reconciliation state of a consumer group member
+type ConsumerMemberState int
+
+const (
+	// MemberStable holds its whole target assignment
+	MemberStable ConsumerMemberState = iota
+	// MemberUnrevokedPartitions must revoke partitions before it gets new ones
+	MemberUnrevokedPartitions
+	// MemberUnreleasedPartitions waits for other members to revoke partitions of its target assignment
+	MemberUnreleasedPartitions
+)
+
+// ConsumerGroupMember is a member of a group using the consumer rebalance protocol
+type ConsumerGroupMember struct {
+	ID                   string
+	InstanceID           *string
+	RackID               *string
+	ClientID             string
+	ClientHost           string
+	RebalanceTimeout     time.Duration
+	SubscribedTopicNames []string
+	SubscribedTopicRegex *string
+	ServerAssignor       *string
+
+	regex         *regexp.Regexp
+	state         ConsumerMemberState
+	epoch         int32
+	previousEpoch int32
+	// assigned holds the partitions the member may consume
+	assigned PartitionSet
+	// pendingRevocation holds partitions the member must give up before its epoch advances
+	pendingRevocation PartitionSet
+	// sendAssignment is set until the member has been sent its latest assignment
+	sendAssignment bool
+	// leftTemporarily is set for a static member that left with LeaveGroupStaticMemberEpoch
+	leftTemporarily bool
+
+	sessionTimer    *time.Timer
+	revocationTimer *time.Timer
+}
+
+// ConsumerGroupHeartbeatResult is the answer to a ConsumerGroupHeartbeat request
+type ConsumerGroupHeartbeatResult struct {
+	ErrorCode           int16
+	ErrorMessage        *string
+	MemberID            *string
+	MemberEpoch         int32
+	HeartbeatIntervalMs int32
+	// Assignment is nil when the member already knows its assignment
+	Assignment PartitionSet
+}
+
+// ConsumerGroupDescription describes a consumer group for ConsumerGroupDescribe
+type ConsumerGroupDescription struct {
+	ErrorCode       int16
+	ErrorMessage    *string
+	GroupID         string
+	State           string
+	GroupEpoch      int32
+	AssignmentEpoch int32
+	AssignorName    string
+	Members         []ConsumerGroupMemberDescription
+	// TopicNames maps the IDs of the subscribed topics to their names
+	TopicNames map[string]string
+}
+
+// ConsumerGroupMemberDescription describes one member of a consumer group
+type ConsumerGroupMemberDescription struct {
+	MemberID             string
+	InstanceID           *string
+	RackID               *string
+	MemberEpoch          int32
+	ClientID             string
+	ClientHost           string
+	SubscribedTopicNames []string
+	SubscribedTopicRegex *string
+	Assignment           PartitionSet
+	TargetAssignment     PartitionSet
+}
+
+// ConsumerGroupHeartbeat runs the consumer rebalance protocol (KIP-848) for one member.
+//
+// The coordinator computes each member's target assignment with a server assignor whenever
+// the group epoch moves, which happens when members join or leave or when the subscribed topics
+// change. Members then converge on their targets through their heartbeats: partitions leaving a
+// member are revoked first, and partitions joining it are only handed out once their previous
+// owner has acknowledged revoking them. A member's epoch catches up with the assignment epoch
+// once it has nothing left to revoke, so no member ever stops consuming for a rebalance.
+func (c *GroupCoordinator) ConsumerGroupHeartbeat(version int16, clientID string, clientHost string, req *ConsumerGroupHeartbeatRequest, topics []Topic, partitions []Partition) ConsumerGroupHeartbeatResult {
+	if message := validateConsumerGroupHeartbeat(version, req); message != "" {
+		return consumerHeartbeatError(ErrorCodeInvalidRequest, message)
+	}
+	if req.ServerAssignor != nil && !slices.Contains(c.config.GroupConsumerAssignors, *req.ServerAssignor) {
+		return consumerHeartbeatError(ErrorCodeUnsupportedAssignor, fmt.Sprintf("Assignor %s is not supported", *req.ServerAssignor))
+	}
+	var regex *regexp.Regexp
+	if req.SubscribedTopicRegex != nil && *req.SubscribedTopicRegex != "" {
+		var err error
+		// Subscriptions match whole topic names
+		if regex, err = regexp.Compile("^(?:" + *req.SubscribedTopicRegex + ")$"); err != nil {
+			return consumerHeartbeatError(ErrorCodeInvalidRegularExpression, err.Error())
+		}
+	}
+
+	g := c.group(req.GroupID, req.MemberEpoch == JoinGroupMemberEpoch)
+	if g == nil {
+		return consumerHeartbeatError(ErrorCodeGroupIDNotFound, fmt.Sprintf("Group %s not found", req.GroupID))
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == GroupDead {
+		return consumerHeartbeatError(ErrorCodeCoordinatorNotAvailable, "")
+	}
+	if g.groupType != GroupTypeConsumer {
+		if g.state != GroupEmpty || len(g.pendingMembers) > 0 || g.groupType == GroupTypeShare {
+			return consumerHeartbeatError(ErrorCodeGroupIDNotFound, fmt.Sprintf("Group %s is not a consumer group", g.ID))
+		}
+		g.convertToConsumerGroup()
+	}
+
+	if req.MemberEpoch == LeaveGroupMemberEpoch || req.MemberEpoch == LeaveGroupStaticMemberEpoch {
+		return c.leaveConsumerGroup(g, req)
+	}
+
+	var member *ConsumerGroupMember
+	joined := false
+	if req.MemberEpoch == JoinGroupMemberEpoch {
+		var errorCode int16
+		var message string
+		if member, joined, errorCode, message = c.joinConsumerGroup(g, req); errorCode != ErrorCodeNone {
+			return consumerHeartbeatError(errorCode, message)
+		}
+	} else {
+		member = g.consumerMembers[req.MemberID]
+		if member == nil {
+			return consumerHeartbeatError(ErrorCodeUnknownMemberID, fmt.Sprintf("Member %s is not a member of group %s", req.MemberID, g.ID))
+		}
+		if !member.acceptsEpoch(req.MemberEpoch, req.ownedPartitions()) {
+			return consumerHeartbeatError(ErrorCodeFencedMemberEpoch,
+				fmt.Sprintf("Member epoch %d does not match the expected epoch %d", req.MemberEpoch, member.epoch))
+		}
+		member.leftTemporarily = false
+	}
+
+	if changed := member.update(clientID, clientHost, req, regex); joined {
+		c.bumpGroupEpoch(g, fmt.Sprintf("member %s joined", member.ID))
+	} else if changed {
+		c.bumpGroupEpoch(g, fmt.Sprintf("member %s updated its subscription", member.ID))
+	}
+	c.refreshSubscriptionMetadata(g, topics, partitions)
+	c.maybeComputeTargetAssignment(g)
+	c.reconcile(g, member, req.ownedPartitions())
+	c.scheduleConsumerSessionTimeout(g, member)
+
+	result := ConsumerGroupHeartbeatResult{
+		ErrorCode:           ErrorCodeNone,
+		MemberID:            stringPtr(member.ID),
+		MemberEpoch:         member.epoch,
+		HeartbeatIntervalMs: int32(c.config.GroupConsumerHeartbeatIntervalMs),
+	}
+	if owned := req.ownedPartitions(); member.sendAssignment || owned != nil && !owned.Equal(member.assigned) {
+		result.Assignment = maps.Clone(member.assigned)
+		member.sendAssignment = false
+	}
+	return result
+}
+
+// validateConsumerGroupHeartbeat checks the fields required for the member epoch of a
+// ConsumerGroupHeartbeat request, returning a message describing the first problem found
+func validateConsumerGroupHeartbeat(version int16, req *ConsumerGroupHeartbeatRequest) string {
+	switch {
+	case req.GroupID == "":
+		return "GroupId can't be empty"
+	case req.InstanceID != nil && *req.InstanceID == "":
+		return "InstanceId can't be empty"
+	case req.RackID != nil && *req.RackID == "":
+		return "RackId can't be empty"
+	case req.MemberEpoch < LeaveGroupStaticMemberEpoch:
+		return fmt.Sprintf("MemberEpoch %d is invalid", req.MemberEpoch)
+	case req.MemberID == "" && (version >= 1 || req.MemberEpoch != JoinGroupMemberEpoch):
+		return "MemberId can't be empty"
+	case req.MemberEpoch == LeaveGroupStaticMemberEpoch && req.InstanceID == nil:
+		return "InstanceId can't be null for a static member leaving temporarily"
+	}
+
+	if req.MemberEpoch == JoinGroupMemberEpoch {
+		switch {
+		case req.RebalanceTimeoutMs < 0:
+			return "RebalanceTimeoutMs must be provided when joining"
+		case req.SubscribedTopicNames == nil && req.SubscribedTopicRegex == nil:
+			return "SubscribedTopicNames or SubscribedTopicRegex must be set when joining"
+		case req.Topics == nil || len(req.Topics) > 0:
+			return "TopicPartitions must be empty when joining"
+		}
+	}
+	return ""
+}
+
+// consumerHeartbeatError builds a failed ConsumerGroupHeartbeat result
+func consumerHeartbeatError(errorCode int16, message string) ConsumerGroupHeartbeatResult {
+	result := ConsumerGroupHeartbeatResult{ErrorCode: errorCode}
+	if message != "" {
+		result.ErrorMessage = stringPtr(message)
+	}
+	return result
+}
+
+// joinConsumerGroup adds a member joining with epoch 0, or resets a member rejoining with its
+// existing ID. A static member may take over the assignment of its previous incarnation once
+// that has left temporarily. joined reports whether a member was added to the group.
+func (c *GroupCoordinator) joinConsumerGroup(g *ConsumerGroup, req *ConsumerGroupHeartbeatRequest) (member *ConsumerGroupMember, joined bool, errorCode int16, message string) {
+	memberID := req.MemberID
+	if memberID == "" {
+		memberID = newMemberID(g.ID)
+	}
+
+	if req.InstanceID != nil {
+		if previousID, ok := g.staticMembers[*req.InstanceID]; ok && previousID != memberID {
+			previous := g.consumerMembers[previousID]
+			if !previous.leftTemporarily {
+				return nil, false, ErrorCodeUnreleasedInstanceID,
+					fmt.Sprintf("Static member %s with instance id %s is not released", previousID, *req.InstanceID)
+			}
+
+			member = previous
+			g.removeConsumerMember(previous)
+			member.ID = memberID
+			member.leftTemporarily = false
+			member.sendAssignment = true
+			g.addConsumerMember(member)
+			if target, ok := g.targetAssignment[previousID]; ok {
+				delete(g.targetAssignment, previousID)
+				g.targetAssignment[memberID] = target
+			}
+			c.logger.Printf("Group %s: static member %s replaced member %s", g.ID, memberID, previousID)
+			return member, false, ErrorCodeNone, ""
+		}
+	}
+
+	if member = g.consumerMembers[memberID]; member != nil {
+		// The member lost its state and gives up its partitions
+		member.stopTimers()
+		member.epoch, member.previousEpoch = JoinGroupMemberEpoch, JoinGroupMemberEpoch
+		member.state = MemberStable
+		member.assigned = make(PartitionSet)
+		member.pendingRevocation = make(PartitionSet)
+		member.sendAssignment = true
+		return member, false, ErrorCodeNone, ""
+	}
+
+	if len(g.consumerMembers) >= c.config.GroupMaxSize {
+		return nil, false, ErrorCodeGroupMaxSizeReached, fmt.Sprintf("Group %s has reached its maximum size", g.ID)
+	}
+
+	member = &ConsumerGroupMember{
+		ID:                memberID,
+		InstanceID:        req.InstanceID,
+		assigned:          make(PartitionSet),
+		pendingRevocation: make(PartitionSet),
+		sendAssignment:    true,
+	}
+	g.addConsumerMember(member)
+	return member, true, ErrorCodeNone, ""
+}
+
+// leaveConsumerGroup removes a leaving member. A static member leaving temporarily keeps its
+// assignment for its replacement until its session times out.
+func (c *GroupCoordinator) leaveConsumerGroup(g *ConsumerGroup, req *ConsumerGroupHeartbeatRequest) ConsumerGroupHeartbeatResult {
+	memberID := req.MemberID
+	if req.InstanceID != nil {
+		if id, ok := g.staticMembers[*req.InstanceID]; ok {
+			memberID = id
+		}
+	}
+	member := g.consumerMembers[memberID]
+	if member == nil {
+		return consumerHeartbeatError(ErrorCodeUnknownMemberID, fmt.Sprintf("Member %s is not a member of group %s", req.MemberID, g.ID))
+	}
+
+	if req.MemberEpoch == LeaveGroupStaticMemberEpoch {
+		member.leftTemporarily = true
+		c.logger.Printf("Group %s: static member %s left temporarily", g.ID, member.ID)
+	} else {
+		c.removeConsumerMemberAndUpdateGroup(g, member, fmt.Sprintf("member %s left the group", member.ID))
+	}
+	return ConsumerGroupHeartbeatResult{
+		ErrorCode:           ErrorCodeNone,
+		MemberID:            stringPtr(member.ID),
+		MemberEpoch:         req.MemberEpoch,
+		HeartbeatIntervalMs: int32(c.config.GroupConsumerHeartbeatIntervalMs),
+	}
+}
+
+// acceptsEpoch reports whether a heartbeat with the given member epoch comes from the member's
+// current incarnation. The previous epoch is accepted from a member that missed the response
+// moving it to the current one, as long as it owns no partitions it no longer holds.
+func (m *ConsumerGroupMember) acceptsEpoch(epoch int32, owned PartitionSet) bool {
+	if epoch == m.epoch {
+		return true
+	}
+	return epoch == m.previousEpoch && owned != nil && len(owned.Minus(m.assigned)) == 0
+}
+
+// update applies the fields of a heartbeat to the member and reports whether its subscription
+// or preferred assignor changed. Null fields leave the member unchanged.
+func (m *ConsumerGroupMember) update(clientID string, clientHost string, req *ConsumerGroupHeartbeatRequest, regex *regexp.Regexp) bool {
+	m.ClientID = clientID
+	m.ClientHost = clientHost
+	if req.RackID != nil {
+		m.RackID = req.RackID
+	}
+	if req.RebalanceTimeoutMs >= 0 {
+		m.RebalanceTimeout = time.Duration(req.RebalanceTimeoutMs) * time.Millisecond
+	}
+
+	changed := false
+	if req.SubscribedTopicNames != nil {
+		names := slices.Sorted(slices.Values(req.SubscribedTopicNames))
+		names = slices.Compact(names)
+		if !slices.Equal(names, m.SubscribedTopicNames) {
+			m.SubscribedTopicNames = names
+			changed = true
+		}
+	}
+	if req.SubscribedTopicRegex != nil && !equalStringPtrs(req.SubscribedTopicRegex, m.SubscribedTopicRegex) {
+		m.SubscribedTopicRegex = req.SubscribedTopicRegex
+		m.regex = regex
+		changed = true
+	}
+	if req.ServerAssignor != nil && !equalStringPtrs(req.ServerAssignor, m.ServerAssignor) {
+		m.ServerAssignor = req.ServerAssignor
+		changed = true
+	}
+	return changed
+}
+
+// subscribes reports whether the member subscribes to a topic by name or regex.
+// Regexes do not match internal topics.
+func (m *ConsumerGroupMember) subscribes(topic string) bool {
+	if slices.Contains(m.SubscribedTopicNames, topic) {
+		return true
+	}
+	return m.regex != nil && !IsInternalTopic(topic) && m.regex.MatchString(topic)
+}
+
+// stopTimers cancels the member's session and revocation timers
+func (m *ConsumerGroupMember) stopTimers() {
+	if m.sessionTimer != nil {
+		m.sessionTimer.Stop()
+	}
+	m.stopRevocationTimer()
+}
+
+// stopRevocationTimer cancels the member's revocation timer, if any
+func (m *ConsumerGroupMember) stopRevocationTimer() {
+	if m.revocationTimer != nil {
+		m.revocationTimer.Stop()
+		m.revocationTimer = nil
+	}
+}
+
+// bumpGroupEpoch starts a new group epoch, for which a new target assignment is computed
+func (c *GroupCoordinator) bumpGroupEpoch(g *ConsumerGroup, reason string) {
+	g.groupEpoch++
+	c.logger.Printf("Group %s: epoch %d: %s", g.ID, g.groupEpoch, reason)
+}
+
+// refreshSubscriptionMetadata resolves the members' subscriptions against the topic metadata,
+// bumping the group epoch when the subscribed topics or their partition counts change
+func (c *GroupCoordinator) refreshSubscriptionMetadata(g *ConsumerGroup, topics []Topic, partitions []Partition) {
+	metadata := make(map[string]AssignorTopic)
+	for _, topic := range topics {
+		if g.isSubscribed(topic.Name) {
+			metadata[topic.UUID] = AssignorTopic{
+				ID:         topic.UUID,
+				Name:       topic.Name,
+				Partitions: int32(len(filterPartitionsByTopicUUID(partitions, topic.UUID))),
+			}
+		}
+	}
+
+	if !maps.Equal(metadata, g.subscriptionMetadata) {
+		g.subscriptionMetadata = metadata
+		c.bumpGroupEpoch(g, "subscribed topic metadata changed")
+	}
+}
+
+// isSubscribed reports whether any member of a consumer or share group subscribes to a topic
+func (g *ConsumerGroup) isSubscribed(topic string) bool {
+	for _, member := range g.consumerMembers {
+		if member.subscribes(topic) {
+			return true
+		}
+	}
+	for _, member := range g.shareMembers {
+		if slices.Contains(member.SubscribedTopicNames, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// maybeComputeTargetAssignment computes the target assignment of a new group epoch
+func (c *GroupCoordinator) maybeComputeTargetAssignment(g *ConsumerGroup) {
+	if g.assignmentEpoch >= g.groupEpoch {
+		return
+	}
+
+	g.assignorName = g.selectAssignor(c.config.GroupConsumerAssignors)
+	members := make([]AssignorMember, 0, len(g.consumerMembers))
+	for _, member := range g.consumerMembers {
+		var topicIDs []string
+		for id, topic := range g.subscriptionMetadata {
+			if member.subscribes(topic.Name) {
+				topicIDs = append(topicIDs, id)
+			}
+		}
+		members = append(members, AssignorMember{
+			ID:         member.ID,
+			InstanceID: member.InstanceID,
+			Topics:     topicIDs,
+			Current:    g.targetAssignment[member.ID],
+		})
+	}
+
+	g.targetAssignment = ServerAssignors[g.assignorName].Assign(members, g.subscriptionMetadata)
+	g.assignmentEpoch = g.groupEpoch
+	c.logger.Printf("Group %s: computed target assignment of epoch %d for %d members with the %s assignor",
+		g.ID, g.assignmentEpoch, len(members), g.assignorName)
+}
+
+// selectAssignor picks the server assignor preferred by most members. Ties, and groups whose
+// members have no preference, go to the first of the enabled assignors.
+func (g *ConsumerGroup) selectAssignor(enabled []string) string {
+	votes := make(map[string]int)
+	for _, member := range g.consumerMembers {
+		if member.ServerAssignor != nil {
+			votes[*member.ServerAssignor]++
+		}
+	}
+
+	selected := enabled[0]
+	for _, name := range enabled {
+		if votes[name] > votes[selected] {
+			selected = name
+		}
+	}
+	return selected
+}
+
+// reconcile moves a member towards its target assignment. Partitions leaving the member are
+// revoked first; partitions joining it are only handed out once their previous owner has
+// revoked them. owned holds the partitions the member reported owning, or nil if it did not.
+func (c *GroupCoordinator) reconcile(g *ConsumerGroup, member *ConsumerGroupMember, owned PartitionSet) {
+	if member.state == MemberUnrevokedPartitions {
+		if owned == nil || len(owned.Intersect(member.pendingRevocation)) > 0 {
+			return
+		}
+		member.pendingRevocation = make(PartitionSet)
+		member.stopRevocationTimer()
+	} else if member.state == MemberStable && member.epoch == g.assignmentEpoch {
+		return
+	}
+
+	target := g.targetAssignment[member.ID]
+	if revoked := member.assigned.Minus(target); len(revoked) > 0 {
+		member.assigned = member.assigned.Intersect(target)
+		member.pendingRevocation = revoked
+		member.state = MemberUnrevokedPartitions
+		member.sendAssignment = true
+		c.scheduleRevocationTimeout(g, member)
+		return
+	}
+
+	wanted := target.Minus(member.assigned)
+	granted := wanted.Minus(g.ownedPartitions(member))
+	if len(granted) > 0 {
+		member.assigned = member.assigned.Union(granted)
+		member.sendAssignment = true
+	}
+	if member.epoch != g.assignmentEpoch {
+		member.previousEpoch, member.epoch = member.epoch, g.assignmentEpoch
+		member.sendAssignment = true
+	}
+	member.state = MemberStable
+	if len(granted) < len(wanted) {
+		member.state = MemberUnreleasedPartitions
+	}
+}
+
+// ownedPartitions returns the partitions held or still being revoked by every member but one
+func (g *ConsumerGroup) ownedPartitions(except *ConsumerGroupMember) PartitionSet {
+	owned := make(PartitionSet)
+	for _, member := range g.consumerMembers {
+		if member == except {
+			continue
+		}
+		for tp := range member.assigned {
+			owned.Add(tp)
+		}
+		for tp := range member.pendingRevocation {
+			owned.Add(tp)
+		}
+	}
+	return owned
+}
+
+// scheduleConsumerSessionTimeout (re)starts a member's session timer; members that miss it
+// are removed from the group
+func (c *GroupCoordinator) scheduleConsumerSessionTimeout(g *ConsumerGroup, member *ConsumerGroupMember) {
+	if member.sessionTimer != nil {
+		member.sessionTimer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Duration(c.config.GroupConsumerSessionTimeoutMs)*time.Millisecond, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if member.sessionTimer != timer || g.consumerMembers[member.ID] != member {
+			return
+		}
+		c.removeConsumerMemberAndUpdateGroup(g, member, fmt.Sprintf("session of member %s timed out", member.ID))
+	})
+	member.sessionTimer = timer
+}
+
+// scheduleRevocationTimeout bounds how long a member may take to revoke partitions; a member
+// that misses it is fenced, so its partitions can move on
+func (c *GroupCoordinator) scheduleRevocationTimeout(g *ConsumerGroup, member *ConsumerGroupMember) {
+	member.stopRevocationTimer()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(member.RebalanceTimeout, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if member.revocationTimer != timer || g.consumerMembers[member.ID] != member {
+			return
+		}
+		c.removeConsumerMemberAndUpdateGroup(g, member, fmt.Sprintf("member %s did not revoke its partitions in time", member.ID))
+	})
+	member.revocationTimer = timer
+}
+
+// removeConsumerMemberAndUpdateGroup removes a member and recomputes the target assignment
+// of the remaining members
+func (c *GroupCoordinator) removeConsumerMemberAndUpdateGroup(g *ConsumerGroup, member *ConsumerGroupMember, reason string) {
+	member.stopTimers()
+	g.removeConsumerMember(member)
+	delete(g.targetAssignment, member.ID)
+	c.bumpGroupEpoch(g, reason)
+	c.maybeComputeTargetAssignment(g)
+}
+
+// addConsumerMember adds a member to a consumer group
+func (g *ConsumerGroup) addConsumerMember(member *ConsumerGroupMember) {
+	g.consumerMembers[member.ID] = member
+	if member.InstanceID != nil {
+		g.staticMembers[*member.InstanceID] = member.ID
+	}
+	g.state = GroupStable
+}
+
+// removeConsumerMember drops a member from a consumer group, emptying the group with its last member
+func (g *ConsumerGroup) removeConsumerMember(member *ConsumerGroupMember) {
+	delete(g.consumerMembers, member.ID)
+	if member.InstanceID != nil && g.staticMembers[*member.InstanceID] == member.ID {
+		delete(g.staticMembers, *member.InstanceID)
+	}
+	if len(g.consumerMembers) == 0 {
+		g.state = GroupEmpty
+		g.emptySince = time.Now()
+	}
+}
+
+// validateConsumerCommit checks that an offset commit comes from a member of a consumer group
+// at its current or previous member epoch
+func (g *ConsumerGroup) validateConsumerCommit(memberID string, memberEpoch int32) int16 {
+	member := g.consumerMembers[memberID]
+	if member == nil {
+		return ErrorCodeUnknownMemberID
+	}
+	if memberEpoch != member.epoch && memberEpoch != member.previousEpoch {
+		return ErrorCodeStaleMemberEpoch
+	}
+	return ErrorCodeNone
+}
+
+// convertToConsumerGroup turns an empty classic group, which may hold committed offsets,
+// into a consumer group
+func (g *ConsumerGroup) convertToConsumerGroup() {
+	g.groupType = GroupTypeConsumer
+	g.protocolType = ConsumerProtocolType
+	g.protocolName = ""
+	g.consumerMembers = make(map[string]*ConsumerGroupMember)
+	g.targetAssignment = make(map[string]PartitionSet)
+	g.subscriptionMetadata = make(map[string]AssignorTopic)
+	g.staticMembers = make(map[string]string)
+}
+
+// convertToClassicGroup turns an empty consumer group into a classic group
+func (g *ConsumerGroup) convertToClassicGroup() {
+	g.groupType = GroupTypeClassic
+	g.protocolType = ""
+	g.assignorName = ""
+	g.consumerMembers = nil
+	g.shareMembers = nil
+	g.targetAssignment = nil
+	g.subscriptionMetadata = nil
+	g.staticMembers = make(map[string]string)
+}
+
+// stateName returns the group state reported by the admin APIs. A consumer group with members
+// is Assigning until its target assignment is computed, Reconciling until every member holds
+// its target assignment and Stable after that.
+func (g *ConsumerGroup) stateName() string {
+	if g.groupType != GroupTypeConsumer || g.state != GroupStable {
+		return g.state.String()
+	}
+	if g.assignmentEpoch < g.groupEpoch {
+		return "Assigning"
+	}
+	for _, member := range g.consumerMembers {
+		if member.epoch != g.assignmentEpoch || member.state != MemberStable {
+			return "Reconciling"
+		}
+	}
+	return "Stable"
+}
+
+// DescribeConsumerGroup describes a group using the consumer rebalance protocol
+func (c *GroupCoordinator) DescribeConsumerGroup(groupID string) ConsumerGroupDescription {
+	description := ConsumerGroupDescription{GroupID: groupID, State: GroupDead.String()}
+	fail := func(errorCode int16, message string) ConsumerGroupDescription {
+		description.ErrorCode = errorCode
+		description.ErrorMessage = stringPtr(message)
+		return description
+	}
+
+	g := c.group(groupID, false)
+	if g == nil {
+		return fail(ErrorCodeGroupIDNotFound, fmt.Sprintf("Group %s not found", groupID))
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == GroupDead {
+		return fail(ErrorCodeGroupIDNotFound, fmt.Sprintf("Group %s not found", groupID))
+	}
+	if g.groupType != GroupTypeConsumer {
+		return fail(ErrorCodeGroupIDNotFound, fmt.Sprintf("Group %s is not a consumer group", groupID))
+	}
+
+	description.ErrorCode = ErrorCodeNone
+	description.State = g.stateName()
+	description.GroupEpoch = g.groupEpoch
+	description.AssignmentEpoch = g.assignmentEpoch
+	description.AssignorName = g.assignorName
+	description.TopicNames = make(map[string]string, len(g.subscriptionMetadata))
+	for id, topic := range g.subscriptionMetadata {
+		description.TopicNames[id] = topic.Name
+	}
+
+	members := slices.Collect(maps.Values(g.consumerMembers))
+	slices.SortFunc(members, func(a, b *ConsumerGroupMember) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	for _, member := range members {
+		target := g.targetAssignment[member.ID]
+		if target == nil {
+			target = make(PartitionSet)
+		}
+		description.Members = append(description.Members, ConsumerGroupMemberDescription{
+			MemberID:             member.ID,
+			InstanceID:           member.InstanceID,
+			RackID:               member.RackID,
+			MemberEpoch:          member.epoch,
+			ClientID:             member.ClientID,
+			ClientHost:           member.ClientHost,
+			SubscribedTopicNames: member.SubscribedTopicNames,
+			SubscribedTopicRegex: member.SubscribedTopicRegex,
+			Assignment:           maps.Clone(member.assigned),
+			TargetAssignment:     maps.Clone(target),
+		})
+	}
+
+	return description
+}
+
+// equalStringPtrs reports whether two nullable strings are equal
+func equalStringPtrs(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,31 @@
+package main
+
+import "fmt"
+
+// ConsumerGroupDescribeRequest represents a parsed ConsumerGroupDescribe request
+type ConsumerGroupDescribeRequest struct {
+	GroupIDs                    []string
+	IncludeAuthorizedOperations bool
+}
+
+// ParseConsumerGroupDescribeRequest parses the body of a ConsumerGroupDescribe request (v0-v1)
+func ParseConsumerGroupDescribeRequest(baseReq *SwiftQueueRequest) (*ConsumerGroupDescribeRequest, error) {
+	version := baseReq.APIVersion
+	if version < ConsumerGroupDescribeMinVersion || version > ConsumerGroupDescribeMaxVersion {
+		return nil, fmt.Errorf("unsupported consumer group describe version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &ConsumerGroupDescribeRequest{}
+	req.GroupIDs = d.ReadStringArray(flexible)
+	req.IncludeAuthorizedOperations = d.ReadBool()
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse consumer group describe request: %w", err)
+	}
+
+	return req, nil
+}
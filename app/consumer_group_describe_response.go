@@ -0,0 +1,86 @@
+package main
+
+// ConsumerGroupMemberTypeConsumer marks members using the consumer rebalance protocol (v1+)
+const ConsumerGroupMemberTypeConsumer = 1
+
+// BuildConsumerGroupDescribeResponse describes each requested consumer group and builds the response
+func BuildConsumerGroupDescribeResponse(baseReq *SwiftQueueRequest, req *ConsumerGroupDescribeRequest, broker *Broker) []byte {
+	descriptions := make([]ConsumerGroupDescription, 0, len(req.GroupIDs))
+	for _, groupID := range req.GroupIDs {
+		descriptions = append(descriptions, broker.groupCoordinator.DescribeConsumerGroup(groupID))
+	}
+	return encodeConsumerGroupDescribeResponse(baseReq, req, descriptions)
+}
+
+// encodeConsumerGroupDescribeResponse serializes the ConsumerGroupDescribe response for the request's version
+func encodeConsumerGroupDescribeResponse(baseReq *SwiftQueueRequest, req *ConsumerGroupDescribeRequest, descriptions []ConsumerGroupDescription) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Throttle time
+	rb.WriteInt32(0)
+
+	rb.WriteArrayLength(len(descriptions), flexible)
+	for _, group := range descriptions {
+		rb.WriteInt16(group.ErrorCode)
+		rb.WriteNullableString(group.ErrorMessage, flexible)
+		rb.WriteStringField(group.GroupID, flexible)
+		rb.WriteStringField(group.State, flexible)
+		rb.WriteInt32(group.GroupEpoch)
+		rb.WriteInt32(group.AssignmentEpoch)
+		rb.WriteStringField(group.AssignorName, flexible)
+
+		rb.WriteArrayLength(len(group.Members), flexible)
+		for _, member := range group.Members {
+			rb.WriteStringField(member.MemberID, flexible)
+			rb.WriteNullableString(member.InstanceID, flexible)
+			rb.WriteNullableString(member.RackID, flexible)
+			rb.WriteInt32(member.MemberEpoch)
+			rb.WriteStringField(member.ClientID, flexible)
+			rb.WriteStringField(member.ClientHost, flexible)
+			rb.WriteArrayLength(len(member.SubscribedTopicNames), flexible)
+			for _, name := range member.SubscribedTopicNames {
+				rb.WriteStringField(name, flexible)
+			}
+			rb.WriteNullableString(member.SubscribedTopicRegex, flexible)
+			writeConsumerGroupAssignment(rb, member.Assignment, group.TopicNames, flexible)
+			writeConsumerGroupAssignment(rb, member.TargetAssignment, group.TopicNames, flexible)
+			if version >= 1 {
+				rb.WriteInt8(ConsumerGroupMemberTypeConsumer)
+			}
+			rb.WriteTaggedFields(flexible)
+		}
+
+		authorizedOperations := int32(AuthorizedOperationsOmitted)
+		if req.IncludeAuthorizedOperations {
+			authorizedOperations = GroupAuthorizedOperations
+		}
+		rb.WriteInt32(authorizedOperations)
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
+
+// writeConsumerGroupAssignment writes an assignment with the name of each topic
+func writeConsumerGroupAssignment(rb *ResponseBuilder, assignment PartitionSet, topicNames map[string]string, flexible bool) {
+	topicIDs, partitions := assignment.ByTopic()
+	rb.WriteArrayLength(len(topicIDs), flexible)
+	for _, topicID := range topicIDs {
+		rb.WriteUUID(topicID)
+		rb.WriteStringField(topicNames[topicID], flexible)
+		rb.WriteArrayLength(len(partitions[topicID]), flexible)
+		for _, partition := range partitions[topicID] {
+			rb.WriteInt32(partition)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+	rb.WriteTaggedFields(flexible)
+}
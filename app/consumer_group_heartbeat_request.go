@@ -0,0 +1,84 @@
+package main
+
+import "fmt"
+
+// ConsumerGroupHeartbeatRequest represents a parsed ConsumerGroupHeartbeat request.
+// Nullable fields are null when unchanged since the member's previous heartbeat.
+type ConsumerGroupHeartbeatRequest struct {
+	GroupID              string
+	MemberID             string
+	MemberEpoch          int32
+	InstanceID           *string
+	RackID               *string
+	RebalanceTimeoutMs   int32
+	SubscribedTopicNames []string
+	SubscribedTopicRegex *string
+	ServerAssignor       *string
+	// Topics holds the partitions the member owns
+	Topics []ConsumerGroupHeartbeatTopic
+}
+
+// ConsumerGroupHeartbeatTopic lists partitions of one topic, identified by topic ID
+type ConsumerGroupHeartbeatTopic struct {
+	TopicID    string
+	Partitions []int32
+}
+
+// ParseConsumerGroupHeartbeatRequest parses the body of a ConsumerGroupHeartbeat request (v0-v1)
+func ParseConsumerGroupHeartbeatRequest(baseReq *SwiftQueueRequest) (*ConsumerGroupHeartbeatRequest, error) {
+	version := baseReq.APIVersion
+	if version < ConsumerGroupHeartbeatMinVersion || version > ConsumerGroupHeartbeatMaxVersion {
+		return nil, fmt.Errorf("unsupported consumer group heartbeat version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &ConsumerGroupHeartbeatRequest{}
+	req.GroupID = d.ReadString(flexible)
+	req.MemberID = d.ReadString(flexible)
+	req.MemberEpoch = d.ReadInt32()
+	req.InstanceID = d.ReadNullableString(flexible)
+	req.RackID = d.ReadNullableString(flexible)
+	req.RebalanceTimeoutMs = d.ReadInt32()
+	req.SubscribedTopicNames = d.ReadStringArray(flexible)
+	if version >= 1 {
+		req.SubscribedTopicRegex = d.ReadNullableString(flexible)
+	}
+	req.ServerAssignor = d.ReadNullableString(flexible)
+
+	if topicCount := d.ReadArrayLength(flexible); topicCount >= 0 {
+		req.Topics = make([]ConsumerGroupHeartbeatTopic, 0, topicCount)
+		for i := 0; i < topicCount && d.Err() == nil; i++ {
+			topic := ConsumerGroupHeartbeatTopic{}
+			topic.TopicID = d.ReadUUID()
+			partitionCount := d.ReadArrayLength(flexible)
+			for j := 0; j < partitionCount && d.Err() == nil; j++ {
+				topic.Partitions = append(topic.Partitions, d.ReadInt32())
+			}
+			d.SkipTaggedFields(flexible)
+			req.Topics = append(req.Topics, topic)
+		}
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse consumer group heartbeat request: %w", err)
+	}
+
+	return req, nil
+}
+
+// ownedPartitions returns the partitions the member reported owning, or nil if it did not report them
+func (req *ConsumerGroupHeartbeatRequest) ownedPartitions() PartitionSet {
+	if req.Topics == nil {
+		return nil
+	}
+	owned := make(PartitionSet)
+	for _, topic := range req.Topics {
+		for _, partition := range topic.Partitions {
+			owned.Add(TopicIDPartition{TopicID: topic.TopicID, Partition: partition})
+		}
+	}
+	return owned
+}
@@ -0,0 +1,50 @@
+package main
+
+// BuildConsumerGroupHeartbeatResponse runs the member's heartbeat through the group coordinator
+// and builds the response
+func BuildConsumerGroupHeartbeatResponse(baseReq *SwiftQueueRequest, req *ConsumerGroupHeartbeatRequest, broker *Broker, clientHost string) []byte {
+	topics, partitions := broker.TopicsAndPartitions()
+
+	result := broker.groupCoordinator.ConsumerGroupHeartbeat(baseReq.APIVersion, baseReq.ClientID, clientHost, req, topics, partitions)
+	return encodeConsumerGroupHeartbeatResponse(baseReq, result)
+}
+
+// encodeConsumerGroupHeartbeatResponse serializes the ConsumerGroupHeartbeat response
+func encodeConsumerGroupHeartbeatResponse(baseReq *SwiftQueueRequest, result ConsumerGroupHeartbeatResult) []byte {
+	flexible := IsFlexibleVersion(baseReq.APIKey, baseReq.APIVersion)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Throttle time
+	rb.WriteInt32(0)
+	rb.WriteInt16(result.ErrorCode)
+	rb.WriteNullableString(result.ErrorMessage, flexible)
+	rb.WriteNullableString(result.MemberID, flexible)
+	rb.WriteInt32(result.MemberEpoch)
+	rb.WriteInt32(result.HeartbeatIntervalMs)
+
+	// The assignment is a nullable struct, prefixed by -1 when null and 1 otherwise
+	if result.Assignment == nil {
+		rb.WriteInt8(-1)
+	} else {
+		rb.WriteInt8(1)
+		topicIDs, partitions := result.Assignment.ByTopic()
+		rb.WriteArrayLength(len(topicIDs), flexible)
+		for _, topicID := range topicIDs {
+			rb.WriteUUID(topicID)
+			rb.WriteArrayLength(len(partitions[topicID]), flexible)
+			for _, partition := range partitions[topicID] {
+				rb.WriteInt32(partition)
+			}
+			rb.WriteTaggedFields(flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
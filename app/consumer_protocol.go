@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConsumerProtocolType is the protocol type used by Kafka consumers in classic groups
+const ConsumerProtocolType = "consumer"
+
+// decodeConsumerSubscription returns the topics listed in a ConsumerProtocolSubscription,
+// the member metadata consumers send in JoinGroup
+func decodeConsumerSubscription(metadata []byte) ([]string, error) {
+	d := NewDecoder(metadata)
+	d.ReadInt16() // version; later versions only append fields
+
+	var topics []string
+	topicCount := d.ReadArrayLength(false)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topics = append(topics, d.ReadString(false))
+	}
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("invalid consumer subscription: %w", err)
+	}
+	return topics, nil
+}
+
+// decodeConsumerAssignment returns the partitions listed in a ConsumerProtocolAssignment,
+// the assignment the leader sends each consumer in SyncGroup
+func decodeConsumerAssignment(assignment []byte) ([]TopicPartition, error) {
+	if len(assignment) == 0 {
+		return nil, nil
+	}
+
+	d := NewDecoder(assignment)
+	d.ReadInt16() // version
+
+	var partitions []TopicPartition
+	topicCount := d.ReadArrayLength(false)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := d.ReadString(false)
+		partitionCount := d.ReadArrayLength(false)
+		for j := 0; j < partitionCount && d.Err() == nil; j++ {
+			partitions = append(partitions, TopicPartition{Topic: topic, Partition: d.ReadInt32()})
+		}
+	}
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("invalid consumer assignment: %w", err)
+	}
+	return partitions, nil
+}
+
+// formatConsumerAssignment renders a consumer assignment for logging, e.g. "orders-0,orders-1"
+func formatConsumerAssignment(assignment []byte) string {
+	partitions, err := decodeConsumerAssignment(assignment)
+	if err != nil {
+		return err.Error()
+	}
+	names := make([]string, len(partitions))
+	for i, tp := range partitions {
+		names[i] = tp.String()
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,67 @@
+package main
+
+import "fmt"
+
+// CreatePartitionsRequest represents a parsed CreatePartitions request
+type CreatePartitionsRequest struct {
+	Topics       []CreatePartitionsTopic
+	TimeoutMs    int32
+	ValidateOnly bool
+}
+
+// CreatePartitionsTopic asks for a topic to grow to Count partitions.
+// Assignments, when not nil, lists the replica brokers of each new partition.
+type CreatePartitionsTopic struct {
+	Name        string
+	Count       int32
+	Assignments [][]int32
+}
+
+// ParseCreatePartitionsRequest parses the body of a CreatePartitions request (v0-v3)
+func ParseCreatePartitionsRequest(baseReq *SwiftQueueRequest) (*CreatePartitionsRequest, error) {
+	version := baseReq.APIVersion
+	if version < CreatePartitionsMinVersion || version > CreatePartitionsMaxVersion {
+		return nil, fmt.Errorf("unsupported create partitions version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &CreatePartitionsRequest{}
+
+	topicCount := d.ReadArrayLength(flexible)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := CreatePartitionsTopic{
+			Name:  d.ReadString(flexible),
+			Count: d.ReadInt32(),
+		}
+
+		assignmentCount := d.ReadArrayLength(flexible)
+		if assignmentCount >= 0 {
+			topic.Assignments = make([][]int32, 0, assignmentCount)
+		}
+		for j := 0; j < assignmentCount && d.Err() == nil; j++ {
+			brokerCount := d.ReadArrayLength(flexible)
+			brokerIDs := make([]int32, 0, max(brokerCount, 0))
+			for k := 0; k < brokerCount && d.Err() == nil; k++ {
+				brokerIDs = append(brokerIDs, d.ReadInt32())
+			}
+			d.SkipTaggedFields(flexible)
+
+			topic.Assignments = append(topic.Assignments, brokerIDs)
+		}
+		d.SkipTaggedFields(flexible)
+
+		req.Topics = append(req.Topics, topic)
+	}
+
+	req.TimeoutMs = d.ReadInt32()
+	req.ValidateOnly = d.ReadBool()
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse create partitions request: %w", err)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CreatePartitionsTopicResult is the outcome of growing one topic
+type CreatePartitionsTopicResult struct {
+	Name         string
+	ErrorCode    int16
+	ErrorMessage *string
+}
+
+// BuildCreatePartitionsResponse grows (or, for validate_only requests, validates growing) each topic and builds the response
+func BuildCreatePartitionsResponse(baseReq *SwiftQueueRequest, req *CreatePartitionsRequest, broker *Broker) []byte {
+	counts := make(map[string]int, len(req.Topics))
+	for _, topic := range req.Topics {
+		counts[topic.Name]++
+	}
+
+	results := make([]CreatePartitionsTopicResult, 0, len(req.Topics))
+	for _, topic := range req.Topics {
+		result := CreatePartitionsTopicResult{Name: topic.Name, ErrorCode: ErrorCodeNone}
+		if counts[topic.Name] > 1 {
+			result.ErrorCode = ErrorCodeInvalidRequest
+			result.ErrorMessage = stringPtr(fmt.Sprintf("request contains multiple entries for topic %s", topic.Name))
+			results = append(results, result)
+			continue
+		}
+
+		if err := broker.CreatePartitions(topic.Name, topic.Count, topic.Assignments, req.ValidateOnly); err != nil {
+			result.ErrorCode = createPartitionsErrorCode(err)
+			if result.ErrorCode == ErrorCodeUnknownServerError {
+				broker.logger.Printf("CreatePartitions: failed to grow %s: %v", topic.Name, err)
+			}
+			result.ErrorMessage = stringPtr(err.Error())
+		}
+		results = append(results, result)
+	}
+
+	return encodeCreatePartitionsResponse(baseReq, results)
+}
+
+// createPartitionsErrorCode maps a partition creation error to its protocol error code
+func createPartitionsErrorCode(err error) int16 {
+	if errors.Is(err, ErrUnknownTopic) {
+		return ErrorCodeUnknownTopicOrPart
+	}
+	return createTopicErrorCode(err)
+}
+
+// encodeCreatePartitionsResponse serializes the CreatePartitions response for the request's version
+func encodeCreatePartitionsResponse(baseReq *SwiftQueueRequest, results []CreatePartitionsTopicResult) []byte {
+	flexible := IsFlexibleVersion(baseReq.APIKey, baseReq.APIVersion)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Throttle time
+	rb.WriteInt32(0)
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, topic := range results {
+		rb.WriteStringField(topic.Name, flexible)
+		rb.WriteInt16(topic.ErrorCode)
+		rb.WriteNullableString(topic.ErrorMessage, flexible)
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
@@ -0,0 +1,88 @@
+package main
+
+import "fmt"
+
+// CreateTopicsRequest represents a parsed CreateTopics request
+type CreateTopicsRequest struct {
+	Topics       []CreatableTopic
+	TimeoutMs    int32
+	ValidateOnly bool
+}
+
+// CreatableTopic describes one topic to create.
+// NumPartitions and ReplicationFactor are -1 when Assignments are given or the broker defaults apply.
+type CreatableTopic struct {
+	Name              string
+	NumPartitions     int32
+	ReplicationFactor int16
+	Assignments       []CreatableReplicaAssignment
+	Configs           []CreatableTopicConfig
+}
+
+// CreatableReplicaAssignment lists the brokers hosting one partition of a new topic
+type CreatableReplicaAssignment struct {
+	PartitionIndex int32
+	BrokerIDs      []int32
+}
+
+// CreatableTopicConfig is a config override for a new topic
+type CreatableTopicConfig struct {
+	Name  string
+	Value *string
+}
+
+// ParseCreateTopicsRequest parses the body of a CreateTopics request (v2-v7)
+func ParseCreateTopicsRequest(baseReq *SwiftQueueRequest) (*CreateTopicsRequest, error) {
+	version := baseReq.APIVersion
+	if version < CreateTopicsMinVersion || version > CreateTopicsMaxVersion {
+		return nil, fmt.Errorf("unsupported create topics version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &CreateTopicsRequest{}
+
+	topicCount := d.ReadArrayLength(flexible)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := CreatableTopic{
+			Name:              d.ReadString(flexible),
+			NumPartitions:     d.ReadInt32(),
+			ReplicationFactor: d.ReadInt16(),
+		}
+
+		assignmentCount := d.ReadArrayLength(flexible)
+		for j := 0; j < assignmentCount && d.Err() == nil; j++ {
+			assignment := CreatableReplicaAssignment{PartitionIndex: d.ReadInt32()}
+			brokerCount := d.ReadArrayLength(flexible)
+			for k := 0; k < brokerCount && d.Err() == nil; k++ {
+				assignment.BrokerIDs = append(assignment.BrokerIDs, d.ReadInt32())
+			}
+			d.SkipTaggedFields(flexible)
+
+			topic.Assignments = append(topic.Assignments, assignment)
+		}
+
+		configCount := d.ReadArrayLength(flexible)
+		for j := 0; j < configCount && d.Err() == nil; j++ {
+			topic.Configs = append(topic.Configs, CreatableTopicConfig{
+				Name:  d.ReadString(flexible),
+				Value: d.ReadNullableString(flexible),
+			})
+			d.SkipTaggedFields(flexible)
+		}
+		d.SkipTaggedFields(flexible)
+
+		req.Topics = append(req.Topics, topic)
+	}
+
+	req.TimeoutMs = d.ReadInt32()
+	req.ValidateOnly = d.ReadBool()
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse create topics request: %w", err)
+	}
+
+	return req, nil
+}
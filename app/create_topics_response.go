@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Config sources reported for topic configs
+const (
+	ConfigSourceTopic   = 1
+	ConfigSourceDefault = 5
+)
+
+// CreateTopicsTopicResult is the outcome of creating one topic
+type CreateTopicsTopicResult struct {
+	Name              string
+	TopicID           string
+	ErrorCode         int16
+	ErrorMessage      *string
+	NumPartitions     int32
+	ReplicationFactor int16
+	Configs           []TopicConfigEntry
+}
+
+// BuildCreateTopicsResponse creates (or, for validate_only requests, validates) each topic and builds the response
+func BuildCreateTopicsResponse(baseReq *SwiftQueueRequest, req *CreateTopicsRequest, broker *Broker) []byte {
+	counts := make(map[string]int, len(req.Topics))
+	for _, topic := range req.Topics {
+		counts[topic.Name]++
+	}
+
+	results := make([]CreateTopicsTopicResult, 0, len(req.Topics))
+	for _, topic := range req.Topics {
+		if counts[topic.Name] > 1 {
+			results = append(results, createTopicsError(topic.Name, ErrorCodeInvalidRequest,
+				fmt.Sprintf("request contains multiple entries for topic %s", topic.Name)))
+			continue
+		}
+		results = append(results, createTopic(broker, topic, req.ValidateOnly))
+	}
+
+	return encodeCreateTopicsResponse(baseReq, results)
+}
+
+// createTopic resolves the partition layout and configs of a topic and creates it
+func createTopic(broker *Broker, topic CreatableTopic, validateOnly bool) CreateTopicsTopicResult {
+	assignments, err := creatableAssignments(broker, topic)
+	if err != nil {
+		return createTopicsError(topic.Name, createTopicErrorCode(err), err.Error())
+	}
+
+	configs := make(map[string]string, len(topic.Configs))
+	for _, config := range topic.Configs {
+		if config.Value != nil {
+			configs[config.Name] = *config.Value
+		}
+	}
+
+	created, err := broker.CreateTopic(TopicSpec{Name: topic.Name, Assignments: assignments, Configs: configs}, validateOnly)
+	if err != nil {
+		errorCode := createTopicErrorCode(err)
+		if errorCode == ErrorCodeUnknownServerError {
+			broker.logger.Printf("CreateTopics: failed to create %s: %v", topic.Name, err)
+		}
+		return createTopicsError(topic.Name, errorCode, err.Error())
+	}
+
+	return CreateTopicsTopicResult{
+		Name:              topic.Name,
+		TopicID:           created.UUID,
+		ErrorCode:         ErrorCodeNone,
+		NumPartitions:     int32(len(assignments)),
+		ReplicationFactor: int16(len(assignments[0])),
+		Configs:           TopicConfigEntries(configs),
+	}
+}
+
+// creatableAssignments returns the replicas of every partition, either as given explicitly
+// or spread according to the requested partition count and replication factor
+func creatableAssignments(broker *Broker, topic CreatableTopic) ([][]int32, error) {
+	if len(topic.Assignments) == 0 {
+		numPartitions := topic.NumPartitions
+		if numPartitions == -1 {
+			numPartitions = int32(broker.config.NumPartitions)
+		}
+		replicationFactor := topic.ReplicationFactor
+		if replicationFactor == -1 {
+			replicationFactor = 1
+		}
+		return broker.UniformAssignments(numPartitions, replicationFactor)
+	}
+
+	if topic.NumPartitions != -1 || topic.ReplicationFactor != -1 {
+		return nil, fmt.Errorf("%w: both partition count and replication factor must be -1 when assignments are given", ErrInvalidRequest)
+	}
+	assignments := make([][]int32, len(topic.Assignments))
+	for _, assignment := range topic.Assignments {
+		index := assignment.PartitionIndex
+		if index < 0 || int(index) >= len(assignments) || assignments[index] != nil {
+			return nil, fmt.Errorf("%w: partitions must be numbered consecutively from 0", ErrInvalidReplicaAssignment)
+		}
+		assignments[index] = append([]int32{}, assignment.BrokerIDs...)
+	}
+	return assignments, nil
+}
+
+// createTopicErrorCode maps a topic creation error to its protocol error code
+func createTopicErrorCode(err error) int16 {
+	switch {
+	case errors.Is(err, ErrInvalidTopicName):
+		return ErrorCodeInvalidTopic
+	case errors.Is(err, ErrTopicAlreadyExists):
+		return ErrorCodeTopicAlreadyExists
+	case errors.Is(err, ErrInvalidPartitions):
+		return ErrorCodeInvalidPartitions
+	case errors.Is(err, ErrInvalidReplicationFactor):
+		return ErrorCodeInvalidReplicationFactor
+	case errors.Is(err, ErrInvalidReplicaAssignment):
+		return ErrorCodeInvalidReplicaAssignment
+	case errors.Is(err, ErrInvalidConfig):
+		return ErrorCodeInvalidConfig
+	case errors.Is(err, ErrInvalidRequest):
+		return ErrorCodeInvalidRequest
+	default:
+		return ErrorCodeUnknownServerError
+	}
+}
+
+// createTopicsError builds a failed topic result
+func createTopicsError(name string, errorCode int16, message string) CreateTopicsTopicResult {
+	return CreateTopicsTopicResult{
+		Name:              name,
+		TopicID:           NoTopicID,
+		ErrorCode:         errorCode,
+		ErrorMessage:      &message,
+		NumPartitions:     -1,
+		ReplicationFactor: -1,
+	}
+}
+
+// encodeCreateTopicsResponse serializes the CreateTopics response for the request's version
+func encodeCreateTopicsResponse(baseReq *SwiftQueueRequest, results []CreateTopicsTopicResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Throttle time
+	rb.WriteInt32(0)
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, topic := range results {
+		rb.WriteStringField(topic.Name, flexible)
+		if version >= 7 {
+			rb.WriteUUID(topic.TopicID)
+		}
+		rb.WriteInt16(topic.ErrorCode)
+		rb.WriteNullableString(topic.ErrorMessage, flexible)
+		if version >= 5 {
+			rb.WriteInt32(topic.NumPartitions)
+			rb.WriteInt16(topic.ReplicationFactor)
+
+			if topic.Configs == nil {
+				rb.WriteArrayLength(-1, flexible)
+			} else {
+				rb.WriteArrayLength(len(topic.Configs), flexible)
+			}
+			for _, config := range topic.Configs {
+				rb.WriteStringField(config.Name, flexible)
+				value := config.Value
+				rb.WriteNullableString(&value, flexible)
+				rb.WriteBool(false) // read only
+				source := int8(ConfigSourceTopic)
+				if config.IsDefault {
+					source = ConfigSourceDefault
+				}
+				rb.WriteInt8(source)
+				rb.WriteBool(false) // sensitive
+				rb.WriteTaggedFields(flexible)
+			}
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// Decoder reads SwiftQueue protocol primitives from a request body.
+// It is the read-side counterpart of ResponseBuilder.
+//
+// The decoder keeps the first error it encounters; once an error has occurred every
+// subsequent read returns a zero value. Callers read all fields and check Err once
+// at the end, which keeps the per-API parsers close to the shape of the schema.
+type Decoder struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+// NewDecoder creates a decoder over data
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// Err returns the first error encountered while decoding
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Offset returns the number of bytes consumed so far
+func (d *Decoder) Offset() int {
+	return d.offset
+}
+
+// Remaining returns the number of unread bytes
+func (d *Decoder) Remaining() int {
+	return len(d.data) - d.offset
+}
+
+// next returns the next n bytes, or nil if fewer than n remain
+func (d *Decoder) next(n int, field string) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data)-d.offset {
+		d.err = fmt.Errorf("request too short: cannot read %s (need %d bytes at offset %d, have %d)", field, n, d.offset, len(d.data))
+		return nil
+	}
+	b := d.data[d.offset : d.offset+n]
+	d.offset += n
+	return b
+}
+
+// ReadInt8 reads an 8-bit integer
+func (d *Decoder) ReadInt8() int8 {
+	b := d.next(1, "int8")
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+
+// ReadBool reads a boolean encoded as a single byte
+func (d *Decoder) ReadBool() bool {
+	return d.ReadInt8() != 0
+}
+
+// ReadInt16 reads a 16-bit integer
+func (d *Decoder) ReadInt16() int16 {
+	b := d.next(SizeInt16, "int16")
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+// ReadInt32 reads a 32-bit integer
+func (d *Decoder) ReadInt32() int32 {
+	b := d.next(SizeInt32, "int32")
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+// ReadInt64 reads a 64-bit integer
+func (d *Decoder) ReadInt64() int64 {
+	b := d.next(SizeInt64, "int64")
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+// ReadUVarint reads an unsigned variable-length integer
+func (d *Decoder) ReadUVarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.offset:])
+	if n <= 0 {
+		d.err = fmt.Errorf("invalid unsigned varint at offset %d", d.offset)
+		return 0
+	}
+	d.offset += n
+	return v
+}
+
+// ReadVarint reads a zigzag-encoded signed variable-length integer
+func (d *Decoder) ReadVarint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data[d.offset:])
+	if n <= 0 {
+		d.err = fmt.Errorf("invalid varint at offset %d", d.offset)
+		return 0
+	}
+	d.offset += n
+	return v
+}
+
+// readLength reads a string, bytes or array length.
+// Flexible versions use an unsigned varint holding length+1, older versions a fixed-width integer.
+// A return value of -1 means null.
+func (d *Decoder) readLength(flexible bool, wide bool) int {
+	if flexible {
+		return int(d.ReadUVarint()) - 1
+	}
+	if wide {
+		return int(d.ReadInt32())
+	}
+	return int(d.ReadInt16())
+}
+
+// ReadString reads a non-nullable string
+func (d *Decoder) ReadString(flexible bool) string {
+	s := d.ReadNullableString(flexible)
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// ReadNullableString reads a string that may be null
+func (d *Decoder) ReadNullableString(flexible bool) *string {
+	length := d.readLength(flexible, false)
+	if d.err != nil || length < 0 {
+		return nil
+	}
+	b := d.next(length, "string")
+	if b == nil {
+		return nil
+	}
+	s := string(b)
+	return &s
+}
+
+// ReadBytes reads a nullable byte array; nil is returned for null
+func (d *Decoder) ReadBytes(flexible bool) []byte {
+	length := d.readLength(flexible, true)
+	if d.err != nil || length < 0 {
+		return nil
+	}
+	return d.next(length, "bytes")
+}
+
+// ReadArrayLength reads an array length; -1 is returned for a null array
+func (d *Decoder) ReadArrayLength(flexible bool) int {
+	length := d.readLength(flexible, true)
+	if d.err == nil && length > d.Remaining() {
+		// Every array element takes at least one byte, so this guards against bogus lengths
+		d.err = fmt.Errorf("array length %d exceeds remaining %d bytes", length, d.Remaining())
+		return 0
+	}
+	return length
+}
+
+// ReadStringArray reads an array of non-nullable strings; nil is returned for a null array
+func (d *Decoder) ReadStringArray(flexible bool) []string {
+	count := d.ReadArrayLength(flexible)
+	if d.err != nil || count < 0 {
+		return nil
+	}
+	values := make([]string, 0, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		values = append(values, d.ReadString(flexible))
+	}
+	return values
+}
+
+// ReadInt32Array reads an array of 32-bit integers; nil is returned for a null array
+func (d *Decoder) ReadInt32Array(flexible bool) []int32 {
+	count := d.ReadArrayLength(flexible)
+	if d.err != nil || count < 0 {
+		return nil
+	}
+	values := make([]int32, 0, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		values = append(values, d.ReadInt32())
+	}
+	return values
+}
+
+// ReadVarintBytes reads a byte array prefixed by a signed varint length, as used inside records.
+// nil is returned for a null (-1) length.
+func (d *Decoder) ReadVarintBytes() []byte {
+	length := d.ReadVarint()
+	if d.err != nil || length < 0 {
+		return nil
+	}
+	return d.next(int(length), "varint bytes")
+}
+
+// ReadUUID reads a 16-byte UUID and returns it hex-encoded, matching Topic.UUID
+func (d *Decoder) ReadUUID() string {
+	b := d.next(UUIDSize, "uuid")
+	if b == nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// ReadRaw reads n raw bytes
+func (d *Decoder) ReadRaw(n int) []byte {
+	return d.next(n, "raw bytes")
+}
+
+// SkipTaggedFields skips a tagged field section; it is a no-op for non-flexible versions
+func (d *Decoder) SkipTaggedFields(flexible bool) {
+	if !flexible {
+		return
+	}
+	count := d.ReadUVarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		d.ReadUVarint() // tag
+		size := d.ReadUVarint()
+		d.next(int(size), "tagged field")
+	}
+}
+
+// ReadTaggedFields reads a flexible tagged field section, calling read with a decoder over the
+// data of each field. Fields whose tag read does not know are skipped by not reading them.
+func (d *Decoder) ReadTaggedFields(read func(tag uint64, field *Decoder)) {
+	count := d.ReadUVarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		tag := d.ReadUVarint()
+		size := d.ReadUVarint()
+		data := d.next(int(size), "tagged field")
+		if data == nil {
+			return
+		}
+		field := NewDecoder(data)
+		read(tag, field)
+		if field.err != nil {
+			d.err = fmt.Errorf("tagged field %d: %w", tag, field.err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "fmt"
+
+// DeleteGroupsRequest represents a parsed DeleteGroups request
+type DeleteGroupsRequest struct {
+	GroupNames []string
+}
+
+// ParseDeleteGroupsRequest parses the body of a DeleteGroups request (v0-v2)
+func ParseDeleteGroupsRequest(baseReq *SwiftQueueRequest) (*DeleteGroupsRequest, error) {
+	version := baseReq.APIVersion
+	if version < DeleteGroupsMinVersion || version > DeleteGroupsMaxVersion {
+		return nil, fmt.Errorf("unsupported delete groups version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &DeleteGroupsRequest{}
+	req.GroupNames = d.ReadStringArray(flexible)
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse delete groups request: %w", err)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+// DeleteGroupsResult is the outcome of deleting one group
+type DeleteGroupsResult struct {
+	GroupID   string
+	ErrorCode int16
+}
+
+// BuildDeleteGroupsResponse deletes each requested group and builds the response
+func BuildDeleteGroupsResponse(baseReq *SwiftQueueRequest, req *DeleteGroupsRequest, broker *Broker) []byte {
+	results := make([]DeleteGroupsResult, 0, len(req.GroupNames))
+	for _, groupID := range req.GroupNames {
+		results = append(results, DeleteGroupsResult{
+			GroupID:   groupID,
+			ErrorCode: broker.groupCoordinator.DeleteGroup(groupID),
+		})
+	}
+	return encodeDeleteGroupsResponse(baseReq, results)
+}
+
+// encodeDeleteGroupsResponse serializes the DeleteGroups response for the request's version
+func encodeDeleteGroupsResponse(baseReq *SwiftQueueRequest, results []DeleteGroupsResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Throttle time
+	rb.WriteInt32(0)
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, result := range results {
+		rb.WriteStringField(result.GroupID, flexible)
+		rb.WriteInt16(result.ErrorCode)
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
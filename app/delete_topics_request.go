@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+
+// DeleteTopicsRequest represents a parsed DeleteTopics request
+type DeleteTopicsRequest struct {
+	Topics    []DeleteTopicState
+	TimeoutMs int32
+}
+
+// DeleteTopicState names a topic to delete.
+// Versions before 6 only carry names; later versions give either Name or TopicID.
+type DeleteTopicState struct {
+	Name    *string
+	TopicID string
+}
+
+// ParseDeleteTopicsRequest parses the body of a DeleteTopics request (v1-v6)
+func ParseDeleteTopicsRequest(baseReq *SwiftQueueRequest) (*DeleteTopicsRequest, error) {
+	version := baseReq.APIVersion
+	if version < DeleteTopicsMinVersion || version > DeleteTopicsMaxVersion {
+		return nil, fmt.Errorf("unsupported delete topics version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &DeleteTopicsRequest{}
+
+	topicCount := d.ReadArrayLength(flexible)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := DeleteTopicState{TopicID: NoTopicID}
+		if version >= 6 {
+			topic.Name = d.ReadNullableString(flexible)
+			topic.TopicID = d.ReadUUID()
+			d.SkipTaggedFields(flexible)
+		} else {
+			name := d.ReadString(flexible)
+			topic.Name = &name
+		}
+		req.Topics = append(req.Topics, topic)
+	}
+
+	req.TimeoutMs = d.ReadInt32()
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse delete topics request: %w", err)
+	}
+
+	return req, nil
+}
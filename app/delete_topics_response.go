@@ -0,0 +1,116 @@
+package main
+
+import "errors"
+
+// DeleteTopicsTopicResult is the outcome of deleting one topic
+type DeleteTopicsTopicResult struct {
+	Name         *string
+	TopicID      string
+	ErrorCode    int16
+	ErrorMessage *string
+}
+
+// BuildDeleteTopicsResponse deletes each requested topic and builds the response
+func BuildDeleteTopicsResponse(baseReq *SwiftQueueRequest, req *DeleteTopicsRequest, broker *Broker) []byte {
+	topics, _ := broker.TopicsAndPartitions()
+
+	// Each topic may only be listed once, whether by name or by ID
+	counts := make(map[string]int, len(req.Topics))
+	for _, state := range req.Topics {
+		if topic := resolveDeleteTopic(topics, state); topic != nil {
+			counts[topic.UUID]++
+		}
+	}
+
+	results := make([]DeleteTopicsTopicResult, 0, len(req.Topics))
+	for _, state := range req.Topics {
+		result := DeleteTopicsTopicResult{Name: state.Name, TopicID: state.TopicID, ErrorCode: ErrorCodeNone}
+		topic := resolveDeleteTopic(topics, state)
+
+		switch {
+		case state.Name != nil && state.TopicID != NoTopicID:
+			result.ErrorCode = ErrorCodeInvalidRequest
+			result.ErrorMessage = stringPtr("topic name and topic ID cannot both be set")
+		case topic == nil && state.Name == nil:
+			result.ErrorCode = ErrorCodeUnknownTopicID
+		case topic == nil:
+			result.ErrorCode = ErrorCodeUnknownTopicOrPart
+		case counts[topic.UUID] > 1:
+			result.ErrorCode = ErrorCodeInvalidRequest
+			result.ErrorMessage = stringPtr("duplicate topic in request")
+		default:
+			name := topic.Name
+			result.Name = &name
+			result.TopicID = topic.UUID
+			if err := broker.DeleteTopic(*topic); err != nil {
+				switch {
+				case errors.Is(err, ErrTopicDeletionDisabled):
+					result.ErrorCode = ErrorCodeTopicDeletionDisabled
+				case errors.Is(err, ErrUnknownTopic):
+					result.ErrorCode = ErrorCodeUnknownTopicOrPart
+				default:
+					broker.logger.Printf("DeleteTopics: failed to delete %s: %v", topic.Name, err)
+					result.ErrorCode = ErrorCodeUnknownServerError
+				}
+				result.ErrorMessage = stringPtr(err.Error())
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return encodeDeleteTopicsResponse(baseReq, results)
+}
+
+// resolveDeleteTopic finds the topic named by a DeleteTopics entry
+func resolveDeleteTopic(topics []Topic, state DeleteTopicState) *Topic {
+	if state.Name != nil {
+		return findTopicByName(topics, *state.Name)
+	}
+	if state.TopicID == NoTopicID {
+		return nil
+	}
+	return findTopicByUUID(topics, state.TopicID)
+}
+
+// stringPtr returns a pointer to s
+func stringPtr(s string) *string {
+	return &s
+}
+
+// encodeDeleteTopicsResponse serializes the DeleteTopics response for the request's version
+func encodeDeleteTopicsResponse(baseReq *SwiftQueueRequest, results []DeleteTopicsTopicResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Throttle time
+	rb.WriteInt32(0)
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, topic := range results {
+		if version >= 6 {
+			rb.WriteNullableString(topic.Name, flexible)
+			rb.WriteUUID(topic.TopicID)
+		} else {
+			name := ""
+			if topic.Name != nil {
+				name = *topic.Name
+			}
+			rb.WriteStringField(name, flexible)
+		}
+		rb.WriteInt16(topic.ErrorCode)
+		if version >= 5 {
+			rb.WriteNullableString(topic.ErrorMessage, flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
@@ -0,0 +1,33 @@
+package main
+
+import "fmt"
+
+// DescribeGroupsRequest represents a parsed DescribeGroups request
+type DescribeGroupsRequest struct {
+	Groups                      []string
+	IncludeAuthorizedOperations bool
+}
+
+// ParseDescribeGroupsRequest parses the body of a DescribeGroups request (v0-v5)
+func ParseDescribeGroupsRequest(baseReq *SwiftQueueRequest) (*DescribeGroupsRequest, error) {
+	version := baseReq.APIVersion
+	if version < DescribeGroupsMinVersion || version > DescribeGroupsMaxVersion {
+		return nil, fmt.Errorf("unsupported describe groups version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &DescribeGroupsRequest{}
+	req.Groups = d.ReadStringArray(flexible)
+	if version >= 3 {
+		req.IncludeAuthorizedOperations = d.ReadBool()
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse describe groups request: %w", err)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+// DescribeGroupsResult is the description of one requested group
+type DescribeGroupsResult struct {
+	ErrorCode int16
+	GroupDescription
+}
+
+// BuildDescribeGroupsResponse describes each requested group and builds the response
+func BuildDescribeGroupsResponse(baseReq *SwiftQueueRequest, req *DescribeGroupsRequest, broker *Broker) []byte {
+	results := make([]DescribeGroupsResult, 0, len(req.Groups))
+	for _, groupID := range req.Groups {
+		if groupID == "" {
+			results = append(results, DescribeGroupsResult{ErrorCode: ErrorCodeInvalidGroupID})
+			continue
+		}
+
+		description, errorCode := broker.groupCoordinator.DescribeGroup(groupID)
+		for _, member := range description.Members {
+			if description.ProtocolType == ConsumerProtocolType && len(member.Assignment) > 0 {
+				broker.logger.Printf("DescribeGroups: group %s member %s (client %s, host %s) assigned [%s]",
+					groupID, member.MemberID, member.ClientID, member.ClientHost, formatConsumerAssignment(member.Assignment))
+			}
+		}
+		results = append(results, DescribeGroupsResult{ErrorCode: errorCode, GroupDescription: description})
+	}
+	return encodeDescribeGroupsResponse(baseReq, req, results)
+}
+
+// encodeDescribeGroupsResponse serializes the DescribeGroups response for the request's version
+func encodeDescribeGroupsResponse(baseReq *SwiftQueueRequest, req *DescribeGroupsRequest, results []DescribeGroupsResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	if version >= 1 {
+		// Throttle time
+		rb.WriteInt32(0)
+	}
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, group := range results {
+		rb.WriteInt16(group.ErrorCode)
+		rb.WriteStringField(group.GroupID, flexible)
+		rb.WriteStringField(group.State, flexible)
+		rb.WriteStringField(group.ProtocolType, flexible)
+		rb.WriteStringField(group.ProtocolName, flexible)
+
+		rb.WriteArrayLength(len(group.Members), flexible)
+		for _, member := range group.Members {
+			rb.WriteStringField(member.MemberID, flexible)
+			if version >= 4 {
+				rb.WriteNullableString(member.GroupInstanceID, flexible)
+			}
+			rb.WriteStringField(member.ClientID, flexible)
+			rb.WriteStringField(member.ClientHost, flexible)
+			rb.WriteBytesField(member.Metadata, flexible)
+			rb.WriteBytesField(member.Assignment, flexible)
+			rb.WriteTaggedFields(flexible)
+		}
+
+		if version >= 3 {
+			authorizedOperations := int32(AuthorizedOperationsOmitted)
+			if req.IncludeAuthorizedOperations {
+				authorizedOperations = GroupAuthorizedOperations
+			}
+			rb.WriteInt32(authorizedOperations)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
@@ -0,0 +1,36 @@
+package main
+
+import "fmt"
+
+// EndTxnRequest represents a parsed EndTxn request
+type EndTxnRequest struct {
+	TransactionalID string
+	ProducerID      int64
+	ProducerEpoch   int16
+	// Committed is true to commit the transaction and false to abort it
+	Committed bool
+}
+
+// ParseEndTxnRequest parses the body of an EndTxn request (v0-v3)
+func ParseEndTxnRequest(baseReq *SwiftQueueRequest) (*EndTxnRequest, error) {
+	version := baseReq.APIVersion
+	if version < EndTxnMinVersion || version > EndTxnMaxVersion {
+		return nil, fmt.Errorf("unsupported end txn version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &EndTxnRequest{}
+	req.TransactionalID = d.ReadString(flexible)
+	req.ProducerID = d.ReadInt64()
+	req.ProducerEpoch = d.ReadInt16()
+	req.Committed = d.ReadBool()
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse end txn request: %w", err)
+	}
+
+	return req, nil
+}
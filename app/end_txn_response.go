@@ -0,0 +1,26 @@
+package main
+
+// endTxnFencedVersion is the first EndTxn version answered with PRODUCER_FENCED
+const endTxnFencedVersion = 2
+
+// BuildEndTxnResponse commits or aborts the producer's transaction and builds the response.
+// The response is sent once the markers have been written to every partition of the transaction.
+func BuildEndTxnResponse(baseReq *SwiftQueueRequest, req *EndTxnRequest, broker *Broker) []byte {
+	errorCode := broker.transactionCoordinator.EndTxn(req.TransactionalID, req.ProducerID, req.ProducerEpoch,
+		baseReq.APIVersion >= endTxnFencedVersion, req.Committed)
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, baseReq.APIVersion)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Throttle time
+	rb.WriteInt32(0)
+	rb.WriteInt16(errorCode)
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
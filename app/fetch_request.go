@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Isolation levels accepted by Fetch and ListOffsets
+const (
+	IsolationReadUncommitted = 0
+	IsolationReadCommitted   = 1
+)
+
+// FetchRequest represents a parsed Fetch request
+type FetchRequest struct {
+	ReplicaID       int32
+	MaxWaitMs       int32
+	MinBytes        int32
+	MaxBytes        int32
+	IsolationLevel  int
+	SessionID       int32
+	SessionEpoch    int32
+	Topics          []FetchTopic
+	ForgottenTopics []FetchForgottenTopic
+	RackID          string
+}
+
+// FetchTopic lists the partitions requested for one topic.
+// Versions before 13 identify the topic by Name, later versions by TopicID.
+type FetchTopic struct {
+	Name       string
+	TopicID    string
+	Partitions []FetchPartition
+}
+
+// FetchPartition describes where to read from a single partition
+type FetchPartition struct {
+	Index              int32
+	CurrentLeaderEpoch int32
+	FetchOffset        int64
+	LastFetchedEpoch   int32
+	LogStartOffset     int64
+	PartitionMaxBytes  int32
+}
+
+// FetchForgottenTopic lists partitions to drop from an incremental fetch session
+type FetchForgottenTopic struct {
+	Name       string
+	TopicID    string
+	Partitions []int32
+}
+
+// ParseFetchRequest parses the body of a Fetch request (v0-v16)
+func ParseFetchRequest(baseReq *SwiftQueueRequest) (*FetchRequest, error) {
+	version := baseReq.APIVersion
+	if version < FetchMinVersion || version > FetchMaxVersion {
+		return nil, fmt.Errorf("unsupported fetch version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &FetchRequest{
+		ReplicaID:      -1,
+		MaxBytes:       math.MaxInt32,
+		IsolationLevel: IsolationReadUncommitted,
+		SessionEpoch:   -1,
+	}
+
+	// From v15 the replica ID moved into a tagged field
+	if version <= 14 {
+		req.ReplicaID = d.ReadInt32()
+	}
+	req.MaxWaitMs = d.ReadInt32()
+	req.MinBytes = d.ReadInt32()
+	if version >= 3 {
+		req.MaxBytes = d.ReadInt32()
+	}
+	if version >= 4 {
+		req.IsolationLevel = int(d.ReadInt8())
+	}
+	if version >= 7 {
+		req.SessionID = d.ReadInt32()
+		req.SessionEpoch = d.ReadInt32()
+	}
+
+	topicCount := d.ReadArrayLength(flexible)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := FetchTopic{}
+		if version >= 13 {
+			topic.TopicID = d.ReadUUID()
+		} else {
+			topic.Name = d.ReadString(flexible)
+		}
+
+		partitionCount := d.ReadArrayLength(flexible)
+		for j := 0; j < partitionCount && d.Err() == nil; j++ {
+			partition := FetchPartition{
+				CurrentLeaderEpoch: -1,
+				LastFetchedEpoch:   -1,
+				LogStartOffset:     -1,
+			}
+			partition.Index = d.ReadInt32()
+			if version >= 9 {
+				partition.CurrentLeaderEpoch = d.ReadInt32()
+			}
+			partition.FetchOffset = d.ReadInt64()
+			if version >= 12 {
+				partition.LastFetchedEpoch = d.ReadInt32()
+			}
+			if version >= 5 {
+				partition.LogStartOffset = d.ReadInt64()
+			}
+			partition.PartitionMaxBytes = d.ReadInt32()
+			d.SkipTaggedFields(flexible)
+
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+		d.SkipTaggedFields(flexible)
+
+		req.Topics = append(req.Topics, topic)
+	}
+
+	if version >= 7 {
+		forgottenCount := d.ReadArrayLength(flexible)
+		for i := 0; i < forgottenCount && d.Err() == nil; i++ {
+			forgotten := FetchForgottenTopic{}
+			if version >= 13 {
+				forgotten.TopicID = d.ReadUUID()
+			} else {
+				forgotten.Name = d.ReadString(flexible)
+			}
+
+			partitionCount := d.ReadArrayLength(flexible)
+			for j := 0; j < partitionCount && d.Err() == nil; j++ {
+				forgotten.Partitions = append(forgotten.Partitions, d.ReadInt32())
+			}
+			d.SkipTaggedFields(flexible)
+
+			req.ForgottenTopics = append(req.ForgottenTopics, forgotten)
+		}
+	}
+
+	if version >= 11 {
+		req.RackID = d.ReadString(flexible)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
@@ -1,37 +1,284 @@
 package main
 
 import (
-// "encoding/binary"
-// "encoding/hex"
-// "fmt"
+	"errors"
+	"sync"
+	"time"
 )
 
-func BuildFetchResponse(baseReq *SwiftQueueRequest, req *FetchRequest) []byte {
+// FetchTopicResult holds the partition results for one topic of a Fetch response
+type FetchTopicResult struct {
+	Name       string
+	TopicID    string
+	Partitions []FetchPartitionResult
+}
+
+// FetchPartitionResult holds the records and log positions returned for one partition
+type FetchPartitionResult struct {
+	Index            int32
+	ErrorCode        int16
+	HighWatermark    int64
+	LastStableOffset int64
+	LogStartOffset   int64
+	// AbortedTransactions is nil unless the consumer reads committed records
+	AbortedTransactions []AbortedTxn
+	Records             []byte
+}
+
+// HandleFetch answers a Fetch request.
+// The request is first resolved against the fetch session cache. When fewer than MinBytes
+// are available and the client is willing to wait, the fetch is parked in the fetch
+// purgatory until producers append enough data or MaxWaitMs expires.
+func HandleFetch(baseReq *SwiftQueueRequest, req *FetchRequest, broker *Broker, respond func([]byte)) {
+	fetchContext := broker.fetchSessions.NewContext(baseReq.APIVersion, req)
+	if fetchContext.ErrorCode != ErrorCodeNone {
+		respond(encodeFetchResponse(baseReq, fetchContext.ErrorCode, FetchSessionIDNone, nil))
+		return
+	}
+	req = fetchContext.Request
+
+	respondWith := func(results []FetchTopicResult) {
+		results = fetchContext.UpdateAndFilter(results)
+		respond(encodeFetchResponse(baseReq, ErrorCodeNone, fetchContext.SessionID(), results))
+	}
+
+	if req.MaxWaitMs <= 0 || req.MinBytes <= 0 {
+		respondWith(readFetchTopics(broker, baseReq.APIVersion, req))
+		return
+	}
+
+	var mu sync.Mutex
+	var ready []FetchTopicResult
+
+	tryComplete := func() bool {
+		results := readFetchTopics(broker, baseReq.APIVersion, req)
+		if fetchedBytes(results) < int(req.MinBytes) && !hasFetchErrors(results) {
+			return false
+		}
+		mu.Lock()
+		ready = results
+		mu.Unlock()
+		return true
+	}
+
+	onComplete := func() {
+		mu.Lock()
+		results := ready
+		mu.Unlock()
+		if results == nil {
+			// Expired: answer with whatever is available now
+			results = readFetchTopics(broker, baseReq.APIVersion, req)
+		}
+		respondWith(results)
+	}
+
+	keys := make([]string, 0)
+	for _, topic := range req.Topics {
+		name := topic.Name
+		if baseReq.APIVersion >= 13 {
+			name = topicNameForID(broker, topic.TopicID)
+		}
+		for _, partition := range topic.Partitions {
+			keys = append(keys, TopicPartition{Topic: name, Partition: partition.Index}.String())
+		}
+	}
+
+	operation := NewDelayedOperation(time.Duration(req.MaxWaitMs)*time.Millisecond, tryComplete, onComplete)
+	broker.fetchPurgatory.TryCompleteElseWatch(operation, keys)
+}
+
+// fetchedBytes returns the number of record bytes in the results
+func fetchedBytes(results []FetchTopicResult) int {
+	total := 0
+	for _, topic := range results {
+		for _, partition := range topic.Partitions {
+			total += len(partition.Records)
+		}
+	}
+	return total
+}
+
+// hasFetchErrors reports whether any partition failed; such fetches are answered immediately
+func hasFetchErrors(results []FetchTopicResult) bool {
+	for _, topic := range results {
+		for _, partition := range topic.Partitions {
+			if partition.ErrorCode != ErrorCodeNone {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// topicNameForID resolves a topic ID to its name, or returns "" if it is unknown
+func topicNameForID(broker *Broker, topicID string) string {
+	topics, _ := broker.TopicsAndPartitions()
+	if topic := findTopicByUUID(topics, topicID); topic != nil {
+		return topic.Name
+	}
+	return ""
+}
+
+// readFetchTopics reads every requested partition, honoring the request-level MaxBytes
+func readFetchTopics(broker *Broker, version int16, req *FetchRequest) []FetchTopicResult {
+	topics, partitions := broker.TopicsAndPartitions()
+
+	bytesRead := 0
+	results := make([]FetchTopicResult, 0, len(req.Topics))
+	for _, fetchTopic := range req.Topics {
+		var topic *Topic
+		unknownTopicError := int16(ErrorCodeUnknownTopicOrPart)
+		if version >= 13 {
+			topic = findTopicByUUID(topics, fetchTopic.TopicID)
+			unknownTopicError = ErrorCodeUnknownTopicID
+		} else {
+			topic = findTopicByName(topics, fetchTopic.Name)
+		}
+
+		topicResult := FetchTopicResult{
+			Name:    fetchTopic.Name,
+			TopicID: fetchTopic.TopicID,
+		}
+		for _, fetchPartition := range fetchTopic.Partitions {
+			var result FetchPartitionResult
+			if topic == nil {
+				result = fetchError(fetchPartition.Index, unknownTopicError)
+			} else if !hasPartition(partitions, topic.UUID, fetchPartition.Index) {
+				result = fetchError(fetchPartition.Index, ErrorCodeUnknownTopicOrPart)
+			} else {
+				maxBytes := min(int(fetchPartition.PartitionMaxBytes), int(req.MaxBytes)-bytesRead)
+				result = readFetchPartition(broker, topic.Name, fetchPartition, req.IsolationLevel, maxBytes, bytesRead == 0)
+			}
+			bytesRead += len(result.Records)
+			topicResult.Partitions = append(topicResult.Partitions, result)
+		}
+
+		results = append(results, topicResult)
+	}
+
+	return results
+}
+
+// readFetchPartition reads records from a single partition log. Consumers reading committed
+// records only get records below the last stable offset, along with the aborted transactions
+// among them.
+func readFetchPartition(broker *Broker, topicName string, fetchPartition FetchPartition, isolationLevel int, maxBytes int, minOneBatch bool) FetchPartitionResult {
+	tp := TopicPartition{Topic: topicName, Partition: fetchPartition.Index}
+	partitionLog, err := broker.logManager.GetOrCreateLog(tp)
+	if err != nil {
+		broker.logger.Printf("Fetch: failed to open log for %s: %v", tp, err)
+		return fetchError(fetchPartition.Index, ErrorCodeStorageError)
+	}
+
+	result := FetchPartitionResult{
+		Index:            fetchPartition.Index,
+		ErrorCode:        ErrorCodeNone,
+		HighWatermark:    partitionLog.LogEndOffset(),
+		LastStableOffset: partitionLog.LastStableOffset(),
+		LogStartOffset:   partitionLog.LogStartOffset(),
+		Records:          []byte{},
+	}
+
+	var records []byte
+	if isolationLevel == IsolationReadCommitted {
+		var aborted []AbortedTxn
+		records, aborted, err = partitionLog.ReadCommitted(fetchPartition.FetchOffset, max(maxBytes, 0), minOneBatch)
+		result.AbortedTransactions = append(make([]AbortedTxn, 0, len(aborted)), aborted...)
+	} else {
+		records, err = partitionLog.Read(fetchPartition.FetchOffset, max(maxBytes, 0), minOneBatch)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrOffsetOutOfRange):
+			result.ErrorCode = ErrorCodeOffsetOutOfRange
+		case errors.Is(err, ErrCorruptBatch):
+			broker.logger.Printf("Fetch: %s: %v", tp, err)
+			result.ErrorCode = ErrorCodeCorruptMessage
+		default:
+			broker.logger.Printf("Fetch: failed to read %s: %v", tp, err)
+			result.ErrorCode = ErrorCodeStorageError
+		}
+		return result
+	}
+	result.Records = records
+
+	return result
+}
+
+// fetchError builds a failed partition result
+func fetchError(index int32, errorCode int16) FetchPartitionResult {
+	return FetchPartitionResult{
+		Index:            index,
+		ErrorCode:        errorCode,
+		HighWatermark:    -1,
+		LastStableOffset: -1,
+		LogStartOffset:   -1,
+		Records:          []byte{},
+	}
+}
+
+// encodeFetchResponse serializes the Fetch response for the request's version
+func encodeFetchResponse(baseReq *SwiftQueueRequest, errorCode int16, sessionID int32, results []FetchTopicResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
 	rb := NewResponseBuilder()
 
-	// Correlation ID
-	rb.WriteInt32(baseReq.CorrelationID)
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
 
-	// Error code
-	errorCode := ErrorCodeNone
-	if baseReq.APIVersion < FetchMinVersion || baseReq.APIVersion > FetchMaxVersion {
-		errorCode = ErrorCodeUnsupportedVersion
+	// Throttle time
+	if version >= 1 {
+		rb.WriteInt32(0)
 	}
-	rb.WriteInt16(int16(errorCode))
 
-	rb.WriteInt32(0)
-	rb.WriteUInt8(0)
-	rb.WriteInt32(req.SessionID)
-	rb.WriteUInt8(1)
-	rb.WriteInt32(0)
+	// Top-level error code and session
+	if version >= 7 {
+		rb.WriteInt16(errorCode)
+		rb.WriteInt32(sessionID)
+	}
+
+	// Topic responses
+	rb.WriteArrayLength(len(results), flexible)
+	for _, topic := range results {
+		if version >= 13 {
+			rb.WriteUUID(topic.TopicID)
+		} else {
+			rb.WriteStringField(topic.Name, flexible)
+		}
 
-	// rb.WriteInt32(req.MaxWaitMs)
-	// rb.WriteUInt8(uint8(req.IsolationLevel))
-	// rb.WriteInt32(req.SessionID)
-	// rb.WriteInt32(req.SessionEpoch)
+		rb.WriteArrayLength(len(topic.Partitions), flexible)
+		for _, partition := range topic.Partitions {
+			rb.WriteInt32(partition.Index)
+			rb.WriteInt16(partition.ErrorCode)
+			rb.WriteInt64(partition.HighWatermark)
+			if version >= 4 {
+				rb.WriteInt64(partition.LastStableOffset)
+			}
+			if version >= 5 {
+				rb.WriteInt64(partition.LogStartOffset)
+			}
+			if version >= 4 {
+				if partition.AbortedTransactions == nil {
+					rb.WriteArrayLength(-1, flexible)
+				} else {
+					rb.WriteArrayLength(len(partition.AbortedTransactions), flexible)
+					for _, txn := range partition.AbortedTransactions {
+						rb.WriteInt64(txn.ProducerID)
+						rb.WriteInt64(txn.FirstOffset)
+						rb.WriteTaggedFields(flexible)
+					}
+				}
+			}
+			if version >= 11 {
+				// Preferred read replica (none)
+				rb.WriteInt32(-1)
+			}
+			rb.WriteBytesField(partition.Records, flexible)
+			rb.WriteTaggedFields(flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
 
-	// Error code
-	// rb.WriteInt16(int16(ErrorCodeNone))
+	rb.WriteTaggedFields(flexible)
 
 	rb.PrependMessageSize()
 
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"container/list"
+	"math/rand"
+	"sync"
+)
+
+// Special fetch session IDs and epochs
+const (
+	// FetchSessionIDNone is used by sessionless fetches and by clients asking for a new session
+	FetchSessionIDNone = 0
+	// FetchSessionEpochInitial asks the broker to create a new session
+	FetchSessionEpochInitial = 0
+	// FetchSessionEpochFinal closes the session (if any) and makes the fetch sessionless
+	FetchSessionEpochFinal = -1
+)
+
+// sessionPartitionKey identifies a partition within a fetch session.
+// Topic holds the topic name for versions before 13 and the topic ID afterwards.
+type sessionPartitionKey struct {
+	Topic     string
+	Partition int32
+}
+
+// cachedPartition is a partition tracked by a fetch session together with the
+// log positions last sent to the client
+type cachedPartition struct {
+	topic            FetchTopic
+	partition        FetchPartition
+	highWatermark    int64
+	lastStableOffset int64
+	logStartOffset   int64
+}
+
+// FetchSession remembers the partitions a client fetches, so later requests only
+// need to list what changed and responses only include partitions with news
+type FetchSession struct {
+	ID         int32
+	mu         sync.Mutex
+	epoch      int32
+	partitions map[sessionPartitionKey]*cachedPartition
+	order      []sessionPartitionKey
+}
+
+// FetchSessionCache holds the broker's incremental fetch sessions, evicting the
+// least recently used session when it is full
+type FetchSessionCache struct {
+	mu       sync.Mutex
+	maxSlots int
+	sessions map[int32]*list.Element
+	lru      *list.List
+}
+
+// NewFetchSessionCache creates a cache holding at most maxSlots sessions
+func NewFetchSessionCache(maxSlots int) *FetchSessionCache {
+	return &FetchSessionCache{
+		maxSlots: maxSlots,
+		sessions: make(map[int32]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// FetchContext is the outcome of resolving a Fetch request against the session cache
+type FetchContext struct {
+	// ErrorCode is a top-level session error; when set the fetch must not be served
+	ErrorCode int16
+	// Request is the effective request to serve, covering every partition of the session
+	Request *FetchRequest
+
+	session     *FetchSession
+	incremental bool
+	byTopicID   bool
+}
+
+// SessionID returns the session ID to send back to the client
+func (fc *FetchContext) SessionID() int32 {
+	if fc.session == nil {
+		return FetchSessionIDNone
+	}
+	return fc.session.ID
+}
+
+// NewContext applies the session fields of a Fetch request to the cache
+func (c *FetchSessionCache) NewContext(version int16, req *FetchRequest) *FetchContext {
+	fc := &FetchContext{Request: req, byTopicID: version >= 13}
+
+	switch {
+	case req.SessionEpoch == FetchSessionEpochFinal:
+		// Close the session, if any, and serve a sessionless full fetch
+		if req.SessionID != FetchSessionIDNone {
+			c.remove(req.SessionID)
+		}
+	case req.SessionEpoch == FetchSessionEpochInitial:
+		// Replace any existing session with a new full session
+		if req.SessionID != FetchSessionIDNone {
+			c.remove(req.SessionID)
+		}
+		fc.session = c.create(fc, req)
+	case req.SessionID == FetchSessionIDNone:
+		fc.ErrorCode = ErrorCodeInvalidFetchSessionEpoch
+	default:
+		session := c.get(req.SessionID)
+		if session == nil {
+			fc.ErrorCode = ErrorCodeFetchSessionIDNotFound
+			return fc
+		}
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		if session.epoch != req.SessionEpoch {
+			fc.ErrorCode = ErrorCodeInvalidFetchSessionEpoch
+			return fc
+		}
+		session.update(fc, req)
+		session.epoch = nextSessionEpoch(session.epoch)
+		fc.session = session
+		fc.incremental = true
+		fc.Request = session.fetchRequest(req)
+	}
+
+	return fc
+}
+
+// create starts a new full session holding the request's partitions.
+// It returns nil when sessions are disabled.
+func (c *FetchSessionCache) create(fc *FetchContext, req *FetchRequest) *FetchSession {
+	if c.maxSlots <= 0 {
+		return nil
+	}
+
+	session := &FetchSession{
+		epoch:      nextSessionEpoch(FetchSessionEpochInitial),
+		partitions: make(map[sessionPartitionKey]*cachedPartition),
+	}
+	session.update(fc, req)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.sessions) >= c.maxSlots {
+		oldest := c.lru.Back()
+		evicted := c.lru.Remove(oldest).(*FetchSession)
+		delete(c.sessions, evicted.ID)
+	}
+
+	for session.ID == FetchSessionIDNone || c.sessions[session.ID] != nil {
+		session.ID = rand.Int31()
+	}
+	c.sessions[session.ID] = c.lru.PushFront(session)
+
+	return session
+}
+
+// get returns a session and marks it as recently used
+func (c *FetchSessionCache) get(id int32) *FetchSession {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.sessions[id]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*FetchSession)
+}
+
+// remove drops a session from the cache
+func (c *FetchSessionCache) remove(id int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.sessions[id]; ok {
+		c.lru.Remove(element)
+		delete(c.sessions, id)
+	}
+}
+
+// nextSessionEpoch returns the epoch following epoch, wrapping around to 1
+func nextSessionEpoch(epoch int32) int32 {
+	if epoch < 0 || epoch == 1<<31-1 {
+		return 1
+	}
+	return epoch + 1
+}
+
+// update adds or refreshes the request's partitions and drops the forgotten ones
+func (s *FetchSession) update(fc *FetchContext, req *FetchRequest) {
+	for _, topic := range req.Topics {
+		for _, partition := range topic.Partitions {
+			key := fc.partitionKey(topic.Name, topic.TopicID, partition.Index)
+			if cached, ok := s.partitions[key]; ok {
+				cached.partition = partition
+				continue
+			}
+			s.partitions[key] = &cachedPartition{
+				topic:            FetchTopic{Name: topic.Name, TopicID: topic.TopicID},
+				partition:        partition,
+				highWatermark:    -1,
+				lastStableOffset: -1,
+				logStartOffset:   -1,
+			}
+			s.order = append(s.order, key)
+		}
+	}
+
+	for _, forgotten := range req.ForgottenTopics {
+		for _, index := range forgotten.Partitions {
+			delete(s.partitions, fc.partitionKey(forgotten.Name, forgotten.TopicID, index))
+		}
+	}
+
+	// Keep insertion order for the remaining partitions
+	order := s.order[:0]
+	for _, key := range s.order {
+		if _, ok := s.partitions[key]; ok {
+			order = append(order, key)
+		}
+	}
+	s.order = order
+}
+
+// fetchRequest builds a request covering every partition in the session
+func (s *FetchSession) fetchRequest(req *FetchRequest) *FetchRequest {
+	effective := *req
+	effective.Topics = nil
+	effective.ForgottenTopics = nil
+
+	topicIndex := make(map[string]int)
+	for _, key := range s.order {
+		cached := s.partitions[key]
+		index, ok := topicIndex[key.Topic]
+		if !ok {
+			index = len(effective.Topics)
+			topicIndex[key.Topic] = index
+			effective.Topics = append(effective.Topics, cached.topic)
+		}
+		effective.Topics[index].Partitions = append(effective.Topics[index].Partitions, cached.partition)
+	}
+
+	return &effective
+}
+
+// partitionKey returns the session key for a partition of the request
+func (fc *FetchContext) partitionKey(name string, topicID string, partition int32) sessionPartitionKey {
+	if fc.byTopicID {
+		return sessionPartitionKey{Topic: topicID, Partition: partition}
+	}
+	return sessionPartitionKey{Topic: name, Partition: partition}
+}
+
+// UpdateAndFilter records the positions being sent for each session partition.
+// For incremental fetches it drops partitions that have nothing new to report.
+func (fc *FetchContext) UpdateAndFilter(results []FetchTopicResult) []FetchTopicResult {
+	if fc.session == nil {
+		return results
+	}
+
+	fc.session.mu.Lock()
+	defer fc.session.mu.Unlock()
+
+	filtered := make([]FetchTopicResult, 0, len(results))
+	for _, topic := range results {
+		kept := FetchTopicResult{Name: topic.Name, TopicID: topic.TopicID}
+		for _, partition := range topic.Partitions {
+			cached, ok := fc.session.partitions[fc.partitionKey(topic.Name, topic.TopicID, partition.Index)]
+			if !ok {
+				continue
+			}
+			changed := len(partition.Records) > 0 ||
+				partition.ErrorCode != ErrorCodeNone ||
+				partition.HighWatermark != cached.highWatermark ||
+				partition.LastStableOffset != cached.lastStableOffset ||
+				partition.LogStartOffset != cached.logStartOffset
+			cached.highWatermark = partition.HighWatermark
+			cached.lastStableOffset = partition.LastStableOffset
+			cached.logStartOffset = partition.LogStartOffset
+
+			if changed || !fc.incremental {
+				kept.Partitions = append(kept.Partitions, partition)
+			}
+		}
+		if len(kept.Partitions) > 0 || !fc.incremental {
+			filtered = append(filtered, kept)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,50 @@
+package main
+
+import "fmt"
+
+// Coordinator key types of a FindCoordinator request
+const (
+	CoordinatorKeyTypeGroup       = 0
+	CoordinatorKeyTypeTransaction = 1
+	CoordinatorKeyTypeShare       = 2
+)
+
+// FindCoordinatorRequest represents a parsed FindCoordinator request.
+// Versions before 4 look up a single key; later versions batch them.
+type FindCoordinatorRequest struct {
+	KeyType int8
+	Keys    []string
+}
+
+// ParseFindCoordinatorRequest parses the body of a FindCoordinator request (v0-v6)
+func ParseFindCoordinatorRequest(baseReq *SwiftQueueRequest) (*FindCoordinatorRequest, error) {
+	version := baseReq.APIVersion
+	if version < FindCoordinatorMinVersion || version > FindCoordinatorMaxVersion {
+		return nil, fmt.Errorf("unsupported find coordinator version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &FindCoordinatorRequest{KeyType: CoordinatorKeyTypeGroup}
+
+	if version < 4 {
+		req.Keys = []string{d.ReadString(flexible)}
+		if version >= 1 {
+			req.KeyType = d.ReadInt8()
+		}
+	} else {
+		req.KeyType = d.ReadInt8()
+		keyCount := d.ReadArrayLength(flexible)
+		for i := 0; i < keyCount && d.Err() == nil; i++ {
+			req.Keys = append(req.Keys, d.ReadString(flexible))
+		}
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse find coordinator request: %w", err)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import "fmt"
+
+// FindCoordinatorResult is the coordinator found for one key
+type FindCoordinatorResult struct {
+	Key          string
+	NodeID       int32
+	Host         string
+	Port         int32
+	ErrorCode    int16
+	ErrorMessage *string
+}
+
+// BuildFindCoordinatorResponse answers a FindCoordinator request.
+// This broker coordinates every group and transactional ID, so it always names itself.
+func BuildFindCoordinatorResponse(baseReq *SwiftQueueRequest, req *FindCoordinatorRequest, broker *Broker) []byte {
+	results := make([]FindCoordinatorResult, 0, len(req.Keys))
+	for _, key := range req.Keys {
+		result := FindCoordinatorResult{
+			Key:       key,
+			NodeID:    int32(broker.config.NodeID),
+			Host:      broker.config.AdvertisedHost,
+			Port:      int32(broker.config.Port),
+			ErrorCode: ErrorCodeNone,
+		}
+
+		switch req.KeyType {
+		case CoordinatorKeyTypeGroup, CoordinatorKeyTypeTransaction, CoordinatorKeyTypeShare:
+			if key == "" && req.KeyType == CoordinatorKeyTypeGroup {
+				result = findCoordinatorError(key, ErrorCodeInvalidGroupID, "group ID must not be empty")
+			}
+		default:
+			result = findCoordinatorError(key, ErrorCodeInvalidRequest, fmt.Sprintf("unknown coordinator key type %d", req.KeyType))
+		}
+
+		results = append(results, result)
+	}
+
+	return encodeFindCoordinatorResponse(baseReq, results)
+}
+
+// findCoordinatorError builds a failed lookup result
+func findCoordinatorError(key string, errorCode int16, message string) FindCoordinatorResult {
+	return FindCoordinatorResult{
+		Key:          key,
+		NodeID:       -1,
+		Port:         -1,
+		ErrorCode:    errorCode,
+		ErrorMessage: &message,
+	}
+}
+
+// encodeFindCoordinatorResponse serializes the FindCoordinator response for the request's version
+func encodeFindCoordinatorResponse(baseReq *SwiftQueueRequest, results []FindCoordinatorResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	if version >= 1 {
+		// Throttle time
+		rb.WriteInt32(0)
+	}
+
+	if version >= 4 {
+		rb.WriteArrayLength(len(results), flexible)
+		for _, result := range results {
+			rb.WriteStringField(result.Key, flexible)
+			rb.WriteInt32(result.NodeID)
+			rb.WriteStringField(result.Host, flexible)
+			rb.WriteInt32(result.Port)
+			rb.WriteInt16(result.ErrorCode)
+			rb.WriteNullableString(result.ErrorMessage, flexible)
+			rb.WriteTaggedFields(flexible)
+		}
+	} else {
+		// Older versions look up exactly one key
+		result := results[0]
+		rb.WriteInt16(result.ErrorCode)
+		if version >= 1 {
+			rb.WriteNullableString(result.ErrorMessage, flexible)
+		}
+		rb.WriteInt32(result.NodeID)
+		rb.WriteStringField(result.Host, flexible)
+		rb.WriteInt32(result.Port)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
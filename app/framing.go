@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrFrameTooLarge is returned when a client announces a request larger than the configured maximum
+var ErrFrameTooLarge = errors.New("request frame too large")
+
+// FrameReader splits a connection byte stream into length-prefixed request frames.
+//
+// Every SwiftQueue request starts with a 4-byte big-endian MessageSize followed by
+// exactly MessageSize bytes. The reader is buffered, so several pipelined requests
+// arriving in a single TCP read are returned one by one, and a request split across
+// multiple reads is reassembled before it is returned.
+type FrameReader struct {
+	reader         *bufio.Reader
+	maxRequestSize int
+}
+
+// NewFrameReader creates a frame reader on top of r
+func NewFrameReader(r io.Reader, bufferSize int, maxRequestSize int) *FrameReader {
+	return &FrameReader{
+		reader:         bufio.NewReaderSize(r, bufferSize),
+		maxRequestSize: maxRequestSize,
+	}
+}
+
+// ReadFrame reads the next complete request frame.
+// The returned slice includes the 4-byte size prefix so it can be passed directly to the
+// request parsers. io.EOF is returned when the stream ends cleanly between frames and
+// io.ErrUnexpectedEOF when it ends in the middle of a frame.
+func (fr *FrameReader) ReadFrame() ([]byte, error) {
+	sizeBuf := make([]byte, SizeInt32)
+	if _, err := io.ReadFull(fr.reader, sizeBuf); err != nil {
+		return nil, err
+	}
+
+	messageSize := int32(binary.BigEndian.Uint32(sizeBuf))
+	if messageSize < 0 {
+		return nil, fmt.Errorf("invalid request size: %d", messageSize)
+	}
+	if int(messageSize) > fr.maxRequestSize {
+		return nil, fmt.Errorf("%w: %d bytes exceeds max.request.size of %d bytes", ErrFrameTooLarge, messageSize, fr.maxRequestSize)
+	}
+
+	frame := make([]byte, SizeInt32+int(messageSize))
+	copy(frame, sizeBuf)
+	if _, err := io.ReadFull(fr.reader, frame[SizeInt32:]); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return frame, nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Group types reported by ListGroups
+const (
+	// GroupTypeClassic is the type of groups using the classic rebalance protocol
+	GroupTypeClassic = "classic"
+	// GroupTypeConsumer is the type of groups using the consumer rebalance protocol (KIP-848)
+	GroupTypeConsumer = "consumer"
+	// GroupTypeShare is the type of share groups (KIP-932)
+	GroupTypeShare = "share"
+)
+
+// GroupListing summarizes a group for ListGroups
+type GroupListing struct {
+	GroupID      string
+	ProtocolType string
+	State        string
+	Type         string
+}
+
+// GroupDescription describes a group and its members for DescribeGroups
+type GroupDescription struct {
+	GroupID      string
+	State        string
+	ProtocolType string
+	ProtocolName string
+	Members      []GroupMemberDescription
+}
+
+// GroupMemberDescription describes one member of a group.
+// Metadata and Assignment are only filled in while the group is Stable.
+type GroupMemberDescription struct {
+	MemberID        string
+	GroupInstanceID *string
+	ClientID        string
+	ClientHost      string
+	Metadata        []byte
+	Assignment      []byte
+}
+
+// ListGroups returns every group known to the coordinator, ordered by group ID
+func (c *GroupCoordinator) ListGroups() []GroupListing {
+	var listings []GroupListing
+	for _, g := range c.snapshotGroups() {
+		g.mu.Lock()
+		if g.state != GroupDead {
+			listings = append(listings, GroupListing{
+				GroupID:      g.ID,
+				ProtocolType: g.protocolType,
+				State:        g.stateName(),
+				Type:         g.groupType,
+			})
+		}
+		g.mu.Unlock()
+	}
+
+	slices.SortFunc(listings, func(a, b GroupListing) int {
+		return cmp.Compare(a.GroupID, b.GroupID)
+	})
+	return listings
+}
+
+// DescribeGroup describes a classic group. Unknown groups are described as Dead with no members;
+// consumer groups are described by DescribeConsumerGroup instead.
+func (c *GroupCoordinator) DescribeGroup(groupID string) (GroupDescription, int16) {
+	description := GroupDescription{GroupID: groupID, State: GroupDead.String()}
+
+	g := c.group(groupID, false)
+	if g == nil {
+		return description, ErrorCodeNone
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.groupType != GroupTypeClassic {
+		return description, ErrorCodeGroupIDNotFound
+	}
+
+	description.State = g.state.String()
+	description.ProtocolType = g.protocolType
+	stable := g.state == GroupStable
+	if stable {
+		description.ProtocolName = g.protocolName
+	}
+
+	for _, id := range g.order {
+		member := g.members[id]
+		memberDescription := GroupMemberDescription{
+			MemberID:        member.ID,
+			GroupInstanceID: member.GroupInstanceID,
+			ClientID:        member.ClientID,
+			ClientHost:      member.ClientHost,
+			Metadata:        []byte{},
+			Assignment:      []byte{},
+		}
+		if stable {
+			if metadata := member.metadata(g.protocolName); metadata != nil {
+				memberDescription.Metadata = metadata
+			}
+			if member.Assignment != nil {
+				memberDescription.Assignment = member.Assignment
+			}
+		}
+		description.Members = append(description.Members, memberDescription)
+	}
+
+	return description, ErrorCodeNone
+}
+
+// DeleteGroup deletes an empty group together with its committed offsets, or with the share
+// partition state of a share group
+func (c *GroupCoordinator) DeleteGroup(groupID string) int16 {
+	if groupID == "" {
+		return ErrorCodeInvalidGroupID
+	}
+
+	g := c.group(groupID, false)
+	if g == nil {
+		return ErrorCodeGroupIDNotFound
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch {
+	case g.state == GroupDead:
+		return ErrorCodeGroupIDNotFound
+	case g.state != GroupEmpty || len(g.pendingMembers) > 0:
+		return ErrorCodeNonEmptyGroup
+	}
+
+	partitions := make([]TopicPartition, 0, len(g.offsets))
+	for tp := range g.offsets {
+		partitions = append(partitions, tp)
+	}
+	if !c.deleteOffsets(g, partitions) {
+		return ErrorCodeUnknownServerError
+	}
+	if g.groupType == GroupTypeShare {
+		if err := c.sharePartitions.DeleteGroup(groupID); err != nil {
+			c.logger.Printf("Group %s: failed to delete share partition state: %v", groupID, err)
+			return ErrorCodeUnknownServerError
+		}
+	}
+
+	c.removeGroup(g)
+	c.logger.Printf("Group %s: deleted", groupID)
+	return ErrorCodeNone
+}
+
+// DeleteGroupOffsets deletes a group's committed offsets for the given partitions.
+// A group with members keeps the offsets of topics its consumers are subscribed to.
+// It returns a group-level error code and an error code per partition.
+func (c *GroupCoordinator) DeleteGroupOffsets(groupID string, partitions []TopicPartition) (int16, map[TopicPartition]int16) {
+	g := c.group(groupID, false)
+	if g == nil {
+		return ErrorCodeGroupIDNotFound, nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == GroupDead {
+		return ErrorCodeGroupIDNotFound, nil
+	}
+
+	subscribed := make(map[string]bool)
+	if g.state != GroupEmpty {
+		if g.protocolType != ConsumerProtocolType {
+			// Without a consumer subscription there is no telling which offsets are in use
+			return ErrorCodeNonEmptyGroup, nil
+		}
+		subscribed = g.subscribedTopics()
+	}
+
+	errorCodes := make(map[TopicPartition]int16, len(partitions))
+	var deleted []TopicPartition
+	for _, tp := range partitions {
+		if subscribed[tp.Topic] {
+			errorCodes[tp] = ErrorCodeGroupSubscribedToTopic
+			continue
+		}
+		errorCodes[tp] = ErrorCodeNone
+		if _, ok := g.offsets[tp]; ok {
+			deleted = append(deleted, tp)
+		}
+	}
+
+	if !c.deleteOffsets(g, deleted) {
+		for _, tp := range deleted {
+			errorCodes[tp] = ErrorCodeUnknownServerError
+		}
+	}
+
+	return ErrorCodeNone, errorCodes
+}
+
+// subscribedTopics returns the topics the group's consumers subscribe to
+func (g *ConsumerGroup) subscribedTopics() map[string]bool {
+	topics := make(map[string]bool)
+	for _, topic := range g.subscriptionMetadata {
+		topics[topic.Name] = true
+	}
+	for _, member := range g.members {
+		// No protocol is selected before the group's first rebalance completes
+		metadata := member.metadata(g.protocolName)
+		if g.protocolName == "" && len(member.Protocols) > 0 {
+			metadata = member.Protocols[0].Metadata
+		}
+
+		subscription, err := decodeConsumerSubscription(metadata)
+		if err != nil {
+			continue
+		}
+		for _, topic := range subscription {
+			topics[topic] = true
+		}
+	}
+	return topics
+}
+
+// removeGroup marks a group Dead and forgets it. The caller holds the group's lock.
+func (c *GroupCoordinator) removeGroup(g *ConsumerGroup) {
+	g.state = GroupDead
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.groups[g.ID] == g {
+		delete(c.groups, g.ID)
+	}
+}
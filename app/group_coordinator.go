@@ -0,0 +1,1182 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// GroupState is the state of a consumer group in the classic rebalance protocol
+type GroupState int
+
+const (
+	// GroupEmpty has no members
+	GroupEmpty GroupState = iota
+	// GroupPreparingRebalance waits for the members to (re)join
+	GroupPreparingRebalance
+	// GroupCompletingRebalance waits for the leader to send the assignment in SyncGroup
+	GroupCompletingRebalance
+	// GroupStable has members holding the assignment of the current generation
+	GroupStable
+	// GroupDead has been removed from the coordinator
+	GroupDead
+)
+
+var groupStateNames = [...]string{"Empty", "PreparingRebalance", "CompletingRebalance", "Stable", "Dead"}
+
+// String returns the state name used by the Kafka protocol
+func (s GroupState) String() string {
+	return groupStateNames[s]
+}
+
+// GroupProtocol is an assignment protocol supported by a member, with the member's metadata for it
+type GroupProtocol struct {
+	Name     string
+	Metadata []byte
+}
+
+// GroupMember is a member of a classic consumer group
+type GroupMember struct {
+	ID               string
+	GroupInstanceID  *string
+	ClientID         string
+	ClientHost       string
+	SessionTimeout   time.Duration
+	RebalanceTimeout time.Duration
+	ProtocolType     string
+	Protocols        []GroupProtocol
+	Assignment       []byte
+
+	// Pending JoinGroup and SyncGroup responses
+	awaitingJoin func(JoinGroupResult)
+	awaitingSync func(SyncGroupResult)
+	sessionTimer *time.Timer
+}
+
+// JoinGroupResult is the answer to a JoinGroup request
+type JoinGroupResult struct {
+	ErrorCode    int16
+	GenerationID int32
+	ProtocolType *string
+	ProtocolName *string
+	LeaderID     string
+	MemberID     string
+	// Members is only sent to the leader, which computes the assignment
+	Members []JoinGroupMemberMetadata
+}
+
+// JoinGroupMemberMetadata is a member's metadata for the selected protocol, sent to the leader
+type JoinGroupMemberMetadata struct {
+	MemberID        string
+	GroupInstanceID *string
+	Metadata        []byte
+}
+
+// SyncGroupResult is the answer to a SyncGroup request
+type SyncGroupResult struct {
+	ErrorCode    int16
+	ProtocolType *string
+	ProtocolName *string
+	Assignment   []byte
+}
+
+// ConsumerGroup holds the membership and rebalance state of one group.
+// All fields except ID are guarded by mu.
+type ConsumerGroup struct {
+	ID string
+
+	mu           sync.Mutex
+	state        GroupState
+	generationID int32
+	protocolType string
+	protocolName string
+	leaderID     string
+	members      map[string]*GroupMember
+	// order holds member IDs in join order; the first member becomes leader if the leader leaves
+	order []string
+	// staticMembers maps group instance IDs to member IDs
+	staticMembers map[string]string
+	// pendingMembers were given a member ID but have not rejoined with it yet
+	pendingMembers map[string]*time.Timer
+
+	rebalanceTimer *time.Timer
+	// initialRebalance is set while an empty group waits for more members before its first rebalance
+	initialRebalance bool
+
+	// groupType is GroupTypeClassic, GroupTypeConsumer or GroupTypeShare; it only changes while
+	// the group is empty. Consumer and share groups are Empty without members and Stable
+	// otherwise; the finer-grained state of consumer groups is derived from the epochs by stateName.
+	groupType string
+
+	// State of the consumer rebalance protocol, see consumer_group.go
+	groupEpoch       int32
+	assignmentEpoch  int32
+	assignorName     string
+	consumerMembers  map[string]*ConsumerGroupMember
+	targetAssignment map[string]PartitionSet
+	// subscriptionMetadata holds the subscribed topics by ID as of the group epoch
+	subscriptionMetadata map[string]AssignorTopic
+
+	// shareMembers holds the members of a share group, see share_group.go
+	shareMembers map[string]*ShareGroupMember
+
+	// offsets holds the group's committed offsets
+	offsets map[TopicPartition]CommittedOffset
+	// pendingTxnOffsets holds the offsets committed by ongoing transactions, by producer ID
+	pendingTxnOffsets map[int64]map[TopicPartition]CommittedOffset
+	// emptySince is when the group last became empty; committed offsets of an empty
+	// consumer group expire once it has been empty for the retention period
+	emptySince time.Time
+}
+
+// GroupCoordinator runs the classic rebalance protocol for the consumer groups coordinated by
+// this broker. Being the only broker, it coordinates every group.
+//
+// A rebalance moves the group from PreparingRebalance, where JoinGroup responses are held until
+// every known member has rejoined or the rebalance timeout expires, to CompletingRebalance,
+// where the elected leader sends the assignment in SyncGroup, and finally to Stable. Members
+// that miss their session timeout are removed, which triggers another rebalance.
+//
+// Committed offsets are kept in memory with their group and persisted in the offsets log,
+// from which they are loaded at startup.
+type GroupCoordinator struct {
+	config          *Config
+	logger          *log.Logger
+	offsetStore     *OffsetStore
+	sharePartitions *SharePartitionManager
+
+	mu     sync.Mutex
+	groups map[string]*ConsumerGroup
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewGroupCoordinator creates a coordinator holding the offsets committed in the offsets log
+// and starts expiring offsets past their retention. Members leaving share groups release
+// their records in sharePartitions.
+func NewGroupCoordinator(config *Config, logger *log.Logger, logManager *LogManager, sharePartitions *SharePartitionManager) (*GroupCoordinator, error) {
+	offsetStore, offsets, pendingOffsets, err := OpenOffsetStore(logManager)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &GroupCoordinator{
+		config:          config,
+		logger:          logger,
+		offsetStore:     offsetStore,
+		sharePartitions: sharePartitions,
+		groups:          make(map[string]*ConsumerGroup),
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+
+	for key, offset := range offsets {
+		c.group(key.Group, true).offsets[key.TopicPartition] = offset
+	}
+	for producerID, pending := range pendingOffsets {
+		for key, offset := range pending {
+			c.group(key.Group, true).addPendingTxnOffset(producerID, key.TopicPartition, offset)
+		}
+	}
+	logger.Printf("Loaded %d committed offsets for %d groups", len(offsets), len(c.groups))
+
+	if err := offsetStore.MaybeCompact(); err != nil {
+		logger.Printf("Failed to compact offsets log: %v", err)
+	}
+
+	go c.runOffsetExpiration()
+
+	return c, nil
+}
+
+// group returns the group with the given ID, creating an empty group if create is set
+func (c *GroupCoordinator) group(id string, create bool) *ConsumerGroup {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.groups[id]
+	if !ok && create {
+		g = &ConsumerGroup{
+			ID:                id,
+			groupType:         GroupTypeClassic,
+			members:           make(map[string]*GroupMember),
+			staticMembers:     make(map[string]string),
+			pendingMembers:    make(map[string]*time.Timer),
+			offsets:           make(map[TopicPartition]CommittedOffset),
+			pendingTxnOffsets: make(map[int64]map[TopicPartition]CommittedOffset),
+			emptySince:        time.Now(),
+		}
+		c.groups[id] = g
+	}
+	return g
+}
+
+// JoinGroup adds or refreshes a member and calls callback once the join completes,
+// which may be after the rebalance has waited for the other members
+func (c *GroupCoordinator) JoinGroup(version int16, clientID string, clientHost string, req *JoinGroupRequest, callback func(JoinGroupResult)) {
+	fail := func(errorCode int16) {
+		callback(JoinGroupResult{ErrorCode: errorCode, GenerationID: -1, MemberID: req.MemberID})
+	}
+
+	if req.GroupID == "" {
+		fail(ErrorCodeInvalidGroupID)
+		return
+	}
+	if req.SessionTimeoutMs < int32(c.config.GroupMinSessionTimeoutMs) || req.SessionTimeoutMs > int32(c.config.GroupMaxSessionTimeoutMs) {
+		fail(ErrorCodeInvalidSessionTimeout)
+		return
+	}
+	if req.ProtocolType == "" || len(req.Protocols) == 0 {
+		fail(ErrorCodeInconsistentGroupProtocol)
+		return
+	}
+
+	// Only members without an ID may create a group
+	g := c.group(req.GroupID, req.MemberID == "")
+	if g == nil {
+		fail(ErrorCodeUnknownMemberID)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == GroupDead {
+		fail(ErrorCodeCoordinatorNotAvailable)
+		return
+	}
+	if g.groupType != GroupTypeClassic {
+		if g.state != GroupEmpty || g.groupType == GroupTypeShare {
+			fail(ErrorCodeInconsistentGroupProtocol)
+			return
+		}
+		g.convertToClassicGroup()
+	}
+	if !g.supportsProtocols(req.ProtocolType, req.Protocols) {
+		fail(ErrorCodeInconsistentGroupProtocol)
+		return
+	}
+
+	member := &GroupMember{
+		ID:               req.MemberID,
+		GroupInstanceID:  req.GroupInstanceID,
+		ClientID:         clientID,
+		ClientHost:       clientHost,
+		SessionTimeout:   time.Duration(req.SessionTimeoutMs) * time.Millisecond,
+		RebalanceTimeout: time.Duration(req.RebalanceTimeoutMs) * time.Millisecond,
+		ProtocolType:     req.ProtocolType,
+		Protocols:        req.Protocols,
+	}
+
+	if req.MemberID == "" {
+		c.joinNewMember(g, version, member, callback)
+	} else {
+		c.joinExistingMember(g, member, callback)
+	}
+}
+
+// joinNewMember assigns a member ID to a member joining for the first time
+func (c *GroupCoordinator) joinNewMember(g *ConsumerGroup, version int16, member *GroupMember, callback func(JoinGroupResult)) {
+	if len(g.members)+len(g.pendingMembers) >= c.config.GroupMaxSize {
+		callback(JoinGroupResult{ErrorCode: ErrorCodeGroupMaxSizeReached, GenerationID: -1})
+		return
+	}
+
+	if member.GroupInstanceID != nil {
+		// A static member rejoining under a new member ID replaces, and fences, its old incarnation
+		member.ID = newMemberID(*member.GroupInstanceID)
+		if oldID, ok := g.staticMembers[*member.GroupInstanceID]; ok {
+			c.fenceMember(g, g.members[oldID])
+		}
+		c.addMemberAndRebalance(g, member, callback)
+		return
+	}
+
+	member.ID = newMemberID(member.ClientID)
+	if version >= 4 {
+		// The member must rejoin with its new ID, so a lost response does not leave a phantom member behind
+		c.addPendingMember(g, member.ID, member.SessionTimeout)
+		callback(JoinGroupResult{ErrorCode: ErrorCodeMemberIDRequired, GenerationID: -1, MemberID: member.ID})
+		return
+	}
+	c.addMemberAndRebalance(g, member, callback)
+}
+
+// joinExistingMember handles a JoinGroup from a member that already has an ID
+func (c *GroupCoordinator) joinExistingMember(g *ConsumerGroup, member *GroupMember, callback func(JoinGroupResult)) {
+	if timer, ok := g.pendingMembers[member.ID]; ok {
+		timer.Stop()
+		delete(g.pendingMembers, member.ID)
+		c.addMemberAndRebalance(g, member, callback)
+		return
+	}
+
+	existing, errorCode := g.validateMember(member.ID, member.GroupInstanceID)
+	if errorCode != ErrorCodeNone {
+		callback(JoinGroupResult{ErrorCode: errorCode, GenerationID: -1, MemberID: member.ID})
+		return
+	}
+
+	switch g.state {
+	case GroupPreparingRebalance:
+		c.updateMember(g, existing, member, callback)
+		c.maybeCompleteJoin(g)
+	case GroupCompletingRebalance, GroupStable:
+		// A follower rejoining with unchanged metadata gets the current generation back;
+		// a changed subscription, or a rejoining leader, starts a new rebalance
+		if g.state == GroupStable && existing.ID == g.leaderID || !sameProtocols(existing.Protocols, member.Protocols) {
+			c.updateMember(g, existing, member, callback)
+			c.prepareRebalance(g, fmt.Sprintf("member %s rejoined", existing.ID))
+			return
+		}
+		callback(g.joinResult(existing))
+	default:
+		callback(JoinGroupResult{ErrorCode: ErrorCodeUnknownMemberID, GenerationID: -1, MemberID: member.ID})
+	}
+}
+
+// addMemberAndRebalance adds a member to the group and waits for it in the next rebalance
+func (c *GroupCoordinator) addMemberAndRebalance(g *ConsumerGroup, member *GroupMember, callback func(JoinGroupResult)) {
+	if len(g.members) == 0 {
+		g.protocolType = member.ProtocolType
+	}
+	if g.leaderID == "" {
+		g.leaderID = member.ID
+	}
+
+	member.awaitingJoin = callback
+	g.members[member.ID] = member
+	g.order = append(g.order, member.ID)
+	if member.GroupInstanceID != nil {
+		g.staticMembers[*member.GroupInstanceID] = member.ID
+	}
+	c.scheduleSessionTimeout(g, member)
+
+	if g.state == GroupPreparingRebalance {
+		c.maybeCompleteJoin(g)
+		return
+	}
+	c.prepareRebalance(g, fmt.Sprintf("member %s joined", member.ID))
+}
+
+// updateMember refreshes an existing member from a new JoinGroup request
+func (c *GroupCoordinator) updateMember(g *ConsumerGroup, existing *GroupMember, member *GroupMember, callback func(JoinGroupResult)) {
+	if existing.awaitingJoin != nil {
+		// Superseded by the new request
+		existing.awaitingJoin(JoinGroupResult{ErrorCode: ErrorCodeRebalanceInProgress, GenerationID: -1, MemberID: existing.ID})
+	}
+	existing.ClientID = member.ClientID
+	existing.ClientHost = member.ClientHost
+	existing.SessionTimeout = member.SessionTimeout
+	existing.RebalanceTimeout = member.RebalanceTimeout
+	existing.Protocols = member.Protocols
+	existing.awaitingJoin = callback
+	c.scheduleSessionTimeout(g, existing)
+}
+
+// addPendingMember remembers a member ID handed out with MEMBER_ID_REQUIRED until the member
+// rejoins with it or its session timeout passes
+func (c *GroupCoordinator) addPendingMember(g *ConsumerGroup, memberID string, sessionTimeout time.Duration) {
+	var timer *time.Timer
+	timer = time.AfterFunc(sessionTimeout, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.pendingMembers[memberID] != timer {
+			return
+		}
+		delete(g.pendingMembers, memberID)
+		c.maybeCompleteJoin(g)
+	})
+	g.pendingMembers[memberID] = timer
+}
+
+// prepareRebalance moves the group to PreparingRebalance, asking every member to rejoin
+func (c *GroupCoordinator) prepareRebalance(g *ConsumerGroup, reason string) {
+	if g.state == GroupCompletingRebalance {
+		// The assignment being waited for is already stale
+		for _, member := range g.members {
+			if callback := member.awaitingSync; callback != nil {
+				member.awaitingSync = nil
+				callback(SyncGroupResult{ErrorCode: ErrorCodeRebalanceInProgress})
+			}
+		}
+	}
+
+	// The first rebalance of an empty group waits a little for more members to arrive
+	delay := g.rebalanceTimeout()
+	g.initialRebalance = g.state == GroupEmpty
+	if g.initialRebalance {
+		delay = min(delay, time.Duration(c.config.GroupInitialRebalanceDelayMs)*time.Millisecond)
+	}
+
+	c.logger.Printf("Group %s: preparing rebalance from %s (generation %d): %s", g.ID, g.state, g.generationID, reason)
+	g.state = GroupPreparingRebalance
+	c.scheduleRebalanceTimeout(g, delay)
+	c.maybeCompleteJoin(g)
+}
+
+// maybeCompleteJoin completes the join phase once every known member has rejoined
+func (c *GroupCoordinator) maybeCompleteJoin(g *ConsumerGroup) {
+	if g.state != GroupPreparingRebalance || g.initialRebalance || len(g.pendingMembers) > 0 {
+		return
+	}
+	for _, member := range g.members {
+		if member.awaitingJoin == nil {
+			return
+		}
+	}
+	c.completeJoin(g)
+}
+
+// completeJoin starts a new generation with the members that rejoined, elects the leader,
+// selects the protocol and answers the pending JoinGroup requests
+func (c *GroupCoordinator) completeJoin(g *ConsumerGroup) {
+	g.stopRebalanceTimer()
+	g.initialRebalance = false
+
+	for _, id := range slices.Clone(g.order) {
+		if member := g.members[id]; member.awaitingJoin == nil {
+			c.logger.Printf("Group %s: removing member %s which did not rejoin", g.ID, id)
+			g.removeMember(member)
+		}
+	}
+
+	g.generationID++
+	if len(g.members) == 0 {
+		g.state = GroupEmpty
+		g.protocolName = ""
+		g.leaderID = ""
+		g.emptySince = time.Now()
+		c.logger.Printf("Group %s: generation %d is empty", g.ID, g.generationID)
+		return
+	}
+
+	if _, ok := g.members[g.leaderID]; !ok {
+		g.leaderID = g.order[0]
+	}
+	g.protocolName = g.selectProtocol()
+	g.state = GroupCompletingRebalance
+	c.logger.Printf("Group %s: generation %d with %d members, leader %s, protocol %s",
+		g.ID, g.generationID, len(g.members), g.leaderID, g.protocolName)
+
+	// Members that do not sync within the rebalance timeout are removed
+	c.scheduleRebalanceTimeout(g, g.rebalanceTimeout())
+
+	for _, id := range g.order {
+		member := g.members[id]
+		callback := member.awaitingJoin
+		member.awaitingJoin = nil
+		c.scheduleSessionTimeout(g, member)
+		callback(g.joinResult(member))
+	}
+}
+
+// SyncGroup records the leader's assignment and calls callback with the member's assignment
+// once the leader has sent it
+func (c *GroupCoordinator) SyncGroup(req *SyncGroupRequest, callback func(SyncGroupResult)) {
+	fail := func(errorCode int16) {
+		callback(SyncGroupResult{ErrorCode: errorCode})
+	}
+
+	g := c.group(req.GroupID, false)
+	if g == nil {
+		fail(ErrorCodeUnknownMemberID)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == GroupDead {
+		fail(ErrorCodeCoordinatorNotAvailable)
+		return
+	}
+	member, errorCode := g.validateMember(req.MemberID, req.GroupInstanceID)
+	if errorCode != ErrorCodeNone {
+		fail(errorCode)
+		return
+	}
+	if req.GenerationID != g.generationID {
+		fail(ErrorCodeIllegalGeneration)
+		return
+	}
+	if req.ProtocolType != nil && *req.ProtocolType != g.protocolType ||
+		req.ProtocolName != nil && *req.ProtocolName != g.protocolName {
+		fail(ErrorCodeInconsistentGroupProtocol)
+		return
+	}
+
+	switch g.state {
+	case GroupPreparingRebalance:
+		fail(ErrorCodeRebalanceInProgress)
+	case GroupCompletingRebalance:
+		if member.awaitingSync != nil {
+			member.awaitingSync(SyncGroupResult{ErrorCode: ErrorCodeRebalanceInProgress})
+		}
+		member.awaitingSync = callback
+		c.scheduleSessionTimeout(g, member)
+		if member.ID != g.leaderID {
+			return
+		}
+
+		// Members missing from the leader's assignment get an empty one
+		assignments := make(map[string][]byte, len(req.Assignments))
+		for _, assignment := range req.Assignments {
+			assignments[assignment.MemberID] = assignment.Assignment
+		}
+		for id, m := range g.members {
+			m.Assignment = assignments[id]
+			if m.Assignment == nil {
+				m.Assignment = []byte{}
+			}
+		}
+
+		g.stopRebalanceTimer()
+		g.state = GroupStable
+		c.logger.Printf("Group %s: generation %d is stable", g.ID, g.generationID)
+		for _, id := range g.order {
+			m := g.members[id]
+			if g.protocolType == ConsumerProtocolType {
+				c.logger.Printf("Group %s: member %s assigned [%s]", g.ID, id, formatConsumerAssignment(m.Assignment))
+			}
+			if pending := m.awaitingSync; pending != nil {
+				m.awaitingSync = nil
+				pending(g.syncResult(m))
+			}
+		}
+	case GroupStable:
+		c.scheduleSessionTimeout(g, member)
+		callback(g.syncResult(member))
+	default:
+		fail(ErrorCodeUnknownMemberID)
+	}
+}
+
+// Heartbeat keeps a member's session alive and tells it whether a rebalance is in progress
+func (c *GroupCoordinator) Heartbeat(groupID string, memberID string, groupInstanceID *string, generationID int32) int16 {
+	g := c.group(groupID, false)
+	if g == nil {
+		return ErrorCodeUnknownMemberID
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch g.state {
+	case GroupDead:
+		return ErrorCodeCoordinatorNotAvailable
+	case GroupEmpty:
+		return ErrorCodeUnknownMemberID
+	}
+	member, errorCode := g.validateMember(memberID, groupInstanceID)
+	if errorCode != ErrorCodeNone {
+		return errorCode
+	}
+	if generationID != g.generationID {
+		return ErrorCodeIllegalGeneration
+	}
+
+	c.scheduleSessionTimeout(g, member)
+	if g.state == GroupPreparingRebalance {
+		return ErrorCodeRebalanceInProgress
+	}
+	return ErrorCodeNone
+}
+
+// LeaveGroup removes members from a group, returning a group-level error code and one
+// error code per leaving member
+func (c *GroupCoordinator) LeaveGroup(groupID string, members []LeavingMember) (int16, []int16) {
+	errorCodes := make([]int16, len(members))
+
+	g := c.group(groupID, false)
+	if g == nil {
+		for i := range errorCodes {
+			errorCodes[i] = ErrorCodeUnknownMemberID
+		}
+		return ErrorCodeNone, errorCodes
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == GroupDead {
+		return ErrorCodeCoordinatorNotAvailable, nil
+	}
+	for i, leaving := range members {
+		errorCodes[i] = c.leaveMember(g, leaving)
+	}
+	return ErrorCodeNone, errorCodes
+}
+
+// leaveMember removes one member, identified by member ID or group instance ID
+func (c *GroupCoordinator) leaveMember(g *ConsumerGroup, leaving LeavingMember) int16 {
+	memberID := leaving.MemberID
+	if leaving.GroupInstanceID != nil {
+		id, ok := g.staticMembers[*leaving.GroupInstanceID]
+		if !ok {
+			return ErrorCodeUnknownMemberID
+		}
+		if memberID != "" && memberID != id {
+			return ErrorCodeFencedInstanceID
+		}
+		memberID = id
+	}
+
+	if timer, ok := g.pendingMembers[memberID]; ok {
+		timer.Stop()
+		delete(g.pendingMembers, memberID)
+		c.maybeCompleteJoin(g)
+		return ErrorCodeNone
+	}
+
+	member, ok := g.members[memberID]
+	if !ok {
+		return ErrorCodeUnknownMemberID
+	}
+	c.removeMemberAndUpdateGroup(g, member, fmt.Sprintf("member %s left the group", memberID))
+	return ErrorCodeNone
+}
+
+// CommitOffsets validates the committing member against its group and persists the offsets.
+// Members of the current generation may commit, as may standalone consumers (generation -1)
+// of groups without members. Members of consumer groups commit with their member epoch.
+func (c *GroupCoordinator) CommitOffsets(groupID string, generationID int32, memberID string, groupInstanceID *string, offsets map[TopicPartition]CommittedOffset) int16 {
+	if groupID == "" {
+		return ErrorCodeInvalidGroupID
+	}
+
+	g := c.group(groupID, generationID < 0)
+	if g == nil {
+		return ErrorCodeIllegalGeneration
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if errorCode := c.validateOffsetCommit(g, generationID, memberID, groupInstanceID); errorCode != ErrorCodeNone {
+		return errorCode
+	}
+
+	if err := c.offsetStore.Commit(groupID, offsets); err != nil {
+		c.logger.Printf("Group %s: failed to commit offsets: %v", groupID, err)
+		return ErrorCodeUnknownServerError
+	}
+	for tp, offset := range offsets {
+		g.offsets[tp] = offset
+	}
+	return ErrorCodeNone
+}
+
+// validateOffsetCommit checks that a member may commit offsets for the group. The caller holds g.mu.
+func (c *GroupCoordinator) validateOffsetCommit(g *ConsumerGroup, generationID int32, memberID string, groupInstanceID *string) int16 {
+	switch {
+	case g.state == GroupDead:
+		return ErrorCodeCoordinatorNotAvailable
+	case g.groupType == GroupTypeShare:
+		// Share groups track delivery per record instead of committing offsets
+		return ErrorCodeGroupIDNotFound
+	case generationID < 0 && g.state == GroupEmpty:
+		// Standalone consumers manage their own partitions
+	case g.groupType == GroupTypeConsumer:
+		if errorCode := g.validateConsumerCommit(memberID, generationID); errorCode != ErrorCodeNone {
+			return errorCode
+		}
+	case g.state == GroupCompletingRebalance:
+		// The member's partitions may be about to move
+		return ErrorCodeRebalanceInProgress
+	default:
+		member, errorCode := g.validateMember(memberID, groupInstanceID)
+		if errorCode != ErrorCodeNone {
+			return errorCode
+		}
+		if generationID != g.generationID {
+			return ErrorCodeIllegalGeneration
+		}
+		c.scheduleSessionTimeout(g, member)
+	}
+	return ErrorCodeNone
+}
+
+// CommitTxnOffsets persists offsets committed by a transactional producer on behalf of a group.
+// They become the group's committed offsets only once the transaction commits. Producers that
+// do not pass the member of a consumer (generation -1 without a member ID) are not validated
+// against the group's membership.
+func (c *GroupCoordinator) CommitTxnOffsets(groupID string, producerID int64, producerEpoch int16, generationID int32, memberID string, groupInstanceID *string, offsets map[TopicPartition]CommittedOffset) int16 {
+	if groupID == "" {
+		return ErrorCodeInvalidGroupID
+	}
+
+	g := c.group(groupID, true)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if generationID >= 0 || memberID != "" {
+		if errorCode := c.validateOffsetCommit(g, generationID, memberID, groupInstanceID); errorCode != ErrorCodeNone {
+			return errorCode
+		}
+	} else if g.state == GroupDead {
+		return ErrorCodeCoordinatorNotAvailable
+	} else if g.groupType == GroupTypeShare {
+		return ErrorCodeGroupIDNotFound
+	}
+
+	if err := c.offsetStore.CommitTransactional(groupID, producerID, producerEpoch, offsets); err != nil {
+		c.logger.Printf("Group %s: failed to commit offsets of producer %d: %v", groupID, producerID, err)
+		return ErrorCodeUnknownServerError
+	}
+	for tp, offset := range offsets {
+		g.addPendingTxnOffset(producerID, tp, offset)
+	}
+	return ErrorCodeNone
+}
+
+// CompleteTransaction writes the marker ending a producer's transaction to the offsets log.
+// A committed transaction's offsets become the committed offsets of their groups; an aborted
+// transaction's offsets are dropped.
+func (c *GroupCoordinator) CompleteTransaction(producerID int64, producerEpoch int16, commit bool) error {
+	if err := c.offsetStore.WriteTxnMarker(producerID, producerEpoch, commit); err != nil {
+		return err
+	}
+
+	for _, g := range c.snapshotGroups() {
+		g.mu.Lock()
+		if commit {
+			for tp, offset := range g.pendingTxnOffsets[producerID] {
+				g.offsets[tp] = offset
+			}
+		}
+		delete(g.pendingTxnOffsets, producerID)
+		g.mu.Unlock()
+	}
+	return nil
+}
+
+// addPendingTxnOffset records an offset committed by a producer's ongoing transaction
+func (g *ConsumerGroup) addPendingTxnOffset(producerID int64, tp TopicPartition, offset CommittedOffset) {
+	if g.pendingTxnOffsets[producerID] == nil {
+		g.pendingTxnOffsets[producerID] = make(map[TopicPartition]CommittedOffset)
+	}
+	g.pendingTxnOffsets[producerID][tp] = offset
+}
+
+// PendingTxnPartitions returns the partitions for which a group has offsets committed by
+// transactions that have not completed yet
+func (c *GroupCoordinator) PendingTxnPartitions(groupID string) map[TopicPartition]bool {
+	pending := make(map[TopicPartition]bool)
+
+	g := c.group(groupID, false)
+	if g == nil {
+		return pending
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, offsets := range g.pendingTxnOffsets {
+		for tp := range offsets {
+			pending[tp] = true
+		}
+	}
+	return pending
+}
+
+// FetchOffsets returns a group's committed offsets for the given partitions, or all of them
+// when partitions is nil. Partitions without a committed offset are left out.
+func (c *GroupCoordinator) FetchOffsets(groupID string, partitions []TopicPartition) map[TopicPartition]CommittedOffset {
+	offsets := make(map[TopicPartition]CommittedOffset)
+
+	g := c.group(groupID, false)
+	if g == nil {
+		return offsets
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if partitions == nil {
+		for tp, offset := range g.offsets {
+			offsets[tp] = offset
+		}
+		return offsets
+	}
+	for _, tp := range partitions {
+		if offset, ok := g.offsets[tp]; ok {
+			offsets[tp] = offset
+		}
+	}
+	return offsets
+}
+
+// DeleteTopicOffsets removes every group's committed offsets for a deleted topic
+func (c *GroupCoordinator) DeleteTopicOffsets(topic string) {
+	for _, g := range c.snapshotGroups() {
+		g.mu.Lock()
+		var deleted []TopicPartition
+		for tp := range g.offsets {
+			if tp.Topic == topic {
+				deleted = append(deleted, tp)
+			}
+		}
+		c.deleteOffsets(g, deleted)
+		g.mu.Unlock()
+	}
+}
+
+// runOffsetExpiration periodically expires offsets past their retention until Shutdown
+func (c *GroupCoordinator) runOffsetExpiration() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(time.Duration(c.config.OffsetsRetentionCheckIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.expireOffsets(time.Now())
+		}
+	}
+}
+
+// expireOffsets removes the offsets of empty groups that are past their retention, drops
+// groups left with neither members nor offsets and compacts the offsets log.
+//
+// Offsets of a consumer group expire once the group has been empty for the retention period.
+// Offsets committed by standalone consumers, which never join the group, expire by commit time.
+func (c *GroupCoordinator) expireOffsets(now time.Time) {
+	retention := time.Duration(c.config.OffsetsRetentionMinutes) * time.Minute
+
+	for _, g := range c.snapshotGroups() {
+		g.mu.Lock()
+		if g.state == GroupEmpty {
+			var expired []TopicPartition
+			for tp, offset := range g.offsets {
+				since := time.UnixMilli(offset.CommitTimestamp)
+				if g.protocolType != "" {
+					since = g.emptySince
+				}
+				if now.Sub(since) >= retention {
+					expired = append(expired, tp)
+				}
+			}
+			if c.deleteOffsets(g, expired) && len(expired) > 0 {
+				c.logger.Printf("Group %s: expired %d committed offsets", g.ID, len(expired))
+			}
+
+			if len(g.offsets) == 0 && len(g.pendingMembers) == 0 && len(g.pendingTxnOffsets) == 0 {
+				c.removeGroup(g)
+				c.logger.Printf("Group %s: removed empty group", g.ID)
+			}
+		}
+		g.mu.Unlock()
+	}
+
+	if err := c.offsetStore.MaybeCompact(); err != nil {
+		c.logger.Printf("Failed to compact offsets log: %v", err)
+	}
+}
+
+// deleteOffsets removes committed offsets from a group and the offsets log.
+// It reports whether the offsets were deleted.
+func (c *GroupCoordinator) deleteOffsets(g *ConsumerGroup, partitions []TopicPartition) bool {
+	if len(partitions) == 0 {
+		return true
+	}
+	if err := c.offsetStore.Delete(g.ID, partitions); err != nil {
+		c.logger.Printf("Group %s: failed to delete committed offsets: %v", g.ID, err)
+		return false
+	}
+	for _, tp := range partitions {
+		delete(g.offsets, tp)
+	}
+	return true
+}
+
+// snapshotGroups returns the current groups. Callers lock each group themselves, as the
+// coordinator lock must not be held while waiting for a group lock.
+func (c *GroupCoordinator) snapshotGroups() []*ConsumerGroup {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Collect(maps.Values(c.groups))
+}
+
+// Shutdown stops offset expiration and the coordinator's timers
+func (c *GroupCoordinator) Shutdown() {
+	close(c.stop)
+	<-c.done
+
+	for _, g := range c.snapshotGroups() {
+		g.mu.Lock()
+		g.stopRebalanceTimer()
+		for _, member := range g.members {
+			member.sessionTimer.Stop()
+		}
+		for _, timer := range g.pendingMembers {
+			timer.Stop()
+		}
+		for _, member := range g.consumerMembers {
+			member.stopTimers()
+		}
+		for _, member := range g.shareMembers {
+			member.sessionTimer.Stop()
+		}
+		g.mu.Unlock()
+	}
+}
+
+// fenceMember removes a static member replaced by a newer incarnation
+func (c *GroupCoordinator) fenceMember(g *ConsumerGroup, member *GroupMember) {
+	if member.awaitingJoin != nil {
+		member.awaitingJoin(JoinGroupResult{ErrorCode: ErrorCodeFencedInstanceID, GenerationID: -1, MemberID: member.ID})
+		member.awaitingJoin = nil
+	}
+	if member.awaitingSync != nil {
+		member.awaitingSync(SyncGroupResult{ErrorCode: ErrorCodeFencedInstanceID})
+		member.awaitingSync = nil
+	}
+	g.removeMember(member)
+}
+
+// removeMemberAndUpdateGroup removes a member and rebalances the remaining members
+func (c *GroupCoordinator) removeMemberAndUpdateGroup(g *ConsumerGroup, member *GroupMember, reason string) {
+	if member.awaitingJoin != nil {
+		member.awaitingJoin(JoinGroupResult{ErrorCode: ErrorCodeUnknownMemberID, GenerationID: -1, MemberID: member.ID})
+		member.awaitingJoin = nil
+	}
+	if member.awaitingSync != nil {
+		member.awaitingSync(SyncGroupResult{ErrorCode: ErrorCodeUnknownMemberID})
+		member.awaitingSync = nil
+	}
+	g.removeMember(member)
+
+	switch g.state {
+	case GroupStable, GroupCompletingRebalance:
+		c.prepareRebalance(g, reason)
+	case GroupPreparingRebalance:
+		c.maybeCompleteJoin(g)
+	}
+}
+
+// scheduleSessionTimeout (re)starts a member's session timer.
+// Members waiting for a JoinGroup or SyncGroup response are kept alive.
+func (c *GroupCoordinator) scheduleSessionTimeout(g *ConsumerGroup, member *GroupMember) {
+	if member.sessionTimer != nil {
+		member.sessionTimer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(member.SessionTimeout, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if member.sessionTimer != timer || g.members[member.ID] != member {
+			return
+		}
+		if member.awaitingJoin != nil || member.awaitingSync != nil {
+			c.scheduleSessionTimeout(g, member)
+			return
+		}
+		c.removeMemberAndUpdateGroup(g, member, fmt.Sprintf("session of member %s timed out", member.ID))
+	})
+	member.sessionTimer = timer
+}
+
+// scheduleRebalanceTimeout bounds the current rebalance phase.
+// When it expires the join phase completes without the missing members, and members
+// that did not sync in time are removed.
+func (c *GroupCoordinator) scheduleRebalanceTimeout(g *ConsumerGroup, delay time.Duration) {
+	g.stopRebalanceTimer()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.rebalanceTimer != timer {
+			return
+		}
+		g.rebalanceTimer = nil
+
+		switch g.state {
+		case GroupPreparingRebalance:
+			c.completeJoin(g)
+		case GroupCompletingRebalance:
+			for _, id := range slices.Clone(g.order) {
+				if member := g.members[id]; member.awaitingSync == nil {
+					c.logger.Printf("Group %s: removing member %s which did not sync", g.ID, id)
+					g.removeMember(member)
+				}
+			}
+			c.prepareRebalance(g, "members did not sync in time")
+		}
+	})
+	g.rebalanceTimer = timer
+}
+
+// stopRebalanceTimer cancels the rebalance timer, if any
+func (g *ConsumerGroup) stopRebalanceTimer() {
+	if g.rebalanceTimer != nil {
+		g.rebalanceTimer.Stop()
+		g.rebalanceTimer = nil
+	}
+}
+
+// removeMember drops a member from the group without triggering a rebalance
+func (g *ConsumerGroup) removeMember(member *GroupMember) {
+	if member.sessionTimer != nil {
+		member.sessionTimer.Stop()
+	}
+	delete(g.members, member.ID)
+	g.order = slices.DeleteFunc(g.order, func(id string) bool { return id == member.ID })
+	if member.GroupInstanceID != nil && g.staticMembers[*member.GroupInstanceID] == member.ID {
+		delete(g.staticMembers, *member.GroupInstanceID)
+	}
+	if g.leaderID == member.ID {
+		g.leaderID = ""
+		if len(g.order) > 0 {
+			g.leaderID = g.order[0]
+		}
+	}
+}
+
+// validateMember looks up the member a request comes from
+func (g *ConsumerGroup) validateMember(memberID string, groupInstanceID *string) (*GroupMember, int16) {
+	if groupInstanceID != nil {
+		if id, ok := g.staticMembers[*groupInstanceID]; ok && id != memberID {
+			return nil, ErrorCodeFencedInstanceID
+		}
+	}
+	member, ok := g.members[memberID]
+	if !ok {
+		return nil, ErrorCodeUnknownMemberID
+	}
+	return member, ErrorCodeNone
+}
+
+// supportsProtocols reports whether a member with the given protocols may join the group:
+// it must use the group's protocol type and share at least one protocol with every member
+func (g *ConsumerGroup) supportsProtocols(protocolType string, protocols []GroupProtocol) bool {
+	if len(g.members) == 0 {
+		return true
+	}
+	if protocolType != g.protocolType {
+		return false
+	}
+	candidates := g.candidateProtocols()
+	for _, protocol := range protocols {
+		if candidates[protocol.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// candidateProtocols returns the protocols supported by every member
+func (g *ConsumerGroup) candidateProtocols() map[string]bool {
+	var candidates map[string]bool
+	for _, member := range g.members {
+		supported := make(map[string]bool, len(member.Protocols))
+		for _, protocol := range member.Protocols {
+			if candidates == nil || candidates[protocol.Name] {
+				supported[protocol.Name] = true
+			}
+		}
+		candidates = supported
+	}
+	return candidates
+}
+
+// selectProtocol picks the candidate protocol preferred by most members; each member votes for
+// the first candidate in its own preference order
+func (g *ConsumerGroup) selectProtocol() string {
+	candidates := g.candidateProtocols()
+	votes := make(map[string]int)
+	for _, member := range g.members {
+		for _, protocol := range member.Protocols {
+			if candidates[protocol.Name] {
+				votes[protocol.Name]++
+				break
+			}
+		}
+	}
+
+	// Ties go to the leader's preference
+	selected := ""
+	for _, protocol := range g.members[g.leaderID].Protocols {
+		if votes[protocol.Name] > votes[selected] {
+			selected = protocol.Name
+		}
+	}
+	return selected
+}
+
+// rebalanceTimeout returns the longest rebalance timeout of the members
+func (g *ConsumerGroup) rebalanceTimeout() time.Duration {
+	var timeout time.Duration
+	for _, member := range g.members {
+		timeout = max(timeout, member.RebalanceTimeout)
+	}
+	return timeout
+}
+
+// joinResult builds the JoinGroup response of the current generation for a member
+func (g *ConsumerGroup) joinResult(member *GroupMember) JoinGroupResult {
+	result := JoinGroupResult{
+		ErrorCode:    ErrorCodeNone,
+		GenerationID: g.generationID,
+		ProtocolType: stringPtr(g.protocolType),
+		ProtocolName: stringPtr(g.protocolName),
+		LeaderID:     g.leaderID,
+		MemberID:     member.ID,
+	}
+	if member.ID == g.leaderID {
+		for _, id := range g.order {
+			m := g.members[id]
+			result.Members = append(result.Members, JoinGroupMemberMetadata{
+				MemberID:        m.ID,
+				GroupInstanceID: m.GroupInstanceID,
+				Metadata:        m.metadata(g.protocolName),
+			})
+		}
+	}
+	return result
+}
+
+// syncResult builds the SyncGroup response carrying a member's assignment
+func (g *ConsumerGroup) syncResult(member *GroupMember) SyncGroupResult {
+	return SyncGroupResult{
+		ErrorCode:    ErrorCodeNone,
+		ProtocolType: stringPtr(g.protocolType),
+		ProtocolName: stringPtr(g.protocolName),
+		Assignment:   member.Assignment,
+	}
+}
+
+// metadata returns the member's metadata for a protocol
+func (m *GroupMember) metadata(protocol string) []byte {
+	for _, p := range m.Protocols {
+		if p.Name == protocol {
+			return p.Metadata
+		}
+	}
+	return []byte{}
+}
+
+// sameProtocols reports whether two protocol lists are identical, including their order and metadata
+func sameProtocols(a, b []GroupProtocol) bool {
+	return slices.EqualFunc(a, b, func(x, y GroupProtocol) bool {
+		return x.Name == y.Name && string(x.Metadata) == string(y.Metadata)
+	})
+}
+
+// newMemberID generates a member ID made of prefix and a random UUID
+func newMemberID(prefix string) string {
+	id := make([]byte, UUIDSize)
+	rand.Read(id)
+	return fmt.Sprintf("%s-%x-%x-%x-%x-%x", prefix, id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -14,62 +15,128 @@ type ConnectionHandler struct {
 	conn   net.Conn
 	config *Config
 	logger *log.Logger
+	broker *Broker
 }
 
 // NewConnectionHandler creates a new connection handler
-func NewConnectionHandler(conn net.Conn, config *Config, logger *log.Logger) *ConnectionHandler {
+func NewConnectionHandler(conn net.Conn, config *Config, logger *log.Logger, broker *Broker) *ConnectionHandler {
 	return &ConnectionHandler{
 		conn:   conn,
 		config: config,
 		logger: logger,
+		broker: broker,
 	}
 }
 
-// Handle processes the connection lifecycle
+// maxInFlightRequests bounds how many responses may be pending on one connection
+const maxInFlightRequests = 100
+
+// Handle processes the connection lifecycle.
+//
+// Requests are read and processed in order, but their responses are written by a separate
+// goroutine. A request that is parked (such as a long-poll Fetch) therefore does not stop
+// later requests on the same connection from being processed; responses are still sent
+// in request order, as the protocol requires.
 func (h *ConnectionHandler) Handle(ctx context.Context) error {
 	defer h.conn.Close()
 
 	h.logger.Printf("New connection from %s", h.conn.RemoteAddr())
 
-	// Create a buffer for reading requests
-	buffer := make([]byte, h.config.MaxBufferSize)
+	// Interrupt the wait for the next request once the server shuts down
+	stop := context.AfterFunc(ctx, func() {
+		h.conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
 
-	for {
-		select {
-		case <-ctx.Done():
-			h.logger.Printf("Connection handler shutting down for %s", h.conn.RemoteAddr())
-			return ctx.Err()
-		default:
-		}
+	// Frame reader splits the stream into complete, length-prefixed requests
+	frames := NewFrameReader(h.conn, h.config.MaxBufferSize, h.config.MaxRequestSize)
+
+	// Response slots, queued in request order
+	responses := make(chan chan []byte, maxInFlightRequests)
+	writerDone := make(chan struct{})
+	var writeErr error
+	go func() {
+		defer close(writerDone)
+		writeErr = h.writeResponses(responses)
+	}()
 
-		// Set read deadline
+	err := h.readRequests(ctx, frames, responses, writerDone)
+	close(responses)
+
+	// Wait for pending responses to be flushed
+	<-writerDone
+	if err == nil {
+		err = writeErr
+	}
+	return err
+}
+
+// readRequests reads and processes requests until the connection ends
+func (h *ConnectionHandler) readRequests(ctx context.Context, frames *FrameReader, responses chan<- chan []byte, writerDone <-chan struct{}) error {
+	for {
+		// Set read deadline. Shutdown is checked afterwards, so that a shutdown starting
+		// from here on interrupts the read by moving the deadline.
 		if err := h.conn.SetReadDeadline(time.Now().Add(h.config.ReadTimeout)); err != nil {
 			return fmt.Errorf("failed to set read deadline: %w", err)
 		}
+		if ctx.Err() != nil {
+			h.logger.Printf("Connection handler shutting down for %s", h.conn.RemoteAddr())
+			return nil
+		}
 
-		// Read from connection
-		n, err := h.conn.Read(buffer)
+		// Read the next complete request from the connection
+		frame, err := frames.ReadFrame()
 		if err != nil {
 			if err == io.EOF {
 				h.logger.Printf("Client %s closed connection", h.conn.RemoteAddr())
 				return nil
 			}
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				h.logger.Printf("Read timeout for %s", h.conn.RemoteAddr())
+				if ctx.Err() != nil {
+					h.logger.Printf("Connection handler shutting down for %s", h.conn.RemoteAddr())
+				} else {
+					h.logger.Printf("Read timeout for %s", h.conn.RemoteAddr())
+				}
 				return nil
 			}
+			if errors.Is(err, ErrFrameTooLarge) {
+				// The stream cannot be resynchronised safely, so drop the connection
+				return fmt.Errorf("rejecting request from %s: %w", h.conn.RemoteAddr(), err)
+			}
 			return fmt.Errorf("error reading from connection: %w", err)
 		}
 
-		if n == 0 {
-			continue
+		// Reserve the response slot before processing so responses keep request order
+		slot := make(chan []byte, 1)
+		select {
+		case responses <- slot:
+		case <-writerDone:
+			// The writer failed; Handle reports its error
+			return nil
+		}
+		respond := func(response []byte) {
+			select {
+			case slot <- response:
+			default:
+				// A response was already delivered for this request
+			}
 		}
 
 		// Process the request
-		response, err := h.processRequest(buffer[:n])
-		if err != nil {
+		if err := h.processRequest(frame, respond); err != nil {
 			h.logger.Printf("Error processing request from %s: %v", h.conn.RemoteAddr(), err)
-			// Send error response or continue based on error type
+			respond(nil)
+		}
+	}
+}
+
+// writeResponses writes responses in request order as they become available
+func (h *ConnectionHandler) writeResponses(responses <-chan chan []byte) error {
+	for slot := range responses {
+		response := <-slot
+
+		// Some requests (e.g. Produce with acks=0) expect no response
+		if response == nil {
 			continue
 		}
 
@@ -80,19 +147,24 @@ func (h *ConnectionHandler) Handle(ctx context.Context) error {
 
 		// Send response
 		if _, err := h.conn.Write(response); err != nil {
+			// Unblock the reader so the connection is torn down
+			h.conn.Close()
 			return fmt.Errorf("error writing response: %w", err)
 		}
 
 		h.logger.Printf("Response sent to %s", h.conn.RemoteAddr())
 	}
+	return nil
 }
 
-// processRequest handles a single request and returns the response
-func (h *ConnectionHandler) processRequest(data []byte) ([]byte, error) {
+// processRequest handles a single request and passes its response to respond.
+// Most requests respond before returning; delayed operations such as long-poll
+// fetches respond later from another goroutine. A nil response sends nothing.
+func (h *ConnectionHandler) processRequest(data []byte, respond func([]byte)) error {
 	// Parse the base request to determine API key
 	baseReq, err := ParseApiVersionRequest(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse request: %w", err)
+		return fmt.Errorf("failed to parse request: %w", err)
 	}
 
 	h.logger.Printf("Request: APIKey=%d, Version=%d, CorrelationID=%d, ClientID=%s",
@@ -101,29 +173,204 @@ func (h *ConnectionHandler) processRequest(data []byte) ([]byte, error) {
 	// Route based on API key
 	switch baseReq.APIKey {
 	case APIKeyApiVersions:
-		headerResponse := BuildApiVersionsResponse(baseReq.CorrelationID, baseReq.APIVersion, APIVersionsMinVersion, APIVersionsMaxVersion)
-		return headerResponse, nil
+		respond(BuildApiVersionsResponse(baseReq.CorrelationID, baseReq.APIVersion, APIVersionsMinVersion, APIVersionsMaxVersion))
+	case APIKeyProduce:
+		req, err := ParseProduceRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse produce request: %w", err)
+		}
+		respond(BuildProduceResponse(baseReq, req, h.broker))
 	case APIKeyFetch:
-		req, err := ParseFetchRequest(data)
+		req, err := ParseFetchRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse fetch request: %w", err)
+		}
+		HandleFetch(baseReq, req, h.broker, respond)
+	case APIKeyListOffsets:
+		req, err := ParseListOffsetsRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse list offsets request: %w", err)
+		}
+		respond(BuildListOffsetsResponse(baseReq, req, h.broker))
+	case APIKeyMetadata:
+		req, err := ParseMetadataRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse metadata request: %w", err)
+		}
+		respond(BuildMetadataResponse(baseReq, req, h.broker))
+	case APIKeyOffsetCommit:
+		req, err := ParseOffsetCommitRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse offset commit request: %w", err)
+		}
+		respond(BuildOffsetCommitResponse(baseReq, req, h.broker))
+	case APIKeyOffsetFetch:
+		req, err := ParseOffsetFetchRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse offset fetch request: %w", err)
+		}
+		respond(BuildOffsetFetchResponse(baseReq, req, h.broker))
+	case APIKeyFindCoordinator:
+		req, err := ParseFindCoordinatorRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse find coordinator request: %w", err)
+		}
+		respond(BuildFindCoordinatorResponse(baseReq, req, h.broker))
+	case APIKeyJoinGroup:
+		req, err := ParseJoinGroupRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse join group request: %w", err)
+		}
+		HandleJoinGroup(baseReq, req, h.broker, h.clientHost(), respond)
+	case APIKeyHeartbeat:
+		req, err := ParseHeartbeatRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse heartbeat request: %w", err)
+		}
+		respond(BuildHeartbeatResponse(baseReq, req, h.broker))
+	case APIKeyLeaveGroup:
+		req, err := ParseLeaveGroupRequest(baseReq)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse fetch request: %w", err)
+			return fmt.Errorf("failed to parse leave group request: %w", err)
 		}
-		fetchResponse := BuildFetchResponse(baseReq, req)
-		return fetchResponse, nil
+		respond(BuildLeaveGroupResponse(baseReq, req, h.broker))
+	case APIKeySyncGroup:
+		req, err := ParseSyncGroupRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse sync group request: %w", err)
+		}
+		HandleSyncGroup(baseReq, req, h.broker, respond)
+	case APIKeyDescribeGroups:
+		req, err := ParseDescribeGroupsRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse describe groups request: %w", err)
+		}
+		respond(BuildDescribeGroupsResponse(baseReq, req, h.broker))
+	case APIKeyListGroups:
+		req, err := ParseListGroupsRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse list groups request: %w", err)
+		}
+		respond(BuildListGroupsResponse(baseReq, req, h.broker))
+	case APIKeyCreateTopics:
+		req, err := ParseCreateTopicsRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse create topics request: %w", err)
+		}
+		respond(BuildCreateTopicsResponse(baseReq, req, h.broker))
+	case APIKeyDeleteTopics:
+		req, err := ParseDeleteTopicsRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse delete topics request: %w", err)
+		}
+		respond(BuildDeleteTopicsResponse(baseReq, req, h.broker))
+	case APIKeyInitProducerID:
+		req, err := ParseInitProducerIDRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse init producer id request: %w", err)
+		}
+		respond(BuildInitProducerIDResponse(baseReq, req, h.broker))
+	case APIKeyAddPartitionsToTxn:
+		req, err := ParseAddPartitionsToTxnRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse add partitions to txn request: %w", err)
+		}
+		respond(BuildAddPartitionsToTxnResponse(baseReq, req, h.broker))
+	case APIKeyAddOffsetsToTxn:
+		req, err := ParseAddOffsetsToTxnRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse add offsets to txn request: %w", err)
+		}
+		respond(BuildAddOffsetsToTxnResponse(baseReq, req, h.broker))
+	case APIKeyEndTxn:
+		req, err := ParseEndTxnRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse end txn request: %w", err)
+		}
+		respond(BuildEndTxnResponse(baseReq, req, h.broker))
+	case APIKeyWriteTxnMarkers:
+		req, err := ParseWriteTxnMarkersRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse write txn markers request: %w", err)
+		}
+		respond(BuildWriteTxnMarkersResponse(baseReq, req, h.broker))
+	case APIKeyTxnOffsetCommit:
+		req, err := ParseTxnOffsetCommitRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse txn offset commit request: %w", err)
+		}
+		respond(BuildTxnOffsetCommitResponse(baseReq, req, h.broker))
+	case APIKeyCreatePartitions:
+		req, err := ParseCreatePartitionsRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse create partitions request: %w", err)
+		}
+		respond(BuildCreatePartitionsResponse(baseReq, req, h.broker))
+	case APIKeyDeleteGroups:
+		req, err := ParseDeleteGroupsRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse delete groups request: %w", err)
+		}
+		respond(BuildDeleteGroupsResponse(baseReq, req, h.broker))
+	case APIKeyOffsetDelete:
+		req, err := ParseOffsetDeleteRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse offset delete request: %w", err)
+		}
+		respond(BuildOffsetDeleteResponse(baseReq, req, h.broker))
+	case APIKeyConsumerGroupHeartbeat:
+		req, err := ParseConsumerGroupHeartbeatRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse consumer group heartbeat request: %w", err)
+		}
+		respond(BuildConsumerGroupHeartbeatResponse(baseReq, req, h.broker, h.clientHost()))
+	case APIKeyConsumerGroupDescribe:
+		req, err := ParseConsumerGroupDescribeRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse consumer group describe request: %w", err)
+		}
+		respond(BuildConsumerGroupDescribeResponse(baseReq, req, h.broker))
+	case APIKeyShareGroupHeartbeat:
+		req, err := ParseShareGroupHeartbeatRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse share group heartbeat request: %w", err)
+		}
+		respond(BuildShareGroupHeartbeatResponse(baseReq, req, h.broker, h.clientHost()))
+	case APIKeyShareFetch:
+		req, err := ParseShareFetchRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse share fetch request: %w", err)
+		}
+		HandleShareFetch(baseReq, req, h.broker, respond)
+	case APIKeyShareAcknowledge:
+		req, err := ParseShareAcknowledgeRequest(baseReq)
+		if err != nil {
+			return fmt.Errorf("failed to parse share acknowledge request: %w", err)
+		}
+		respond(BuildShareAcknowledgeResponse(baseReq, req, h.broker))
 	case APIKeyDescribeCluster:
-		headerResponse := BuildApiVersionsResponse(baseReq.CorrelationID, baseReq.APIVersion, DescribeClusterMinVersion, DescribeClusterMaxVersion)
-		return headerResponse, nil
+		respond(BuildApiVersionsResponse(baseReq.CorrelationID, baseReq.APIVersion, DescribeClusterMinVersion, DescribeClusterMaxVersion))
 	case APIKeyDescribeTopicPartitions:
 		req, err := ParseDescribeTopicRequest(baseReq, data)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse describe topic request: %w", err)
+			return fmt.Errorf("failed to parse describe topic request: %w", err)
 		}
-		return BuildDescribeTopicResponse(req, data, h.config), nil
+		respond(BuildDescribeTopicResponse(req, data, h.broker))
 
 	default:
 		h.logger.Printf("Unsupported API key: %d", baseReq.APIKey)
 		// Return minimal error response
-		return []byte{0, 0, 0, 0}, nil
+		respond([]byte{0, 0, 0, 0})
 	}
 
+	return nil
+}
+
+// clientHost returns the client's address in the form Kafka reports it for group members
+func (h *ConnectionHandler) clientHost() string {
+	host, _, err := net.SplitHostPort(h.conn.RemoteAddr().String())
+	if err != nil {
+		host = h.conn.RemoteAddr().String()
+	}
+	return "/" + host
 }
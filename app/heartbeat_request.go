@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+// HeartbeatRequest represents a parsed Heartbeat request
+type HeartbeatRequest struct {
+	GroupID         string
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID *string
+}
+
+// ParseHeartbeatRequest parses the body of a Heartbeat request (v0-v4)
+func ParseHeartbeatRequest(baseReq *SwiftQueueRequest) (*HeartbeatRequest, error) {
+	version := baseReq.APIVersion
+	if version < HeartbeatMinVersion || version > HeartbeatMaxVersion {
+		return nil, fmt.Errorf("unsupported heartbeat version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &HeartbeatRequest{}
+	req.GroupID = d.ReadString(flexible)
+	req.GenerationID = d.ReadInt32()
+	req.MemberID = d.ReadString(flexible)
+	if version >= 3 {
+		req.GroupInstanceID = d.ReadNullableString(flexible)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse heartbeat request: %w", err)
+	}
+
+	return req, nil
+}
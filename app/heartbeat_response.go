@@ -0,0 +1,24 @@
+package main
+
+// BuildHeartbeatResponse refreshes the member's session and builds the response
+func BuildHeartbeatResponse(baseReq *SwiftQueueRequest, req *HeartbeatRequest, broker *Broker) []byte {
+	errorCode := broker.groupCoordinator.Heartbeat(req.GroupID, req.MemberID, req.GroupInstanceID, req.GenerationID)
+
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	if version >= 1 {
+		// Throttle time
+		rb.WriteInt32(0)
+	}
+	rb.WriteInt16(errorCode)
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+// InitProducerIDRequest represents a parsed InitProducerId request
+type InitProducerIDRequest struct {
+	TransactionalID      *string
+	TransactionTimeoutMs int32
+	ProducerID           int64
+	ProducerEpoch        int16
+}
+
+// ParseInitProducerIDRequest parses the body of an InitProducerId request (v0-v5)
+func ParseInitProducerIDRequest(baseReq *SwiftQueueRequest) (*InitProducerIDRequest, error) {
+	version := baseReq.APIVersion
+	if version < InitProducerIDMinVersion || version > InitProducerIDMaxVersion {
+		return nil, fmt.Errorf("unsupported init producer id version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &InitProducerIDRequest{ProducerID: NoProducerID, ProducerEpoch: NoProducerEpoch}
+	req.TransactionalID = d.ReadNullableString(flexible)
+	req.TransactionTimeoutMs = d.ReadInt32()
+	if version >= 3 {
+		req.ProducerID = d.ReadInt64()
+		req.ProducerEpoch = d.ReadInt16()
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse init producer id request: %w", err)
+	}
+
+	return req, nil
+}
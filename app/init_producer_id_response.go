@@ -0,0 +1,41 @@
+package main
+
+// initProducerIDFencedVersion is the first InitProducerId version answered with PRODUCER_FENCED
+const initProducerIDFencedVersion = 4
+
+// BuildInitProducerIDResponse allocates a producer ID and builds the response.
+// Idempotent producers always get a new producer ID at epoch 0, even when they pass their
+// current one. Producers with a transactional ID are assigned by the transaction coordinator.
+func BuildInitProducerIDResponse(baseReq *SwiftQueueRequest, req *InitProducerIDRequest, broker *Broker) []byte {
+	errorCode := int16(ErrorCodeNone)
+	producerID, producerEpoch := int64(NoProducerID), int16(NoProducerEpoch)
+
+	if req.TransactionalID != nil && *req.TransactionalID == "" {
+		errorCode = ErrorCodeInvalidRequest
+	} else if req.TransactionalID != nil {
+		producerID, producerEpoch, errorCode = broker.transactionCoordinator.InitProducerID(*req.TransactionalID,
+			req.TransactionTimeoutMs, req.ProducerID, req.ProducerEpoch, baseReq.APIVersion >= initProducerIDFencedVersion)
+	} else if id, err := broker.producerIDs.GenerateProducerID(); err != nil {
+		broker.logger.Printf("InitProducerId: %v", err)
+		errorCode = ErrorCodeCoordinatorNotAvailable
+	} else {
+		producerID, producerEpoch = id, 0
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, baseReq.APIVersion)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Throttle time
+	rb.WriteInt32(0)
+	rb.WriteInt16(errorCode)
+	rb.WriteInt64(producerID)
+	rb.WriteInt16(producerEpoch)
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
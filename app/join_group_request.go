@@ -0,0 +1,60 @@
+package main
+
+import "fmt"
+
+// JoinGroupRequest represents a parsed JoinGroup request
+type JoinGroupRequest struct {
+	GroupID            string
+	SessionTimeoutMs   int32
+	RebalanceTimeoutMs int32
+	MemberID           string
+	GroupInstanceID    *string
+	ProtocolType       string
+	Protocols          []GroupProtocol
+	Reason             *string
+}
+
+// ParseJoinGroupRequest parses the body of a JoinGroup request (v0-v9)
+func ParseJoinGroupRequest(baseReq *SwiftQueueRequest) (*JoinGroupRequest, error) {
+	version := baseReq.APIVersion
+	if version < JoinGroupMinVersion || version > JoinGroupMaxVersion {
+		return nil, fmt.Errorf("unsupported join group version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &JoinGroupRequest{}
+	req.GroupID = d.ReadString(flexible)
+	req.SessionTimeoutMs = d.ReadInt32()
+	// Version 0 has no separate rebalance timeout
+	req.RebalanceTimeoutMs = req.SessionTimeoutMs
+	if version >= 1 {
+		req.RebalanceTimeoutMs = d.ReadInt32()
+	}
+	req.MemberID = d.ReadString(flexible)
+	if version >= 5 {
+		req.GroupInstanceID = d.ReadNullableString(flexible)
+	}
+	req.ProtocolType = d.ReadString(flexible)
+
+	protocolCount := d.ReadArrayLength(flexible)
+	for i := 0; i < protocolCount && d.Err() == nil; i++ {
+		protocol := GroupProtocol{}
+		protocol.Name = d.ReadString(flexible)
+		protocol.Metadata = d.ReadBytes(flexible)
+		d.SkipTaggedFields(flexible)
+		req.Protocols = append(req.Protocols, protocol)
+	}
+
+	if version >= 8 {
+		req.Reason = d.ReadNullableString(flexible)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse join group request: %w", err)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+// HandleJoinGroup passes a JoinGroup request to the group coordinator and responds once
+// the member has joined, which may be after the group has waited for its other members
+func HandleJoinGroup(baseReq *SwiftQueueRequest, req *JoinGroupRequest, broker *Broker, clientHost string, respond func([]byte)) {
+	broker.groupCoordinator.JoinGroup(baseReq.APIVersion, baseReq.ClientID, clientHost, req, func(result JoinGroupResult) {
+		respond(encodeJoinGroupResponse(baseReq, result))
+	})
+}
+
+// encodeJoinGroupResponse serializes the JoinGroup response for the request's version
+func encodeJoinGroupResponse(baseReq *SwiftQueueRequest, result JoinGroupResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	if version >= 2 {
+		// Throttle time
+		rb.WriteInt32(0)
+	}
+	rb.WriteInt16(result.ErrorCode)
+	rb.WriteInt32(result.GenerationID)
+	if version >= 7 {
+		rb.WriteNullableString(result.ProtocolType, flexible)
+		rb.WriteNullableString(result.ProtocolName, flexible)
+	} else {
+		protocolName := ""
+		if result.ProtocolName != nil {
+			protocolName = *result.ProtocolName
+		}
+		rb.WriteStringField(protocolName, flexible)
+	}
+	rb.WriteStringField(result.LeaderID, flexible)
+	if version >= 9 {
+		// Skip assignment (the leader always computes the assignment)
+		rb.WriteBool(false)
+	}
+	rb.WriteStringField(result.MemberID, flexible)
+
+	rb.WriteArrayLength(len(result.Members), flexible)
+	for _, member := range result.Members {
+		rb.WriteStringField(member.MemberID, flexible)
+		if version >= 5 {
+			rb.WriteNullableString(member.GroupInstanceID, flexible)
+		}
+		rb.WriteBytesField(member.Metadata, flexible)
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
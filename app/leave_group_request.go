@@ -0,0 +1,54 @@
+package main
+
+import "fmt"
+
+// LeaveGroupRequest represents a parsed LeaveGroup request.
+// Versions before 3 name a single member; later versions batch members.
+type LeaveGroupRequest struct {
+	GroupID string
+	Members []LeavingMember
+}
+
+// LeavingMember identifies a member leaving its group by member ID or group instance ID
+type LeavingMember struct {
+	MemberID        string
+	GroupInstanceID *string
+	Reason          *string
+}
+
+// ParseLeaveGroupRequest parses the body of a LeaveGroup request (v0-v5)
+func ParseLeaveGroupRequest(baseReq *SwiftQueueRequest) (*LeaveGroupRequest, error) {
+	version := baseReq.APIVersion
+	if version < LeaveGroupMinVersion || version > LeaveGroupMaxVersion {
+		return nil, fmt.Errorf("unsupported leave group version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &LeaveGroupRequest{}
+	req.GroupID = d.ReadString(flexible)
+
+	if version < 3 {
+		req.Members = []LeavingMember{{MemberID: d.ReadString(flexible)}}
+	} else {
+		memberCount := d.ReadArrayLength(flexible)
+		for i := 0; i < memberCount && d.Err() == nil; i++ {
+			member := LeavingMember{}
+			member.MemberID = d.ReadString(flexible)
+			member.GroupInstanceID = d.ReadNullableString(flexible)
+			if version >= 5 {
+				member.Reason = d.ReadNullableString(flexible)
+			}
+			d.SkipTaggedFields(flexible)
+			req.Members = append(req.Members, member)
+		}
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse leave group request: %w", err)
+	}
+
+	return req, nil
+}
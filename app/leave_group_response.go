@@ -0,0 +1,40 @@
+package main
+
+// BuildLeaveGroupResponse removes the leaving members from their group and builds the response
+func BuildLeaveGroupResponse(baseReq *SwiftQueueRequest, req *LeaveGroupRequest, broker *Broker) []byte {
+	errorCode, memberErrors := broker.groupCoordinator.LeaveGroup(req.GroupID, req.Members)
+
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	if version >= 1 {
+		// Throttle time
+		rb.WriteInt32(0)
+	}
+
+	if version < 3 {
+		// The single member's error is the response error
+		if errorCode == ErrorCodeNone && len(memberErrors) > 0 {
+			errorCode = memberErrors[0]
+		}
+		rb.WriteInt16(errorCode)
+	} else {
+		rb.WriteInt16(errorCode)
+		rb.WriteArrayLength(len(memberErrors), flexible)
+		for i, memberError := range memberErrors {
+			rb.WriteStringField(req.Members[i].MemberID, flexible)
+			rb.WriteNullableString(req.Members[i].GroupInstanceID, flexible)
+			rb.WriteInt16(memberError)
+			rb.WriteTaggedFields(flexible)
+		}
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
@@ -0,0 +1,36 @@
+package main
+
+import "fmt"
+
+// ListGroupsRequest represents a parsed ListGroups request.
+// Empty filters match every group.
+type ListGroupsRequest struct {
+	StatesFilter []string
+	TypesFilter  []string
+}
+
+// ParseListGroupsRequest parses the body of a ListGroups request (v0-v5)
+func ParseListGroupsRequest(baseReq *SwiftQueueRequest) (*ListGroupsRequest, error) {
+	version := baseReq.APIVersion
+	if version < ListGroupsMinVersion || version > ListGroupsMaxVersion {
+		return nil, fmt.Errorf("unsupported list groups version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &ListGroupsRequest{}
+	if version >= 4 {
+		req.StatesFilter = d.ReadStringArray(flexible)
+	}
+	if version >= 5 {
+		req.TypesFilter = d.ReadStringArray(flexible)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse list groups request: %w", err)
+	}
+
+	return req, nil
+}
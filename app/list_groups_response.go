@@ -0,0 +1,58 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// BuildListGroupsResponse lists the groups matching the request's filters and builds the response
+func BuildListGroupsResponse(baseReq *SwiftQueueRequest, req *ListGroupsRequest, broker *Broker) []byte {
+	var groups []GroupListing
+	for _, group := range broker.groupCoordinator.ListGroups() {
+		if matchesGroupFilter(req.StatesFilter, group.State) && matchesGroupFilter(req.TypesFilter, group.Type) {
+			groups = append(groups, group)
+		}
+	}
+	return encodeListGroupsResponse(baseReq, groups)
+}
+
+// matchesGroupFilter reports whether value matches a case-insensitive filter; an empty filter matches everything
+func matchesGroupFilter(filter []string, value string) bool {
+	return len(filter) == 0 || slices.ContainsFunc(filter, func(f string) bool {
+		return strings.EqualFold(f, value)
+	})
+}
+
+// encodeListGroupsResponse serializes the ListGroups response for the request's version
+func encodeListGroupsResponse(baseReq *SwiftQueueRequest, groups []GroupListing) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	if version >= 1 {
+		// Throttle time
+		rb.WriteInt32(0)
+	}
+	rb.WriteInt16(ErrorCodeNone)
+
+	rb.WriteArrayLength(len(groups), flexible)
+	for _, group := range groups {
+		rb.WriteStringField(group.GroupID, flexible)
+		rb.WriteStringField(group.ProtocolType, flexible)
+		if version >= 4 {
+			rb.WriteStringField(group.State, flexible)
+		}
+		if version >= 5 {
+			rb.WriteStringField(group.Type, flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
@@ -0,0 +1,90 @@
+package main
+
+import "fmt"
+
+// Special ListOffsets timestamps
+const (
+	// ListOffsetsLatestTimestamp asks for the offset of the next record to be written
+	ListOffsetsLatestTimestamp = -1
+	// ListOffsetsEarliestTimestamp asks for the log start offset
+	ListOffsetsEarliestTimestamp = -2
+	// ListOffsetsMaxTimestamp asks for the offset of the record with the largest timestamp
+	ListOffsetsMaxTimestamp = -3
+	// ListOffsetsEarliestLocalTimestamp asks for the first offset held locally
+	ListOffsetsEarliestLocalTimestamp = -4
+	// ListOffsetsLatestTieredTimestamp asks for the last offset moved to tiered storage
+	ListOffsetsLatestTieredTimestamp = -5
+)
+
+// ListOffsetsRequest represents a parsed ListOffsets request
+type ListOffsetsRequest struct {
+	ReplicaID      int32
+	IsolationLevel int
+	Topics         []ListOffsetsTopic
+	TimeoutMs      int32
+}
+
+// ListOffsetsTopic lists the partitions to look up for one topic
+type ListOffsetsTopic struct {
+	Name       string
+	Partitions []ListOffsetsPartition
+}
+
+// ListOffsetsPartition asks for the offset matching Timestamp in a single partition
+type ListOffsetsPartition struct {
+	Index              int32
+	CurrentLeaderEpoch int32
+	Timestamp          int64
+}
+
+// ParseListOffsetsRequest parses the body of a ListOffsets request (v1-v10)
+func ParseListOffsetsRequest(baseReq *SwiftQueueRequest) (*ListOffsetsRequest, error) {
+	version := baseReq.APIVersion
+	if version < ListOffsetsMinVersion || version > ListOffsetsMaxVersion {
+		return nil, fmt.Errorf("unsupported list offsets version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &ListOffsetsRequest{
+		IsolationLevel: IsolationReadUncommitted,
+	}
+
+	req.ReplicaID = d.ReadInt32()
+	if version >= 2 {
+		req.IsolationLevel = int(d.ReadInt8())
+	}
+
+	topicCount := d.ReadArrayLength(flexible)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := ListOffsetsTopic{Name: d.ReadString(flexible)}
+
+		partitionCount := d.ReadArrayLength(flexible)
+		for j := 0; j < partitionCount && d.Err() == nil; j++ {
+			partition := ListOffsetsPartition{CurrentLeaderEpoch: -1}
+			partition.Index = d.ReadInt32()
+			if version >= 4 {
+				partition.CurrentLeaderEpoch = d.ReadInt32()
+			}
+			partition.Timestamp = d.ReadInt64()
+			d.SkipTaggedFields(flexible)
+
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+		d.SkipTaggedFields(flexible)
+
+		req.Topics = append(req.Topics, topic)
+	}
+
+	if version >= 10 {
+		req.TimeoutMs = d.ReadInt32()
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse list offsets request: %w", err)
+	}
+
+	return req, nil
+}
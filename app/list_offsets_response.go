@@ -0,0 +1,152 @@
+package main
+
+// ListOffsetsTopicResult holds the partition results for one topic of a ListOffsets response
+type ListOffsetsTopicResult struct {
+	Name       string
+	Partitions []ListOffsetsPartitionResult
+}
+
+// ListOffsetsPartitionResult is the offset found for one partition
+type ListOffsetsPartitionResult struct {
+	Index       int32
+	ErrorCode   int16
+	Timestamp   int64
+	Offset      int64
+	LeaderEpoch int32
+}
+
+// BuildListOffsetsResponse resolves each requested timestamp to an offset and builds the response
+func BuildListOffsetsResponse(baseReq *SwiftQueueRequest, req *ListOffsetsRequest, broker *Broker) []byte {
+	topics, partitions := broker.TopicsAndPartitions()
+
+	results := make([]ListOffsetsTopicResult, 0, len(req.Topics))
+	for _, requestTopic := range req.Topics {
+		topicResult := ListOffsetsTopicResult{Name: requestTopic.Name}
+		topic := findTopicByName(topics, requestTopic.Name)
+
+		for _, requestPartition := range requestTopic.Partitions {
+			var result ListOffsetsPartitionResult
+			partition := findPartition(partitions, topic, requestPartition.Index)
+			if partition == nil {
+				result = listOffsetsError(requestPartition.Index, ErrorCodeUnknownTopicOrPart)
+			} else {
+				result = listPartitionOffset(broker, topic.Name, partition, req.IsolationLevel, requestPartition)
+			}
+			topicResult.Partitions = append(topicResult.Partitions, result)
+		}
+
+		results = append(results, topicResult)
+	}
+
+	return encodeListOffsetsResponse(baseReq, results)
+}
+
+// findPartition returns the partition of topic with the given index, or nil if there is none
+func findPartition(partitions []Partition, topic *Topic, index int32) *Partition {
+	if topic == nil {
+		return nil
+	}
+	for _, partition := range filterPartitionsByTopicUUID(partitions, topic.UUID) {
+		if int32(partition.ID) == index {
+			return &partition
+		}
+	}
+	return nil
+}
+
+// listPartitionOffset looks up the offset for a timestamp or sentinel in a single partition log.
+// Consumers reading committed records are given the last stable offset as the latest offset.
+func listPartitionOffset(broker *Broker, topicName string, partition *Partition, isolationLevel int, requestPartition ListOffsetsPartition) ListOffsetsPartitionResult {
+	tp := TopicPartition{Topic: topicName, Partition: requestPartition.Index}
+	partitionLog, err := broker.logManager.GetOrCreateLog(tp)
+	if err != nil {
+		broker.logger.Printf("ListOffsets: failed to open log for %s: %v", tp, err)
+		return listOffsetsError(requestPartition.Index, ErrorCodeStorageError)
+	}
+
+	result := ListOffsetsPartitionResult{
+		Index:       requestPartition.Index,
+		ErrorCode:   ErrorCodeNone,
+		Timestamp:   -1,
+		Offset:      -1,
+		LeaderEpoch: int32(partition.LeaderEpoch),
+	}
+
+	var offset, timestamp int64
+	var found bool
+	switch requestPartition.Timestamp {
+	case ListOffsetsEarliestTimestamp, ListOffsetsEarliestLocalTimestamp:
+		// All data is local, so the earliest local offset is the log start offset
+		result.Offset = partitionLog.LogStartOffset()
+	case ListOffsetsLatestTimestamp:
+		result.Offset = partitionLog.LogEndOffset()
+		if isolationLevel == IsolationReadCommitted {
+			result.Offset = partitionLog.LastStableOffset()
+		}
+	case ListOffsetsLatestTieredTimestamp:
+		// Nothing is tiered, so there is no such offset
+	case ListOffsetsMaxTimestamp:
+		offset, timestamp, found, err = partitionLog.MaxTimestampOffset()
+	default:
+		offset, timestamp, found, err = partitionLog.OffsetForTimestamp(requestPartition.Timestamp)
+	}
+	if err != nil {
+		broker.logger.Printf("ListOffsets: failed to search %s: %v", tp, err)
+		return listOffsetsError(requestPartition.Index, ErrorCodeStorageError)
+	}
+	if found {
+		result.Offset = offset
+		result.Timestamp = timestamp
+	}
+
+	return result
+}
+
+// listOffsetsError builds a failed partition result
+func listOffsetsError(index int32, errorCode int16) ListOffsetsPartitionResult {
+	return ListOffsetsPartitionResult{
+		Index:       index,
+		ErrorCode:   errorCode,
+		Timestamp:   -1,
+		Offset:      -1,
+		LeaderEpoch: -1,
+	}
+}
+
+// encodeListOffsetsResponse serializes the ListOffsets response for the request's version
+func encodeListOffsetsResponse(baseReq *SwiftQueueRequest, results []ListOffsetsTopicResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	if version >= 2 {
+		// Throttle time
+		rb.WriteInt32(0)
+	}
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, topic := range results {
+		rb.WriteStringField(topic.Name, flexible)
+
+		rb.WriteArrayLength(len(topic.Partitions), flexible)
+		for _, partition := range topic.Partitions {
+			rb.WriteInt32(partition.Index)
+			rb.WriteInt16(partition.ErrorCode)
+			rb.WriteInt64(partition.Timestamp)
+			rb.WriteInt64(partition.Offset)
+			if version >= 4 {
+				rb.WriteInt32(partition.LeaderEpoch)
+			}
+			rb.WriteTaggedFields(flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CleanerCheckpointFile is the file in the data directory recording how far each log is compacted
+const CleanerCheckpointFile = "cleaner-offset-checkpoint"
+
+// Directories holding a compacted segment in a partition directory: it is written to the
+// cleaned directory, which is then renamed to "<end offset>.swap" once complete. A swap
+// directory replaces the segments from its segment's base offset up to the end offset.
+const (
+	cleanedDirName = ".cleaned"
+	swapDirSuffix  = ".swap"
+)
+
+// cleanerWriteBytes bounds the batches buffered before they are written to a compacted segment
+const cleanerWriteBytes = 1 << 20
+
+// CleanResult describes one compaction of a log
+type CleanResult struct {
+	// Segments is the number of segments rewritten
+	Segments       int
+	BytesBefore    int64
+	BytesAfter     int64
+	RecordsRemoved int
+	// FirstDirtyOffset is the offset from which the log has not been compacted yet
+	FirstDirtyOffset int64
+}
+
+// compaction is a planned compaction of the oldest segments of a log
+type compaction struct {
+	config LogConfig
+	// segments are the segments to rewrite, each followed by the next one or by end
+	segments []*LogSegment
+	// firstDirty is the first offset not yet compacted; records from it on are mapped by key
+	firstDirty int64
+	// end is the base offset of the first segment left alone
+	end int64
+	// aborted holds the aborted transactions among the segments, whose records are removed
+	aborted []AbortedTxn
+}
+
+// Compact compacts a log with the compact cleanup policy, keeping only the last record of each
+// key. The segments from firstDirtyOffset on are scanned for the latest offset of every key,
+// then every segment but the active one is rewritten without the records superseded by a later
+// record of their key, tombstones older than delete.retention.ms, and records of aborted
+// transactions. Only segments entirely below the last stable offset are compacted, and only
+// once the dirty segments make up min.cleanable.dirty.ratio of them.
+//
+// Offsets are preserved: a batch keeps its header, base offset and sequence numbers even if
+// records are removed from it, and batches of producers are kept even when left empty so that
+// the producer state can still be replayed. Compressed batches are recompressed with their codec;
+// control batches, and batches whose codec is not registered, are kept as they are. Consecutive
+// segments are merged as long as they fit in segment.bytes.
+func (l *PartitionLog) Compact(firstDirtyOffset int64, now int64) (CleanResult, error) {
+	l.cleanMu.Lock()
+	defer l.cleanMu.Unlock()
+
+	plan, ok := l.planCompaction(firstDirtyOffset)
+	if !ok {
+		return CleanResult{FirstDirtyOffset: plan.firstDirty}, nil
+	}
+
+	offsets, err := plan.buildOffsetMap()
+	if err != nil {
+		return CleanResult{FirstDirtyOffset: plan.firstDirty}, err
+	}
+
+	result := CleanResult{FirstDirtyOffset: plan.firstDirty}
+	for i, group := range plan.groups() {
+		end := plan.end
+		if next := i + len(group); next < len(plan.segments) {
+			end = plan.segments[next].baseOffset
+		}
+		if err := l.compactGroup(plan, group, end, offsets, now, &result); err != nil {
+			return result, err
+		}
+	}
+	result.FirstDirtyOffset = plan.end
+	return result, nil
+}
+
+// planCompaction selects the segments to compact. ok is false when the log is not compacted or
+// not dirty enough; plan.firstDirty is then the valid first dirty offset.
+func (l *PartitionLog) planCompaction(firstDirtyOffset int64) (plan compaction, ok bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	plan.config = l.config
+	plan.firstDirty = firstDirtyOffset
+	if plan.firstDirty < l.logStartOffset || plan.firstDirty > l.nextOffset {
+		// The log lost segments to retention, or was deleted and re-created
+		plan.firstDirty = l.logStartOffset
+	}
+	if l.closed || !l.config.HasCleanupPolicy(CleanupPolicyCompact) {
+		return plan, false
+	}
+
+	lastStableOffset := l.lastStableOffset()
+	cleanBytes, dirtyBytes := int64(0), int64(0)
+	for i := 0; i < len(l.segments)-1 && l.segments[i+1].baseOffset <= lastStableOffset; i++ {
+		segment := l.segments[i]
+		plan.segments = append(plan.segments, segment)
+		plan.end = l.segments[i+1].baseOffset
+		if plan.end <= plan.firstDirty {
+			cleanBytes += segment.size
+		} else {
+			dirtyBytes += segment.size
+		}
+	}
+	if dirtyBytes == 0 || float64(dirtyBytes)/float64(cleanBytes+dirtyBytes) < l.config.MinCleanableDirtyRatio {
+		return plan, false
+	}
+
+	plan.aborted = l.collectAborted(plan.segments[0].baseOffset, plan.end)
+	return plan, true
+}
+
+// groups splits the segments into runs that are merged into one segment each: consecutive
+// segments whose combined size fits in segment.bytes and whose offsets fit in its indexes
+func (c *compaction) groups() [][]*LogSegment {
+	var groups [][]*LogSegment
+	start, size := 0, int64(0)
+	for i, segment := range c.segments {
+		if i > start && (size+segment.size > c.config.SegmentBytes || segment.nextOffset-c.segments[start].baseOffset > 1<<31-1) {
+			groups = append(groups, c.segments[start:i])
+			start, size = i, 0
+		}
+		size += segment.size
+	}
+	return append(groups, c.segments[start:])
+}
+
+// buildOffsetMap returns the offset of the last record of each key in the dirty segments
+func (c *compaction) buildOffsetMap() (map[string]int64, error) {
+	offsets := make(map[string]int64)
+	for i, segment := range c.segments {
+		if end := c.segmentEnd(i); end <= c.firstDirty {
+			continue
+		}
+		err := segment.forEachBatchHeader(0, func(header *RecordBatch, position int64) error {
+			if header.IsControl() || !compressionSupported(header.CompressionType()) || c.isAborted(header) {
+				return nil
+			}
+			batch, err := segment.readBatchAt(position, header)
+			if err != nil {
+				return err
+			}
+			records, err := batch.Records()
+			if err != nil {
+				return err
+			}
+			for _, record := range records {
+				if record.Key != nil {
+					offsets[string(record.Key)] = batch.BaseOffset + int64(record.OffsetDelta)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to map keys of %s: %w", segment.path(), err)
+		}
+	}
+	return offsets, nil
+}
+
+// segmentEnd returns the offset following the i-th segment to compact
+func (c *compaction) segmentEnd(i int) int64 {
+	if i+1 < len(c.segments) {
+		return c.segments[i+1].baseOffset
+	}
+	return c.end
+}
+
+// isAborted reports whether a batch holds records of an aborted transaction
+func (c *compaction) isAborted(batch *RecordBatch) bool {
+	if !batch.IsTransactional() || batch.IsControl() {
+		return false
+	}
+	for _, txn := range c.aborted {
+		if txn.ProducerID == batch.ProducerID && txn.FirstOffset <= batch.BaseOffset && batch.BaseOffset < txn.LastOffset {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanBatch returns what compaction keeps of a batch, or nil when nothing is left of it,
+// along with the number of records removed
+func (c *compaction) cleanBatch(batch *RecordBatch, offsets map[string]int64, now int64) (*RecordBatch, int, error) {
+	if batch.IsControl() || !compressionSupported(batch.CompressionType()) {
+		return batch, 0, nil
+	}
+
+	var kept []Record
+	if !c.isAborted(batch) {
+		records, err := batch.Records()
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, record := range records {
+			if c.keep(batch, record, offsets, now) {
+				kept = append(kept, record)
+			}
+		}
+		if len(kept) == len(records) {
+			return batch, 0, nil
+		}
+	}
+
+	removed := int(batch.RecordCount) - len(kept)
+	if len(kept) == 0 && batch.ProducerID == NoProducerID {
+		return nil, removed, nil
+	}
+	cleaned, err := batch.WithRecords(kept)
+	if err != nil {
+		return nil, 0, err
+	}
+	return cleaned, removed, nil
+}
+
+// keep reports whether a record survives compaction: it has no key, or is the last record of
+// its key and not a tombstone past delete.retention.ms
+func (c *compaction) keep(batch *RecordBatch, record Record, offsets map[string]int64, now int64) bool {
+	if record.Key == nil {
+		return true
+	}
+	offset := batch.BaseOffset + int64(record.OffsetDelta)
+	if latest, ok := offsets[string(record.Key)]; ok && offset < latest {
+		return false
+	}
+	return record.Value != nil || now-batch.RecordTimestamp(record) <= c.config.DeleteRetentionMs
+}
+
+// compactGroup writes the compacted copy of a run of segments to the cleaned directory and
+// swaps it in for them. The run is followed by the segment starting at end.
+func (l *PartitionLog) compactGroup(plan compaction, group []*LogSegment, end int64, offsets map[string]int64, now int64, result *CleanResult) error {
+	cleanedDir := filepath.Join(l.dir, cleanedDirName)
+	if err := os.RemoveAll(cleanedDir); err != nil {
+		return fmt.Errorf("failed to clear %s: %w", cleanedDir, err)
+	}
+	if err := os.Mkdir(cleanedDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", cleanedDir, err)
+	}
+
+	cleaned, err := l.writeCleanedSegment(cleanedDir, plan, group, offsets, now, result)
+	if err != nil {
+		os.RemoveAll(cleanedDir)
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		cleaned.close()
+		os.RemoveAll(cleanedDir)
+		return errLogClosed
+	}
+
+	// The rename commits the compaction: from here on startup completes the swap
+	swapDir := filepath.Join(l.dir, fmt.Sprintf("%020d%s", end, swapDirSuffix))
+	if err := os.Rename(cleanedDir, swapDir); err != nil {
+		cleaned.close()
+		os.RemoveAll(cleanedDir)
+		return fmt.Errorf("failed to commit compacted segment: %w", err)
+	}
+	// Open files follow the renames, so the cleaned segment stays usable in its new place and
+	// the old segments stay readable until closed. If the swap fails, the old segments keep
+	// serving the log and the swap is completed at the next startup.
+	if _, err := swapInSegments(swapDir, l.dir, end); err != nil {
+		cleaned.close()
+		return err
+	}
+	cleaned.dir = l.dir
+	for _, segment := range group {
+		segment.close()
+	}
+
+	first := slices.Index(l.segments, group[0])
+	l.segments = slices.Replace(l.segments, first, first+len(group), cleaned)
+
+	result.Segments += len(group)
+	for _, segment := range group {
+		result.BytesBefore += segment.size
+	}
+	result.BytesAfter += cleaned.size
+	return nil
+}
+
+// writeCleanedSegment writes what compaction keeps of a run of segments to a new segment in
+// dir, with the aborted transactions indexed by the original segments
+func (l *PartitionLog) writeCleanedSegment(dir string, plan compaction, group []*LogSegment, offsets map[string]int64, now int64, result *CleanResult) (*LogSegment, error) {
+	cleaned, err := OpenLogSegment(dir, group[0].baseOffset, plan.config.IndexIntervalBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, 0)
+	var batches []*RecordBatch
+	flush := func() error {
+		if len(batches) == 0 {
+			return nil
+		}
+		if err := cleaned.append(buffer, batches); err != nil {
+			return fmt.Errorf("failed to write compacted segment: %w", err)
+		}
+		buffer, batches = buffer[:0], batches[:0]
+		return nil
+	}
+
+	for _, segment := range group {
+		err := segment.forEachBatchHeader(0, func(header *RecordBatch, position int64) error {
+			batch, err := segment.readBatchAt(position, header)
+			if err != nil {
+				return err
+			}
+			kept, removed, err := plan.cleanBatch(batch, offsets, now)
+			if err != nil {
+				return err
+			}
+			result.RecordsRemoved += removed
+			if kept == nil {
+				return nil
+			}
+			buffer = append(buffer, kept.Raw...)
+			batches = append(batches, kept)
+			if len(buffer) >= cleanerWriteBytes {
+				return flush()
+			}
+			return nil
+		})
+		if err == nil {
+			err = flush()
+		}
+		for _, txn := range segment.txnIndex.entries {
+			if err == nil {
+				err = cleaned.txnIndex.Append(txn)
+			}
+		}
+		if err != nil {
+			cleaned.close()
+			return nil, fmt.Errorf("failed to compact %s: %w", segment.path(), err)
+		}
+	}
+
+	if err := cleaned.flush(); err != nil {
+		cleaned.close()
+		return nil, fmt.Errorf("failed to sync compacted segment: %w", err)
+	}
+	return cleaned, nil
+}
+
+// swapInSegments replaces the segments of dir from the base offset of the segment in swapDir
+// up to end with that segment, then removes swapDir. It returns the segment's base offset.
+func swapInSegments(swapDir string, dir string, end int64) (int64, error) {
+	cleaned, err := listSegmentBaseOffsets(swapDir)
+	if err != nil {
+		return 0, err
+	}
+	if len(cleaned) != 1 {
+		return 0, fmt.Errorf("swap directory %s holds %d segments", swapDir, len(cleaned))
+	}
+	baseOffset := cleaned[0]
+
+	existing, err := listSegmentBaseOffsets(dir)
+	if err != nil {
+		return 0, err
+	}
+	for _, existingOffset := range existing {
+		if existingOffset >= baseOffset && existingOffset < end {
+			if err := removeSegmentFiles(dir, existingOffset); err != nil {
+				return 0, fmt.Errorf("failed to remove compacted segment: %w", err)
+			}
+		}
+	}
+	for _, name := range segmentFileNames(baseOffset) {
+		if err := os.Rename(filepath.Join(swapDir, name), filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("failed to swap in compacted segment: %w", err)
+		}
+	}
+	if err := os.Remove(swapDir); err != nil {
+		return 0, fmt.Errorf("failed to remove %s: %w", swapDir, err)
+	}
+	return baseOffset, nil
+}
+
+// completeSegmentSwaps finishes compactions interrupted by a crash. A compacted segment still
+// being written is discarded; one already renamed to its swap directory replaces the segments
+// it was compacted from.
+func completeSegmentSwaps(dir string, logger *log.Logger) error {
+	if err := os.RemoveAll(filepath.Join(dir, cleanedDirName)); err != nil {
+		return fmt.Errorf("failed to discard incomplete compaction in %s: %w", dir, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read partition directory %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), swapDirSuffix)
+		if !entry.IsDir() || !ok {
+			continue
+		}
+		end, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		baseOffset, err := swapInSegments(filepath.Join(dir, entry.Name()), dir, end)
+		if err != nil {
+			return err
+		}
+		logger.Printf("Partition %s: completed interrupted compaction of offsets %d to %d", dir, baseOffset, end)
+	}
+	return nil
+}
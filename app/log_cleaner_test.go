@@ -0,0 +1,161 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// compactedTestConfig returns the config of a compacted log whose segments hold three batches
+// of segmentRecord
+func compactedTestConfig() LogConfig {
+	return LogConfig{
+		SegmentBytes:           3 * int64(BuildRecordBatch(0, 0, []Record{segmentRecord}).Size()),
+		SegmentMs:              7 * 24 * time.Hour.Milliseconds(),
+		IndexIntervalBytes:     4096,
+		CleanupPolicy:          CleanupPolicyCompact,
+		RetentionMs:            -1,
+		RetentionBytes:         -1,
+		MinCleanableDirtyRatio: 0,
+		DeleteRetentionMs:      time.Hour.Milliseconds(),
+		CompressionType:        CompressionTypeProducer,
+		MaxMessageBytes:        1 << 20,
+	}
+}
+
+// segmentRecord is as large as the records the test logs are written with
+var segmentRecord = Record{Key: []byte("a"), Value: []byte("a0")}
+
+type keyedRecord struct {
+	offset int64
+	key    string
+	value  string
+	// tombstone is set for a record with a null value
+	tombstone bool
+}
+
+// readKeyedRecords returns every record of the log in offset order, fetching it segment by
+// segment as a consumer would
+func readKeyedRecords(t *testing.T, l *PartitionLog) []keyedRecord {
+	t.Helper()
+	var records []keyedRecord
+	for offset := int64(0); offset < l.LogEndOffset(); {
+		data, err := l.Read(offset, 1<<20, true)
+		if err != nil {
+			t.Fatalf("Read(%d): %v", offset, err)
+		}
+		batches, err := ParseRecordBatches(data)
+		if err != nil {
+			t.Fatalf("ParseRecordBatches: %v", err)
+		}
+		if len(batches) == 0 {
+			t.Fatalf("Read(%d) returned no batches before the log end", offset)
+		}
+		for _, batch := range batches {
+			batchRecords, err := batch.Records()
+			if err != nil {
+				t.Fatalf("Records of batch at offset %d: %v", batch.BaseOffset, err)
+			}
+			for _, record := range batchRecords {
+				records = append(records, keyedRecord{
+					offset:    batch.BaseOffset + int64(record.OffsetDelta),
+					key:       string(record.Key),
+					value:     string(record.Value),
+					tombstone: record.Value == nil,
+				})
+			}
+			offset = batch.NextOffset()
+		}
+	}
+	return records
+}
+
+func TestCompactKeepsLastValueOfEachKey(t *testing.T) {
+	dir := t.TempDir()
+	logger := log.New(io.Discard, "", 0)
+	l, err := OpenPartitionLog(dir, compactedTestConfig(), 0, logger)
+	if err != nil {
+		t.Fatalf("OpenPartitionLog: %v", err)
+	}
+	defer func() { l.Close() }()
+
+	now := time.Now().UnixMilli()
+	writes := []struct {
+		key   string
+		value *string
+	}{
+		{"a", ptr("a0")}, {"b", ptr("b0")}, {"c", ptr("c0")},
+		{"a", ptr("a1")}, {"c", ptr("c1")}, {"b", ptr("b1")},
+		{"a", ptr("a2")}, {"b", nil}, {"c", ptr("c2")},
+		// The active segment is never compacted
+		{"y", ptr("y0")}, {"a", ptr("a3")},
+	}
+	for _, write := range writes {
+		record := Record{Key: []byte(write.key)}
+		if write.value != nil {
+			record.Value = []byte(*write.value)
+		}
+		if _, err := l.Append([]*RecordBatch{BuildRecordBatch(0, now, []Record{record})}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if len(l.segments) != 4 {
+		t.Fatalf("log has %d segments, want 4", len(l.segments))
+	}
+
+	result, err := l.Compact(0, now)
+	if err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if result.RecordsRemoved != 6 {
+		t.Errorf("RecordsRemoved = %d, want 6", result.RecordsRemoved)
+	}
+	if result.FirstDirtyOffset != 9 {
+		t.Errorf("FirstDirtyOffset = %d, want 9", result.FirstDirtyOffset)
+	}
+
+	want := []keyedRecord{
+		{offset: 6, key: "a", value: "a2"},
+		{offset: 7, key: "b", tombstone: true},
+		{offset: 8, key: "c", value: "c2"},
+		{offset: 9, key: "y", value: "y0"},
+		{offset: 10, key: "a", value: "a3"},
+	}
+	assertKeyedRecords(t, readKeyedRecords(t, l), want)
+	if end := l.LogEndOffset(); end != 11 {
+		t.Errorf("LogEndOffset = %d, want 11", end)
+	}
+
+	// The compacted segments are what the log is reopened with
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	l, err = OpenPartitionLog(dir, compactedTestConfig(), 0, logger)
+	if err != nil {
+		t.Fatalf("OpenPartitionLog: %v", err)
+	}
+	assertKeyedRecords(t, readKeyedRecords(t, l), want)
+
+	// Past delete.retention.ms the tombstone goes too
+	if _, err := l.Compact(0, now+time.Hour.Milliseconds()+1); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	assertKeyedRecords(t, readKeyedRecords(t, l), append(want[:1:1], want[2:]...))
+}
+
+func assertKeyedRecords(t *testing.T, got []keyedRecord, want []keyedRecord) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("log holds %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// LogConfig holds the settings of a partition log: the broker's log defaults with the
+// topic's config overrides applied
+type LogConfig struct {
+	// SegmentBytes is the size at which the active segment is rolled
+	SegmentBytes int64
+	// SegmentMs is the age at which the active segment is rolled
+	SegmentMs int64
+	// IndexIntervalBytes is the number of bytes appended between offset index entries
+	IndexIntervalBytes int64
+	// CleanupPolicy is a comma-separated list of delete and compact
+	CleanupPolicy string
+	// RetentionMs is the age after which segments are deleted, or -1 for no time limit
+	RetentionMs int64
+	// RetentionBytes is the size the log is kept under by deleting segments, or -1 for no size limit
+	RetentionBytes int64
+	// MinCleanableDirtyRatio is the share of the log that must be uncompacted before it is compacted
+	MinCleanableDirtyRatio float64
+	// DeleteRetentionMs is how long tombstones are kept by compaction
+	DeleteRetentionMs int64
+	// CompressionType is the codec produced batches are stored with, or "producer" to keep theirs
+	CompressionType string
+	// MaxMessageBytes is the largest batch that is stored, once recompressed with CompressionType
+	MaxMessageBytes int64
+}
+
+// DefaultLogConfig returns the log settings of partitions whose topic overrides none of them
+func DefaultLogConfig(config *Config) LogConfig {
+	return LogConfig{
+		SegmentBytes:       config.LogSegmentBytes,
+		SegmentMs:          config.LogRollMs,
+		IndexIntervalBytes: config.LogIndexIntervalBytes,
+		CleanupPolicy:      config.LogCleanupPolicy,
+		RetentionMs:        config.LogRetentionMs,
+		RetentionBytes:     config.LogRetentionBytes,
+
+		MinCleanableDirtyRatio: config.LogCleanerMinCleanableRatio,
+		DeleteRetentionMs:      config.LogCleanerDeleteRetentionMs,
+
+		CompressionType: config.CompressionType,
+		MaxMessageBytes: int64(config.MessageMaxBytes),
+	}
+}
+
+// WithOverrides returns the settings with a topic's config overrides applied.
+// Overrides were validated when the topic was created, so unparsable values are ignored.
+func (c LogConfig) WithOverrides(overrides map[string]string) LogConfig {
+	overrideLong(&c.SegmentBytes, overrides, "segment.bytes")
+	overrideLong(&c.SegmentMs, overrides, "segment.ms")
+	overrideLong(&c.IndexIntervalBytes, overrides, "index.interval.bytes")
+	overrideLong(&c.RetentionMs, overrides, "retention.ms")
+	overrideLong(&c.RetentionBytes, overrides, "retention.bytes")
+	overrideLong(&c.DeleteRetentionMs, overrides, "delete.retention.ms")
+	overrideLong(&c.MaxMessageBytes, overrides, "max.message.bytes")
+	if ratio, ok := overrides["min.cleanable.dirty.ratio"]; ok {
+		if r, err := strconv.ParseFloat(ratio, 64); err == nil {
+			c.MinCleanableDirtyRatio = r
+		}
+	}
+	if policy, ok := overrides["cleanup.policy"]; ok {
+		c.CleanupPolicy = policy
+	}
+	if compressionType, ok := overrides["compression.type"]; ok {
+		c.CompressionType = compressionType
+	}
+	return c
+}
+
+// HasCleanupPolicy reports whether policy is one of the log's cleanup policies
+func (c LogConfig) HasCleanupPolicy(policy string) bool {
+	for _, p := range strings.Split(c.CleanupPolicy, ",") {
+		if strings.TrimSpace(p) == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// overrideLong sets *value to the integer override of name, if there is one
+func overrideLong(value *int64, overrides map[string]string, name string) {
+	if override, ok := overrides[name]; ok {
+		if n, err := strconv.ParseInt(override, 10, 64); err == nil {
+			*value = n
+		}
+	}
+}
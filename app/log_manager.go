@@ -0,0 +1,549 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeletedDirSuffix marks partition directories of deleted topics that are waiting to be removed
+const DeletedDirSuffix = "-delete"
+
+// RewrittenDirSuffix marks the new copy of a partition log being rewritten, until it replaces the original
+const RewrittenDirSuffix = ".rewritten"
+
+// CleanShutdownFile marks a data directory whose logs were all flushed when the broker last stopped
+const CleanShutdownFile = ".kafka_cleanshutdown"
+
+// RecoveryPointCheckpointFile records the recovery point of every log in the data directory
+const RecoveryPointCheckpointFile = "recovery-point-offset-checkpoint"
+
+// LogManager owns the partition logs stored under the data directory.
+// Each partition lives in its own directory named "<topic>-<partition>".
+// Background goroutines delete the segments that are past their log's retention,
+// compact the logs of topics with the compact cleanup policy and checkpoint how far each
+// log has been flushed, so that after a crash only the rest is recovered.
+type LogManager struct {
+	config  *Config
+	dataDir string
+	logger  *log.Logger
+	mu      sync.Mutex
+	logs    map[TopicPartition]*PartitionLog
+
+	stop  chan struct{}
+	tasks sync.WaitGroup
+}
+
+// NewLogManager creates the data directory if needed and opens all existing partition logs.
+// Unless the broker last shut down cleanly, the logs are recovered from their recovery points.
+func NewLogManager(config *Config, logger *log.Logger) (*LogManager, error) {
+	dataDir := config.DataDir()
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory %s: %w", dataDir, err)
+	}
+
+	lm := &LogManager{
+		config:  config,
+		dataDir: dataDir,
+		logger:  logger,
+		logs:    make(map[TopicPartition]*PartitionLog),
+		stop:    make(chan struct{}),
+	}
+
+	recoveryPoints, cleanShutdown := lm.loadRecoveryPoints()
+	if err := lm.loadLogs(filepath.Clean(config.LogDirectory), recoveryPoints, cleanShutdown); err != nil {
+		lm.closeLogs()
+		return nil, err
+	}
+	// From here on the logs are written to, so a crash leaves them to be recovered
+	if err := os.Remove(filepath.Join(dataDir, CleanShutdownFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		lm.closeLogs()
+		return nil, fmt.Errorf("failed to remove clean shutdown marker: %w", err)
+	}
+
+	lm.tasks.Add(2)
+	go lm.runRetention()
+	go lm.runRecoveryPointCheckpoints()
+	if config.LogCleanerEnable {
+		lm.tasks.Add(1)
+		go lm.runLogCleaner()
+	}
+	return lm, nil
+}
+
+// loadRecoveryPoints reads the recovery point checkpoint and reports whether the broker last
+// shut down cleanly, in which case every log was flushed whole and none needs recovery
+func (lm *LogManager) loadRecoveryPoints() (map[TopicPartition]int64, bool) {
+	if _, err := os.Stat(filepath.Join(lm.dataDir, CleanShutdownFile)); err == nil {
+		return nil, true
+	}
+
+	recoveryPoints, err := ReadOffsetCheckpoint(filepath.Join(lm.dataDir, RecoveryPointCheckpointFile))
+	if err != nil {
+		lm.logger.Printf("Failed to read recovery point checkpoint, recovering logs from their start: %v", err)
+		return make(map[TopicPartition]int64), false
+	}
+	return recoveryPoints, false
+}
+
+// loadLogs opens every partition directory found in the data directory, recovering each log
+// from its recovery point unless the broker shut down cleanly. Logs without a recovery point
+// are recovered whole. The cluster metadata directory shares the parent directory and is skipped.
+func (lm *LogManager) loadLogs(metadataDir string, recoveryPoints map[TopicPartition]int64, cleanShutdown bool) error {
+	entries, err := os.ReadDir(lm.dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to read data directory: %w", err)
+	}
+	image := lm.loadMetadataImage()
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		dir := filepath.Join(lm.dataDir, name)
+		if dir == metadataDir {
+			continue
+		}
+		if strings.HasSuffix(name, RewrittenDirSuffix) {
+			// A rewrite was interrupted. The new copy is complete, and replaces the original,
+			// only if the original had already been moved aside.
+			name = strings.TrimSuffix(name, RewrittenDirSuffix)
+			original := filepath.Join(lm.dataDir, name)
+			if _, err := os.Stat(original); err == nil {
+				go lm.removeDirs([]string{dir})
+				continue
+			}
+			if err := os.Rename(dir, original); err != nil {
+				return fmt.Errorf("failed to restore rewritten partition %s: %w", name, err)
+			}
+			dir = original
+		}
+		if strings.HasSuffix(name, DeletedDirSuffix) {
+			// Deletion was interrupted before the directory was removed
+			go lm.removeDirs([]string{dir})
+			continue
+		}
+		tp, ok := parsePartitionDirName(name)
+		if !ok {
+			continue
+		}
+
+		recoveryPoint := int64(math.MaxInt64)
+		if !cleanShutdown {
+			recoveryPoint = recoveryPoints[tp]
+		}
+		partitionLog, err := OpenPartitionLog(dir, lm.logConfig(image, tp.Topic), recoveryPoint, lm.logger)
+		if err != nil {
+			return fmt.Errorf("failed to load partition %s: %w", tp, err)
+		}
+		lm.logs[tp] = partitionLog
+		if recoveryPoint < partitionLog.LogEndOffset() {
+			lm.logger.Printf("Recovered partition %s from offset %d (log end offset %d)", tp, recoveryPoint, partitionLog.LogEndOffset())
+		} else {
+			lm.logger.Printf("Loaded partition %s (log end offset %d)", tp, partitionLog.LogEndOffset())
+		}
+	}
+
+	return nil
+}
+
+// parsePartitionDirName splits a "<topic>-<partition>" directory name
+func parsePartitionDirName(name string) (TopicPartition, bool) {
+	separator := strings.LastIndex(name, "-")
+	if separator <= 0 {
+		return TopicPartition{}, false
+	}
+	partition, err := strconv.ParseInt(name[separator+1:], 10, 32)
+	if err != nil || partition < 0 {
+		return TopicPartition{}, false
+	}
+	return TopicPartition{Topic: name[:separator], Partition: int32(partition)}, true
+}
+
+// loadMetadataImage loads the cluster metadata for the topic config overrides of partition
+// logs. Without it the broker's log defaults apply; a missing metadata log just means no
+// topics exist yet.
+func (lm *LogManager) loadMetadataImage() *MetadataImage {
+	image, err := getMetadataImage(lm.config)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			lm.logger.Printf("Failed to load topic configs, using log defaults: %v", err)
+		}
+		return nil
+	}
+	return image
+}
+
+// logConfig returns the settings of a topic's partition logs: the broker's log defaults with
+// the topic's overrides from image applied. Internal topics have no overrides; their stores
+// compact them, so retention never deletes their segments.
+func (lm *LogManager) logConfig(image *MetadataImage, topic string) LogConfig {
+	config := DefaultLogConfig(lm.config)
+	if IsInternalTopic(topic) {
+		config.CleanupPolicy = CleanupPolicyCompact
+		return config
+	}
+	if image == nil {
+		return config
+	}
+	return config.WithOverrides(image.TopicConfigs(topic))
+}
+
+// GetLog returns the log for a partition if it exists
+func (lm *LogManager) GetLog(tp TopicPartition) (*PartitionLog, bool) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	partitionLog, ok := lm.logs[tp]
+	return partitionLog, ok
+}
+
+// GetOrCreateLog returns the log for a partition, creating it on first use
+func (lm *LogManager) GetOrCreateLog(tp TopicPartition) (*PartitionLog, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if partitionLog, ok := lm.logs[tp]; ok {
+		return partitionLog, nil
+	}
+
+	config := lm.logConfig(lm.loadMetadataImage(), tp.Topic)
+	partitionLog, err := OpenPartitionLog(filepath.Join(lm.dataDir, tp.String()), config, 0, lm.logger)
+	if err != nil {
+		return nil, err
+	}
+	lm.logs[tp] = partitionLog
+	lm.logger.Printf("Created partition log %s", tp)
+
+	return partitionLog, nil
+}
+
+// DeleteLogs closes the logs of a deleted topic's partitions and removes their directories in the background.
+// The directories are first renamed so that a topic re-created under the same name starts empty.
+func (lm *LogManager) DeleteLogs(topic Topic, partitions []int32) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	renamed := make([]string, 0, len(partitions))
+	defer func() {
+		go lm.removeDirs(renamed)
+	}()
+
+	for _, partition := range partitions {
+		tp := TopicPartition{Topic: topic.Name, Partition: partition}
+		if partitionLog, ok := lm.logs[tp]; ok {
+			if err := partitionLog.Close(); err != nil {
+				lm.logger.Printf("Failed to close deleted partition %s: %v", tp, err)
+			}
+			delete(lm.logs, tp)
+		}
+
+		dir := filepath.Join(lm.dataDir, tp.String())
+		deletedDir := fmt.Sprintf("%s.%s%s", dir, topic.UUID, DeletedDirSuffix)
+		if err := os.Rename(dir, deletedDir); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("failed to mark partition %s for deletion: %w", tp, err)
+		}
+		renamed = append(renamed, deletedDir)
+	}
+
+	return nil
+}
+
+// RewriteLog replaces the contents of a partition log with batches, as when compacting it,
+// and returns the reopened log. The new log is written next to the old one and swapped in
+// with renames, so an interrupted rewrite leaves either the old or the new log in place.
+func (lm *LogManager) RewriteLog(tp TopicPartition, batches []*RecordBatch) (*PartitionLog, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	dir := filepath.Join(lm.dataDir, tp.String())
+	rewrittenDir := dir + RewrittenDirSuffix
+	if err := os.RemoveAll(rewrittenDir); err != nil {
+		return nil, fmt.Errorf("failed to clear %s: %w", rewrittenDir, err)
+	}
+
+	config := lm.logConfig(lm.loadMetadataImage(), tp.Topic)
+	rewritten, err := OpenPartitionLog(rewrittenDir, config, 0, lm.logger)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rewritten.Append(batches); err != nil {
+		rewritten.Close()
+		return nil, err
+	}
+	if err := rewritten.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close rewritten partition %s: %w", tp, err)
+	}
+
+	if partitionLog, ok := lm.logs[tp]; ok {
+		if err := partitionLog.Close(); err != nil {
+			lm.logger.Printf("Failed to close rewritten partition %s: %v", tp, err)
+		}
+		delete(lm.logs, tp)
+	}
+
+	deletedDir := fmt.Sprintf("%s.%d%s", dir, time.Now().UnixNano(), DeletedDirSuffix)
+	if err := os.Rename(dir, deletedDir); err != nil {
+		return nil, fmt.Errorf("failed to move aside partition %s: %w", tp, err)
+	}
+	if err := os.Rename(rewrittenDir, dir); err != nil {
+		return nil, fmt.Errorf("failed to replace partition %s: %w", tp, err)
+	}
+	go lm.removeDirs([]string{deletedDir})
+
+	partitionLog, err := OpenPartitionLog(dir, config, 0, lm.logger)
+	if err != nil {
+		return nil, err
+	}
+	lm.logs[tp] = partitionLog
+	lm.logger.Printf("Rewrote partition log %s (log end offset %d)", tp, partitionLog.LogEndOffset())
+
+	return partitionLog, nil
+}
+
+// removeDirs deletes partition directories that were marked for deletion
+func (lm *LogManager) removeDirs(dirs []string) {
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			lm.logger.Printf("Failed to delete %s: %v", dir, err)
+			continue
+		}
+		lm.logger.Printf("Deleted %s", dir)
+	}
+}
+
+// runRetention periodically deletes segments past their log's retention until Close
+func (lm *LogManager) runRetention() {
+	defer lm.tasks.Done()
+
+	ticker := time.NewTicker(time.Duration(lm.config.LogRetentionCheckIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lm.stop:
+			return
+		case <-ticker.C:
+			lm.cleanupLogs(time.Now())
+		}
+	}
+}
+
+// cleanupLogs deletes the segments of every log that are past its retention and returns what
+// was removed from each log that lost segments. The topics' current config overrides are
+// applied first. lm.mu is held throughout, so that no log is closed while segments are deleted.
+func (lm *LogManager) cleanupLogs(now time.Time) map[TopicPartition]RetentionResult {
+	lm.refreshLogConfigs()
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	removed := make(map[TopicPartition]RetentionResult)
+	for tp, partitionLog := range lm.logs {
+		result, err := partitionLog.DeleteRetainedSegments(now.UnixMilli())
+		if err != nil {
+			lm.logger.Printf("Failed to delete segments of %s past retention: %v", tp, err)
+		}
+		if result.Segments > 0 {
+			removed[tp] = result
+			lm.logger.Printf("Deleted %d segments (%d bytes) of %s past retention; log start offset is now %d",
+				result.Segments, result.Bytes, tp, result.LogStartOffset)
+		}
+	}
+	return removed
+}
+
+// runLogCleaner periodically compacts the logs of compacted topics until Close
+func (lm *LogManager) runLogCleaner() {
+	defer lm.tasks.Done()
+
+	ticker := time.NewTicker(time.Duration(lm.config.LogCleanerBackoffMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lm.stop:
+			return
+		case <-ticker.C:
+			lm.cleanLogs(time.Now())
+		}
+	}
+}
+
+// cleanLogs compacts the logs of compacted topics that are dirty enough, records in the cleaner
+// checkpoint how far each log is compacted and returns what was removed from each log that was
+// compacted. Internal topics are left to their stores, which compact them by rewriting the log.
+// Logs are compacted without holding lm.mu; a log closed meanwhile fails to compact.
+func (lm *LogManager) cleanLogs(now time.Time) map[TopicPartition]CleanResult {
+	lm.refreshLogConfigs()
+
+	checkpointPath := filepath.Join(lm.dataDir, CleanerCheckpointFile)
+	firstDirtyOffsets, err := ReadOffsetCheckpoint(checkpointPath)
+	if err != nil {
+		lm.logger.Printf("Failed to read cleaner checkpoint, compacting logs from their start: %v", err)
+		firstDirtyOffsets = make(map[TopicPartition]int64)
+	}
+
+	lm.mu.Lock()
+	logs := maps.Clone(lm.logs)
+	lm.mu.Unlock()
+
+	cleaned := make(map[TopicPartition]CleanResult)
+	for tp, partitionLog := range logs {
+		if IsInternalTopic(tp.Topic) {
+			continue
+		}
+		result, err := partitionLog.Compact(firstDirtyOffsets[tp], now.UnixMilli())
+		if err != nil {
+			lm.logger.Printf("Failed to compact %s: %v", tp, err)
+			continue
+		}
+		firstDirtyOffsets[tp] = result.FirstDirtyOffset
+		if result.Segments > 0 {
+			cleaned[tp] = result
+			lm.logger.Printf("Compacted %d segments of %s from %d to %d bytes, removing %d records; compacted up to offset %d",
+				result.Segments, tp, result.BytesBefore, result.BytesAfter, result.RecordsRemoved, result.FirstDirtyOffset)
+		}
+	}
+
+	// Logs deleted since are dropped from the checkpoint
+	lm.mu.Lock()
+	for tp := range firstDirtyOffsets {
+		if _, ok := lm.logs[tp]; !ok {
+			delete(firstDirtyOffsets, tp)
+		}
+	}
+	lm.mu.Unlock()
+	if err := WriteOffsetCheckpoint(checkpointPath, firstDirtyOffsets); err != nil {
+		lm.logger.Printf("Failed to write cleaner checkpoint: %v", err)
+	}
+
+	return cleaned
+}
+
+// refreshLogConfigs applies the topics' current config overrides to their open logs
+func (lm *LogManager) refreshLogConfigs() {
+	image := lm.loadMetadataImage()
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	for tp, partitionLog := range lm.logs {
+		partitionLog.SetConfig(lm.logConfig(image, tp.Topic))
+	}
+}
+
+// runRecoveryPointCheckpoints periodically flushes the logs and checkpoints their recovery
+// points until Close, so that recovery after a crash only rescans what was appended since
+func (lm *LogManager) runRecoveryPointCheckpoints() {
+	defer lm.tasks.Done()
+
+	ticker := time.NewTicker(time.Duration(lm.config.LogFlushOffsetCheckpointIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lm.stop:
+			return
+		case <-ticker.C:
+			lm.flushAppendedLogs()
+			if err := lm.checkpointRecoveryPoints(); err != nil {
+				lm.logger.Printf("Failed to write recovery point checkpoint: %v", err)
+			}
+		}
+	}
+}
+
+// flushAppendedLogs flushes the logs appended to since they were last flushed, moving their
+// recovery points to their log end offsets. The logs are flushed without holding lm.mu, so
+// that partitions can be opened meanwhile; logs closed in the meantime are skipped.
+func (lm *LogManager) flushAppendedLogs() {
+	lm.mu.Lock()
+	logs := maps.Clone(lm.logs)
+	lm.mu.Unlock()
+
+	for tp, partitionLog := range logs {
+		if partitionLog.RecoveryPoint() >= partitionLog.LogEndOffset() {
+			continue
+		}
+		if err := partitionLog.Flush(); err != nil && !errors.Is(err, errLogClosed) {
+			lm.logger.Printf("Failed to flush partition %s: %v", tp, err)
+		}
+	}
+}
+
+// checkpointRecoveryPoints writes the recovery point of every open log to the recovery point
+// checkpoint. Logs deleted since the last checkpoint are dropped from it.
+func (lm *LogManager) checkpointRecoveryPoints() error {
+	lm.mu.Lock()
+	recoveryPoints := make(map[TopicPartition]int64, len(lm.logs))
+	for tp, partitionLog := range lm.logs {
+		recoveryPoints[tp] = partitionLog.RecoveryPoint()
+	}
+	lm.mu.Unlock()
+
+	return WriteOffsetCheckpoint(filepath.Join(lm.dataDir, RecoveryPointCheckpointFile), recoveryPoints)
+}
+
+// Close stops the background tasks, flushes and closes every open partition log and, once
+// all of them are safely on disk, marks the data directory as shut down cleanly
+func (lm *LogManager) Close() error {
+	close(lm.stop)
+	lm.tasks.Wait()
+
+	err := lm.flushLogs()
+	if err == nil {
+		err = lm.checkpointRecoveryPoints()
+	}
+	if closeErr := lm.closeLogs(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(lm.dataDir, CleanShutdownFile), nil, 0644); err != nil {
+		return fmt.Errorf("failed to write clean shutdown marker: %w", err)
+	}
+	return nil
+}
+
+// flushLogs flushes every open partition log
+func (lm *LogManager) flushLogs() error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	var firstErr error
+	for tp, partitionLog := range lm.logs {
+		if err := partitionLog.Flush(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to flush partition %s: %w", tp, err)
+		}
+	}
+	return firstErr
+}
+
+// closeLogs closes every open partition log
+func (lm *LogManager) closeLogs() error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	var firstErr error
+	for tp, partitionLog := range lm.logs {
+		if err := partitionLog.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close partition %s: %w", tp, err)
+		}
+	}
+	lm.logs = make(map[TopicPartition]*PartitionLog)
+
+	return firstErr
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogFileName returns the name of the segment file whose first offset is baseOffset
+func LogFileName(baseOffset int64) string {
+	return fmt.Sprintf("%020d.log", baseOffset)
+}
+
+// parseLogFileName returns the base offset of a segment file name
+func parseLogFileName(name string) (int64, bool) {
+	digits, ok := strings.CutSuffix(name, ".log")
+	if !ok {
+		return 0, false
+	}
+	baseOffset, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || baseOffset < 0 {
+		return 0, false
+	}
+	return baseOffset, true
+}
+
+// listSegmentBaseOffsets returns the base offsets of the segment files in dir, in order
+func listSegmentBaseOffsets(dir string) ([]int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segments in %s: %w", dir, err)
+	}
+
+	var baseOffsets []int64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if baseOffset, ok := parseLogFileName(entry.Name()); ok {
+			baseOffsets = append(baseOffsets, baseOffset)
+		}
+	}
+	slices.Sort(baseOffsets)
+	return baseOffsets, nil
+}
+
+// LogSegment is one file of a partition log with its offset, time and transaction indexes.
+// The files are named after the segment's base offset, the first offset it can hold.
+type LogSegment struct {
+	dir         string
+	baseOffset  int64
+	file        *os.File
+	offsetIndex *OffsetIndex
+	timeIndex   *TimeIndex
+	txnIndex    *TxnIndex
+	size        int64
+	nextOffset  int64
+
+	// rollTimestamp is the time the segment's age is measured from: the max timestamp of its
+	// first batch, or the time it was created while it is empty
+	rollTimestamp int64
+
+	indexIntervalBytes int64
+	// bytesSinceIndexed counts the bytes appended since the last offset index entry
+	bytesSinceIndexed int64
+
+	// indexesMissing is set when the offset or time index file did not exist when the segment
+	// was opened, so that the empty index created in its place must be rebuilt
+	indexesMissing bool
+}
+
+// OpenLogSegment opens the segment starting at baseOffset in dir, creating its files if necessary.
+// The segment is empty until it is recovered.
+func OpenLogSegment(dir string, baseOffset int64, indexIntervalBytes int64) (*LogSegment, error) {
+	filePath := filepath.Join(dir, LogFileName(baseOffset))
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment %s: %w", filePath, err)
+	}
+
+	offsetIndexPath := filepath.Join(dir, OffsetIndexFileName(baseOffset))
+	timeIndexPath := filepath.Join(dir, TimeIndexFileName(baseOffset))
+	_, offsetIndexErr := os.Stat(offsetIndexPath)
+	_, timeIndexErr := os.Stat(timeIndexPath)
+
+	offsetIndex, err := OpenOffsetIndex(offsetIndexPath, baseOffset)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	timeIndex, err := OpenTimeIndex(timeIndexPath, baseOffset)
+	if err != nil {
+		file.Close()
+		offsetIndex.Close()
+		return nil, err
+	}
+
+	txnIndex, err := OpenTxnIndex(filepath.Join(dir, TxnIndexFileName(baseOffset)))
+	if err != nil {
+		file.Close()
+		offsetIndex.Close()
+		timeIndex.Close()
+		return nil, err
+	}
+
+	return &LogSegment{
+		dir:                dir,
+		baseOffset:         baseOffset,
+		file:               file,
+		offsetIndex:        offsetIndex,
+		timeIndex:          timeIndex,
+		txnIndex:           txnIndex,
+		nextOffset:         baseOffset,
+		rollTimestamp:      time.Now().UnixMilli(),
+		indexIntervalBytes: indexIntervalBytes,
+		indexesMissing:     errors.Is(offsetIndexErr, os.ErrNotExist) || errors.Is(timeIndexErr, os.ErrNotExist),
+	}, nil
+}
+
+// load prepares a segment that was flushed to disk for use without scanning all of it: the
+// indexes are sanity checked and only the batch headers after the last offset index entry are
+// read to find the next offset. ok is false if an index is missing or does not match the
+// segment file, or the segment ends in an incomplete batch; the segment must then be recovered.
+func (s *LogSegment) load() (ok bool, err error) {
+	if s.indexesMissing {
+		return false, nil
+	}
+	info, err := s.file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to stat segment: %w", err)
+	}
+	s.size = info.Size()
+	if s.offsetIndex.Validate(s.size) != nil || s.timeIndex.Validate() != nil {
+		return false, nil
+	}
+
+	// Every batch of a segment raises or sets the largest timestamp of an empty segment, so a
+	// segment holding batches has at least one time index entry
+	lastTime, hasTimeEntries := s.timeIndex.Last()
+	if s.size == 0 {
+		return !hasTimeEntries && len(s.offsetIndex.Entries()) == 0, nil
+	}
+	if !hasTimeEntries {
+		return false, nil
+	}
+
+	first, err := readBatchHeaderAt(s.file, 0, s.size)
+	if err != nil {
+		return false, nil
+	}
+	s.rollTimestamp = first.MaxTimestamp
+
+	s.nextOffset = s.baseOffset
+	position := int64(0)
+	if last, ok := s.offsetIndex.Last(); ok {
+		position = last.Position
+		header, err := readBatchHeaderAt(s.file, position, s.size)
+		if err != nil || header.BaseOffset != last.Offset {
+			return false, nil
+		}
+	}
+	s.bytesSinceIndexed = s.size - position
+	for position < s.size {
+		header, err := readBatchHeaderAt(s.file, position, s.size)
+		if err != nil {
+			return false, nil
+		}
+		s.nextOffset = header.NextOffset()
+		position += BatchHeaderSize + int64(header.BatchLength)
+	}
+
+	return lastTime.Offset < s.nextOffset, nil
+}
+
+// recover scans the segment to find its next offset and rebuilds the offset and time indexes
+// if they do not match it. Every batch is read whole and its CRC verified; the segment is
+// truncated at the first batch that is incomplete or corrupt, as left by a write interrupted
+// by a crash. truncated reports whether anything was cut off.
+func (s *LogSegment) recover(logger *log.Logger) (truncated bool, err error) {
+	info, err := s.file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to stat segment: %w", err)
+	}
+	fileSize := info.Size()
+
+	offsetEntries := make([]OffsetIndexEntry, 0)
+	timeEntries := make([]TimeIndexEntry, 0)
+	s.nextOffset = s.baseOffset
+	s.bytesSinceIndexed = 0
+	position := int64(0)
+	for {
+		header, err := readBatchHeaderAt(s.file, position, fileSize)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var batch *RecordBatch
+		if err == nil {
+			batch, err = s.readBatchAt(position, header)
+		}
+		if err != nil {
+			logger.Printf("Segment %s: invalid batch at position %d (offset %d): %v; truncating %d bytes",
+				s.path(), position, s.nextOffset, err, fileSize-position)
+			break
+		}
+
+		if position == 0 {
+			s.rollTimestamp = batch.MaxTimestamp
+		}
+		if s.bytesSinceIndexed >= s.indexIntervalBytes && position > 0 {
+			offsetEntries = append(offsetEntries, OffsetIndexEntry{Offset: batch.BaseOffset, Position: position})
+			s.bytesSinceIndexed = 0
+		}
+		if len(timeEntries) == 0 || batch.MaxTimestamp > timeEntries[len(timeEntries)-1].Timestamp {
+			timeEntries = append(timeEntries, TimeIndexEntry{Timestamp: batch.MaxTimestamp, Offset: batch.BaseOffset})
+		}
+		s.nextOffset = batch.NextOffset()
+		s.bytesSinceIndexed += int64(batch.Size())
+		position += int64(batch.Size())
+	}
+
+	if position < fileSize {
+		if err := s.file.Truncate(position); err != nil {
+			return false, fmt.Errorf("failed to truncate invalid batch at position %d: %w", position, err)
+		}
+		truncated = true
+	}
+	s.size = position
+
+	if !slices.Equal(offsetEntries, s.offsetIndex.Entries()) || s.offsetIndex.Validate(s.size) != nil {
+		logger.Printf("Segment %s: rebuilding offset index", s.path())
+		if err := s.offsetIndex.Reset(offsetEntries); err != nil {
+			return false, err
+		}
+	}
+	if !slices.Equal(timeEntries, s.timeIndex.Entries()) || s.timeIndex.Validate() != nil {
+		logger.Printf("Segment %s: rebuilding time index", s.path())
+		if err := s.timeIndex.Reset(timeEntries); err != nil {
+			return false, err
+		}
+	}
+	s.indexesMissing = false
+
+	return truncated, nil
+}
+
+// append writes the encoded batches to the end of the segment and indexes them
+func (s *LogSegment) append(buffer []byte, batches []*RecordBatch) error {
+	if _, err := s.file.WriteAt(buffer, s.size); err != nil {
+		// Cut off whatever part of the write made it to disk
+		s.file.Truncate(s.size)
+		return err
+	}
+
+	if s.size == 0 && len(batches) > 0 {
+		s.rollTimestamp = batches[0].MaxTimestamp
+	}
+	position := s.size
+	for _, batch := range batches {
+		if s.bytesSinceIndexed >= s.indexIntervalBytes && position > 0 {
+			if err := s.offsetIndex.Append(batch.BaseOffset, position); err != nil {
+				return err
+			}
+			s.bytesSinceIndexed = 0
+		}
+		if err := s.timeIndex.MaybeAppend(batch.MaxTimestamp, batch.BaseOffset); err != nil {
+			return err
+		}
+		s.bytesSinceIndexed += int64(batch.Size())
+		position += int64(batch.Size())
+		s.nextOffset = batch.NextOffset()
+	}
+	s.size = position
+
+	return nil
+}
+
+// batchPosition returns the file position of the first batch whose last offset is at or after
+// offset, or the end of the segment if there is none. The scan starts at the closest batch
+// the offset index holds.
+func (s *LogSegment) batchPosition(offset int64) (int64, error) {
+	position := s.offsetIndex.Lookup(offset)
+	for position < s.size {
+		batch, err := readBatchHeaderAt(s.file, position, s.size)
+		if err != nil {
+			return 0, err
+		}
+		if batch.LastOffset() >= offset {
+			break
+		}
+		position += BatchHeaderSize + int64(batch.BatchLength)
+	}
+	return position, nil
+}
+
+// read returns the batches stored from position on, stopping at maxOffset or before the
+// batch that would exceed maxBytes. When minOneBatch is set the first batch is returned even
+// if it alone is larger than maxBytes. Only the selected range of the file is read.
+func (s *LogSegment) read(position int64, maxOffset int64, maxBytes int, minOneBatch bool) ([]byte, error) {
+	// Collect whole batches until maxBytes is reached
+	end := position
+	for end < s.size {
+		batch, err := readBatchHeaderAt(s.file, end, s.size)
+		if err != nil {
+			return nil, err
+		}
+		batchSize := BatchHeaderSize + int64(batch.BatchLength)
+		if batch.BaseOffset >= maxOffset || (end+batchSize-position > int64(maxBytes) && !(minOneBatch && end == position)) {
+			break
+		}
+		end += batchSize
+	}
+
+	records := make([]byte, end-position)
+	if _, err := s.file.ReadAt(records, position); err != nil {
+		return nil, fmt.Errorf("failed to read %s at position %d: %w", s.path(), position, err)
+	}
+	return records, nil
+}
+
+// readBatchContaining reads the complete batch that contains offset
+func (s *LogSegment) readBatchContaining(offset int64) (*RecordBatch, error) {
+	position, err := s.batchPosition(offset)
+	if err != nil {
+		return nil, err
+	}
+	header, err := readBatchHeaderAt(s.file, position, s.size)
+	if err != nil {
+		return nil, err
+	}
+	return s.readBatchAt(position, header)
+}
+
+// readBatchAt reads the complete batch stored at position, whose header has been read
+func (s *LogSegment) readBatchAt(position int64, header *RecordBatch) (*RecordBatch, error) {
+	data := make([]byte, BatchHeaderSize+int(header.BatchLength))
+	if _, err := s.file.ReadAt(data, position); err != nil {
+		return nil, fmt.Errorf("failed to read batch at position %d: %w", position, err)
+	}
+	return ParseRecordBatchHeader(data)
+}
+
+// forEachBatchHeader calls fn with the header and position of every batch from position on
+func (s *LogSegment) forEachBatchHeader(position int64, fn func(header *RecordBatch, position int64) error) error {
+	for position < s.size {
+		header, err := readBatchHeaderAt(s.file, position, s.size)
+		if err != nil {
+			return err
+		}
+		if err := fn(header, position); err != nil {
+			return err
+		}
+		position += BatchHeaderSize + int64(header.BatchLength)
+	}
+	return nil
+}
+
+// shouldRoll reports whether appending size bytes holding offsets up to lastOffset requires a
+// new segment: the segment would outgrow segmentBytes, has outlived segmentMs, or cannot hold
+// the offsets relative to its base offset in its indexes
+func (s *LogSegment) shouldRoll(config LogConfig, size int, lastOffset int64, now int64) bool {
+	if s.size == 0 {
+		return false
+	}
+	return s.size+int64(size) > config.SegmentBytes ||
+		now-s.rollTimestamp >= config.SegmentMs ||
+		lastOffset-s.baseOffset > 1<<31-1
+}
+
+// maxTimestamp returns the largest timestamp in the segment, or the time the segment's age is
+// measured from while it is empty
+func (s *LogSegment) maxTimestamp() int64 {
+	if last, ok := s.timeIndex.Last(); ok {
+		return last.Timestamp
+	}
+	return s.rollTimestamp
+}
+
+// path returns the path of the segment's log file
+func (s *LogSegment) path() string {
+	return filepath.Join(s.dir, LogFileName(s.baseOffset))
+}
+
+// flush syncs the segment and index files to disk
+func (s *LogSegment) flush() error {
+	return errors.Join(s.file.Sync(), s.offsetIndex.Sync(), s.timeIndex.Sync(), s.txnIndex.Sync())
+}
+
+// close closes the segment and index files, returning any errors
+func (s *LogSegment) close() error {
+	return errors.Join(s.offsetIndex.Close(), s.timeIndex.Close(), s.txnIndex.Close(), s.file.Close())
+}
+
+// delete closes the segment and removes its files
+func (s *LogSegment) delete() error {
+	s.close()
+	return removeSegmentFiles(s.dir, s.baseOffset)
+}
+
+// segmentFileNames returns the names of the log and index files of the segment starting at baseOffset
+func segmentFileNames(baseOffset int64) []string {
+	return []string{LogFileName(baseOffset), OffsetIndexFileName(baseOffset), TimeIndexFileName(baseOffset), TxnIndexFileName(baseOffset)}
+}
+
+// removeSegmentFiles removes the log and index files of the segment starting at baseOffset
+func removeSegmentFiles(dir string, baseOffset int64) error {
+	var errs []error
+	for _, name := range segmentFileNames(baseOffset) {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestSegment writes a segment holding three single-record batches and returns the
+// batches and the encoded bytes of a fourth one
+func writeTestSegment(t *testing.T, dir string) ([]*RecordBatch, []byte) {
+	t.Helper()
+	segment, err := OpenLogSegment(dir, 0, 4096)
+	if err != nil {
+		t.Fatalf("OpenLogSegment: %v", err)
+	}
+	defer segment.close()
+
+	var batches []*RecordBatch
+	for i := range 4 {
+		batches = append(batches, BuildRecordBatch(int64(i), 1700000000000+int64(i), []Record{
+			{Key: []byte{byte('a' + i)}, Value: []byte("value")},
+		}))
+	}
+	for _, batch := range batches[:3] {
+		if err := segment.append(batch.Raw, []*RecordBatch{batch}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if err := segment.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	return batches[:3], batches[3].Raw
+}
+
+func TestLogSegmentRecover(t *testing.T) {
+	tests := []struct {
+		name string
+		// damage alters the segment file given the encoded next batch
+		damage        func(file *os.File, size int64, next []byte) error
+		wantTruncated bool
+		wantBatches   int
+	}{
+		{
+			name:        "intact",
+			damage:      func(*os.File, int64, []byte) error { return nil },
+			wantBatches: 3,
+		},
+		{
+			name: "torn batch header",
+			damage: func(file *os.File, size int64, next []byte) error {
+				_, err := file.WriteAt(next[:BatchHeaderSize-2], size)
+				return err
+			},
+			wantTruncated: true,
+			wantBatches:   3,
+		},
+		{
+			name: "torn batch body",
+			damage: func(file *os.File, size int64, next []byte) error {
+				_, err := file.WriteAt(next[:len(next)-5], size)
+				return err
+			},
+			wantTruncated: true,
+			wantBatches:   3,
+		},
+		{
+			name: "corrupt last batch",
+			damage: func(file *os.File, size int64, next []byte) error {
+				last := make([]byte, 1)
+				if _, err := file.ReadAt(last, size-1); err != nil {
+					return err
+				}
+				last[0] ^= 0xff
+				_, err := file.WriteAt(last, size-1)
+				return err
+			},
+			wantTruncated: true,
+			wantBatches:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			batches, next := writeTestSegment(t, dir)
+			var size int64
+			for _, batch := range batches {
+				size += int64(batch.Size())
+			}
+
+			file, err := os.OpenFile(filepath.Join(dir, LogFileName(0)), os.O_RDWR, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tt.damage(file, size, next)
+			file.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			segment, err := OpenLogSegment(dir, 0, 4096)
+			if err != nil {
+				t.Fatalf("OpenLogSegment: %v", err)
+			}
+			defer segment.close()
+			truncated, err := segment.recover(log.New(io.Discard, "", 0))
+			if err != nil {
+				t.Fatalf("recover: %v", err)
+			}
+
+			var wantSize int64
+			for _, batch := range batches[:tt.wantBatches] {
+				wantSize += int64(batch.Size())
+			}
+			if truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", truncated, tt.wantTruncated)
+			}
+			if segment.size != wantSize {
+				t.Errorf("size = %d, want %d", segment.size, wantSize)
+			}
+			if want := int64(tt.wantBatches); segment.nextOffset != want {
+				t.Errorf("nextOffset = %d, want %d", segment.nextOffset, want)
+			}
+			info, err := os.Stat(segment.path())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != wantSize {
+				t.Errorf("file size = %d, want %d", info.Size(), wantSize)
+			}
+
+			var offsets []int64
+			err = segment.forEachBatchHeader(0, func(header *RecordBatch, _ int64) error {
+				offsets = append(offsets, header.BaseOffset)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("forEachBatchHeader: %v", err)
+			}
+			if len(offsets) != tt.wantBatches {
+				t.Errorf("read back batches at offsets %v, want %d batches", offsets, tt.wantBatches)
+			}
+		})
+	}
+}
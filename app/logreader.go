@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -26,7 +27,7 @@ type LogEntry struct {
 func NewLogReader(basePath string) (*LogReader, error) {
 	// Validate that the directory exists
 	if _, err := os.Stat(basePath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("log directory does not exist: %s", basePath)
+		return nil, fmt.Errorf("log directory does not exist: %s: %w", basePath, err)
 	}
 
 	return &LogReader{
@@ -135,6 +136,46 @@ func (lr *LogReader) ReadLogFileBytes(fileName string, offset int64, length int)
 	return buffer[:n], nil
 }
 
+// ForEachBatch calls fn with every record batch of a log file, in order. Batches are read
+// one at a time at their position in the file, so the file is never loaded whole. It stops
+// at the first batch that is incomplete or fails its CRC check and returns why.
+func (lr *LogReader) ForEachBatch(fileName string, fn func(batch *RecordBatch)) error {
+	filePath := filepath.Join(lr.basePath, fileName)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", fileName, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file %s: %w", fileName, err)
+	}
+
+	position := int64(0)
+	for {
+		header, err := readBatchHeaderAt(file, position, info.Size())
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("batch at position %d of %s: %w", position, fileName, err)
+		}
+
+		data := make([]byte, BatchHeaderSize+int(header.BatchLength))
+		if _, err := file.ReadAt(data, position); err != nil {
+			return fmt.Errorf("failed to read batch at position %d of %s: %w", position, fileName, err)
+		}
+		batch, err := ParseRecordBatchHeader(data)
+		if err != nil {
+			return fmt.Errorf("batch at position %d of %s: %w", position, fileName, err)
+		}
+		fn(batch)
+		position += int64(batch.Size())
+	}
+}
+
 // GetLogFileInfo returns information about a specific log file
 func (lr *LogReader) GetLogFileInfo(fileName string) (*LogEntry, error) {
 	filePath := filepath.Join(lr.basePath, fileName)
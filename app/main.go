@@ -1,5 +1,34 @@
 // Package main implements a SwiftQueue protocol server that handles basic SwiftQueue API requests.
 // This server supports the following SwiftQueue APIs:
+//   - Produce (API Key 0): Appends record batches to on-disk partition logs
+//   - Fetch (API Key 1): Returns stored record batches from partition logs
+//   - ListOffsets (API Key 2): Resolves timestamps and earliest/latest sentinels to offsets
+//   - Metadata (API Key 3): Returns brokers, topics and partition leaders, optionally auto-creating topics
+//   - OffsetCommit (API Key 8): Stores a consumer group's committed offsets in the offsets log
+//   - OffsetFetch (API Key 9): Returns a consumer group's committed offsets
+//   - FindCoordinator (API Key 10): Names this broker as the coordinator of every group
+//   - JoinGroup (API Key 11): Joins a consumer group, waiting for the group to rebalance
+//   - Heartbeat (API Key 12): Keeps a group member's session alive
+//   - LeaveGroup (API Key 13): Removes members from a consumer group
+//   - SyncGroup (API Key 14): Distributes the leader's partition assignment to the members
+//   - DescribeGroups (API Key 15): Describes groups, their members and assignments
+//   - ListGroups (API Key 16): Lists groups, optionally filtered by state and type
+//   - CreateTopics (API Key 19): Validates and creates topics in the metadata log
+//   - DeleteTopics (API Key 20): Removes topics and deletes their partition data
+//   - InitProducerId (API Key 22): Allocates producer IDs for idempotent and transactional producers
+//   - AddPartitionsToTxn (API Key 24): Adds partitions to a producer's transaction
+//   - AddOffsetsToTxn (API Key 25): Adds a group's offset commits to a producer's transaction
+//   - EndTxn (API Key 26): Commits or aborts a transaction by writing markers to its partitions
+//   - WriteTxnMarkers (API Key 27): Writes commit or abort markers to partitions
+//   - TxnOffsetCommit (API Key 28): Commits a group's offsets inside a transaction
+//   - CreatePartitions (API Key 37): Adds partitions to existing topics
+//   - DeleteGroups (API Key 42): Deletes empty groups and their committed offsets
+//   - OffsetDelete (API Key 47): Deletes a group's committed offsets for topics it no longer consumes
+//   - ConsumerGroupHeartbeat (API Key 68): Runs the consumer rebalance protocol with server-side assignment
+//   - ConsumerGroupDescribe (API Key 69): Describes consumer groups using the consumer rebalance protocol
+//   - ShareGroupHeartbeat (API Key 76): Keeps share group members alive and assigns them partitions
+//   - ShareFetch (API Key 78): Acquires records for share group members and applies acknowledgements
+//   - ShareAcknowledge (API Key 79): Accepts, releases or rejects records acquired by share group members
 //   - ApiVersions (API Key 18): Returns the list of supported API versions
 //   - DescribeTopicPartitions (API Key 1): Returns metadata about topics
 //   - DescribeCluster (API Key 75): Returns cluster metadata
@@ -1,21 +1,34 @@
 package main
 
 import (
-	"encoding/binary"
-	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 )
 
 // Constants for metadata parsing
 const (
 	// Batch header offsets
-	BatchHeaderSize     = 12
-	BatchLengthOffset   = 8
-	RecordBatchOverhead = 45
+	BatchHeaderSize   = 12
+	BatchLengthOffset = 8
 
 	// Record type identifiers
-	RecordTypeTopic     = 2
-	RecordTypePartition = 3
+	RecordTypeRegisterBroker           = 0
+	RecordTypeUnregisterBroker         = 1
+	RecordTypeTopic                    = 2
+	RecordTypePartition                = 3
+	RecordTypeConfig                   = 4
+	RecordTypePartitionChange          = 5
+	RecordTypeFenceBroker              = 7
+	RecordTypeUnfenceBroker            = 8
+	RecordTypeRemoveTopic              = 9
+	RecordTypeFeatureLevel             = 12
+	RecordTypeProducerIDs              = 15
+	RecordTypeBrokerRegistrationChange = 17
+
+	// Config resource types
+	ConfigResourceTypeTopic  = 2
+	ConfigResourceTypeBroker = 4
 
 	// UUID size
 	UUIDSize = 16
@@ -48,248 +61,104 @@ func (ms *MetadataService) Close() error {
 	return nil
 }
 
-// GetTopicsAndPartitions reads all topics and partitions from the cluster metadata
-func (ms *MetadataService) GetTopicsAndPartitions() ([]Topic, []Partition, error) {
-	logFile, err := ms.logReader.ReadLogFile("00000000000000000000.log")
-	fmt.Printf("Log file data: % X\n", logFile.Data)
-
+// LoadImage reads the metadata log segments in order and applies their records. Records that
+// cannot be decoded are skipped. Reading stops at the first incomplete or corrupt batch: it is
+// either still being written or dropped by the recovery at the next startup.
+func (ms *MetadataService) LoadImage() (*MetadataImage, error) {
+	logFiles, err := ms.logReader.ListLogFiles()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read log file: %w", err)
+		return nil, fmt.Errorf("failed to list log files: %w", err)
 	}
 
-	topics, partitions := ms.parseMetadataLog(logFile.Data)
-	return topics, partitions, nil
-}
-
-// parseMetadataLog parses the metadata log file and extracts topics and partitions
-func (ms *MetadataService) parseMetadataLog(data []byte) ([]Topic, []Partition) {
-	topics := make([]Topic, 0)
-	partitions := make([]Partition, 0)
-
-	offset := 0
-	for offset < len(data) {
-		// Check if we have enough data for batch header
-		if offset+BatchHeaderSize > len(data) {
+	image := NewMetadataImage()
+	for _, fileName := range logFiles {
+		err := ms.logReader.ForEachBatch(fileName, func(batch *RecordBatch) {
+			records, err := batch.Records()
+			if err != nil {
+				return
+			}
+			for _, record := range records {
+				image.Apply(record.Value)
+			}
+		})
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrCorruptBatch) || errors.Is(err, ErrUnsupportedMagic) {
 			break
 		}
-
-		// Read batch length
-		batchLength := binary.BigEndian.Uint32(data[offset+BatchLengthOffset : offset+BatchHeaderSize])
-		recordOffset := offset + BatchHeaderSize + RecordBatchOverhead
-		// Parse records in this batch
-		batchTopics, batchPartitions := ms.parseRecordBatch(data[recordOffset:])
-		topics = append(topics, batchTopics...)
-		partitions = append(partitions, batchPartitions...)
-
-		// Move to next batch
-		totalRecordSize := BatchHeaderSize + int(batchLength)
-		if offset+totalRecordSize > len(data)-1 {
-			break
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log file: %w", err)
 		}
-		offset += totalRecordSize
 	}
-	fmt.Printf("topics: %+v\n partitions: %+v\n", topics, partitions)
-
-	return topics, partitions
+	return image, nil
 }
 
-// parseRecordBatch parses a single record batch
-func (ms *MetadataService) parseRecordBatch(batch []byte) ([]Topic, []Partition) {
-	if len(batch) < 4 {
-		return nil, nil
-	}
-
-	topics := make([]Topic, 0)
-	partitions := make([]Partition, 0)
-
-	offset := 0
-	recordsLength := binary.BigEndian.Uint32(batch[offset : offset+4])
-	offset += 4
-
-	recordOffset := offset
-	for i := 0; i < int(recordsLength); i++ {
-		if recordOffset >= len(batch) {
-			break
-		}
-
-		offset = recordOffset
-
-		// Read record length
-		var perRecordLengthInt int16
-		if i == 0 {
-			perRecordLength := uint16(batch[offset])
-			perRecordLengthInt = ZigZagDecode16(perRecordLength)
-			offset += 1
-			recordOffset += int(perRecordLengthInt) + 1
-		} else {
-			perRecordLength := uint16(batch[offset])
-			perRecordLengthInt = ZigZagDecode16(perRecordLength)
-			offset += 2
-			recordOffset += int(perRecordLengthInt) + 2
-		}
-
-		offset += 3 // Skip attributes, timestamp delta, and offset delta
-
-		// Parse key
-		if offset >= len(batch) {
-			break
-		}
-		keyLength := int(batch[offset])
-		offset += 1
-		if keyLength > 1 {
-			offset += keyLength - 1
-		}
-
-		// Parse value
-		if offset >= len(batch) {
-			break
-		}
-
-		var valueLengthInt int
-		if i == 0 {
-			valueLength := uint16(batch[offset])
-			valueLengthInt = int(ZigZagDecode16(valueLength))
-			offset += 1
-		} else {
-			valueLength := uint16(batch[offset])
-			valueLengthInt = int(ZigZagDecode16(valueLength))
-			offset += 2
-		}
-
-		offset += 1 // Skip headers count
-		typeRecord := int(batch[offset])
-		offset += 2 // Skip to record data
-
-		// Parse based on record type
-		if typeRecord == int(RecordTypeTopic) {
-			topic, _ := ms.parseTopicRecord(batch, offset)
-			if topic != nil {
-				topics = append(topics, *topic)
-			}
-		} else if typeRecord == RecordTypePartition {
-			partition, _ := ms.parsePartitionRecord(batch, offset)
-			if partition != nil {
-				partitions = append(partitions, *partition)
-			}
-		}
-
-		offset += valueLengthInt
+// GetTopicsAndPartitions reads all topics and partitions from the cluster metadata
+func (ms *MetadataService) GetTopicsAndPartitions() ([]Topic, []Partition, error) {
+	image, err := ms.LoadImage()
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return topics, partitions
-}
-
-// ZigZagDecode8 decodes a ZigZag-encoded 8-bit integer
-func ZigZagDecode8(n uint8) int8 {
-	return int8((n >> 1) ^ uint8(-(int8(n) & 1)))
+	return image.Topics, image.Partitions, nil
 }
 
-func ZigZagDecode16(n uint16) int16 {
-	return int16((n >> 1) ^ uint16(-(int16(n) & 1)))
-}
-
-// parseTopicRecord parses a topic record
-func (ms *MetadataService) parseTopicRecord(batch []byte, offset int) (*Topic, int) {
-	if offset >= len(batch) {
-		return nil, offset
-	}
-
-	nameLength := int(batch[offset])
-	offset += 1
-
-	if offset+nameLength-1 >= len(batch) {
-		return nil, offset
-	}
-
-	topicName := batch[offset : offset+nameLength-1]
-	offset += nameLength - 1
-
-	if offset+UUIDSize >= len(batch) {
-		return nil, offset
+// NextProducerID returns the first producer ID not yet reserved by a broker, as recorded by
+// the latest ProducerIdsRecord of the metadata log
+func (ms *MetadataService) NextProducerID() (int64, error) {
+	image, err := ms.LoadImage()
+	if err != nil {
+		return 0, err
 	}
-	topicUUID := batch[offset : offset+UUIDSize]
-	offset += UUIDSize
-
-	return &Topic{
-		Name: string(topicName),
-		UUID: hex.EncodeToString(topicUUID),
-	}, offset
+	return image.NextProducerID, nil
 }
 
-// parsePartitionRecord parses a partition record
-func (ms *MetadataService) parsePartitionRecord(batch []byte, offset int) (*Partition, int) {
-	if offset+1 > len(batch) {
-		return nil, offset
+// decodeMetadataFrame reads the frame version, record type and record version that prefix
+// every metadata record value
+func decodeMetadataFrame(d *Decoder) (recordType int, version int, err error) {
+	frameVersion := d.ReadUVarint()
+	recordType = int(d.ReadUVarint())
+	version = int(d.ReadUVarint())
+	if err := d.Err(); err != nil {
+		return 0, 0, err
 	}
-
-	// Parse partition ID
-	if offset+4 > len(batch) {
-		return nil, offset
+	if frameVersion > metadataFrameVersion {
+		return 0, 0, fmt.Errorf("unsupported metadata record frame version %d", frameVersion)
 	}
-	partitionID := binary.BigEndian.Uint32(batch[offset : offset+4])
-	offset += 4
-
-	// Parse topic UUID
-	if offset+UUIDSize > len(batch) {
-		return nil, offset
-	}
-	topicUUID := batch[offset : offset+UUIDSize]
-	offset += UUIDSize
-
-	// Parse replicas
-	if offset+1 > len(batch) {
-		return nil, offset
-	}
-	lengthReplica := int(batch[offset])
-	offset += 1
-
-	if offset+4 > len(batch) {
-		return nil, offset
-	}
-	replicaID := binary.BigEndian.Uint32(batch[offset : offset+4])
-	offset += 4
-
-	// Parse in-sync replicas
-	if offset+1 > len(batch) {
-		return nil, offset
-	}
-	lengthSyncReplica := int(batch[offset])
-	offset += 1
-
-	if offset+4 > len(batch) {
-		return nil, offset
-	}
-	syncReplicaID := binary.BigEndian.Uint32(batch[offset : offset+4])
-	offset += 4
+	return recordType, version, nil
+}
 
-	// Parse removing and adding replicas
-	if offset+2 > len(batch) {
-		return nil, offset
+// decodeTopicRecord decodes a TopicRecord: the topic name and ID
+func decodeTopicRecord(d *Decoder) (Topic, error) {
+	topic := Topic{
+		Name: d.ReadString(true),
+		UUID: d.ReadUUID(),
 	}
-	lengthRemovingReplica := int(batch[offset])
-	offset += 1
-	lengthAddingReplica := int(batch[offset])
-	offset += 1
+	d.SkipTaggedFields(true)
+	return topic, d.Err()
+}
 
-	// Parse leader info
-	if offset+8 > len(batch) {
-		return nil, offset
+// decodePartitionRecord decodes a PartitionRecord: the partition's replica sets, leader and
+// epochs. Version 1 added the log directory of each replica, which SwiftQueue does not track.
+func decodePartitionRecord(d *Decoder, version int) (Partition, error) {
+	partition := Partition{
+		ID:               uint32(d.ReadInt32()),
+		TopicUUID:        d.ReadUUID(),
+		ReplicaIDs:       d.ReadInt32Array(true),
+		ISR:              d.ReadInt32Array(true),
+		RemovingReplicas: d.ReadInt32Array(true),
+		AddingReplicas:   d.ReadInt32Array(true),
+		LeaderID:         uint32(d.ReadInt32()),
+		LeaderEpoch:      uint32(d.ReadInt32()),
+		PartitionEpoch:   d.ReadInt32(),
+	}
+	if version >= 1 {
+		directoryCount := d.ReadArrayLength(true)
+		for i := 0; i < directoryCount && d.Err() == nil; i++ {
+			d.ReadUUID()
+		}
 	}
-	leaderID := binary.BigEndian.Uint32(batch[offset : offset+4])
-	offset += 4
-	leaderEpoch := binary.BigEndian.Uint32(batch[offset : offset+4])
-	offset += 4
-
-	return &Partition{
-		ID:                    partitionID,
-		TopicUUID:             hex.EncodeToString(topicUUID),
-		ReplicaLength:         lengthReplica,
-		ReplicaID:             replicaID,
-		LengthSyncReplica:     lengthSyncReplica,
-		InSyncReplica:         syncReplicaID,
-		LengthRemovingReplica: lengthRemovingReplica,
-		LengthAddingReplica:   lengthAddingReplica,
-		LeaderID:              leaderID,
-		LeaderEpoch:           leaderEpoch,
-	}, offset
+	d.ReadTaggedFields(func(tag uint64, field *Decoder) {
+		if tag == 0 {
+			partition.LeaderRecoveryState = field.ReadInt8()
+		}
+	})
+	return partition, d.Err()
 }
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Values of the PartitionChangeRecord and BrokerRegistrationChangeRecord fields that leave
+// the corresponding state unchanged or change it
+const (
+	partitionChangeLeaderUnchanged = -2
+	brokerRegistrationFence        = -1
+	brokerRegistrationUnfence      = 1
+	brokerRegistrationShuttingDown = 1
+)
+
+// ConfigResource identifies the topic or broker a config applies to
+type ConfigResource struct {
+	Type int8
+	Name string
+}
+
+// BrokerEndpoint is a listener a broker registered
+type BrokerEndpoint struct {
+	Name             string
+	Host             string
+	Port             uint16
+	SecurityProtocol int16
+}
+
+// FeatureRange is the range of levels of a feature a broker supports
+type FeatureRange struct {
+	Min int16
+	Max int16
+}
+
+// BrokerRegistration is a broker registered with the controller
+type BrokerRegistration struct {
+	ID                   int32
+	Epoch                int64
+	IncarnationID        string
+	Endpoints            []BrokerEndpoint
+	Features             map[string]FeatureRange
+	Rack                 *string
+	Fenced               bool
+	InControlledShutdown bool
+}
+
+// MetadataImage is the cluster metadata obtained by applying the records of the metadata log
+// in order: the topics and their partitions, the registered brokers, the config overrides of
+// topics and brokers, and the finalized feature levels.
+type MetadataImage struct {
+	Topics     []Topic
+	Partitions []Partition
+	Brokers    map[int32]*BrokerRegistration
+	// Configs holds the config overrides of each resource
+	Configs map[ConfigResource]map[string]string
+	// Features holds the finalized level of each feature
+	Features map[string]int16
+	// NextProducerID is the first producer ID not yet reserved by a broker
+	NextProducerID int64
+}
+
+// NewMetadataImage creates an image of an empty cluster
+func NewMetadataImage() *MetadataImage {
+	return &MetadataImage{
+		Topics:     make([]Topic, 0),
+		Partitions: make([]Partition, 0),
+		Brokers:    make(map[int32]*BrokerRegistration),
+		Configs:    make(map[ConfigResource]map[string]string),
+		Features:   make(map[string]int16),
+	}
+}
+
+// Clone returns a copy of the image that records can be applied to without changing the image
+func (img *MetadataImage) Clone() *MetadataImage {
+	clone := &MetadataImage{
+		Topics:         slices.Clone(img.Topics),
+		Partitions:     slices.Clone(img.Partitions),
+		Brokers:        make(map[int32]*BrokerRegistration, len(img.Brokers)),
+		Configs:        make(map[ConfigResource]map[string]string, len(img.Configs)),
+		Features:       maps.Clone(img.Features),
+		NextProducerID: img.NextProducerID,
+	}
+	for id, registration := range img.Brokers {
+		copied := *registration
+		clone.Brokers[id] = &copied
+	}
+	for resource, configs := range img.Configs {
+		clone.Configs[resource] = maps.Clone(configs)
+	}
+	return clone
+}
+
+// TopicConfigs returns the config overrides of a topic
+func (img *MetadataImage) TopicConfigs(name string) map[string]string {
+	return img.Configs[ConfigResource{Type: ConfigResourceTypeTopic, Name: name}]
+}
+
+// BrokerConfigs returns the config overrides of a broker
+func (img *MetadataImage) BrokerConfigs(brokerID int32) map[string]string {
+	return img.Configs[ConfigResource{Type: ConfigResourceTypeBroker, Name: fmt.Sprint(brokerID)}]
+}
+
+// Broker returns the registration of a broker, or nil if it is not registered
+func (img *MetadataImage) Broker(brokerID int32) *BrokerRegistration {
+	return img.Brokers[brokerID]
+}
+
+// UnfencedBrokers returns the registered brokers that are not fenced, ordered by ID
+func (img *MetadataImage) UnfencedBrokers() []*BrokerRegistration {
+	var brokers []*BrokerRegistration
+	for _, id := range slices.Sorted(maps.Keys(img.Brokers)) {
+		if !img.Brokers[id].Fenced {
+			brokers = append(brokers, img.Brokers[id])
+		}
+	}
+	return brokers
+}
+
+// FeatureLevel returns the finalized level of a feature, or 0 if it is not finalized
+func (img *MetadataImage) FeatureLevel(name string) int16 {
+	return img.Features[name]
+}
+
+// Apply applies the value of a metadata record. Record types the image does not track are
+// ignored; records of tracked types that cannot be decoded return an error.
+func (img *MetadataImage) Apply(value []byte) error {
+	d := NewDecoder(value)
+	recordType, version, err := decodeMetadataFrame(d)
+	if err != nil {
+		return fmt.Errorf("failed to decode metadata record frame: %w", err)
+	}
+
+	switch recordType {
+	case RecordTypeTopic:
+		var topic Topic
+		if topic, err = decodeTopicRecord(d); err == nil {
+			img.Topics = append(img.Topics, topic)
+		}
+	case RecordTypePartition:
+		var partition Partition
+		if partition, err = decodePartitionRecord(d, version); err == nil {
+			img.putPartition(partition)
+		}
+	case RecordTypePartitionChange:
+		err = img.applyPartitionChange(d)
+	case RecordTypeRemoveTopic:
+		img.removeTopic(d.ReadUUID())
+		err = d.Err()
+	case RecordTypeConfig:
+		err = img.applyConfig(d)
+	case RecordTypeRegisterBroker:
+		err = img.applyRegisterBroker(d, version)
+	case RecordTypeUnregisterBroker, RecordTypeFenceBroker, RecordTypeUnfenceBroker, RecordTypeBrokerRegistrationChange:
+		err = img.applyBrokerChange(d, recordType)
+	case RecordTypeFeatureLevel:
+		name := d.ReadString(true)
+		level := d.ReadInt16()
+		if err = d.Err(); err == nil {
+			if level == 0 {
+				delete(img.Features, name)
+			} else {
+				img.Features[name] = level
+			}
+		}
+	case RecordTypeProducerIDs:
+		d.ReadInt32() // broker ID
+		d.ReadInt64() // broker epoch
+		next := d.ReadInt64()
+		if err = d.Err(); err == nil {
+			img.NextProducerID = next
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to decode metadata record of type %d: %w", recordType, err)
+	}
+	return nil
+}
+
+// putPartition adds a partition, replacing the partition with the same topic and index
+func (img *MetadataImage) putPartition(partition Partition) {
+	for i := range img.Partitions {
+		if img.Partitions[i].TopicUUID == partition.TopicUUID && img.Partitions[i].ID == partition.ID {
+			img.Partitions[i] = partition
+			return
+		}
+	}
+	img.Partitions = append(img.Partitions, partition)
+}
+
+// removeTopic removes a topic with its partitions and config overrides
+func (img *MetadataImage) removeTopic(topicUUID string) {
+	if topic := findTopicByUUID(img.Topics, topicUUID); topic != nil {
+		delete(img.Configs, ConfigResource{Type: ConfigResourceTypeTopic, Name: topic.Name})
+	}
+	img.Topics = slices.DeleteFunc(img.Topics, func(topic Topic) bool {
+		return topic.UUID == topicUUID
+	})
+	img.Partitions = slices.DeleteFunc(img.Partitions, func(partition Partition) bool {
+		return partition.TopicUUID == topicUUID
+	})
+}
+
+// applyPartitionChange applies a PartitionChangeRecord: only the fields present in its tagged
+// fields change, a new leader starts a new leader epoch and every change a new partition epoch
+func (img *MetadataImage) applyPartitionChange(d *Decoder) error {
+	partitionID := d.ReadInt32()
+	topicUUID := d.ReadUUID()
+
+	leader := int32(partitionChangeLeaderUnchanged)
+	leaderRecoveryState := int8(-1)
+	var isr, replicas, removing, adding []int32
+	d.ReadTaggedFields(func(tag uint64, field *Decoder) {
+		switch tag {
+		case 0:
+			isr = field.ReadInt32Array(true)
+		case 1:
+			leader = field.ReadInt32()
+		case 2:
+			replicas = field.ReadInt32Array(true)
+		case 3:
+			removing = field.ReadInt32Array(true)
+		case 4:
+			adding = field.ReadInt32Array(true)
+		case 5:
+			leaderRecoveryState = field.ReadInt8()
+		}
+	})
+	if err := d.Err(); err != nil {
+		return err
+	}
+
+	index := slices.IndexFunc(img.Partitions, func(partition Partition) bool {
+		return partition.TopicUUID == topicUUID && partition.ID == uint32(partitionID)
+	})
+	if index < 0 {
+		return fmt.Errorf("change of unknown partition %d of topic %s", partitionID, topicUUID)
+	}
+	partition := &img.Partitions[index]
+
+	if isr != nil {
+		partition.ISR = isr
+	}
+	if replicas != nil {
+		partition.ReplicaIDs = replicas
+	}
+	if removing != nil {
+		partition.RemovingReplicas = removing
+	}
+	if adding != nil {
+		partition.AddingReplicas = adding
+	}
+	if leaderRecoveryState >= 0 {
+		partition.LeaderRecoveryState = leaderRecoveryState
+	}
+	if leader != partitionChangeLeaderUnchanged {
+		partition.LeaderID = uint32(leader)
+		partition.LeaderEpoch++
+	}
+	partition.PartitionEpoch++
+	return nil
+}
+
+// applyConfig applies a ConfigRecord: a null value removes the override
+func (img *MetadataImage) applyConfig(d *Decoder) error {
+	resource := ConfigResource{Type: d.ReadInt8(), Name: d.ReadString(true)}
+	name := d.ReadString(true)
+	value := d.ReadNullableString(true)
+	if err := d.Err(); err != nil {
+		return err
+	}
+
+	configs := img.Configs[resource]
+	if value == nil {
+		delete(configs, name)
+		if len(configs) == 0 {
+			delete(img.Configs, resource)
+		}
+		return nil
+	}
+	if configs == nil {
+		configs = make(map[string]string)
+		img.Configs[resource] = configs
+	}
+	configs[name] = *value
+	return nil
+}
+
+// applyRegisterBroker applies a RegisterBrokerRecord, replacing any previous registration of the broker
+func (img *MetadataImage) applyRegisterBroker(d *Decoder, version int) error {
+	registration := &BrokerRegistration{
+		ID:       d.ReadInt32(),
+		Features: make(map[string]FeatureRange),
+	}
+	if version >= 2 {
+		d.ReadBool() // is migrating ZooKeeper broker
+	}
+	registration.IncarnationID = d.ReadUUID()
+	registration.Epoch = d.ReadInt64()
+
+	endpointCount := d.ReadArrayLength(true)
+	for i := 0; i < endpointCount && d.Err() == nil; i++ {
+		registration.Endpoints = append(registration.Endpoints, BrokerEndpoint{
+			Name:             d.ReadString(true),
+			Host:             d.ReadString(true),
+			Port:             uint16(d.ReadInt16()),
+			SecurityProtocol: d.ReadInt16(),
+		})
+		d.SkipTaggedFields(true)
+	}
+
+	featureCount := d.ReadArrayLength(true)
+	for i := 0; i < featureCount && d.Err() == nil; i++ {
+		name := d.ReadString(true)
+		registration.Features[name] = FeatureRange{Min: d.ReadInt16(), Max: d.ReadInt16()}
+		d.SkipTaggedFields(true)
+	}
+
+	registration.Rack = d.ReadNullableString(true)
+	registration.Fenced = d.ReadBool()
+	if version >= 1 {
+		registration.InControlledShutdown = d.ReadBool()
+	}
+	if err := d.Err(); err != nil {
+		return err
+	}
+
+	img.Brokers[registration.ID] = registration
+	return nil
+}
+
+// applyBrokerChange applies the records changing a registered broker: unregistering, fencing
+// and unfencing it, or changing its registration. Records for an older epoch of the broker
+// are ignored.
+func (img *MetadataImage) applyBrokerChange(d *Decoder, recordType int) error {
+	brokerID := d.ReadInt32()
+	epoch := d.ReadInt64()
+
+	fenced, shuttingDown := int8(0), int8(0)
+	if recordType == RecordTypeBrokerRegistrationChange {
+		d.ReadTaggedFields(func(tag uint64, field *Decoder) {
+			switch tag {
+			case 0:
+				fenced = field.ReadInt8()
+			case 1:
+				shuttingDown = field.ReadInt8()
+			}
+		})
+	}
+	if err := d.Err(); err != nil {
+		return err
+	}
+
+	registration := img.Brokers[brokerID]
+	if registration == nil || registration.Epoch != epoch {
+		return nil
+	}
+	switch recordType {
+	case RecordTypeUnregisterBroker:
+		delete(img.Brokers, brokerID)
+	case RecordTypeFenceBroker:
+		registration.Fenced = true
+	case RecordTypeUnfenceBroker:
+		registration.Fenced = false
+	case RecordTypeBrokerRegistrationChange:
+		switch fenced {
+		case brokerRegistrationFence:
+			registration.Fenced = true
+		case brokerRegistrationUnfence:
+			registration.Fenced = false
+		}
+		if shuttingDown == brokerRegistrationShuttingDown {
+			registration.InControlledShutdown = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import "fmt"
+
+// MetadataRequest represents a parsed Metadata request
+type MetadataRequest struct {
+	// Topics lists the requested topics; nil means every topic
+	Topics                             []MetadataRequestTopic
+	AllowAutoTopicCreation             bool
+	IncludeClusterAuthorizedOperations bool
+	IncludeTopicAuthorizedOperations   bool
+}
+
+// MetadataRequestTopic names a requested topic.
+// From v10 a topic may be identified by TopicID instead, in which case Name is nil.
+type MetadataRequestTopic struct {
+	TopicID string
+	Name    *string
+}
+
+// ParseMetadataRequest parses the body of a Metadata request (v0-v12)
+func ParseMetadataRequest(baseReq *SwiftQueueRequest) (*MetadataRequest, error) {
+	version := baseReq.APIVersion
+	if version < MetadataMinVersion || version > MetadataMaxVersion {
+		return nil, fmt.Errorf("unsupported metadata version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	// Versions before 4 always allow auto-creation
+	req := &MetadataRequest{AllowAutoTopicCreation: true}
+
+	topicCount := d.ReadArrayLength(flexible)
+	if topicCount >= 0 {
+		req.Topics = make([]MetadataRequestTopic, 0, topicCount)
+	}
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := MetadataRequestTopic{}
+		if version >= 10 {
+			topic.TopicID = d.ReadUUID()
+			topic.Name = d.ReadNullableString(flexible)
+		} else {
+			name := d.ReadString(flexible)
+			topic.Name = &name
+		}
+		d.SkipTaggedFields(flexible)
+
+		req.Topics = append(req.Topics, topic)
+	}
+	// An empty topic array meant "all topics" before null arrays were allowed
+	if version == 0 && len(req.Topics) == 0 {
+		req.Topics = nil
+	}
+
+	if version >= 4 {
+		req.AllowAutoTopicCreation = d.ReadBool()
+	}
+	if version >= 8 && version <= 10 {
+		req.IncludeClusterAuthorizedOperations = d.ReadBool()
+	}
+	if version >= 8 {
+		req.IncludeTopicAuthorizedOperations = d.ReadBool()
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata request: %w", err)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// NoTopicID is the all-zero topic ID sent when a topic has no ID or none was given
+var NoTopicID = strings.Repeat("0", 2*UUIDSize)
+
+// MetadataTopicResult describes one topic of a Metadata response
+type MetadataTopicResult struct {
+	ErrorCode  int16
+	Name       *string
+	TopicID    string
+	IsInternal bool
+	Partitions []MetadataPartitionResult
+}
+
+// MetadataPartitionResult describes the leader and replicas of one partition
+type MetadataPartitionResult struct {
+	ErrorCode       int16
+	Index           int32
+	LeaderID        int32
+	LeaderEpoch     int32
+	ReplicaNodes    []int32
+	InSyncReplicas  []int32
+	OfflineReplicas []int32
+}
+
+// BuildMetadataResponse describes this broker and the requested topics, auto-creating
+// unknown topics when both the request and the broker configuration allow it
+func BuildMetadataResponse(baseReq *SwiftQueueRequest, req *MetadataRequest, broker *Broker) []byte {
+	topics, partitions := broker.TopicsAndPartitions()
+
+	if req.AllowAutoTopicCreation && broker.config.AutoCreateTopic && autoCreateTopics(broker, topics, req.Topics) {
+		topics, partitions = broker.TopicsAndPartitions()
+	}
+
+	var results []MetadataTopicResult
+	if req.Topics == nil {
+		results = make([]MetadataTopicResult, 0, len(topics))
+		for i := range topics {
+			results = append(results, describeMetadataTopic(&topics[i], partitions))
+		}
+	} else {
+		results = make([]MetadataTopicResult, 0, len(req.Topics))
+		for _, requested := range req.Topics {
+			results = append(results, lookupMetadataTopic(topics, partitions, requested))
+		}
+	}
+
+	return encodeMetadataResponse(baseReq, req, broker.config, results)
+}
+
+// autoCreateTopics creates the requested topics that do not exist yet.
+// It returns true if any topic was created.
+func autoCreateTopics(broker *Broker, topics []Topic, requested []MetadataRequestTopic) bool {
+	created := false
+	for _, topic := range requested {
+		if topic.Name == nil || findTopicByName(topics, *topic.Name) != nil || ValidateTopicName(*topic.Name) != nil {
+			continue
+		}
+		assignments, err := broker.UniformAssignments(int32(broker.config.NumPartitions), 1)
+		if err != nil {
+			broker.logger.Printf("Metadata: failed to auto-create topic %s: %v", *topic.Name, err)
+			continue
+		}
+		if _, err := broker.CreateTopic(TopicSpec{Name: *topic.Name, Assignments: assignments}, false); err != nil {
+			if !errors.Is(err, ErrTopicAlreadyExists) {
+				broker.logger.Printf("Metadata: failed to auto-create topic %s: %v", *topic.Name, err)
+			}
+			continue
+		}
+		created = true
+	}
+	return created
+}
+
+// lookupMetadataTopic resolves a requested topic by name or ID
+func lookupMetadataTopic(topics []Topic, partitions []Partition, requested MetadataRequestTopic) MetadataTopicResult {
+	if requested.Name == nil {
+		if requested.TopicID != NoTopicID {
+			if topic := findTopicByUUID(topics, requested.TopicID); topic != nil {
+				return describeMetadataTopic(topic, partitions)
+			}
+		}
+		return MetadataTopicResult{
+			ErrorCode:  ErrorCodeUnknownTopicID,
+			TopicID:    requested.TopicID,
+			Partitions: []MetadataPartitionResult{},
+		}
+	}
+
+	result := MetadataTopicResult{
+		Name:       requested.Name,
+		TopicID:    NoTopicID,
+		IsInternal: IsInternalTopic(*requested.Name),
+		Partitions: []MetadataPartitionResult{},
+	}
+	if err := ValidateTopicName(*requested.Name); err != nil {
+		result.ErrorCode = ErrorCodeInvalidTopic
+		return result
+	}
+	topic := findTopicByName(topics, *requested.Name)
+	if topic == nil {
+		result.ErrorCode = ErrorCodeUnknownTopicOrPart
+		return result
+	}
+	return describeMetadataTopic(topic, partitions)
+}
+
+// describeMetadataTopic builds the result for an existing topic
+func describeMetadataTopic(topic *Topic, partitions []Partition) MetadataTopicResult {
+	name := topic.Name
+	result := MetadataTopicResult{
+		ErrorCode:  ErrorCodeNone,
+		Name:       &name,
+		TopicID:    topic.UUID,
+		IsInternal: IsInternalTopic(topic.Name),
+	}
+
+	topicPartitions := filterPartitionsByTopicUUID(partitions, topic.UUID)
+	result.Partitions = make([]MetadataPartitionResult, 0, len(topicPartitions))
+	for _, partition := range topicPartitions {
+		partitionResult := MetadataPartitionResult{
+			ErrorCode:       ErrorCodeNone,
+			Index:           int32(partition.ID),
+			LeaderID:        int32(partition.LeaderID),
+			LeaderEpoch:     int32(partition.LeaderEpoch),
+			ReplicaNodes:    partition.Replicas(),
+			InSyncReplicas:  partition.InSyncReplicas(),
+			OfflineReplicas: []int32{},
+		}
+		if partitionResult.LeaderID < 0 {
+			partitionResult.ErrorCode = ErrorCodeLeaderNotAvailable
+		}
+		result.Partitions = append(result.Partitions, partitionResult)
+	}
+
+	return result
+}
+
+// encodeMetadataResponse serializes the Metadata response for the request's version
+func encodeMetadataResponse(baseReq *SwiftQueueRequest, req *MetadataRequest, config *Config, results []MetadataTopicResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	if version >= 3 {
+		// Throttle time
+		rb.WriteInt32(0)
+	}
+
+	// Brokers: this broker is the only one
+	rb.WriteArrayLength(1, flexible)
+	rb.WriteInt32(int32(config.NodeID))
+	rb.WriteStringField(config.AdvertisedHost, flexible)
+	rb.WriteInt32(int32(config.Port))
+	if version >= 1 {
+		// Rack
+		rb.WriteNullableString(nil, flexible)
+	}
+	rb.WriteTaggedFields(flexible)
+
+	if version >= 2 {
+		var clusterID *string
+		if config.ClusterID != "" {
+			clusterID = &config.ClusterID
+		}
+		rb.WriteNullableString(clusterID, flexible)
+	}
+	if version >= 1 {
+		// Controller ID
+		rb.WriteInt32(int32(config.NodeID))
+	}
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, topic := range results {
+		rb.WriteInt16(topic.ErrorCode)
+		if version >= 12 {
+			rb.WriteNullableString(topic.Name, flexible)
+		} else {
+			name := ""
+			if topic.Name != nil {
+				name = *topic.Name
+			}
+			rb.WriteStringField(name, flexible)
+		}
+		if version >= 10 {
+			rb.WriteUUID(topic.TopicID)
+		}
+		if version >= 1 {
+			rb.WriteBool(topic.IsInternal)
+		}
+
+		rb.WriteArrayLength(len(topic.Partitions), flexible)
+		for _, partition := range topic.Partitions {
+			rb.WriteInt16(partition.ErrorCode)
+			rb.WriteInt32(partition.Index)
+			rb.WriteInt32(partition.LeaderID)
+			if version >= 7 {
+				rb.WriteInt32(partition.LeaderEpoch)
+			}
+			writeInt32Array(rb, partition.ReplicaNodes, flexible)
+			writeInt32Array(rb, partition.InSyncReplicas, flexible)
+			if version >= 5 {
+				writeInt32Array(rb, partition.OfflineReplicas, flexible)
+			}
+			rb.WriteTaggedFields(flexible)
+		}
+
+		if version >= 8 {
+			authorizedOperations := int32(AuthorizedOperationsOmitted)
+			if req.IncludeTopicAuthorizedOperations {
+				authorizedOperations = TopicAuthorizedOperations
+			}
+			rb.WriteInt32(authorizedOperations)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	if version >= 8 && version <= 10 {
+		authorizedOperations := int32(AuthorizedOperationsOmitted)
+		if req.IncludeClusterAuthorizedOperations {
+			authorizedOperations = ClusterAuthorizedOperations
+		}
+		rb.WriteInt32(authorizedOperations)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
+
+// writeInt32Array writes an array of 32-bit integers
+func writeInt32Array(rb *ResponseBuilder, values []int32, flexible bool) {
+	rb.WriteArrayLength(len(values), flexible)
+	for _, value := range values {
+		rb.WriteInt32(value)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metadata record framing written by the broker
+const (
+	metadataFrameVersion   = 1
+	topicRecordVersion     = 0
+	partitionRecordVersion = 1
+	configRecordVersion    = 0
+	removeTopicVersion     = 0
+	producerIDsVersion     = 0
+)
+
+// MetadataWriter appends records to the cluster metadata log read by MetadataService.
+// It keeps the image of the log in memory, so that requests resolve topics and partitions
+// without reading the log.
+type MetadataWriter struct {
+	config *Config
+	mu     sync.Mutex
+	dir    string
+
+	// image is replaced, never modified, as records are appended
+	image atomic.Pointer[MetadataImage]
+}
+
+// NewMetadataWriter creates a writer for the metadata log in the configured log directory
+func NewMetadataWriter(config *Config) *MetadataWriter {
+	w := &MetadataWriter{
+		config: config,
+		dir:    filepath.Clean(config.LogDirectory),
+	}
+	w.image.Store(NewMetadataImage())
+	return w
+}
+
+// Image returns the cluster metadata as of the last batch appended. The image is shared and
+// must not be modified.
+func (w *MetadataWriter) Image() *MetadataImage {
+	return w.image.Load()
+}
+
+// activeSegment returns the base offset and path of the last metadata log segment, which
+// records are appended to. The caller holds w.mu.
+func (w *MetadataWriter) activeSegment() (int64, string, error) {
+	baseOffsets, err := listSegmentBaseOffsets(w.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, "", err
+	}
+	baseOffset := int64(0)
+	if len(baseOffsets) > 0 {
+		baseOffset = baseOffsets[len(baseOffsets)-1]
+	}
+	return baseOffset, filepath.Join(w.dir, LogFileName(baseOffset)), nil
+}
+
+// Append writes the record values as a single batch at the end of the metadata log.
+// A partially written batch left at the tail of the log is overwritten.
+func (w *MetadataWriter) Append(values [][]byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create metadata log directory: %w", err)
+	}
+	baseOffset, path, err := w.activeSegment()
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open metadata log: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat metadata log: %w", err)
+	}
+
+	// Find the end of the last complete batch and the next offset to assign
+	position, nextOffset := int64(0), baseOffset
+	for {
+		batch, err := readBatchHeaderAt(file, position, info.Size())
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return err
+		}
+		nextOffset = batch.NextOffset()
+		position += BatchHeaderSize + int64(batch.BatchLength)
+	}
+
+	records := make([]Record, len(values))
+	for i, value := range values {
+		records[i] = Record{Value: value}
+	}
+	batch := BuildRecordBatch(nextOffset, time.Now().UnixMilli(), records)
+
+	if _, err := file.WriteAt(batch.Raw, position); err != nil {
+		return fmt.Errorf("failed to write metadata batch: %w", err)
+	}
+	if err := file.Truncate(position + int64(batch.Size())); err != nil {
+		return fmt.Errorf("failed to truncate metadata log: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync metadata log: %w", err)
+	}
+
+	image := w.image.Load().Clone()
+	for _, value := range values {
+		image.Apply(value)
+	}
+	w.image.Store(image)
+	return nil
+}
+
+// Recover truncates the active metadata log segment after its last valid batch, dropping a
+// batch that a crash left incomplete or corrupt, so that records appended later are not
+// hidden behind it, and then loads the image of the log
+func (w *MetadataWriter) Recover(logger *log.Logger) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.truncateInvalidTail(logger); err != nil {
+		return err
+	}
+	return w.loadImage()
+}
+
+// loadImage reads the image of the metadata log. A missing metadata log just means no topics
+// exist yet. The caller holds w.mu.
+func (w *MetadataWriter) loadImage() error {
+	metadataService, err := NewMetadataService(w.config)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create metadata service: %w", err)
+	}
+	defer metadataService.Close()
+
+	image, err := metadataService.LoadImage()
+	if err != nil {
+		return fmt.Errorf("failed to load metadata image: %w", err)
+	}
+	w.image.Store(image)
+	return nil
+}
+
+// truncateInvalidTail truncates the active segment after its last valid batch. The caller holds w.mu.
+func (w *MetadataWriter) truncateInvalidTail(logger *log.Logger) error {
+	_, path, err := w.activeSegment()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read metadata log: %w", err)
+	}
+
+	position := 0
+	for position < len(data) {
+		batch, err := ParseRecordBatchHeader(data[position:])
+		if err != nil {
+			logger.Printf("Metadata log %s: invalid batch at position %d: %v; truncating %d bytes",
+				path, position, err, len(data)-position)
+			if err := os.Truncate(path, int64(position)); err != nil {
+				return fmt.Errorf("failed to truncate metadata log: %w", err)
+			}
+			return nil
+		}
+		position += batch.Size()
+	}
+	return nil
+}
+
+// NewTopicUUID generates a random hex-encoded topic ID
+func NewTopicUUID() (string, error) {
+	id := make([]byte, UUIDSize)
+	for {
+		if _, err := rand.Read(id); err != nil {
+			return "", fmt.Errorf("failed to generate topic id: %w", err)
+		}
+		// The all-zero UUID is reserved to mean "no topic ID"
+		for _, b := range id {
+			if b != 0 {
+				return hex.EncodeToString(id), nil
+			}
+		}
+	}
+}
+
+// appendMetadataFrame appends the frame version, record type and record version that prefix every metadata record value
+func appendMetadataFrame(buf []byte, recordType int, version int) []byte {
+	buf = binary.AppendUvarint(buf, metadataFrameVersion)
+	buf = binary.AppendUvarint(buf, uint64(recordType))
+	return binary.AppendUvarint(buf, uint64(version))
+}
+
+// EncodeTopicRecord encodes a TopicRecord value
+func EncodeTopicRecord(topic Topic) []byte {
+	uuid, _ := hex.DecodeString(topic.UUID)
+
+	buf := appendMetadataFrame(nil, RecordTypeTopic, topicRecordVersion)
+	buf = appendCompactString(buf, topic.Name)
+	buf = append(buf, uuid...)
+	return binary.AppendUvarint(buf, 0) // tagged fields
+}
+
+// EncodePartitionRecord encodes a PartitionRecord value for a partition replicated on replicas,
+// led by the first replica with every replica in sync
+func EncodePartitionRecord(topicUUID string, partition int32, replicas []int32) []byte {
+	uuid, _ := hex.DecodeString(topicUUID)
+	leader := int32(-1)
+	if len(replicas) > 0 {
+		leader = replicas[0]
+	}
+
+	buf := appendMetadataFrame(nil, RecordTypePartition, partitionRecordVersion)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(partition))
+	buf = append(buf, uuid...)
+	buf = appendCompactInt32s(buf, replicas) // replicas
+	buf = appendCompactInt32s(buf, replicas) // in-sync replicas
+	buf = appendCompactInt32s(buf, nil)      // removing replicas
+	buf = appendCompactInt32s(buf, nil)      // adding replicas
+	buf = binary.BigEndian.AppendUint32(buf, uint32(leader))
+	buf = binary.BigEndian.AppendUint32(buf, 0) // leader epoch
+	buf = binary.BigEndian.AppendUint32(buf, 0) // partition epoch
+
+	// Log directories, one per replica; the zero UUID means unassigned
+	buf = binary.AppendUvarint(buf, uint64(len(replicas)+1))
+	buf = append(buf, make([]byte, UUIDSize*len(replicas))...)
+
+	return binary.AppendUvarint(buf, 0) // tagged fields
+}
+
+// EncodeConfigRecord encodes a ConfigRecord value setting name to value on a resource
+func EncodeConfigRecord(resourceType int8, resourceName string, name string, value string) []byte {
+	buf := appendMetadataFrame(nil, RecordTypeConfig, configRecordVersion)
+	buf = append(buf, byte(resourceType))
+	buf = appendCompactString(buf, resourceName)
+	buf = appendCompactString(buf, name)
+	buf = appendCompactString(buf, value)
+	return binary.AppendUvarint(buf, 0) // tagged fields
+}
+
+// EncodeRemoveTopicRecord encodes a RemoveTopicRecord value
+func EncodeRemoveTopicRecord(topicUUID string) []byte {
+	uuid, _ := hex.DecodeString(topicUUID)
+
+	buf := appendMetadataFrame(nil, RecordTypeRemoveTopic, removeTopicVersion)
+	buf = append(buf, uuid...)
+	return binary.AppendUvarint(buf, 0) // tagged fields
+}
+
+// EncodeProducerIDsRecord encodes a ProducerIdsRecord value reserving every producer ID below
+// nextProducerID for the broker
+func EncodeProducerIDsRecord(brokerID int32, nextProducerID int64) []byte {
+	buf := appendMetadataFrame(nil, RecordTypeProducerIDs, producerIDsVersion)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(brokerID))
+	buf = binary.BigEndian.AppendUint64(buf, 0) // broker epoch
+	buf = binary.BigEndian.AppendUint64(buf, uint64(nextProducerID))
+	return binary.AppendUvarint(buf, 0) // tagged fields
+}
+
+// appendCompactString appends a compact string
+func appendCompactString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)+1))
+	return append(buf, s...)
+}
+
+// appendCompactInt32s appends a compact array of 32-bit integers
+func appendCompactInt32s(buf []byte, values []int32) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(values)+1))
+	for _, value := range values {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(value))
+	}
+	return buf
+}
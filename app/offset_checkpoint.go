@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// offsetCheckpointVersion is the format version of offset checkpoint files
+const offsetCheckpointVersion = 0
+
+// ReadOffsetCheckpoint reads an offset checkpoint file as written by Kafka: the version, the
+// number of entries, then one "<topic> <partition> <offset>" line per partition.
+// A missing file holds no offsets.
+func ReadOffsetCheckpoint(path string) (map[TopicPartition]int64, error) {
+	offsets := make(map[TopicPartition]int64)
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return offsets, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint %s: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lines := make([]string, 0)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %w", path, err)
+	}
+
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("malformed checkpoint %s: missing header", path)
+	}
+	if version, err := strconv.Atoi(lines[0]); err != nil || version != offsetCheckpointVersion {
+		return nil, fmt.Errorf("malformed checkpoint %s: unsupported version %q", path, lines[0])
+	}
+	count, err := strconv.Atoi(lines[1])
+	if err != nil || count != len(lines)-2 {
+		return nil, fmt.Errorf("malformed checkpoint %s: expected %q entries, found %d", path, lines[1], len(lines)-2)
+	}
+
+	for _, line := range lines[2:] {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed checkpoint %s: invalid entry %q", path, line)
+		}
+		partition, err := strconv.ParseInt(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed checkpoint %s: invalid partition in %q", path, line)
+		}
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed checkpoint %s: invalid offset in %q", path, line)
+		}
+		offsets[TopicPartition{Topic: fields[0], Partition: int32(partition)}] = offset
+	}
+
+	return offsets, nil
+}
+
+// WriteOffsetCheckpoint replaces the offset checkpoint file at path with offsets.
+// The file is written under a temporary name, synced and renamed, so a crash leaves either
+// the old or the new checkpoint.
+func WriteOffsetCheckpoint(path string, offsets map[TopicPartition]int64) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d\n%d\n", offsetCheckpointVersion, len(offsets))
+	for tp, offset := range offsets {
+		fmt.Fprintf(&sb, "%s %d %d\n", tp.Topic, tp.Partition, offset)
+	}
+
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint %s: %w", tmpPath, err)
+	}
+	if _, err := file.WriteString(sb.String()); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write checkpoint %s: %w", tmpPath, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync checkpoint %s: %w", tmpPath, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close checkpoint %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import "fmt"
+
+// OffsetCommitRequest represents a parsed OffsetCommit request
+type OffsetCommitRequest struct {
+	GroupID         string
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID *string
+	Topics          []OffsetCommitTopic
+}
+
+// OffsetCommitTopic holds the offsets committed for one topic
+type OffsetCommitTopic struct {
+	Name       string
+	Partitions []OffsetCommitPartition
+}
+
+// OffsetCommitPartition is the offset committed for one partition
+type OffsetCommitPartition struct {
+	Index       int32
+	Offset      int64
+	LeaderEpoch int32
+	Metadata    *string
+}
+
+// ParseOffsetCommitRequest parses the body of an OffsetCommit request (v2-v9)
+func ParseOffsetCommitRequest(baseReq *SwiftQueueRequest) (*OffsetCommitRequest, error) {
+	version := baseReq.APIVersion
+	if version < OffsetCommitMinVersion || version > OffsetCommitMaxVersion {
+		return nil, fmt.Errorf("unsupported offset commit version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &OffsetCommitRequest{}
+	req.GroupID = d.ReadString(flexible)
+	req.GenerationID = d.ReadInt32()
+	req.MemberID = d.ReadString(flexible)
+	if version >= 7 {
+		req.GroupInstanceID = d.ReadNullableString(flexible)
+	}
+	if version <= 4 {
+		// Retention time (ignored; offsets.retention.minutes applies)
+		d.ReadInt64()
+	}
+
+	topicCount := d.ReadArrayLength(flexible)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := OffsetCommitTopic{}
+		topic.Name = d.ReadString(flexible)
+
+		partitionCount := d.ReadArrayLength(flexible)
+		for j := 0; j < partitionCount && d.Err() == nil; j++ {
+			partition := OffsetCommitPartition{LeaderEpoch: -1}
+			partition.Index = d.ReadInt32()
+			partition.Offset = d.ReadInt64()
+			if version >= 6 {
+				partition.LeaderEpoch = d.ReadInt32()
+			}
+			partition.Metadata = d.ReadNullableString(flexible)
+			d.SkipTaggedFields(flexible)
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+
+		d.SkipTaggedFields(flexible)
+		req.Topics = append(req.Topics, topic)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse offset commit request: %w", err)
+	}
+
+	return req, nil
+}
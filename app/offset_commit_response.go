@@ -0,0 +1,99 @@
+package main
+
+import "time"
+
+// OffsetCommitTopicResult holds the per-partition results for one topic of an OffsetCommit request
+type OffsetCommitTopicResult struct {
+	Name       string
+	Partitions []OffsetCommitPartitionResult
+}
+
+// OffsetCommitPartitionResult is the outcome of committing the offset of one partition
+type OffsetCommitPartitionResult struct {
+	Index     int32
+	ErrorCode int16
+}
+
+// BuildOffsetCommitResponse validates the committed offsets, stores them through the
+// group coordinator and builds the response
+func BuildOffsetCommitResponse(baseReq *SwiftQueueRequest, req *OffsetCommitRequest, broker *Broker) []byte {
+	topics, partitions := broker.TopicsAndPartitions()
+
+	commitTimestamp := time.Now().UnixMilli()
+	offsets := make(map[TopicPartition]CommittedOffset)
+
+	results := make([]OffsetCommitTopicResult, 0, len(req.Topics))
+	for _, topicData := range req.Topics {
+		topicResult := OffsetCommitTopicResult{Name: topicData.Name}
+		topic := findTopicByName(topics, topicData.Name)
+
+		for _, partitionData := range topicData.Partitions {
+			result := OffsetCommitPartitionResult{Index: partitionData.Index, ErrorCode: ErrorCodeNone}
+			metadata := ""
+			if partitionData.Metadata != nil {
+				metadata = *partitionData.Metadata
+			}
+
+			switch {
+			case topic == nil || !hasPartition(partitions, topic.UUID, partitionData.Index):
+				result.ErrorCode = ErrorCodeUnknownTopicOrPart
+			case len(metadata) > broker.config.OffsetMetadataMaxBytes:
+				result.ErrorCode = ErrorCodeOffsetMetadataTooLarge
+			default:
+				offsets[TopicPartition{Topic: topicData.Name, Partition: partitionData.Index}] = CommittedOffset{
+					Offset:          partitionData.Offset,
+					LeaderEpoch:     partitionData.LeaderEpoch,
+					Metadata:        metadata,
+					CommitTimestamp: commitTimestamp,
+				}
+			}
+			topicResult.Partitions = append(topicResult.Partitions, result)
+		}
+
+		results = append(results, topicResult)
+	}
+
+	// Group errors apply to every partition that was otherwise valid
+	errorCode := broker.groupCoordinator.CommitOffsets(req.GroupID, req.GenerationID, req.MemberID, req.GroupInstanceID, offsets)
+	for _, topic := range results {
+		for i := range topic.Partitions {
+			if topic.Partitions[i].ErrorCode == ErrorCodeNone {
+				topic.Partitions[i].ErrorCode = errorCode
+			}
+		}
+	}
+
+	return encodeOffsetCommitResponse(baseReq, results)
+}
+
+// encodeOffsetCommitResponse serializes the OffsetCommit response for the request's version
+func encodeOffsetCommitResponse(baseReq *SwiftQueueRequest, results []OffsetCommitTopicResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	if version >= 3 {
+		// Throttle time
+		rb.WriteInt32(0)
+	}
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, topic := range results {
+		rb.WriteStringField(topic.Name, flexible)
+		rb.WriteArrayLength(len(topic.Partitions), flexible)
+		for _, partition := range topic.Partitions {
+			rb.WriteInt32(partition.Index)
+			rb.WriteInt16(partition.ErrorCode)
+			rb.WriteTaggedFields(flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
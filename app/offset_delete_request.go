@@ -0,0 +1,48 @@
+package main
+
+import "fmt"
+
+// OffsetDeleteRequest represents a parsed OffsetDelete request
+type OffsetDeleteRequest struct {
+	GroupID string
+	Topics  []OffsetDeleteTopic
+}
+
+// OffsetDeleteTopic names the partitions of one topic whose offsets should be deleted
+type OffsetDeleteTopic struct {
+	Name             string
+	PartitionIndexes []int32
+}
+
+// ParseOffsetDeleteRequest parses the body of an OffsetDelete request (v0)
+func ParseOffsetDeleteRequest(baseReq *SwiftQueueRequest) (*OffsetDeleteRequest, error) {
+	version := baseReq.APIVersion
+	if version < OffsetDeleteMinVersion || version > OffsetDeleteMaxVersion {
+		return nil, fmt.Errorf("unsupported offset delete version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &OffsetDeleteRequest{}
+	req.GroupID = d.ReadString(flexible)
+
+	topicCount := d.ReadArrayLength(flexible)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := OffsetDeleteTopic{}
+		topic.Name = d.ReadString(flexible)
+		partitionCount := d.ReadArrayLength(flexible)
+		for j := 0; j < partitionCount && d.Err() == nil; j++ {
+			topic.PartitionIndexes = append(topic.PartitionIndexes, d.ReadInt32())
+		}
+		d.SkipTaggedFields(flexible)
+		req.Topics = append(req.Topics, topic)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse offset delete request: %w", err)
+	}
+
+	return req, nil
+}
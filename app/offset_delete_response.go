@@ -0,0 +1,79 @@
+package main
+
+// OffsetDeleteTopicResult holds the per-partition results for one topic of an OffsetDelete request
+type OffsetDeleteTopicResult struct {
+	Name       string
+	Partitions []OffsetDeletePartitionResult
+}
+
+// OffsetDeletePartitionResult is the outcome of deleting the committed offset of one partition
+type OffsetDeletePartitionResult struct {
+	Index     int32
+	ErrorCode int16
+}
+
+// BuildOffsetDeleteResponse deletes the group's committed offsets for the requested
+// partitions and builds the response
+func BuildOffsetDeleteResponse(baseReq *SwiftQueueRequest, req *OffsetDeleteRequest, broker *Broker) []byte {
+	topics, partitions := broker.TopicsAndPartitions()
+
+	var requested []TopicPartition
+	for _, topicData := range req.Topics {
+		topic := findTopicByName(topics, topicData.Name)
+		for _, index := range topicData.PartitionIndexes {
+			if topic != nil && hasPartition(partitions, topic.UUID, index) {
+				requested = append(requested, TopicPartition{Topic: topicData.Name, Partition: index})
+			}
+		}
+	}
+
+	errorCode, errorCodes := broker.groupCoordinator.DeleteGroupOffsets(req.GroupID, requested)
+	if errorCode != ErrorCodeNone {
+		return encodeOffsetDeleteResponse(baseReq, errorCode, nil)
+	}
+
+	results := make([]OffsetDeleteTopicResult, 0, len(req.Topics))
+	for _, topicData := range req.Topics {
+		topicResult := OffsetDeleteTopicResult{Name: topicData.Name}
+		for _, index := range topicData.PartitionIndexes {
+			result := OffsetDeletePartitionResult{Index: index, ErrorCode: ErrorCodeUnknownTopicOrPart}
+			if code, ok := errorCodes[TopicPartition{Topic: topicData.Name, Partition: index}]; ok {
+				result.ErrorCode = code
+			}
+			topicResult.Partitions = append(topicResult.Partitions, result)
+		}
+		results = append(results, topicResult)
+	}
+
+	return encodeOffsetDeleteResponse(baseReq, ErrorCodeNone, results)
+}
+
+// encodeOffsetDeleteResponse serializes the OffsetDelete response
+func encodeOffsetDeleteResponse(baseReq *SwiftQueueRequest, errorCode int16, results []OffsetDeleteTopicResult) []byte {
+	flexible := IsFlexibleVersion(baseReq.APIKey, baseReq.APIVersion)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	rb.WriteInt16(errorCode)
+	// Throttle time
+	rb.WriteInt32(0)
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, topic := range results {
+		rb.WriteStringField(topic.Name, flexible)
+		rb.WriteArrayLength(len(topic.Partitions), flexible)
+		for _, partition := range topic.Partitions {
+			rb.WriteInt32(partition.Index)
+			rb.WriteInt16(partition.ErrorCode)
+			rb.WriteTaggedFields(flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
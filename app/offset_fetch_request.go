@@ -0,0 +1,90 @@
+package main
+
+import "fmt"
+
+// OffsetFetchRequest represents a parsed OffsetFetch request.
+// Versions before 8 fetch the offsets of a single group; later versions batch groups.
+type OffsetFetchRequest struct {
+	Groups        []OffsetFetchGroup
+	RequireStable bool
+}
+
+// OffsetFetchGroup names a group and the partitions whose offsets to fetch
+type OffsetFetchGroup struct {
+	GroupID     string
+	MemberID    *string
+	MemberEpoch int32
+	// Topics is nil to fetch every committed offset of the group
+	Topics []OffsetFetchTopic
+}
+
+// OffsetFetchTopic lists the partitions of a topic whose offsets to fetch
+type OffsetFetchTopic struct {
+	Name             string
+	PartitionIndexes []int32
+}
+
+// ParseOffsetFetchRequest parses the body of an OffsetFetch request (v1-v9)
+func ParseOffsetFetchRequest(baseReq *SwiftQueueRequest) (*OffsetFetchRequest, error) {
+	version := baseReq.APIVersion
+	if version < OffsetFetchMinVersion || version > OffsetFetchMaxVersion {
+		return nil, fmt.Errorf("unsupported offset fetch version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &OffsetFetchRequest{}
+
+	if version < 8 {
+		group := OffsetFetchGroup{MemberEpoch: -1}
+		group.GroupID = d.ReadString(flexible)
+		group.Topics = readOffsetFetchTopics(d, flexible)
+		req.Groups = []OffsetFetchGroup{group}
+		if version >= 7 {
+			req.RequireStable = d.ReadBool()
+		}
+	} else {
+		groupCount := d.ReadArrayLength(flexible)
+		for i := 0; i < groupCount && d.Err() == nil; i++ {
+			group := OffsetFetchGroup{MemberEpoch: -1}
+			group.GroupID = d.ReadString(flexible)
+			if version >= 9 {
+				group.MemberID = d.ReadNullableString(flexible)
+				group.MemberEpoch = d.ReadInt32()
+			}
+			group.Topics = readOffsetFetchTopics(d, flexible)
+			d.SkipTaggedFields(flexible)
+			req.Groups = append(req.Groups, group)
+		}
+		req.RequireStable = d.ReadBool()
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse offset fetch request: %w", err)
+	}
+
+	return req, nil
+}
+
+// readOffsetFetchTopics reads a nullable array of topics; null means all topics
+func readOffsetFetchTopics(d *Decoder, flexible bool) []OffsetFetchTopic {
+	topicCount := d.ReadArrayLength(flexible)
+	if topicCount < 0 {
+		return nil
+	}
+
+	topics := make([]OffsetFetchTopic, 0, topicCount)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := OffsetFetchTopic{}
+		topic.Name = d.ReadString(flexible)
+		indexCount := d.ReadArrayLength(flexible)
+		for j := 0; j < indexCount && d.Err() == nil; j++ {
+			topic.PartitionIndexes = append(topic.PartitionIndexes, d.ReadInt32())
+		}
+		d.SkipTaggedFields(flexible)
+		topics = append(topics, topic)
+	}
+	return topics
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+)
+
+// OffsetFetchGroupResult holds the committed offsets returned for one group
+type OffsetFetchGroupResult struct {
+	GroupID   string
+	Topics    []OffsetFetchTopicResult
+	ErrorCode int16
+}
+
+// OffsetFetchTopicResult holds the committed offsets of one topic
+type OffsetFetchTopicResult struct {
+	Name       string
+	Partitions []OffsetFetchPartitionResult
+}
+
+// OffsetFetchPartitionResult is the committed offset of one partition; -1 means none
+type OffsetFetchPartitionResult struct {
+	Index       int32
+	Offset      int64
+	LeaderEpoch int32
+	Metadata    *string
+	ErrorCode   int16
+}
+
+// BuildOffsetFetchResponse looks up the committed offsets of each requested group and builds the response
+func BuildOffsetFetchResponse(baseReq *SwiftQueueRequest, req *OffsetFetchRequest, broker *Broker) []byte {
+	results := make([]OffsetFetchGroupResult, 0, len(req.Groups))
+	for _, group := range req.Groups {
+		results = append(results, fetchGroupOffsets(broker, group, req.RequireStable))
+	}
+	return encodeOffsetFetchResponse(baseReq, results)
+}
+
+// fetchGroupOffsets returns the committed offsets of one group for the requested
+// partitions, or every committed offset when no topics are given. When requireStable is set,
+// partitions with offsets pending in a transaction fail with UNSTABLE_OFFSET_COMMIT.
+func fetchGroupOffsets(broker *Broker, group OffsetFetchGroup, requireStable bool) OffsetFetchGroupResult {
+	result := OffsetFetchGroupResult{GroupID: group.GroupID, ErrorCode: ErrorCodeNone}
+
+	var requested []TopicPartition
+	if group.Topics != nil {
+		requested = make([]TopicPartition, 0)
+		for _, topic := range group.Topics {
+			for _, index := range topic.PartitionIndexes {
+				requested = append(requested, TopicPartition{Topic: topic.Name, Partition: index})
+			}
+		}
+	}
+
+	offsets := broker.groupCoordinator.FetchOffsets(group.GroupID, requested)
+	var unstable map[TopicPartition]bool
+	if requireStable {
+		unstable = broker.groupCoordinator.PendingTxnPartitions(group.GroupID)
+	}
+
+	if requested == nil {
+		// List every committed offset, ordered by topic and partition
+		requested = make([]TopicPartition, 0, len(offsets))
+		for tp := range offsets {
+			requested = append(requested, tp)
+		}
+		slices.SortFunc(requested, func(a, b TopicPartition) int {
+			return cmp.Or(cmp.Compare(a.Topic, b.Topic), cmp.Compare(a.Partition, b.Partition))
+		})
+	}
+
+	for _, tp := range requested {
+		partition := OffsetFetchPartitionResult{Index: tp.Partition, Offset: -1, LeaderEpoch: -1, Metadata: stringPtr(""), ErrorCode: ErrorCodeNone}
+		if unstable[tp] {
+			partition.ErrorCode = ErrorCodeUnstableOffsetCommit
+		} else if offset, ok := offsets[tp]; ok {
+			partition.Offset = offset.Offset
+			partition.LeaderEpoch = offset.LeaderEpoch
+			partition.Metadata = stringPtr(offset.Metadata)
+		}
+
+		if n := len(result.Topics); n == 0 || result.Topics[n-1].Name != tp.Topic {
+			result.Topics = append(result.Topics, OffsetFetchTopicResult{Name: tp.Topic})
+		}
+		topic := &result.Topics[len(result.Topics)-1]
+		topic.Partitions = append(topic.Partitions, partition)
+	}
+
+	return result
+}
+
+// encodeOffsetFetchResponse serializes the OffsetFetch response for the request's version
+func encodeOffsetFetchResponse(baseReq *SwiftQueueRequest, results []OffsetFetchGroupResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	if version >= 3 {
+		// Throttle time
+		rb.WriteInt32(0)
+	}
+
+	if version < 8 {
+		// Older versions answer for exactly one group
+		group := results[0]
+		writeOffsetFetchTopics(rb, version, group.Topics, flexible)
+		if version >= 2 {
+			rb.WriteInt16(group.ErrorCode)
+		}
+	} else {
+		rb.WriteArrayLength(len(results), flexible)
+		for _, group := range results {
+			rb.WriteStringField(group.GroupID, flexible)
+			writeOffsetFetchTopics(rb, version, group.Topics, flexible)
+			rb.WriteInt16(group.ErrorCode)
+			rb.WriteTaggedFields(flexible)
+		}
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
+
+// writeOffsetFetchTopics writes the committed offsets of one group
+func writeOffsetFetchTopics(rb *ResponseBuilder, version int16, topics []OffsetFetchTopicResult, flexible bool) {
+	rb.WriteArrayLength(len(topics), flexible)
+	for _, topic := range topics {
+		rb.WriteStringField(topic.Name, flexible)
+		rb.WriteArrayLength(len(topic.Partitions), flexible)
+		for _, partition := range topic.Partitions {
+			rb.WriteInt32(partition.Index)
+			rb.WriteInt64(partition.Offset)
+			if version >= 5 {
+				rb.WriteInt32(partition.LeaderEpoch)
+			}
+			rb.WriteNullableString(partition.Metadata, flexible)
+			rb.WriteInt16(partition.ErrorCode)
+			rb.WriteTaggedFields(flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+}
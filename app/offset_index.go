@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// OffsetIndexEntrySize is the size of one offset index entry: a 4-byte relative offset and a 4-byte file position
+const OffsetIndexEntrySize = 8
+
+// OffsetIndexFileName returns the name of the offset index file for the segment starting at baseOffset
+func OffsetIndexFileName(baseOffset int64) string {
+	return fmt.Sprintf("%020d.index", baseOffset)
+}
+
+// OffsetIndexEntry maps the base offset of a batch to its position in the segment file
+type OffsetIndexEntry struct {
+	Offset   int64
+	Position int64
+}
+
+// OffsetIndex is the sparse offset index of one log segment.
+//
+// An entry is appended for the first batch written after at least index.interval.bytes of
+// batches went unindexed, so offsets and positions in the index are strictly increasing.
+// Offsets are stored relative to the segment base offset. Looking up the last entry at or
+// before a target offset yields the position from which to scan for the batch holding it.
+type OffsetIndex struct {
+	file       *os.File
+	baseOffset int64
+	entries    []OffsetIndexEntry
+}
+
+// OpenOffsetIndex opens or creates the offset index at path, loading its entries
+func OpenOffsetIndex(path string, baseOffset int64) (*OffsetIndex, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open offset index %s: %w", path, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read offset index %s: %w", path, err)
+	}
+
+	index := &OffsetIndex{
+		file:       file,
+		baseOffset: baseOffset,
+	}
+	for position := 0; position+OffsetIndexEntrySize <= len(data); position += OffsetIndexEntrySize {
+		index.entries = append(index.entries, OffsetIndexEntry{
+			Offset:   baseOffset + int64(binary.BigEndian.Uint32(data[position:])),
+			Position: int64(binary.BigEndian.Uint32(data[position+SizeInt32:])),
+		})
+	}
+
+	return index, nil
+}
+
+// Entries returns the loaded index entries
+func (oi *OffsetIndex) Entries() []OffsetIndexEntry {
+	return oi.entries
+}
+
+// Append records that the batch starting at offset is stored at position
+func (oi *OffsetIndex) Append(offset int64, position int64) error {
+	if last, ok := oi.Last(); ok && (offset <= last.Offset || position <= last.Position) {
+		return fmt.Errorf("offset index entry (%d, %d) does not follow (%d, %d)", offset, position, last.Offset, last.Position)
+	}
+
+	entry := make([]byte, OffsetIndexEntrySize)
+	binary.BigEndian.PutUint32(entry, uint32(offset-oi.baseOffset))
+	binary.BigEndian.PutUint32(entry[SizeInt32:], uint32(position))
+
+	if _, err := oi.file.WriteAt(entry, int64(len(oi.entries)*OffsetIndexEntrySize)); err != nil {
+		return fmt.Errorf("failed to append offset index entry: %w", err)
+	}
+	oi.entries = append(oi.entries, OffsetIndexEntry{Offset: offset, Position: position})
+
+	return nil
+}
+
+// Lookup returns the position of the last indexed batch starting at or before target,
+// or 0 when no such batch is indexed
+func (oi *OffsetIndex) Lookup(target int64) int64 {
+	i := sort.Search(len(oi.entries), func(i int) bool {
+		return oi.entries[i].Offset > target
+	})
+	if i == 0 {
+		return 0
+	}
+	return oi.entries[i-1].Position
+}
+
+// Last returns the entry with the largest offset
+func (oi *OffsetIndex) Last() (OffsetIndexEntry, bool) {
+	if len(oi.entries) == 0 {
+		return OffsetIndexEntry{}, false
+	}
+	return oi.entries[len(oi.entries)-1], true
+}
+
+// Reset truncates the index to the given entries and rewrites it
+func (oi *OffsetIndex) Reset(entries []OffsetIndexEntry) error {
+	data := make([]byte, 0, len(entries)*OffsetIndexEntrySize)
+	for _, entry := range entries {
+		data = binary.BigEndian.AppendUint32(data, uint32(entry.Offset-oi.baseOffset))
+		data = binary.BigEndian.AppendUint32(data, uint32(entry.Position))
+	}
+
+	if err := oi.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate offset index: %w", err)
+	}
+	if _, err := oi.file.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("failed to rewrite offset index: %w", err)
+	}
+	oi.entries = append([]OffsetIndexEntry(nil), entries...)
+
+	return nil
+}
+
+// Validate checks that the index file holds whole entries whose offsets and positions are
+// strictly increasing and fall within a segment of segmentSize bytes
+func (oi *OffsetIndex) Validate(segmentSize int64) error {
+	info, err := oi.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat offset index: %w", err)
+	}
+	if info.Size()%OffsetIndexEntrySize != 0 {
+		return fmt.Errorf("offset index size %d is not a multiple of %d", info.Size(), OffsetIndexEntrySize)
+	}
+	for i, entry := range oi.entries {
+		if entry.Position >= segmentSize {
+			return fmt.Errorf("offset index entry (%d, %d) points past the segment end %d", entry.Offset, entry.Position, segmentSize)
+		}
+		if i > 0 && (entry.Offset <= oi.entries[i-1].Offset || entry.Position <= oi.entries[i-1].Position) {
+			return fmt.Errorf("offset index entry (%d, %d) does not follow (%d, %d)",
+				entry.Offset, entry.Position, oi.entries[i-1].Offset, oi.entries[i-1].Position)
+		}
+	}
+	return nil
+}
+
+// Sync flushes the index file to disk
+func (oi *OffsetIndex) Sync() error {
+	return oi.file.Sync()
+}
+
+// Close closes the index file
+func (oi *OffsetIndex) Close() error {
+	return oi.file.Close()
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OffsetsTopic is the internal topic holding committed offsets
+const OffsetsTopic = "__consumer_offsets"
+
+// Record versions of the offsets log, as written by Kafka
+const (
+	offsetCommitKeyVersion   = 1
+	offsetCommitValueVersion = 3
+)
+
+// offsetsPartition is the partition of the offsets topic used by this broker
+var offsetsPartition = TopicPartition{Topic: OffsetsTopic, Partition: 0}
+
+// internalLogReadBytes bounds each read while replaying an internal log
+const internalLogReadBytes = 1 << 20
+
+// internalLogRecordsPerBatch bounds the batches written when rewriting an internal log
+const internalLogRecordsPerBatch = 1000
+
+// CommittedOffset is an offset committed by a group for one partition
+type CommittedOffset struct {
+	Offset          int64
+	LeaderEpoch     int32
+	Metadata        string
+	CommitTimestamp int64
+}
+
+// offsetKey identifies a committed offset in the offsets log
+type offsetKey struct {
+	Group string
+	TopicPartition
+}
+
+// OffsetStore persists committed offsets in the internal, compacted __consumer_offsets log.
+//
+// Every commit appends a record keyed by group, topic and partition whose value holds the
+// offset; removing an offset appends a tombstone with a null value. Only the latest record
+// for each key matters, so once superseded records make up half of the log it is rewritten
+// with just the latest value of each live key.
+//
+// Offsets committed inside a transaction are written in a transactional batch of the producer
+// and only take effect once the transaction coordinator writes the commit marker to the log.
+// The log is not compacted while such offsets are pending.
+type OffsetStore struct {
+	mu         sync.Mutex
+	logManager *LogManager
+	log        *PartitionLog
+	// latest holds the encoded value of the newest record for each live key
+	latest map[offsetKey][]byte
+	// pending holds the encoded values committed by each producer's ongoing transaction
+	pending map[int64]map[offsetKey][]byte
+	// records counts the records in the log, including superseded ones and tombstones
+	records int
+}
+
+// OpenOffsetStore opens the offsets log and loads the committed offsets it holds, along with
+// the offsets pending in ongoing transactions by producer ID
+func OpenOffsetStore(logManager *LogManager) (*OffsetStore, map[offsetKey]CommittedOffset, map[int64]map[offsetKey]CommittedOffset, error) {
+	partitionLog, err := logManager.GetOrCreateLog(offsetsPartition)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to open offsets log: %w", err)
+	}
+
+	store := &OffsetStore{
+		logManager: logManager,
+		log:        partitionLog,
+		latest:     make(map[offsetKey][]byte),
+		pending:    make(map[int64]map[offsetKey][]byte),
+	}
+	if err := store.load(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	offsets, err := decodeOffsets(store.latest)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pending := make(map[int64]map[offsetKey]CommittedOffset, len(store.pending))
+	for producerID, values := range store.pending {
+		if pending[producerID], err = decodeOffsets(values); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return store, offsets, pending, nil
+}
+
+// decodeOffsets decodes the values of offset commit records
+func decodeOffsets(values map[offsetKey][]byte) (map[offsetKey]CommittedOffset, error) {
+	offsets := make(map[offsetKey]CommittedOffset, len(values))
+	for key, value := range values {
+		offset, err := decodeOffsetCommitValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode committed offset of %s for group %s: %w", key.TopicPartition, key.Group, err)
+		}
+		offsets[key] = offset
+	}
+	return offsets, nil
+}
+
+// load replays the offsets log, keeping the newest value of each key. Offsets committed in
+// a transaction are held back until the transaction's marker is replayed.
+func (s *OffsetStore) load() error {
+	return replayBatches(s.log, func(batch *RecordBatch, records []Record) error {
+		s.records += len(records)
+		if batch.IsControl() {
+			markerType, err := batch.ControlType()
+			if err != nil {
+				return fmt.Errorf("invalid marker at offset %d of offsets log: %w", batch.BaseOffset, err)
+			}
+			s.completeTransaction(batch.ProducerID, markerType == ControlRecordCommit)
+			return nil
+		}
+
+		values := s.latest
+		if batch.IsTransactional() {
+			if values = s.pending[batch.ProducerID]; values == nil {
+				values = make(map[offsetKey][]byte)
+				s.pending[batch.ProducerID] = values
+			}
+		}
+		for _, record := range records {
+			key, ok := decodeOffsetCommitKey(record.Key)
+			if !ok {
+				// Group metadata and other record types are not used by this broker
+				continue
+			}
+			if record.Value == nil {
+				delete(values, key)
+			} else {
+				values[key] = record.Value
+			}
+		}
+		return nil
+	})
+}
+
+// replayRecords calls apply for every record of an internal log in offset order, skipping
+// control batches
+func replayRecords(partitionLog *PartitionLog, apply func(Record)) error {
+	return replayBatches(partitionLog, func(batch *RecordBatch, records []Record) error {
+		if batch.IsControl() {
+			return nil
+		}
+		for _, record := range records {
+			apply(record)
+		}
+		return nil
+	})
+}
+
+// replayBatches calls apply for every batch of an internal log in offset order, along with
+// the batch's decoded records
+func replayBatches(partitionLog *PartitionLog, apply func(*RecordBatch, []Record) error) error {
+	position := partitionLog.LogStartOffset()
+	end := partitionLog.LogEndOffset()
+	for position < end {
+		data, err := partitionLog.Read(position, internalLogReadBytes, true)
+		if err != nil {
+			return fmt.Errorf("failed to read %s at offset %d: %w", partitionLog.Dir(), position, err)
+		}
+		batches, err := ParseRecordBatches(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s at offset %d: %w", partitionLog.Dir(), position, err)
+		}
+		if len(batches) == 0 {
+			break
+		}
+
+		for _, batch := range batches {
+			position = batch.NextOffset()
+			records, err := batch.Records()
+			if err != nil {
+				return fmt.Errorf("failed to decode batch of %s at offset %d: %w", partitionLog.Dir(), batch.BaseOffset, err)
+			}
+			if err := apply(batch, records); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Commit persists the offsets committed by a group
+func (s *OffsetStore) Commit(group string, offsets map[TopicPartition]CommittedOffset) error {
+	records := make([]Record, 0, len(offsets))
+	values := make(map[offsetKey][]byte, len(offsets))
+	for tp, offset := range offsets {
+		key := offsetKey{Group: group, TopicPartition: tp}
+		value := encodeOffsetCommitValue(offset)
+		records = append(records, Record{Key: encodeOffsetCommitKey(key), Value: value})
+		values[key] = value
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(records); err != nil {
+		return err
+	}
+	for key, value := range values {
+		s.latest[key] = value
+	}
+	return nil
+}
+
+// CommitTransactional persists offsets committed by a producer inside its transaction.
+// They are pending until WriteTxnMarker commits or aborts the transaction.
+func (s *OffsetStore) CommitTransactional(group string, producerID int64, producerEpoch int16, offsets map[TopicPartition]CommittedOffset) error {
+	if len(offsets) == 0 {
+		return nil
+	}
+	records := make([]Record, 0, len(offsets))
+	values := make(map[offsetKey][]byte, len(offsets))
+	for tp, offset := range offsets {
+		key := offsetKey{Group: group, TopicPartition: tp}
+		value := encodeOffsetCommitValue(offset)
+		records = append(records, Record{Key: encodeOffsetCommitKey(key), Value: value})
+		values[key] = value
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := BuildTransactionalRecordBatch(producerID, producerEpoch, time.Now().UnixMilli(), records)
+	if _, err := s.log.Append([]*RecordBatch{batch}); err != nil {
+		return fmt.Errorf("failed to append to offsets log: %w", err)
+	}
+	s.records += len(records)
+
+	if s.pending[producerID] == nil {
+		s.pending[producerID] = make(map[offsetKey][]byte)
+	}
+	for key, value := range values {
+		s.pending[producerID][key] = value
+	}
+	return nil
+}
+
+// WriteTxnMarker writes the marker ending a producer's transaction to the offsets log,
+// applying the offsets the transaction committed if it commits
+func (s *OffsetStore) WriteTxnMarker(producerID int64, producerEpoch int16, commit bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := BuildControlBatch(producerID, producerEpoch, commit, 0, time.Now().UnixMilli())
+	if _, err := s.log.Append([]*RecordBatch{batch}); err != nil {
+		return fmt.Errorf("failed to append to offsets log: %w", err)
+	}
+	s.records++
+	s.completeTransaction(producerID, commit)
+	return nil
+}
+
+// completeTransaction applies or drops the offsets pending in a producer's transaction.
+// The caller holds s.mu or is loading the store.
+func (s *OffsetStore) completeTransaction(producerID int64, commit bool) {
+	if commit {
+		for key, value := range s.pending[producerID] {
+			s.latest[key] = value
+		}
+	}
+	delete(s.pending, producerID)
+}
+
+// Delete writes tombstones removing a group's offsets for the given partitions
+func (s *OffsetStore) Delete(group string, partitions []TopicPartition) error {
+	records := make([]Record, 0, len(partitions))
+	for _, tp := range partitions {
+		records = append(records, Record{Key: encodeOffsetCommitKey(offsetKey{Group: group, TopicPartition: tp})})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(records); err != nil {
+		return err
+	}
+	for _, tp := range partitions {
+		delete(s.latest, offsetKey{Group: group, TopicPartition: tp})
+	}
+	return nil
+}
+
+// append writes records to the offsets log as a single batch
+func (s *OffsetStore) append(records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	batch := BuildRecordBatch(0, time.Now().UnixMilli(), records)
+	if _, err := s.log.Append([]*RecordBatch{batch}); err != nil {
+		return fmt.Errorf("failed to append to offsets log: %w", err)
+	}
+	s.records += len(records)
+	return nil
+}
+
+// MaybeCompact rewrites the offsets log without superseded records and tombstones
+// once they make up at least half of it. Logs holding offsets of ongoing transactions
+// are left alone, as rewriting would drop them.
+func (s *OffsetStore) MaybeCompact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	superseded := s.records - len(s.latest)
+	if superseded == 0 || superseded*2 < s.records || len(s.pending) > 0 {
+		return nil
+	}
+
+	keys := make([]offsetKey, 0, len(s.latest))
+	for key := range s.latest {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, compareOffsetKeys)
+
+	records := make([]Record, 0, len(keys))
+	for _, key := range keys {
+		records = append(records, Record{Key: encodeOffsetCommitKey(key), Value: s.latest[key]})
+	}
+	partitionLog, err := rewriteRecords(s.logManager, offsetsPartition, records)
+	if err != nil {
+		return fmt.Errorf("failed to compact offsets log: %w", err)
+	}
+	s.log = partitionLog
+	s.records = len(keys)
+
+	return nil
+}
+
+// rewriteRecords replaces the contents of an internal log with records, written in bounded batches
+func rewriteRecords(logManager *LogManager, tp TopicPartition, records []Record) (*PartitionLog, error) {
+	now := time.Now().UnixMilli()
+	var batches []*RecordBatch
+	for chunk := range slices.Chunk(records, internalLogRecordsPerBatch) {
+		batches = append(batches, BuildRecordBatch(0, now, chunk))
+	}
+	return logManager.RewriteLog(tp, batches)
+}
+
+// compareOffsetKeys orders offset keys by group, topic and partition
+func compareOffsetKeys(a, b offsetKey) int {
+	if c := strings.Compare(a.Group, b.Group); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.Topic, b.Topic); c != 0 {
+		return c
+	}
+	return int(a.Partition) - int(b.Partition)
+}
+
+// encodeOffsetCommitKey encodes an OffsetCommitKey: version, group, topic and partition
+func encodeOffsetCommitKey(key offsetKey) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, offsetCommitKeyVersion)
+	buf = appendString16(buf, key.Group)
+	buf = appendString16(buf, key.Topic)
+	return binary.BigEndian.AppendUint32(buf, uint32(key.Partition))
+}
+
+// decodeOffsetCommitKey decodes an OffsetCommitKey; ok is false for other record keys
+func decodeOffsetCommitKey(data []byte) (key offsetKey, ok bool) {
+	d := NewDecoder(data)
+	version := d.ReadInt16()
+	if d.Err() != nil || version > offsetCommitKeyVersion {
+		return offsetKey{}, false
+	}
+	key.Group = d.ReadString(false)
+	key.Topic = d.ReadString(false)
+	key.Partition = d.ReadInt32()
+	return key, d.Err() == nil
+}
+
+// encodeOffsetCommitValue encodes an OffsetCommitValue (version 3)
+func encodeOffsetCommitValue(offset CommittedOffset) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, offsetCommitValueVersion)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(offset.Offset))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(offset.LeaderEpoch))
+	buf = appendString16(buf, offset.Metadata)
+	return binary.BigEndian.AppendUint64(buf, uint64(offset.CommitTimestamp))
+}
+
+// decodeOffsetCommitValue decodes an OffsetCommitValue of versions 0-3
+func decodeOffsetCommitValue(data []byte) (CommittedOffset, error) {
+	d := NewDecoder(data)
+	offset := CommittedOffset{LeaderEpoch: -1}
+
+	version := d.ReadInt16()
+	if version < 0 || version > offsetCommitValueVersion {
+		return CommittedOffset{}, fmt.Errorf("unsupported offset commit value version %d", version)
+	}
+	offset.Offset = d.ReadInt64()
+	if version >= 3 {
+		offset.LeaderEpoch = d.ReadInt32()
+	}
+	offset.Metadata = d.ReadString(false)
+	offset.CommitTimestamp = d.ReadInt64()
+	if version == 1 {
+		d.ReadInt64() // expire timestamp
+	}
+
+	return offset, d.Err()
+}
+
+// appendString16 appends a string with an int16 length prefix
+func appendString16(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
@@ -0,0 +1,588 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrOffsetOutOfRange is returned when reading from an offset outside [log start, log end]
+var ErrOffsetOutOfRange = errors.New("offset out of range")
+
+// errLogClosed is returned when a log is closed while it is being flushed or compacted
+var errLogClosed = errors.New("log closed")
+
+// PartitionLog is the append-only on-disk log of a single topic partition.
+//
+// The log is split into segments named after their base offset. Batches are stored back to
+// back exactly as they are received on the wire, with their base offsets rewritten to the
+// offsets assigned by the log, and are appended to the last, active segment, which is rolled
+// once it grows past segment.bytes or ages past segment.ms. Segments are flushed to disk when
+// they are rolled and when the log is flushed; the recovery point is the offset up to which the
+// log is known to be on disk, past which it is recovered after a crash.
+type PartitionLog struct {
+	mu sync.RWMutex
+	// cleanMu serializes the removal and rewriting of segments by retention and compaction
+	cleanMu        sync.Mutex
+	dir            string
+	config         LogConfig
+	logger         *log.Logger
+	segments       []*LogSegment
+	producers      *ProducerStateManager
+	logStartOffset int64
+	nextOffset     int64
+	recoveryPoint  int64
+	closed         bool
+}
+
+// OpenPartitionLog opens the partition log in dir, creating it if necessary. Segments holding
+// offsets at or after recoveryPoint may not have reached the disk whole and are recovered;
+// the segments before it are loaded trusting their indexes once they pass a sanity check.
+func OpenPartitionLog(dir string, config LogConfig, recoveryPoint int64, logger *log.Logger) (*PartitionLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create partition directory %s: %w", dir, err)
+	}
+
+	if err := completeSegmentSwaps(dir, logger); err != nil {
+		return nil, err
+	}
+	baseOffsets, err := listSegmentBaseOffsets(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(baseOffsets) == 0 {
+		baseOffsets = []int64{0}
+	}
+
+	partitionLog := &PartitionLog{
+		dir:       dir,
+		config:    config,
+		logger:    logger,
+		producers: NewProducerStateManager(dir),
+	}
+	for _, baseOffset := range baseOffsets {
+		segment, err := OpenLogSegment(dir, baseOffset, config.IndexIntervalBytes)
+		if err != nil {
+			partitionLog.closeFiles()
+			return nil, err
+		}
+		partitionLog.segments = append(partitionLog.segments, segment)
+	}
+
+	if err := partitionLog.loadSegments(recoveryPoint); err != nil {
+		partitionLog.closeFiles()
+		return nil, err
+	}
+	if err := partitionLog.loadProducerState(); err != nil {
+		partitionLog.closeFiles()
+		return nil, err
+	}
+
+	return partitionLog, nil
+}
+
+// loadSegments loads the segments that were flushed before recoveryPoint and recovers the
+// others, as well as any whose indexes turn out to be missing or corrupt, flushing them once
+// recovered. Segments following one that had to be truncated are deleted, as the offsets
+// they hold no longer follow on from the log.
+func (l *PartitionLog) loadSegments(recoveryPoint int64) error {
+	for i, segment := range l.segments {
+		if segment.baseOffset < recoveryPoint {
+			loaded, err := segment.load()
+			if err != nil {
+				return fmt.Errorf("failed to load segment %s: %w", segment.path(), err)
+			}
+			if loaded && segment.nextOffset <= recoveryPoint {
+				continue
+			}
+			if !loaded {
+				l.logger.Printf("Segment %s: missing or corrupt indexes or an incomplete tail batch, recovering it", segment.path())
+			}
+		}
+
+		truncated, err := segment.recover(l.logger)
+		if err != nil {
+			return fmt.Errorf("failed to recover segment %s: %w", segment.path(), err)
+		}
+		if err := segment.flush(); err != nil {
+			return fmt.Errorf("failed to flush recovered segment %s: %w", segment.path(), err)
+		}
+		if truncated && i < len(l.segments)-1 {
+			for _, following := range l.segments[i+1:] {
+				l.logger.Printf("Partition %s: deleting segment %s following a truncated segment", l.dir, following.path())
+				if err := following.delete(); err != nil {
+					return fmt.Errorf("failed to delete segment %s: %w", following.path(), err)
+				}
+			}
+			l.segments = l.segments[:i+1]
+			break
+		}
+	}
+
+	l.logStartOffset = l.segments[0].baseOffset
+	l.nextOffset = l.activeSegment().nextOffset
+	l.recoveryPoint = l.nextOffset
+	return nil
+}
+
+// activeSegment returns the segment appended to. The caller holds l.mu.
+func (l *PartitionLog) activeSegment() *LogSegment {
+	return l.segments[len(l.segments)-1]
+}
+
+// segmentIndex returns the index of the segment holding offset: the last one whose base
+// offset is at or before it. The caller holds l.mu.
+func (l *PartitionLog) segmentIndex(offset int64) int {
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].baseOffset > offset
+	})
+	return max(i-1, 0)
+}
+
+// loadProducerState restores the producer state from the latest snapshot and replays the
+// batches written after it. Transactions aborted after the snapshot are dropped from the
+// transaction indexes first, as replaying their markers indexes them again.
+func (l *PartitionLog) loadProducerState() error {
+	snapshotOffset, err := l.producers.Load(l.nextOffset)
+	if err != nil {
+		return err
+	}
+	for _, segment := range l.segments {
+		if err := segment.txnIndex.TruncateFrom(snapshotOffset); err != nil {
+			return err
+		}
+	}
+	if snapshotOffset == l.nextOffset {
+		return nil
+	}
+
+	for _, segment := range l.segments[l.segmentIndex(snapshotOffset):] {
+		err := segment.forEachBatchHeader(0, func(batch *RecordBatch, position int64) error {
+			if batch.BaseOffset < snapshotOffset || batch.ProducerID == NoProducerID {
+				return nil
+			}
+			if batch.IsControl() {
+				// The marker type is held in the record, so control batches are read whole
+				var err error
+				if batch, err = segment.readBatchAt(position, batch); err != nil {
+					return err
+				}
+			}
+			aborted, err := l.producers.replay(batch)
+			if err != nil {
+				return fmt.Errorf("failed to replay producer state of %s: %w", l.dir, err)
+			}
+			return l.indexAborted(segment, aborted)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexAborted adds aborted transactions to the transaction index of the segment holding their markers
+func (l *PartitionLog) indexAborted(segment *LogSegment, aborted []AbortedTxn) error {
+	for _, txn := range aborted {
+		if err := segment.txnIndex.Append(txn); err != nil {
+			return fmt.Errorf("failed to index aborted transaction in %s: %w", l.dir, err)
+		}
+	}
+	return nil
+}
+
+// readBatchHeaderAt reads the header of the batch stored at position.
+// It returns io.EOF at the end of the file and io.ErrUnexpectedEOF if the batch is incomplete.
+func readBatchHeaderAt(file *os.File, position int64, fileSize int64) (*RecordBatch, error) {
+	if position >= fileSize {
+		return nil, io.EOF
+	}
+	if position+RecordBatchHeaderSize > fileSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	header := make([]byte, RecordBatchHeaderSize)
+	if _, err := file.ReadAt(header, position); err != nil {
+		return nil, fmt.Errorf("failed to read batch header at position %d: %w", position, err)
+	}
+
+	batch := decodeBatchHeader(header)
+	if batch.BatchLength < RecordBatchHeaderSize-BatchHeaderSize || position+BatchHeaderSize+int64(batch.BatchLength) > fileSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return batch, nil
+}
+
+// Append assigns offsets to the batches and writes them to the end of the log.
+// It returns the offset assigned to the first record. The batches of idempotent producers
+// are recorded in the producer state without being validated, as when rewriting a log.
+func (l *PartitionLog) Append(batches []*RecordBatch) (int64, error) {
+	return l.append(batches, false)
+}
+
+// AppendAsLeader appends batches produced by clients like Append, first checking that the
+// batches of idempotent producers follow their previous ones. A retried batch is not appended
+// again; a DuplicateBatchError holding its original offset is returned instead. Batches are
+// recompressed, in place, when compression.type names a codec other than the producer's, and
+// rejected with ErrMessageTooLarge if they then exceed max.message.bytes.
+func (l *PartitionLog) AppendAsLeader(batches []*RecordBatch) (int64, error) {
+	return l.append(batches, true)
+}
+
+// append writes batches to the end of the log, validating producer state if requested
+func (l *PartitionLog) append(batches []*RecordBatch, validate bool) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	baseOffset := l.nextOffset
+	nextOffset := l.nextOffset
+
+	producerAppend := l.producers.prepareAppend()
+	buffer := make([]byte, 0)
+	for i, batch := range batches {
+		if validate && batch.ProducerID != NoProducerID {
+			if err := producerAppend.validate(batch); err != nil {
+				return 0, err
+			}
+		}
+		if validate {
+			recompressed, err := l.recompress(batch)
+			if err != nil {
+				return 0, err
+			}
+			// Recompression can grow a batch past what the producer's batch was checked against
+			if int64(recompressed.Size()) > l.config.MaxMessageBytes {
+				return 0, fmt.Errorf("%w: batch of %d bytes exceeds max.message.bytes of %d",
+					ErrMessageTooLarge, recompressed.Size(), l.config.MaxMessageBytes)
+			}
+			batch, batches[i] = recompressed, recompressed
+		}
+		batch.SetBaseOffset(nextOffset)
+		nextOffset = batch.NextOffset()
+		buffer = append(buffer, batch.Raw...)
+		if batch.ProducerID != NoProducerID {
+			if err := producerAppend.add(batch); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if l.activeSegment().shouldRoll(l.config, len(buffer), nextOffset-1, time.Now().UnixMilli()) {
+		if err := l.roll(); err != nil {
+			return 0, err
+		}
+	}
+
+	segment := l.activeSegment()
+	if err := segment.append(buffer, batches); err != nil {
+		return 0, fmt.Errorf("failed to append to %s: %w", l.dir, err)
+	}
+
+	l.nextOffset = nextOffset
+	if err := l.indexAborted(segment, producerAppend.commit()); err != nil {
+		return 0, err
+	}
+
+	return baseOffset, nil
+}
+
+// recompress returns the batch compressed with the codec selected by compression.type, or the
+// batch itself if it already uses that codec or the producer's codec is kept
+func (l *PartitionLog) recompress(batch *RecordBatch) (*RecordBatch, error) {
+	compression, ok := compressionTypeID(l.config.CompressionType)
+	if !ok || batch.CompressionType() == compression {
+		return batch, nil
+	}
+	return batch.WithCompression(compression)
+}
+
+// roll starts a new active segment at the log end offset. The producer state is snapshotted
+// at the boundary, so that it can be restored without replaying older segments, and the
+// segment rolled is flushed, moving the recovery point past it. The caller holds l.mu.
+func (l *PartitionLog) roll() error {
+	if err := l.producers.TakeSnapshot(l.nextOffset); err != nil {
+		return err
+	}
+	if err := l.activeSegment().flush(); err != nil {
+		return fmt.Errorf("failed to flush segment %s: %w", l.activeSegment().path(), err)
+	}
+	l.recoveryPoint = l.nextOffset
+
+	segment, err := OpenLogSegment(l.dir, l.nextOffset, l.config.IndexIntervalBytes)
+	if err != nil {
+		return err
+	}
+	l.segments = append(l.segments, segment)
+	l.logger.Printf("Partition %s: rolled new segment at offset %d", l.dir, l.nextOffset)
+	return nil
+}
+
+// Read returns the stored batches starting with the batch that contains fetchOffset,
+// stopping before the batch that would exceed maxBytes. When minOneBatch is set the
+// first batch is returned even if it alone is larger than maxBytes, so that a consumer
+// can always make progress.
+func (l *PartitionLog) Read(fetchOffset int64, maxBytes int, minOneBatch bool) ([]byte, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	records, _, err := l.read(fetchOffset, l.nextOffset, maxBytes, minOneBatch)
+	return records, err
+}
+
+// ReadCommitted reads like Read, but only up to the last stable offset, so that no record of
+// a transaction in progress is returned. It also returns the aborted transactions with
+// records among those read, whose records consumers must skip.
+func (l *PartitionLog) ReadCommitted(fetchOffset int64, maxBytes int, minOneBatch bool) ([]byte, []AbortedTxn, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	records, batches, err := l.read(fetchOffset, l.lastStableOffset(), maxBytes, minOneBatch)
+	if err != nil || len(batches) == 0 {
+		return records, nil, err
+	}
+	return records, l.collectAborted(fetchOffset, batches[len(batches)-1].NextOffset()), nil
+}
+
+// collectAborted returns the aborted transactions with records in [startOffset, endOffset).
+// Their markers follow their records, so only segments from the one holding startOffset
+// on are searched. The caller holds l.mu.
+func (l *PartitionLog) collectAborted(startOffset int64, endOffset int64) []AbortedTxn {
+	var aborted []AbortedTxn
+	for _, segment := range l.segments[l.segmentIndex(startOffset):] {
+		aborted = append(aborted, segment.txnIndex.Collect(startOffset, endOffset)...)
+	}
+	return aborted
+}
+
+// read returns the batches starting with the one that contains fetchOffset, stopping at
+// maxOffset or before the batch that would exceed maxBytes, both as stored and parsed.
+// Batches are read from a single segment: the first one holding a batch at or after
+// fetchOffset. The batches' CRCs are verified. The caller holds l.mu.
+func (l *PartitionLog) read(fetchOffset int64, maxOffset int64, maxBytes int, minOneBatch bool) ([]byte, []*RecordBatch, error) {
+	if fetchOffset < l.logStartOffset || fetchOffset > l.nextOffset {
+		return nil, nil, fmt.Errorf("%w: %d not in [%d, %d]", ErrOffsetOutOfRange, fetchOffset, l.logStartOffset, l.nextOffset)
+	}
+
+	for _, segment := range l.segments[l.segmentIndex(fetchOffset):] {
+		position, err := segment.batchPosition(fetchOffset)
+		if err != nil {
+			return nil, nil, err
+		}
+		if position == segment.size {
+			continue
+		}
+
+		records, err := segment.read(position, maxOffset, maxBytes, minOneBatch)
+		if err != nil {
+			return nil, nil, err
+		}
+		batches, err := ParseRecordBatches(records)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s at position %d: %w", segment.path(), position, err)
+		}
+		return records, batches, nil
+	}
+	return []byte{}, nil, nil
+}
+
+// readBatchContaining reads the complete batch that contains offset. The caller holds l.mu.
+func (l *PartitionLog) readBatchContaining(offset int64) (*RecordBatch, error) {
+	return l.segments[l.segmentIndex(offset)].readBatchContaining(offset)
+}
+
+// OffsetForTimestamp returns the offset and timestamp of the first record whose timestamp
+// is at or after target. found is false when every record is older than target.
+func (l *PartitionLog) OffsetForTimestamp(target int64) (offset int64, timestamp int64, found bool, err error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, segment := range l.segments {
+		entry, ok := segment.timeIndex.Lookup(target)
+		if !ok {
+			continue
+		}
+		batch, err := segment.readBatchContaining(entry.Offset)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		offset, timestamp, found = batch.FindTimestamp(target)
+		return offset, timestamp, found, nil
+	}
+	return 0, 0, false, nil
+}
+
+// MaxTimestampOffset returns the offset and timestamp of the record with the largest
+// timestamp in the log. found is false for an empty log.
+func (l *PartitionLog) MaxTimestampOffset() (offset int64, timestamp int64, found bool, err error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var maxSegment *LogSegment
+	var maxEntry TimeIndexEntry
+	for _, segment := range l.segments {
+		if entry, ok := segment.timeIndex.Last(); ok && (maxSegment == nil || entry.Timestamp > maxEntry.Timestamp) {
+			maxSegment, maxEntry = segment, entry
+		}
+	}
+	if maxSegment == nil {
+		return 0, 0, false, nil
+	}
+
+	batch, err := maxSegment.readBatchContaining(maxEntry.Offset)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	offset, timestamp = batch.FindMaxTimestamp()
+	return offset, timestamp, true, nil
+}
+
+// RetentionResult describes the segments deleted from a log past its retention
+type RetentionResult struct {
+	Segments int
+	Bytes    int64
+	// LogStartOffset is the log start offset once the segments are deleted
+	LogStartOffset int64
+}
+
+// DeleteRetainedSegments deletes the oldest segments that are past the log's retention: those
+// whose records are all older than retention.ms, and as many as can go while keeping the log at
+// or above retention.bytes. Logs without the delete cleanup policy are left alone, and the
+// active segment is always kept. The log start offset moves to the first remaining segment.
+func (l *PartitionLog) DeleteRetainedSegments(now int64) (RetentionResult, error) {
+	l.cleanMu.Lock()
+	defer l.cleanMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := RetentionResult{LogStartOffset: l.logStartOffset}
+	if !l.config.HasCleanupPolicy(CleanupPolicyDelete) {
+		return result, nil
+	}
+
+	excessBytes := int64(0)
+	for _, segment := range l.segments {
+		excessBytes += segment.size
+	}
+	excessBytes -= l.config.RetentionBytes
+
+	deleted := 0
+	for deleted < len(l.segments)-1 {
+		segment := l.segments[deleted]
+		expired := l.config.RetentionMs >= 0 && now-segment.maxTimestamp() > l.config.RetentionMs
+		oversized := l.config.RetentionBytes >= 0 && excessBytes >= segment.size
+		if !expired && !oversized {
+			break
+		}
+		excessBytes -= segment.size
+		result.Bytes += segment.size
+		deleted++
+	}
+	if deleted == 0 {
+		return result, nil
+	}
+
+	var errs []error
+	for _, segment := range l.segments[:deleted] {
+		if err := segment.delete(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete segment %s: %w", segment.path(), err))
+		}
+	}
+	l.segments = slices.Delete(l.segments, 0, deleted)
+	l.logStartOffset = max(l.logStartOffset, l.segments[0].baseOffset)
+
+	result.Segments = deleted
+	result.LogStartOffset = l.logStartOffset
+	return result, errors.Join(errs...)
+}
+
+// SetConfig replaces the log settings, as when the topic's config overrides change
+func (l *PartitionLog) SetConfig(config LogConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.config = config
+}
+
+// LogStartOffset returns the first offset still present in the log
+func (l *PartitionLog) LogStartOffset() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.logStartOffset
+}
+
+// LogEndOffset returns the offset that will be assigned to the next appended record
+func (l *PartitionLog) LogEndOffset() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.nextOffset
+}
+
+// LastStableOffset returns the offset below which every transaction has been committed or
+// aborted: the first offset of the oldest transaction in progress, or the log end offset
+func (l *PartitionLog) LastStableOffset() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lastStableOffset()
+}
+
+// lastStableOffset returns the last stable offset. The caller holds l.mu.
+func (l *PartitionLog) lastStableOffset() int64 {
+	if offset, ok := l.producers.firstUnstableOffset(); ok {
+		return offset
+	}
+	return l.nextOffset
+}
+
+// Dir returns the partition directory
+func (l *PartitionLog) Dir() string {
+	return l.dir
+}
+
+// Flush syncs the active segment to disk and moves the recovery point to the log end offset.
+// The segments before it were flushed when they were rolled.
+func (l *PartitionLog) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errLogClosed
+	}
+	if err := l.activeSegment().flush(); err != nil {
+		return fmt.Errorf("failed to flush %s: %w", l.dir, err)
+	}
+	l.recoveryPoint = l.nextOffset
+	return nil
+}
+
+// RecoveryPoint returns the offset up to which the log has been flushed to disk
+func (l *PartitionLog) RecoveryPoint() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.recoveryPoint
+}
+
+// Close snapshots the producer state and closes the segment and index files
+func (l *PartitionLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if err := l.producers.TakeSnapshot(l.nextOffset); err != nil {
+		l.closeFiles()
+		return err
+	}
+	return l.closeFiles()
+}
+
+// closeFiles closes the segment and index files, returning any errors
+func (l *PartitionLog) closeFiles() error {
+	var errs []error
+	for _, segment := range l.segments {
+		errs = append(errs, segment.close())
+	}
+	return errors.Join(errs...)
+}
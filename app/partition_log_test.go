@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"testing"
+)
+
+func TestAppendAsLeaderChecksRecompressedSize(t *testing.T) {
+	config := DefaultLogConfig(DefaultConfig())
+	config.CompressionType = "uncompressed"
+	config.MaxMessageBytes = 10000
+
+	l, err := OpenPartitionLog(t.TempDir(), config, 0, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("OpenPartitionLog: %v", err)
+	}
+	defer l.Close()
+
+	tests := []struct {
+		name      string
+		valueSize int
+		wantErr   error
+	}{
+		{name: "fits once decompressed", valueSize: 1000},
+		{name: "grows past max.message.bytes", valueSize: 100000, wantErr: ErrMessageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch, err := BuildRecordBatch(0, 1700000000000, []Record{
+				{Key: []byte("k"), Value: bytes.Repeat([]byte("x"), tt.valueSize)},
+			}).WithCompression(CompressionGzip)
+			if err != nil {
+				t.Fatalf("WithCompression: %v", err)
+			}
+			if int64(batch.Size()) > config.MaxMessageBytes {
+				t.Fatalf("compressed batch of %d bytes is already too large", batch.Size())
+			}
+
+			endBefore := l.LogEndOffset()
+			_, err = l.AppendAsLeader([]*RecordBatch{batch})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AppendAsLeader error = %v, want %v", err, tt.wantErr)
+			}
+			wantEnd := endBefore + 1
+			if tt.wantErr != nil {
+				wantEnd = endBefore
+			}
+			if end := l.LogEndOffset(); end != wantEnd {
+				t.Errorf("LogEndOffset = %d, want %d", end, wantEnd)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import "fmt"
+
+// ProduceRequest represents a parsed Produce request
+type ProduceRequest struct {
+	TransactionalID *string
+	Acks            int16
+	TimeoutMs       int32
+	Topics          []ProduceTopicData
+}
+
+// ProduceTopicData holds the records sent to the partitions of one topic
+type ProduceTopicData struct {
+	Name       string
+	Partitions []ProducePartitionData
+}
+
+// ProducePartitionData holds the raw record batches sent to one partition
+type ProducePartitionData struct {
+	Index   int32
+	Records []byte
+}
+
+// ParseProduceRequest parses the body of a Produce request (v3+)
+func ParseProduceRequest(baseReq *SwiftQueueRequest) (*ProduceRequest, error) {
+	if baseReq.APIVersion < ProduceMinVersion || baseReq.APIVersion > ProduceMaxVersion {
+		return nil, fmt.Errorf("unsupported produce version: %d", baseReq.APIVersion)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, baseReq.APIVersion)
+	d := NewDecoder(baseReq.Body)
+
+	req := &ProduceRequest{
+		TransactionalID: d.ReadNullableString(flexible),
+		Acks:            d.ReadInt16(),
+		TimeoutMs:       d.ReadInt32(),
+	}
+
+	topicCount := d.ReadArrayLength(flexible)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := ProduceTopicData{
+			Name: d.ReadString(flexible),
+		}
+
+		partitionCount := d.ReadArrayLength(flexible)
+		for j := 0; j < partitionCount && d.Err() == nil; j++ {
+			partition := ProducePartitionData{
+				Index:   d.ReadInt32(),
+				Records: d.ReadBytes(flexible),
+			}
+			d.SkipTaggedFields(flexible)
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+		d.SkipTaggedFields(flexible)
+
+		req.Topics = append(req.Topics, topic)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// LogAppendTimeNone is returned as log_append_time when the topic uses CreateTime timestamps
+const LogAppendTimeNone = -1
+
+// ProduceTopicResult holds the per-partition results for one topic of a Produce request
+type ProduceTopicResult struct {
+	Name       string
+	Partitions []ProducePartitionResult
+}
+
+// ProducePartitionResult is the outcome of appending records to one partition
+type ProducePartitionResult struct {
+	Index           int32
+	ErrorCode       int16
+	BaseOffset      int64
+	LogAppendTimeMs int64
+	LogStartOffset  int64
+	ErrorMessage    *string
+}
+
+// BuildProduceResponse appends the request's records to the partition logs and builds the response.
+// It returns nil for acks=0 requests, which expect no response at all.
+func BuildProduceResponse(baseReq *SwiftQueueRequest, req *ProduceRequest, broker *Broker) []byte {
+	topics, partitions := broker.TopicsAndPartitions()
+
+	results := make([]ProduceTopicResult, 0, len(req.Topics))
+	for _, topicData := range req.Topics {
+		topicResult := ProduceTopicResult{Name: topicData.Name}
+		topic := findTopicByName(topics, topicData.Name)
+
+		for _, partitionData := range topicData.Partitions {
+			var result ProducePartitionResult
+			if req.Acks != -1 && req.Acks != 0 && req.Acks != 1 {
+				result = produceError(partitionData.Index, ErrorCodeInvalidRequiredAcks, fmt.Sprintf("invalid acks value %d", req.Acks))
+			} else {
+				result = produceToPartition(broker, topic, partitions, partitionData)
+			}
+			topicResult.Partitions = append(topicResult.Partitions, result)
+		}
+
+		results = append(results, topicResult)
+	}
+
+	if req.Acks == 0 {
+		return nil
+	}
+
+	return encodeProduceResponse(baseReq, results)
+}
+
+// produceToPartition validates the records for a single partition and appends them to its log
+func produceToPartition(broker *Broker, topic *Topic, partitions []Partition, data ProducePartitionData) ProducePartitionResult {
+	if topic == nil || !hasPartition(partitions, topic.UUID, data.Index) {
+		return produceError(data.Index, ErrorCodeUnknownTopicOrPart, "")
+	}
+	if len(data.Records) == 0 {
+		return produceError(data.Index, ErrorCodeCorruptMessage, "produce request contains no records")
+	}
+
+	batches, err := ParseRecordBatches(data.Records)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedMagic) {
+			return produceError(data.Index, ErrorCodeUnsupportedForMessageFormat, err.Error())
+		}
+		return produceError(data.Index, ErrorCodeCorruptMessage, err.Error())
+	}
+
+	for _, batch := range batches {
+		if batch.Size() > broker.config.MessageMaxBytes {
+			return produceError(data.Index, ErrorCodeMessageTooLarge,
+				fmt.Sprintf("batch of %d bytes exceeds message.max.bytes of %d", batch.Size(), broker.config.MessageMaxBytes))
+		}
+		if batch.BaseOffset != 0 {
+			return produceError(data.Index, ErrorCodeInvalidRecord, "producer batches must have a base offset of 0")
+		}
+		if batch.RecordCount <= 0 || batch.RecordCount != batch.LastOffsetDelta+1 {
+			return produceError(data.Index, ErrorCodeInvalidRecord,
+				fmt.Sprintf("record count %d does not match last offset delta %d", batch.RecordCount, batch.LastOffsetDelta))
+		}
+		if batch.IsControl() {
+			// Transaction markers are only written by the transaction coordinator
+			return produceError(data.Index, ErrorCodeInvalidRecord, "clients may not produce control batches")
+		}
+		if batch.IsTransactional() && batch.ProducerID == NoProducerID {
+			return produceError(data.Index, ErrorCodeInvalidRecord, "transactional batches must have a producer ID")
+		}
+		// Decompressing and decoding every record validates the batch beyond its CRC
+		if _, err := batch.Records(); err != nil {
+			if errors.Is(err, ErrUnsupportedCompression) {
+				return produceError(data.Index, ErrorCodeUnsupportedCompressionType, err.Error())
+			}
+			if errors.Is(err, ErrMessageTooLarge) {
+				return produceError(data.Index, ErrorCodeMessageTooLarge, err.Error())
+			}
+			return produceError(data.Index, ErrorCodeCorruptMessage, fmt.Sprintf("invalid records: %v", err))
+		}
+	}
+
+	// Retries are detected batch by batch, so idempotent producers send one batch at a time
+	if len(batches) > 1 && slices.ContainsFunc(batches, func(batch *RecordBatch) bool { return batch.ProducerID != NoProducerID }) {
+		return produceError(data.Index, ErrorCodeInvalidRecord, "idempotent producers must send a single batch per partition")
+	}
+
+	tp := TopicPartition{Topic: topic.Name, Partition: data.Index}
+	partitionLog, err := broker.logManager.GetOrCreateLog(tp)
+	if err != nil {
+		broker.logger.Printf("Produce: failed to open log for %s: %v", tp, err)
+		return produceError(data.Index, ErrorCodeStorageError, "")
+	}
+
+	baseOffset, err := partitionLog.AppendAsLeader(batches)
+	var duplicate *DuplicateBatchError
+	switch {
+	case errors.As(err, &duplicate):
+		// A retry of a batch already written is acknowledged with its original offset
+		return ProducePartitionResult{
+			Index:           data.Index,
+			ErrorCode:       ErrorCodeNone,
+			BaseOffset:      duplicate.BaseOffset,
+			LogAppendTimeMs: LogAppendTimeNone,
+			LogStartOffset:  partitionLog.LogStartOffset(),
+		}
+	case errors.Is(err, ErrOutOfOrderSequence):
+		return produceError(data.Index, ErrorCodeOutOfOrderSequenceNumber, err.Error())
+	case errors.Is(err, ErrInvalidProducerEpoch):
+		return produceError(data.Index, ErrorCodeInvalidProducerEpoch, err.Error())
+	case errors.Is(err, ErrInvalidTxnState):
+		return produceError(data.Index, ErrorCodeInvalidTxnState, err.Error())
+	case errors.Is(err, ErrUnsupportedCompression):
+		// compression.type names a codec that is not registered
+		return produceError(data.Index, ErrorCodeUnsupportedCompressionType, err.Error())
+	case errors.Is(err, ErrMessageTooLarge):
+		return produceError(data.Index, ErrorCodeMessageTooLarge, err.Error())
+	case err != nil:
+		broker.logger.Printf("Produce: failed to append to %s: %v", tp, err)
+		return produceError(data.Index, ErrorCodeStorageError, "")
+	}
+
+	// Wake up long-poll fetches waiting for data on this partition
+	broker.fetchPurgatory.CheckAndComplete(tp.String())
+
+	return ProducePartitionResult{
+		Index:           data.Index,
+		ErrorCode:       ErrorCodeNone,
+		BaseOffset:      baseOffset,
+		LogAppendTimeMs: LogAppendTimeNone,
+		LogStartOffset:  partitionLog.LogStartOffset(),
+	}
+}
+
+// hasPartition reports whether the topic with the given UUID has a partition with the given index
+func hasPartition(partitions []Partition, topicUUID string, index int32) bool {
+	for _, partition := range filterPartitionsByTopicUUID(partitions, topicUUID) {
+		if int32(partition.ID) == index {
+			return true
+		}
+	}
+	return false
+}
+
+// produceError builds a failed partition result
+func produceError(index int32, errorCode int16, message string) ProducePartitionResult {
+	result := ProducePartitionResult{
+		Index:           index,
+		ErrorCode:       errorCode,
+		BaseOffset:      -1,
+		LogAppendTimeMs: LogAppendTimeNone,
+		LogStartOffset:  -1,
+	}
+	if message != "" {
+		result.ErrorMessage = &message
+	}
+	return result
+}
+
+// encodeProduceResponse serializes the Produce response for the request's version
+func encodeProduceResponse(baseReq *SwiftQueueRequest, results []ProduceTopicResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Topic responses
+	rb.WriteArrayLength(len(results), flexible)
+	for _, topic := range results {
+		rb.WriteStringField(topic.Name, flexible)
+
+		rb.WriteArrayLength(len(topic.Partitions), flexible)
+		for _, partition := range topic.Partitions {
+			rb.WriteInt32(partition.Index)
+			rb.WriteInt16(partition.ErrorCode)
+			rb.WriteInt64(partition.BaseOffset)
+			rb.WriteInt64(partition.LogAppendTimeMs)
+			if version >= 5 {
+				rb.WriteInt64(partition.LogStartOffset)
+			}
+			if version >= 8 {
+				// Record errors (none; failures are reported for the whole partition)
+				rb.WriteArrayLength(0, flexible)
+				rb.WriteNullableString(partition.ErrorMessage, flexible)
+			}
+			rb.WriteTaggedFields(flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	// Throttle time
+	rb.WriteInt32(0)
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// producerIDBlockSize is how many producer IDs the broker reserves in the metadata log at a time
+const producerIDBlockSize = 1000
+
+// ProducerIDManager hands out producer IDs to idempotent producers.
+//
+// IDs must never be reused, even across restarts, so they are taken from blocks reserved by
+// appending a ProducerIdsRecord to the metadata log. A restarted broker reserves a new block
+// and never hands out what was left of the previous one.
+type ProducerIDManager struct {
+	config *Config
+	writer *MetadataWriter
+
+	mu sync.Mutex
+	// next is the next ID to hand out and blockEnd the end of the reserved block
+	next     int64
+	blockEnd int64
+}
+
+// NewProducerIDManager creates a manager that reserves its first block on first use
+func NewProducerIDManager(config *Config, writer *MetadataWriter) *ProducerIDManager {
+	return &ProducerIDManager{
+		config: config,
+		writer: writer,
+	}
+}
+
+// GenerateProducerID returns a producer ID never handed out before
+func (m *ProducerIDManager) GenerateProducerID() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.next >= m.blockEnd {
+		if err := m.reserveBlock(); err != nil {
+			return 0, err
+		}
+	}
+
+	id := m.next
+	m.next++
+	return id, nil
+}
+
+// reserveBlock reserves the next block of producer IDs in the metadata log
+func (m *ProducerIDManager) reserveBlock() error {
+	start, err := m.nextUnreserved()
+	if err != nil {
+		return err
+	}
+
+	end := start + producerIDBlockSize
+	if err := m.writer.Append([][]byte{EncodeProducerIDsRecord(int32(m.config.NodeID), end)}); err != nil {
+		return fmt.Errorf("failed to reserve producer IDs: %w", err)
+	}
+	m.next, m.blockEnd = start, end
+	return nil
+}
+
+// nextUnreserved reads the first producer ID not yet reserved from the metadata log
+func (m *ProducerIDManager) nextUnreserved() (int64, error) {
+	metadataService, err := NewMetadataService(m.config)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to create metadata service: %w", err)
+	}
+	defer metadataService.Close()
+
+	next, err := metadataService.NextProducerID()
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read reserved producer IDs: %w", err)
+	}
+	return max(next, m.blockEnd), nil
+}
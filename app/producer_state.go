@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Producer fields of batches written without idempotence
+const (
+	NoProducerID    = -1
+	NoProducerEpoch = -1
+	NoSequence      = -1
+)
+
+// producerBatchesRetained is how many of a producer's latest batches each partition remembers,
+// matching the number of requests an idempotent producer may have in flight
+const producerBatchesRetained = 5
+
+// producerSnapshotVersion is the format version of producer state snapshot files.
+// Version 2 added the first offset of each producer's ongoing transaction.
+const producerSnapshotVersion = 2
+
+// Errors returned when an idempotent producer's batch does not follow its previous ones
+var (
+	ErrOutOfOrderSequence   = errors.New("out of order sequence number")
+	ErrInvalidProducerEpoch = errors.New("invalid producer epoch")
+	ErrInvalidTxnState      = errors.New("invalid transaction state")
+)
+
+// DuplicateBatchError is returned when a producer retries a batch that is already in the log
+type DuplicateBatchError struct {
+	// BaseOffset is the offset the batch was first written at
+	BaseOffset int64
+}
+
+func (e *DuplicateBatchError) Error() string {
+	return fmt.Sprintf("duplicate of the batch at offset %d", e.BaseOffset)
+}
+
+// ProducerSnapshotFileName returns the name of the producer state snapshot taken at offset
+func ProducerSnapshotFileName(offset int64) string {
+	return fmt.Sprintf("%020d.snapshot", offset)
+}
+
+// producerBatch describes a batch written by an idempotent producer
+type producerBatch struct {
+	FirstSequence int32
+	LastSequence  int32
+	FirstOffset   int64
+	LastOffset    int64
+	Timestamp     int64
+}
+
+// ProducerStateEntry is what a partition remembers about one idempotent producer
+type ProducerStateEntry struct {
+	ProducerID int64
+	Epoch      int16
+	// Batches holds the producer's latest batches, oldest first
+	Batches []producerBatch
+	// CurrentTxnFirstOffset is the offset of the first batch of the producer's ongoing
+	// transaction in the partition, or -1 when it has none
+	CurrentTxnFirstOffset int64
+}
+
+// newProducerStateEntry creates the state of a producer the partition has not seen before
+func newProducerStateEntry(producerID int64, epoch int16) *ProducerStateEntry {
+	return &ProducerStateEntry{ProducerID: producerID, Epoch: epoch, CurrentTxnFirstOffset: -1}
+}
+
+// lastSequence returns the sequence number of the producer's last record, or NoSequence
+func (e *ProducerStateEntry) lastSequence() int32 {
+	if len(e.Batches) == 0 {
+		return NoSequence
+	}
+	return e.Batches[len(e.Batches)-1].LastSequence
+}
+
+// duplicateOf returns the retained batch with the same sequence numbers as batch, if any
+func (e *ProducerStateEntry) duplicateOf(batch *RecordBatch) (producerBatch, bool) {
+	lastSequence := batchLastSequence(batch)
+	for _, retained := range e.Batches {
+		if retained.FirstSequence == batch.BaseSequence && retained.LastSequence == lastSequence {
+			return retained, true
+		}
+	}
+	return producerBatch{}, false
+}
+
+// add records a batch written by the producer, starting over when the epoch changes.
+// Transactional batches written by the broker itself carry no sequence numbers; they only
+// open the producer's transaction.
+func (e *ProducerStateEntry) add(batch *RecordBatch) {
+	e.updateEpoch(batch.ProducerEpoch)
+	if batch.IsTransactional() && e.CurrentTxnFirstOffset == -1 {
+		e.CurrentTxnFirstOffset = batch.BaseOffset
+	}
+	if batch.BaseSequence == NoSequence {
+		return
+	}
+	e.Batches = append(e.Batches, producerBatch{
+		FirstSequence: batch.BaseSequence,
+		LastSequence:  batchLastSequence(batch),
+		FirstOffset:   batch.BaseOffset,
+		LastOffset:    batch.LastOffset(),
+		Timestamp:     batch.MaxTimestamp,
+	})
+	if len(e.Batches) > producerBatchesRetained {
+		e.Batches = slices.Delete(e.Batches, 0, len(e.Batches)-producerBatchesRetained)
+	}
+}
+
+// updateEpoch moves the producer to epoch, forgetting the batches of the previous one
+func (e *ProducerStateEntry) updateEpoch(epoch int16) {
+	if epoch != e.Epoch {
+		e.Epoch = epoch
+		e.Batches = nil
+	}
+}
+
+// endTxn applies the marker of a control batch, ending the producer's ongoing transaction.
+// It returns the transaction when the marker aborts one.
+func (e *ProducerStateEntry) endTxn(batch *RecordBatch, markerType ControlRecordType) (AbortedTxn, bool) {
+	if batch.ProducerEpoch > e.Epoch {
+		e.updateEpoch(batch.ProducerEpoch)
+	}
+	firstOffset := e.CurrentTxnFirstOffset
+	e.CurrentTxnFirstOffset = -1
+	if markerType != ControlRecordAbort || firstOffset == -1 {
+		return AbortedTxn{}, false
+	}
+	return AbortedTxn{ProducerID: e.ProducerID, FirstOffset: firstOffset, LastOffset: batch.BaseOffset}, true
+}
+
+// batchLastSequence returns the sequence number of a batch's last record; sequences wrap
+// around to 0 after the largest int32
+func batchLastSequence(batch *RecordBatch) int32 {
+	return incrementSequence(batch.BaseSequence, batch.LastOffsetDelta)
+}
+
+// incrementSequence adds increment to a sequence number, wrapping around after the largest int32
+func incrementSequence(sequence int32, increment int32) int32 {
+	if sequence > math.MaxInt32-increment {
+		return increment - (math.MaxInt32 - sequence) - 1
+	}
+	return sequence + increment
+}
+
+// ProducerStateManager tracks the idempotent producers writing to one partition, so that retried
+// batches are not appended twice and lost or reordered batches are detected. It also tracks the
+// transactions in progress in the partition: the first offset of the oldest one is the last
+// stable offset, below which consumers reading committed data may fetch.
+//
+// The state is rebuilt from the log when a partition is opened. To avoid replaying the whole log,
+// it is snapshotted to "<offset>.snapshot" in the partition directory when the log is closed;
+// only the batches from the snapshot's offset on are replayed. The caller serializes access.
+type ProducerStateManager struct {
+	dir       string
+	producers map[int64]*ProducerStateEntry
+}
+
+// NewProducerStateManager creates an empty producer state for the partition directory
+func NewProducerStateManager(dir string) *ProducerStateManager {
+	return &ProducerStateManager{
+		dir:       dir,
+		producers: make(map[int64]*ProducerStateEntry),
+	}
+}
+
+// prepareAppend starts staging the producer state changes of an append
+func (s *ProducerStateManager) prepareAppend() *producerAppend {
+	return &producerAppend{
+		state:   s,
+		updated: make(map[int64]*ProducerStateEntry),
+	}
+}
+
+// producerAppend stages the producer state changes of one append; they are applied only once
+// the batches have been written
+type producerAppend struct {
+	state   *ProducerStateManager
+	updated map[int64]*ProducerStateEntry
+	// aborted holds the transactions aborted by the markers of the append
+	aborted []AbortedTxn
+}
+
+// entry returns the staged state of a producer, or nil if the partition has none
+func (a *producerAppend) entry(producerID int64) *ProducerStateEntry {
+	if entry, ok := a.updated[producerID]; ok {
+		return entry
+	}
+	current, ok := a.state.producers[producerID]
+	if !ok {
+		return nil
+	}
+	entry := &ProducerStateEntry{
+		ProducerID:            producerID,
+		Epoch:                 current.Epoch,
+		Batches:               slices.Clone(current.Batches),
+		CurrentTxnFirstOffset: current.CurrentTxnFirstOffset,
+	}
+	a.updated[producerID] = entry
+	return entry
+}
+
+// validate checks that a batch follows the producer's previous batches: retries of a retained
+// batch return a DuplicateBatchError, older epochs ErrInvalidProducerEpoch, and sequence numbers
+// that do not continue the producer's last one ErrOutOfOrderSequence. A producer the partition
+// knows nothing about may start at any sequence, as its earlier batches may have been deleted.
+// Transaction markers only need to carry the producer's current epoch or a newer one, and a
+// producer with an ongoing transaction may not write outside of it.
+func (a *producerAppend) validate(batch *RecordBatch) error {
+	entry := a.entry(batch.ProducerID)
+	if entry == nil {
+		return nil
+	}
+
+	if batch.IsControl() {
+		if batch.ProducerEpoch < entry.Epoch {
+			return fmt.Errorf("%w: marker for producer %d has epoch %d, but its current epoch is %d",
+				ErrInvalidProducerEpoch, batch.ProducerID, batch.ProducerEpoch, entry.Epoch)
+		}
+		return nil
+	}
+
+	switch {
+	case batch.ProducerEpoch < entry.Epoch:
+		return fmt.Errorf("%w: producer %d sent epoch %d, but its current epoch is %d",
+			ErrInvalidProducerEpoch, batch.ProducerID, batch.ProducerEpoch, entry.Epoch)
+	case batch.ProducerEpoch > entry.Epoch:
+		if batch.BaseSequence != 0 {
+			return fmt.Errorf("%w: producer %d started epoch %d at sequence %d instead of 0",
+				ErrOutOfOrderSequence, batch.ProducerID, batch.ProducerEpoch, batch.BaseSequence)
+		}
+	default:
+		if duplicate, ok := entry.duplicateOf(batch); ok {
+			return &DuplicateBatchError{BaseOffset: duplicate.FirstOffset}
+		}
+		if lastSequence := entry.lastSequence(); lastSequence != NoSequence && batch.BaseSequence != incrementSequence(lastSequence, 1) {
+			return fmt.Errorf("%w: producer %d sent sequence %d, expected %d",
+				ErrOutOfOrderSequence, batch.ProducerID, batch.BaseSequence, incrementSequence(lastSequence, 1))
+		}
+	}
+	if entry.CurrentTxnFirstOffset != -1 && !batch.IsTransactional() {
+		return fmt.Errorf("%w: producer %d wrote a non-transactional batch during its transaction",
+			ErrInvalidTxnState, batch.ProducerID)
+	}
+	return nil
+}
+
+// add stages a batch whose offsets have been assigned. Control batches must be complete, as
+// the marker type is read from their record.
+func (a *producerAppend) add(batch *RecordBatch) error {
+	entry := a.entry(batch.ProducerID)
+	if entry == nil {
+		entry = newProducerStateEntry(batch.ProducerID, batch.ProducerEpoch)
+		a.updated[batch.ProducerID] = entry
+	}
+
+	if !batch.IsControl() {
+		entry.add(batch)
+		return nil
+	}
+	markerType, err := batch.ControlType()
+	if err != nil {
+		return fmt.Errorf("control batch at offset %d: %w", batch.BaseOffset, err)
+	}
+	if txn, ok := entry.endTxn(batch, markerType); ok {
+		a.aborted = append(a.aborted, txn)
+	}
+	return nil
+}
+
+// commit applies the staged changes and returns the transactions aborted by the append,
+// each with the last stable offset that followed it
+func (a *producerAppend) commit() []AbortedTxn {
+	for producerID, entry := range a.updated {
+		a.state.producers[producerID] = entry
+	}
+	for i := range a.aborted {
+		lastStableOffset, ok := a.state.firstUnstableOffset()
+		if !ok {
+			lastStableOffset = a.aborted[i].LastOffset + 1
+		}
+		a.aborted[i].LastStableOffset = lastStableOffset
+	}
+	return a.aborted
+}
+
+// replay updates the state with a batch read back from the log and returns the transaction
+// it aborts, if any
+func (s *ProducerStateManager) replay(batch *RecordBatch) ([]AbortedTxn, error) {
+	if batch.ProducerID == NoProducerID {
+		return nil, nil
+	}
+	producerAppend := s.prepareAppend()
+	if err := producerAppend.add(batch); err != nil {
+		return nil, err
+	}
+	return producerAppend.commit(), nil
+}
+
+// firstUnstableOffset returns the first offset of the oldest transaction in progress, if any
+func (s *ProducerStateManager) firstUnstableOffset() (int64, bool) {
+	offset, found := int64(0), false
+	for _, entry := range s.producers {
+		if entry.CurrentTxnFirstOffset != -1 && (!found || entry.CurrentTxnFirstOffset < offset) {
+			offset, found = entry.CurrentTxnFirstOffset, true
+		}
+	}
+	return offset, found
+}
+
+// snapshotOffsets returns the offsets of the snapshot files in the partition directory, in order
+func (s *ProducerStateManager) snapshotOffsets() ([]int64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list producer snapshots in %s: %w", s.dir, err)
+	}
+
+	var offsets []int64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".snapshot")
+		if !ok {
+			continue
+		}
+		if offset, err := strconv.ParseInt(name, 10, 64); err == nil {
+			offsets = append(offsets, offset)
+		}
+	}
+	slices.Sort(offsets)
+	return offsets, nil
+}
+
+// Load restores the latest snapshot taken at or before logEndOffset and returns its offset, from
+// which the log must be replayed. Snapshots past the log end, left by a log that lost its tail,
+// are deleted. Without a usable snapshot the state is empty and the offset is 0.
+func (s *ProducerStateManager) Load(logEndOffset int64) (int64, error) {
+	offsets, err := s.snapshotOffsets()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := len(offsets) - 1; i >= 0; i-- {
+		path := filepath.Join(s.dir, ProducerSnapshotFileName(offsets[i]))
+		if offsets[i] > logEndOffset {
+			os.Remove(path)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read producer snapshot %s: %w", path, err)
+		}
+		producers, err := decodeProducerSnapshot(data)
+		if err != nil {
+			// A corrupt snapshot is skipped in favor of an older one or a full replay
+			os.Remove(path)
+			continue
+		}
+		s.producers = producers
+		return offsets[i], nil
+	}
+
+	s.producers = make(map[int64]*ProducerStateEntry)
+	return 0, nil
+}
+
+// TakeSnapshot writes the state as of offset to a snapshot file and deletes older snapshots.
+// The file is written under a temporary name and renamed, so a crash never leaves a partial one.
+func (s *ProducerStateManager) TakeSnapshot(offset int64) error {
+	path := filepath.Join(s.dir, ProducerSnapshotFileName(offset))
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, encodeProducerSnapshot(s.producers), 0644); err != nil {
+		return fmt.Errorf("failed to write producer snapshot %s: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write producer snapshot %s: %w", path, err)
+	}
+
+	offsets, err := s.snapshotOffsets()
+	if err != nil {
+		return err
+	}
+	for _, older := range offsets {
+		if older < offset {
+			os.Remove(filepath.Join(s.dir, ProducerSnapshotFileName(older)))
+		}
+	}
+	return nil
+}
+
+// encodeProducerSnapshot encodes the producer state: version, a CRC-32C of what follows, then
+// each producer with its ongoing transaction and retained batches
+func encodeProducerSnapshot(producers map[int64]*ProducerStateEntry) []byte {
+	ids := slices.Sorted(maps.Keys(producers))
+
+	body := binary.BigEndian.AppendUint32(nil, uint32(len(ids)))
+	for _, id := range ids {
+		entry := producers[id]
+		body = binary.BigEndian.AppendUint64(body, uint64(entry.ProducerID))
+		body = binary.BigEndian.AppendUint16(body, uint16(entry.Epoch))
+		body = binary.BigEndian.AppendUint64(body, uint64(entry.CurrentTxnFirstOffset))
+		body = binary.BigEndian.AppendUint32(body, uint32(len(entry.Batches)))
+		for _, batch := range entry.Batches {
+			body = binary.BigEndian.AppendUint32(body, uint32(batch.FirstSequence))
+			body = binary.BigEndian.AppendUint32(body, uint32(batch.LastSequence))
+			body = binary.BigEndian.AppendUint64(body, uint64(batch.FirstOffset))
+			body = binary.BigEndian.AppendUint64(body, uint64(batch.LastOffset))
+			body = binary.BigEndian.AppendUint64(body, uint64(batch.Timestamp))
+		}
+	}
+
+	buf := binary.BigEndian.AppendUint16(nil, producerSnapshotVersion)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.Checksum(body, crc32cTable))
+	return append(buf, body...)
+}
+
+// decodeProducerSnapshot decodes a producer state snapshot of version 1 or 2, verifying its checksum
+func decodeProducerSnapshot(data []byte) (map[int64]*ProducerStateEntry, error) {
+	d := NewDecoder(data)
+	version := d.ReadInt16()
+	if d.Err() == nil && (version < 1 || version > producerSnapshotVersion) {
+		return nil, fmt.Errorf("unsupported producer snapshot version %d", version)
+	}
+	checksum := uint32(d.ReadInt32())
+	if d.Err() != nil {
+		return nil, d.Err()
+	}
+	if crc32.Checksum(data[6:], crc32cTable) != checksum {
+		return nil, errors.New("producer snapshot checksum mismatch")
+	}
+
+	producers := make(map[int64]*ProducerStateEntry)
+	count := int(d.ReadInt32())
+	for i := 0; i < count && d.Err() == nil; i++ {
+		entry := newProducerStateEntry(d.ReadInt64(), d.ReadInt16())
+		if version >= 2 {
+			entry.CurrentTxnFirstOffset = d.ReadInt64()
+		}
+		batchCount := int(d.ReadInt32())
+		for j := 0; j < batchCount && d.Err() == nil; j++ {
+			entry.Batches = append(entry.Batches, producerBatch{
+				FirstSequence: d.ReadInt32(),
+				LastSequence:  d.ReadInt32(),
+				FirstOffset:   d.ReadInt64(),
+				LastOffset:    d.ReadInt64(),
+				Timestamp:     d.ReadInt64(),
+			})
+		}
+		producers[entry.ProducerID] = entry
+	}
+	return producers, d.Err()
+}
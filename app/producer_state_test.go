@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testProducers() map[int64]*ProducerStateEntry {
+	ongoing := newProducerStateEntry(1000, 3)
+	ongoing.CurrentTxnFirstOffset = 12
+	ongoing.Batches = []producerBatch{
+		{FirstSequence: 0, LastSequence: 4, FirstOffset: 10, LastOffset: 14, Timestamp: 1700000000000},
+		{FirstSequence: 5, LastSequence: 5, FirstOffset: 17, LastOffset: 17, Timestamp: 1700000000100},
+	}
+	idle := newProducerStateEntry(1001, 0)
+	idle.Batches = []producerBatch{
+		{FirstSequence: 0, LastSequence: 0, FirstOffset: 15, LastOffset: 15, Timestamp: 1700000000050},
+	}
+	return map[int64]*ProducerStateEntry{
+		ongoing.ProducerID: ongoing,
+		idle.ProducerID:    idle,
+		1002:               newProducerStateEntry(1002, 7),
+	}
+}
+
+func TestProducerSnapshotRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	state := NewProducerStateManager(dir)
+	state.producers = testProducers()
+	if err := state.TakeSnapshot(10); err != nil {
+		t.Fatalf("TakeSnapshot(10): %v", err)
+	}
+	if err := state.TakeSnapshot(18); err != nil {
+		t.Fatalf("TakeSnapshot(18): %v", err)
+	}
+
+	offsets, err := state.snapshotOffsets()
+	if err != nil {
+		t.Fatalf("snapshotOffsets: %v", err)
+	}
+	if !reflect.DeepEqual(offsets, []int64{18}) {
+		t.Fatalf("snapshots after TakeSnapshot = %v, want [18]", offsets)
+	}
+
+	restored := NewProducerStateManager(dir)
+	offset, err := restored.Load(18)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if offset != 18 {
+		t.Errorf("Load returned offset %d, want 18", offset)
+	}
+	if !reflect.DeepEqual(restored.producers, testProducers()) {
+		t.Errorf("restored producers = %+v, want %+v", restored.producers, testProducers())
+	}
+}
+
+func TestProducerSnapshotLoad(t *testing.T) {
+	tests := []struct {
+		name         string
+		logEndOffset int64
+		corrupt      bool
+		wantOffset   int64
+		wantState    bool
+	}{
+		{name: "snapshot at log end", logEndOffset: 18, wantOffset: 18, wantState: true},
+		{name: "snapshot past log end", logEndOffset: 17, wantOffset: 0},
+		{name: "corrupt snapshot", logEndOffset: 18, corrupt: true, wantOffset: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			state := NewProducerStateManager(dir)
+			state.producers = testProducers()
+			if err := state.TakeSnapshot(18); err != nil {
+				t.Fatalf("TakeSnapshot: %v", err)
+			}
+			path := filepath.Join(dir, ProducerSnapshotFileName(18))
+			if tt.corrupt {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data[len(data)-1] ^= 0xff
+				if err := os.WriteFile(path, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			restored := NewProducerStateManager(dir)
+			offset, err := restored.Load(tt.logEndOffset)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if offset != tt.wantOffset {
+				t.Errorf("Load returned offset %d, want %d", offset, tt.wantOffset)
+			}
+			if got := len(restored.producers) > 0; got != tt.wantState {
+				t.Errorf("restored %d producers, want state %v", len(restored.producers), tt.wantState)
+			}
+			if _, err := os.Stat(path); tt.wantState == os.IsNotExist(err) {
+				t.Errorf("snapshot kept = %v, want %v", err == nil, tt.wantState)
+			}
+		})
+	}
+}
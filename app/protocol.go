@@ -4,18 +4,100 @@ package main
 const (
 	// API Keys
 	APIKeyDescribeTopicPartitions = 75
+	APIKeyProduce                 = 0
 	APIKeyFetch                   = 1
+	APIKeyListOffsets             = 2
+	APIKeyMetadata                = 3
+	APIKeyOffsetCommit            = 8
+	APIKeyOffsetFetch             = 9
+	APIKeyFindCoordinator         = 10
+	APIKeyJoinGroup               = 11
+	APIKeyHeartbeat               = 12
+	APIKeyLeaveGroup              = 13
+	APIKeySyncGroup               = 14
+	APIKeyDescribeGroups          = 15
+	APIKeyListGroups              = 16
 	APIKeyApiVersions             = 18
+	APIKeyCreateTopics            = 19
+	APIKeyDeleteTopics            = 20
+	APIKeyInitProducerID          = 22
+	APIKeyAddPartitionsToTxn      = 24
+	APIKeyAddOffsetsToTxn         = 25
+	APIKeyEndTxn                  = 26
+	APIKeyWriteTxnMarkers         = 27
+	APIKeyTxnOffsetCommit         = 28
+	APIKeyCreatePartitions        = 37
+	APIKeyDeleteGroups            = 42
+	APIKeyOffsetDelete            = 47
 	APIKeyDescribeCluster         = 60
+	APIKeyConsumerGroupHeartbeat  = 68
+	APIKeyConsumerGroupDescribe   = 69
+	APIKeyShareGroupHeartbeat     = 76
+	APIKeyShareFetch              = 78
+	APIKeyShareAcknowledge        = 79
 
 	// Error Codes
-	ErrorCodeNone               = 0
-	ErrorCodeUnknownTopicOrPart = 3
-	ErrorCodeUnsupportedVersion = 35
+	ErrorCodeUnknownServerError          = -1
+	ErrorCodeNone                        = 0
+	ErrorCodeOffsetOutOfRange            = 1
+	ErrorCodeCorruptMessage              = 2
+	ErrorCodeUnknownTopicOrPart          = 3
+	ErrorCodeLeaderNotAvailable          = 5
+	ErrorCodeMessageTooLarge             = 10
+	ErrorCodeOffsetMetadataTooLarge      = 12
+	ErrorCodeCoordinatorNotAvailable     = 15
+	ErrorCodeNotCoordinator              = 16
+	ErrorCodeInvalidTopic                = 17
+	ErrorCodeInvalidRequiredAcks         = 21
+	ErrorCodeIllegalGeneration           = 22
+	ErrorCodeInconsistentGroupProtocol   = 23
+	ErrorCodeInvalidGroupID              = 24
+	ErrorCodeUnknownMemberID             = 25
+	ErrorCodeInvalidSessionTimeout       = 26
+	ErrorCodeRebalanceInProgress         = 27
+	ErrorCodeUnsupportedVersion          = 35
+	ErrorCodeTopicAlreadyExists          = 36
+	ErrorCodeInvalidPartitions           = 37
+	ErrorCodeInvalidReplicationFactor    = 38
+	ErrorCodeInvalidReplicaAssignment    = 39
+	ErrorCodeInvalidConfig               = 40
+	ErrorCodeInvalidRequest              = 42
+	ErrorCodeUnsupportedForMessageFormat = 43
+	ErrorCodeOutOfOrderSequenceNumber    = 45
+	ErrorCodeInvalidProducerEpoch        = 47
+	ErrorCodeInvalidTxnState             = 48
+	ErrorCodeInvalidProducerIDMapping    = 49
+	ErrorCodeInvalidTransactionTimeout   = 50
+	ErrorCodeConcurrentTransactions      = 51
+	ErrorCodeOperationNotAttempted       = 55
+	ErrorCodeStorageError                = 56
+	ErrorCodeNonEmptyGroup               = 68
+	ErrorCodeGroupIDNotFound             = 69
+	ErrorCodeFetchSessionIDNotFound      = 70
+	ErrorCodeInvalidFetchSessionEpoch    = 71
+	ErrorCodeTopicDeletionDisabled       = 73
+	ErrorCodeUnsupportedCompressionType  = 76
+	ErrorCodeMemberIDRequired            = 79
+	ErrorCodeGroupMaxSizeReached         = 81
+	ErrorCodeFencedInstanceID            = 82
+	ErrorCodeGroupSubscribedToTopic      = 86
+	ErrorCodeInvalidRecord               = 87
+	ErrorCodeUnstableOffsetCommit        = 88
+	ErrorCodeProducerFenced              = 90
+	ErrorCodeUnknownTopicID              = 100
+	ErrorCodeFencedMemberEpoch           = 110
+	ErrorCodeUnreleasedInstanceID        = 111
+	ErrorCodeUnsupportedAssignor         = 112
+	ErrorCodeStaleMemberEpoch            = 113
+	ErrorCodeInvalidRecordState          = 121
+	ErrorCodeShareSessionNotFound        = 122
+	ErrorCodeInvalidShareSessionEpoch    = 123
+	ErrorCodeInvalidRegularExpression    = 128
 
 	// Protocol sizes (in bytes)
 	SizeInt16  = 2
 	SizeInt32  = 4
+	SizeInt64  = 8
 	SizeUInt8  = 1
 	SizeUInt16 = 2
 	SizeUInt32 = 4
@@ -24,23 +106,152 @@ const (
 	APIVersionsMinVersion = 0
 	APIVersionsMaxVersion = 4
 
+	ProduceMinVersion = 3
+	ProduceMaxVersion = 11
+
 	FetchMinVersion = 0
 	FetchMaxVersion = 16
 
+	ListOffsetsMinVersion = 1
+	ListOffsetsMaxVersion = 10
+
+	MetadataMinVersion = 0
+	MetadataMaxVersion = 12
+
+	OffsetCommitMinVersion = 2
+	OffsetCommitMaxVersion = 9
+
+	OffsetFetchMinVersion = 1
+	OffsetFetchMaxVersion = 9
+
+	FindCoordinatorMinVersion = 0
+	FindCoordinatorMaxVersion = 6
+
+	JoinGroupMinVersion = 0
+	JoinGroupMaxVersion = 9
+
+	HeartbeatMinVersion = 0
+	HeartbeatMaxVersion = 4
+
+	LeaveGroupMinVersion = 0
+	LeaveGroupMaxVersion = 5
+
+	SyncGroupMinVersion = 0
+	SyncGroupMaxVersion = 5
+
+	DescribeGroupsMinVersion = 0
+	DescribeGroupsMaxVersion = 5
+
+	ListGroupsMinVersion = 0
+	ListGroupsMaxVersion = 5
+
+	CreateTopicsMinVersion = 2
+	CreateTopicsMaxVersion = 7
+
+	DeleteTopicsMinVersion = 1
+	DeleteTopicsMaxVersion = 6
+
+	InitProducerIDMinVersion = 0
+	InitProducerIDMaxVersion = 5
+
+	AddPartitionsToTxnMinVersion = 0
+	AddPartitionsToTxnMaxVersion = 3
+
+	AddOffsetsToTxnMinVersion = 0
+	AddOffsetsToTxnMaxVersion = 3
+
+	EndTxnMinVersion = 0
+	EndTxnMaxVersion = 3
+
+	WriteTxnMarkersMinVersion = 0
+	WriteTxnMarkersMaxVersion = 1
+
+	TxnOffsetCommitMinVersion = 0
+	TxnOffsetCommitMaxVersion = 3
+
+	CreatePartitionsMinVersion = 0
+	CreatePartitionsMaxVersion = 3
+
+	DeleteGroupsMinVersion = 0
+	DeleteGroupsMaxVersion = 2
+
+	OffsetDeleteMinVersion = 0
+	OffsetDeleteMaxVersion = 0
+
 	DescribeTopicPartitionsMinVersion = 0
 	DescribeTopicPartitionsMaxVersion = 17
 
 	DescribeClusterMinVersion = 0
 	DescribeClusterMaxVersion = 0
 
+	ConsumerGroupHeartbeatMinVersion = 0
+	ConsumerGroupHeartbeatMaxVersion = 1
+
+	ConsumerGroupDescribeMinVersion = 0
+	ConsumerGroupDescribeMaxVersion = 1
+
+	ShareGroupHeartbeatMinVersion = 0
+	ShareGroupHeartbeatMaxVersion = 1
+
+	ShareFetchMinVersion = 0
+	ShareFetchMaxVersion = 1
+
+	ShareAcknowledgeMinVersion = 0
+	ShareAcknowledgeMaxVersion = 1
+
 	// Special response values
-	CursorNoMoreData            = 0xFF    // 255 - indicates no more data in cursor
-	TopicAuthorizedOperations   = 0x0D_F8 // Special value for topic authorized operations
-	PartitionUnusedOperations   = 0       // Unused partition operations value
-	EligibleLeaderReplicasCount = 1       // Default eligible leader replicas
-	LastKnownLSRCount           = 1       // Default last known LSR count
+	CursorNoMoreData            = 0xFF     // 255 - indicates no more data in cursor
+	TopicAuthorizedOperations   = 0x0D_F8  // Special value for topic authorized operations
+	PartitionUnusedOperations   = 0        // Unused partition operations value
+	ClusterAuthorizedOperations = 0x1F_A0  // Cluster operations allowed without an authorizer
+	GroupAuthorizedOperations   = 0x01_48  // Group operations allowed without an authorizer (READ, DESCRIBE, DELETE)
+	AuthorizedOperationsOmitted = -1 << 31 // Authorized operations were not requested
+	EligibleLeaderReplicasCount = 1        // Default eligible leader replicas
+	LastKnownLSRCount           = 1        // Default last known LSR count
 )
 
+// flexibleVersions maps each API key to the first version that uses the flexible
+// (compact, tagged-field) encoding for its request and response
+var flexibleVersions = map[int16]int16{
+	APIKeyProduce:                 9,
+	APIKeyFetch:                   12,
+	APIKeyListOffsets:             6,
+	APIKeyMetadata:                9,
+	APIKeyOffsetCommit:            8,
+	APIKeyOffsetFetch:             6,
+	APIKeyFindCoordinator:         3,
+	APIKeyJoinGroup:               6,
+	APIKeyHeartbeat:               4,
+	APIKeyLeaveGroup:              4,
+	APIKeySyncGroup:               4,
+	APIKeyDescribeGroups:          5,
+	APIKeyListGroups:              3,
+	APIKeyCreateTopics:            5,
+	APIKeyDeleteTopics:            4,
+	APIKeyInitProducerID:          2,
+	APIKeyAddPartitionsToTxn:      3,
+	APIKeyAddOffsetsToTxn:         3,
+	APIKeyEndTxn:                  3,
+	APIKeyWriteTxnMarkers:         1,
+	APIKeyTxnOffsetCommit:         3,
+	APIKeyCreatePartitions:        2,
+	APIKeyDeleteGroups:            2,
+	APIKeyApiVersions:             3,
+	APIKeyDescribeCluster:         0,
+	APIKeyConsumerGroupHeartbeat:  0,
+	APIKeyConsumerGroupDescribe:   0,
+	APIKeyShareGroupHeartbeat:     0,
+	APIKeyShareFetch:              0,
+	APIKeyShareAcknowledge:        0,
+	APIKeyDescribeTopicPartitions: 0,
+}
+
+// IsFlexibleVersion reports whether the given API version uses the flexible encoding
+func IsFlexibleVersion(apiKey int16, apiVersion int16) bool {
+	firstFlexible, ok := flexibleVersions[apiKey]
+	return ok && apiVersion >= firstFlexible
+}
+
 // API version information
 type APIVersion struct {
 	APIKey     uint16
@@ -66,10 +277,150 @@ func SupportedAPIs() []APIVersion {
 			MinVersion: DescribeClusterMinVersion,
 			MaxVersion: DescribeClusterMaxVersion,
 		},
+		{
+			APIKey:     APIKeyProduce,
+			MinVersion: ProduceMinVersion,
+			MaxVersion: ProduceMaxVersion,
+		},
 		{
 			APIKey:     APIKeyFetch,
 			MinVersion: FetchMinVersion,
 			MaxVersion: FetchMaxVersion,
 		},
+		{
+			APIKey:     APIKeyListOffsets,
+			MinVersion: ListOffsetsMinVersion,
+			MaxVersion: ListOffsetsMaxVersion,
+		},
+		{
+			APIKey:     APIKeyMetadata,
+			MinVersion: MetadataMinVersion,
+			MaxVersion: MetadataMaxVersion,
+		},
+		{
+			APIKey:     APIKeyOffsetCommit,
+			MinVersion: OffsetCommitMinVersion,
+			MaxVersion: OffsetCommitMaxVersion,
+		},
+		{
+			APIKey:     APIKeyOffsetFetch,
+			MinVersion: OffsetFetchMinVersion,
+			MaxVersion: OffsetFetchMaxVersion,
+		},
+		{
+			APIKey:     APIKeyFindCoordinator,
+			MinVersion: FindCoordinatorMinVersion,
+			MaxVersion: FindCoordinatorMaxVersion,
+		},
+		{
+			APIKey:     APIKeyJoinGroup,
+			MinVersion: JoinGroupMinVersion,
+			MaxVersion: JoinGroupMaxVersion,
+		},
+		{
+			APIKey:     APIKeyHeartbeat,
+			MinVersion: HeartbeatMinVersion,
+			MaxVersion: HeartbeatMaxVersion,
+		},
+		{
+			APIKey:     APIKeyLeaveGroup,
+			MinVersion: LeaveGroupMinVersion,
+			MaxVersion: LeaveGroupMaxVersion,
+		},
+		{
+			APIKey:     APIKeySyncGroup,
+			MinVersion: SyncGroupMinVersion,
+			MaxVersion: SyncGroupMaxVersion,
+		},
+		{
+			APIKey:     APIKeyDescribeGroups,
+			MinVersion: DescribeGroupsMinVersion,
+			MaxVersion: DescribeGroupsMaxVersion,
+		},
+		{
+			APIKey:     APIKeyListGroups,
+			MinVersion: ListGroupsMinVersion,
+			MaxVersion: ListGroupsMaxVersion,
+		},
+		{
+			APIKey:     APIKeyCreateTopics,
+			MinVersion: CreateTopicsMinVersion,
+			MaxVersion: CreateTopicsMaxVersion,
+		},
+		{
+			APIKey:     APIKeyDeleteTopics,
+			MinVersion: DeleteTopicsMinVersion,
+			MaxVersion: DeleteTopicsMaxVersion,
+		},
+		{
+			APIKey:     APIKeyInitProducerID,
+			MinVersion: InitProducerIDMinVersion,
+			MaxVersion: InitProducerIDMaxVersion,
+		},
+		{
+			APIKey:     APIKeyAddPartitionsToTxn,
+			MinVersion: AddPartitionsToTxnMinVersion,
+			MaxVersion: AddPartitionsToTxnMaxVersion,
+		},
+		{
+			APIKey:     APIKeyAddOffsetsToTxn,
+			MinVersion: AddOffsetsToTxnMinVersion,
+			MaxVersion: AddOffsetsToTxnMaxVersion,
+		},
+		{
+			APIKey:     APIKeyEndTxn,
+			MinVersion: EndTxnMinVersion,
+			MaxVersion: EndTxnMaxVersion,
+		},
+		{
+			APIKey:     APIKeyWriteTxnMarkers,
+			MinVersion: WriteTxnMarkersMinVersion,
+			MaxVersion: WriteTxnMarkersMaxVersion,
+		},
+		{
+			APIKey:     APIKeyTxnOffsetCommit,
+			MinVersion: TxnOffsetCommitMinVersion,
+			MaxVersion: TxnOffsetCommitMaxVersion,
+		},
+		{
+			APIKey:     APIKeyCreatePartitions,
+			MinVersion: CreatePartitionsMinVersion,
+			MaxVersion: CreatePartitionsMaxVersion,
+		},
+		{
+			APIKey:     APIKeyDeleteGroups,
+			MinVersion: DeleteGroupsMinVersion,
+			MaxVersion: DeleteGroupsMaxVersion,
+		},
+		{
+			APIKey:     APIKeyOffsetDelete,
+			MinVersion: OffsetDeleteMinVersion,
+			MaxVersion: OffsetDeleteMaxVersion,
+		},
+		{
+			APIKey:     APIKeyConsumerGroupHeartbeat,
+			MinVersion: ConsumerGroupHeartbeatMinVersion,
+			MaxVersion: ConsumerGroupHeartbeatMaxVersion,
+		},
+		{
+			APIKey:     APIKeyConsumerGroupDescribe,
+			MinVersion: ConsumerGroupDescribeMinVersion,
+			MaxVersion: ConsumerGroupDescribeMaxVersion,
+		},
+		{
+			APIKey:     APIKeyShareGroupHeartbeat,
+			MinVersion: ShareGroupHeartbeatMinVersion,
+			MaxVersion: ShareGroupHeartbeatMaxVersion,
+		},
+		{
+			APIKey:     APIKeyShareFetch,
+			MinVersion: ShareFetchMinVersion,
+			MaxVersion: ShareFetchMaxVersion,
+		},
+		{
+			APIKey:     APIKeyShareAcknowledge,
+			MinVersion: ShareAcknowledgeMinVersion,
+			MaxVersion: ShareAcknowledgeMaxVersion,
+		},
 	}
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DelayedOperation is a request that cannot be answered yet, such as a long-poll Fetch
+// waiting for data. It completes exactly once: either when tryComplete reports that it
+// can finish, or when its timeout expires.
+type DelayedOperation struct {
+	timeout     time.Duration
+	tryComplete func() bool
+	onComplete  func()
+	completed   atomic.Bool
+	timerMu     sync.Mutex
+	timer       *time.Timer
+	purgatory   *Purgatory
+	keys        []string
+}
+
+// NewDelayedOperation creates a delayed operation.
+// tryComplete is called whenever something the operation watches changes and must report
+// whether the operation is ready; onComplete is called once when the operation finishes.
+func NewDelayedOperation(timeout time.Duration, tryComplete func() bool, onComplete func()) *DelayedOperation {
+	return &DelayedOperation{
+		timeout:     timeout,
+		tryComplete: tryComplete,
+		onComplete:  onComplete,
+	}
+}
+
+// ForceComplete completes the operation unless it has already completed.
+// It returns true if this call completed the operation.
+func (op *DelayedOperation) ForceComplete() bool {
+	if !op.completed.CompareAndSwap(false, true) {
+		return false
+	}
+	op.timerMu.Lock()
+	if op.timer != nil {
+		op.timer.Stop()
+	}
+	op.timerMu.Unlock()
+	if op.purgatory != nil {
+		op.purgatory.unwatch(op)
+	}
+	op.onComplete()
+	return true
+}
+
+// IsCompleted reports whether the operation has completed
+func (op *DelayedOperation) IsCompleted() bool {
+	return op.completed.Load()
+}
+
+// Purgatory holds delayed operations until they can complete or expire.
+// Operations are watched under string keys (for example a topic partition); callers
+// that change the state behind a key call CheckAndComplete to wake its watchers.
+type Purgatory struct {
+	mu       sync.Mutex
+	watchers map[string][]*DelayedOperation
+}
+
+// NewPurgatory creates an empty purgatory
+func NewPurgatory() *Purgatory {
+	return &Purgatory{
+		watchers: make(map[string][]*DelayedOperation),
+	}
+}
+
+// TryCompleteElseWatch completes the operation right away if possible; otherwise it parks the
+// operation under keys until CheckAndComplete succeeds on one of them or the timeout expires.
+// It returns true if the operation completed immediately.
+func (p *Purgatory) TryCompleteElseWatch(op *DelayedOperation, keys []string) bool {
+	if op.tryComplete() && op.ForceComplete() {
+		return true
+	}
+
+	op.purgatory = p
+	op.keys = keys
+	p.mu.Lock()
+	for _, key := range keys {
+		p.watchers[key] = append(p.watchers[key], op)
+	}
+	p.mu.Unlock()
+
+	// Check again in case the state changed before the watchers were registered
+	if op.tryComplete() && op.ForceComplete() {
+		return true
+	}
+
+	// Arm the expiration timer unless the operation completed in the meantime
+	op.timerMu.Lock()
+	if !op.IsCompleted() {
+		op.timer = time.AfterFunc(op.timeout, func() { op.ForceComplete() })
+	}
+	op.timerMu.Unlock()
+
+	return false
+}
+
+// CheckAndComplete re-evaluates every operation watching key and returns how many completed
+func (p *Purgatory) CheckAndComplete(key string) int {
+	p.mu.Lock()
+	operations := append([]*DelayedOperation(nil), p.watchers[key]...)
+	p.mu.Unlock()
+
+	completed := 0
+	for _, op := range operations {
+		if !op.IsCompleted() && op.tryComplete() && op.ForceComplete() {
+			completed++
+		}
+	}
+	return completed
+}
+
+// unwatch removes a completed operation from all of its keys
+func (p *Purgatory) unwatch(op *DelayedOperation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, key := range op.keys {
+		operations := p.watchers[key]
+		for i, watched := range operations {
+			if watched == op {
+				operations = append(operations[:i], operations[i+1:]...)
+				break
+			}
+		}
+		if len(operations) == 0 {
+			delete(p.watchers, key)
+		} else {
+			p.watchers[key] = operations
+		}
+	}
+}
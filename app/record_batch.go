@@ -0,0 +1,474 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// Errors returned for batches that cannot be accepted as they are
+var (
+	// ErrUnsupportedMagic is returned for batches written in a message format older than v2
+	ErrUnsupportedMagic = errors.New("unsupported record batch magic")
+	// ErrCorruptBatch is returned for batches whose CRC does not match their contents
+	ErrCorruptBatch = errors.New("corrupt record batch")
+	// ErrUnsupportedCompression is returned for batches compressed with a codec that is not registered
+	ErrUnsupportedCompression = errors.New("unsupported compression type")
+	// ErrMessageTooLarge is returned for batches larger than the configured maximum, whether
+	// decompressed or as they would be stored
+	ErrMessageTooLarge = errors.New("message too large")
+)
+
+// Constants for the RecordBatch v2 on-disk and on-wire format
+const (
+	// RecordBatchHeaderSize is the size of the fixed batch header preceding the records
+	RecordBatchHeaderSize = 61
+
+	// RecordBatchMagic is the only message format version SwiftQueue accepts
+	RecordBatchMagic = 2
+
+	// Field offsets within the batch header
+	batchBaseOffsetOffset      = 0
+	batchLeaderEpochOffset     = 12
+	batchMagicOffset           = 16
+	batchCRCOffset             = 17
+	batchAttributesOffset      = 21
+	batchLastOffsetDeltaOffset = 23
+	batchBaseTimestampOffset   = 27
+	batchMaxTimestampOffset    = 35
+	batchProducerIDOffset      = 43
+	batchProducerEpochOffset   = 51
+	batchBaseSequenceOffset    = 53
+	batchRecordCountOffset     = 57
+
+	// Batch attribute bits
+	batchCompressionMask   = 0x07
+	batchTimestampTypeFlag = 0x08
+	batchTransactionalFlag = 0x10
+	batchControlFlag       = 0x20
+)
+
+// ControlRecordType is the type of the marker held by a control record
+type ControlRecordType int16
+
+// Control record types
+const (
+	ControlRecordAbort  ControlRecordType = 0
+	ControlRecordCommit ControlRecordType = 1
+)
+
+// controlRecordVersion is the version of control record keys and transaction marker values
+const controlRecordVersion = 0
+
+// decodeControlRecordKey decodes the key of a control record: version and type
+func decodeControlRecordKey(data []byte) (ControlRecordType, error) {
+	d := NewDecoder(data)
+	version := d.ReadInt16()
+	markerType := ControlRecordType(d.ReadInt16())
+	if err := d.Err(); err != nil {
+		return 0, fmt.Errorf("invalid control record key: %w", err)
+	}
+	if version < 0 {
+		return 0, fmt.Errorf("invalid control record key version %d", version)
+	}
+	if markerType != ControlRecordAbort && markerType != ControlRecordCommit {
+		return 0, fmt.Errorf("unknown control record type %d", markerType)
+	}
+	return markerType, nil
+}
+
+// crc32cTable is the Castagnoli table used for RecordBatch checksums
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Record is a single record decoded from a batch
+type Record struct {
+	Attributes     int8
+	TimestampDelta int64
+	OffsetDelta    int32
+	Key            []byte
+	Value          []byte
+	Headers        []RecordHeader
+}
+
+// RecordHeader is a key/value header attached to a record
+type RecordHeader struct {
+	Key   string
+	Value []byte
+}
+
+// RecordBatch is a single RecordBatch with its decoded header.
+// Raw holds the complete batch (header and records) exactly as it is stored on disk.
+type RecordBatch struct {
+	BaseOffset           int64
+	BatchLength          int32
+	PartitionLeaderEpoch int32
+	Magic                int8
+	CRC                  uint32
+	Attributes           int16
+	LastOffsetDelta      int32
+	BaseTimestamp        int64
+	MaxTimestamp         int64
+	ProducerID           int64
+	ProducerEpoch        int16
+	BaseSequence         int32
+	RecordCount          int32
+	Raw                  []byte
+}
+
+// Size returns the total size of the batch in bytes
+func (b *RecordBatch) Size() int {
+	return len(b.Raw)
+}
+
+// LastOffset returns the offset of the last record in the batch
+func (b *RecordBatch) LastOffset() int64 {
+	return b.BaseOffset + int64(b.LastOffsetDelta)
+}
+
+// NextOffset returns the offset following the last record in the batch
+func (b *RecordBatch) NextOffset() int64 {
+	return b.LastOffset() + 1
+}
+
+// CompressionType returns the compression codec ID from the batch attributes (0 = none)
+func (b *RecordBatch) CompressionType() int {
+	return int(b.Attributes & batchCompressionMask)
+}
+
+// IsTransactional reports whether the batch was written by a transactional producer
+func (b *RecordBatch) IsTransactional() bool {
+	return b.Attributes&batchTransactionalFlag != 0
+}
+
+// IsControl reports whether the batch holds control records (transaction markers)
+func (b *RecordBatch) IsControl() bool {
+	return b.Attributes&batchControlFlag != 0
+}
+
+// ControlType returns the type of the marker held by a control batch
+func (b *RecordBatch) ControlType() (ControlRecordType, error) {
+	records, err := b.Records()
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, errors.New("control batch holds no records")
+	}
+	return decodeControlRecordKey(records[0].Key)
+}
+
+// Records decodes the records of the batch, decompressing them with the batch's codec.
+// Compressed records may expand to at most MaxDecompressedRecordsBytes.
+func (b *RecordBatch) Records() ([]Record, error) {
+	data := b.Raw[RecordBatchHeaderSize:]
+	if compression := b.CompressionType(); compression != CompressionNone {
+		codec, err := LookupCompressionCodec(compression)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = codec.Decompress(data, MaxDecompressedRecordsBytes); err != nil {
+			return nil, err
+		}
+	}
+	return decodeRecords(data, int(b.RecordCount))
+}
+
+// minRecordSize is the size of the smallest record: one byte each for the length, attributes,
+// timestamp delta, offset delta, key length, value length and header count
+const minRecordSize = 7
+
+// decodeRecords decodes the records laid out back to back in data, which must number count.
+// count is read from the batch header, which the client controls, so the records are decoded
+// until data runs out rather than count times.
+func decodeRecords(data []byte, count int) ([]Record, error) {
+	d := NewDecoder(data)
+	records := make([]Record, 0, max(min(count, len(data)/minRecordSize), 0))
+
+	for i := 0; d.Remaining() > 0; i++ {
+		length := d.ReadVarint()
+		start := d.Offset()
+
+		record := Record{
+			Attributes:     d.ReadInt8(),
+			TimestampDelta: d.ReadVarint(),
+			OffsetDelta:    int32(d.ReadVarint()),
+			Key:            d.ReadVarintBytes(),
+			Value:          d.ReadVarintBytes(),
+		}
+		headerCount := int(d.ReadVarint())
+		for j := 0; j < headerCount && d.Err() == nil; j++ {
+			record.Headers = append(record.Headers, RecordHeader{
+				Key:   string(d.ReadVarintBytes()),
+				Value: d.ReadVarintBytes(),
+			})
+		}
+
+		if err := d.Err(); err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		if consumed := d.Offset() - start; int64(consumed) != length {
+			return nil, fmt.Errorf("record %d: length %d does not match %d decoded bytes", i, length, consumed)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != count {
+		return nil, fmt.Errorf("record count %d does not match the %d records decoded", count, len(records))
+	}
+	return records, nil
+}
+
+// RecordTimestamp returns the timestamp of a record in this batch
+func (b *RecordBatch) RecordTimestamp(record Record) int64 {
+	if b.Attributes&batchTimestampTypeFlag != 0 {
+		// LogAppendTime batches carry the append time as the max timestamp
+		return b.MaxTimestamp
+	}
+	return b.BaseTimestamp + record.TimestampDelta
+}
+
+// FindTimestamp returns the offset and timestamp of the first record whose timestamp is at or
+// after target. Batches whose codec is not registered are resolved at batch granularity.
+func (b *RecordBatch) FindTimestamp(target int64) (int64, int64, bool) {
+	records, err := b.Records()
+	if err != nil {
+		if b.MaxTimestamp >= target {
+			return b.BaseOffset, b.MaxTimestamp, true
+		}
+		return 0, 0, false
+	}
+	for _, record := range records {
+		if timestamp := b.RecordTimestamp(record); timestamp >= target {
+			return b.BaseOffset + int64(record.OffsetDelta), timestamp, true
+		}
+	}
+	return 0, 0, false
+}
+
+// FindMaxTimestamp returns the offset and timestamp of the first record carrying the batch's
+// largest timestamp. Batches whose codec is not registered are resolved at batch granularity.
+func (b *RecordBatch) FindMaxTimestamp() (int64, int64) {
+	offset, timestamp, ok := b.FindTimestamp(b.MaxTimestamp)
+	if !ok {
+		return b.BaseOffset, b.MaxTimestamp
+	}
+	return offset, timestamp
+}
+
+// SetBaseOffset assigns the batch base offset, rewriting the raw header.
+// The base offset is not covered by the CRC, so the checksum stays valid.
+func (b *RecordBatch) SetBaseOffset(offset int64) {
+	b.BaseOffset = offset
+	binary.BigEndian.PutUint64(b.Raw[batchBaseOffsetOffset:], uint64(offset))
+}
+
+// BuildRecordBatch encodes an uncompressed batch holding records, numbered from baseOffset.
+// Every record is stamped with timestamp; the records' offset and timestamp deltas are ignored.
+func BuildRecordBatch(baseOffset int64, timestamp int64, records []Record) *RecordBatch {
+	return buildRecordBatch(baseOffset, 0, NoProducerID, NoProducerEpoch, timestamp, records)
+}
+
+// BuildTransactionalRecordBatch encodes a batch of records written by a producer inside a
+// transaction. Such batches carry no sequence numbers, as they are written by the broker itself.
+func BuildTransactionalRecordBatch(producerID int64, producerEpoch int16, timestamp int64, records []Record) *RecordBatch {
+	return buildRecordBatch(0, batchTransactionalFlag, producerID, producerEpoch, timestamp, records)
+}
+
+// BuildControlBatch encodes the marker that commits or aborts a producer's transaction
+// in one partition
+func BuildControlBatch(producerID int64, producerEpoch int16, commit bool, coordinatorEpoch int32, timestamp int64) *RecordBatch {
+	markerType := ControlRecordAbort
+	if commit {
+		markerType = ControlRecordCommit
+	}
+	key := binary.BigEndian.AppendUint16(nil, controlRecordVersion)
+	key = binary.BigEndian.AppendUint16(key, uint16(markerType))
+	value := binary.BigEndian.AppendUint16(nil, controlRecordVersion)
+	value = binary.BigEndian.AppendUint32(value, uint32(coordinatorEpoch))
+
+	return buildRecordBatch(0, batchTransactionalFlag|batchControlFlag, producerID, producerEpoch, timestamp, []Record{{Key: key, Value: value}})
+}
+
+// buildRecordBatch encodes an uncompressed batch with the given attributes and producer
+func buildRecordBatch(baseOffset int64, attributes int16, producerID int64, producerEpoch int16, timestamp int64, records []Record) *RecordBatch {
+	body := make([]byte, 0, 256)
+	for i, record := range records {
+		record.OffsetDelta = int32(i)
+		record.TimestampDelta = 0
+		body = appendRecord(body, record)
+	}
+
+	raw := make([]byte, RecordBatchHeaderSize, RecordBatchHeaderSize+len(body))
+	binary.BigEndian.PutUint64(raw[batchBaseOffsetOffset:], uint64(baseOffset))
+	binary.BigEndian.PutUint32(raw[BatchLengthOffset:], uint32(RecordBatchHeaderSize-BatchHeaderSize+len(body)))
+	binary.BigEndian.PutUint32(raw[batchLeaderEpochOffset:], 0)
+	raw[batchMagicOffset] = RecordBatchMagic
+	binary.BigEndian.PutUint16(raw[batchAttributesOffset:], uint16(attributes))
+	binary.BigEndian.PutUint32(raw[batchLastOffsetDeltaOffset:], uint32(len(records)-1))
+	binary.BigEndian.PutUint64(raw[batchBaseTimestampOffset:], uint64(timestamp))
+	binary.BigEndian.PutUint64(raw[batchMaxTimestampOffset:], uint64(timestamp))
+	binary.BigEndian.PutUint64(raw[batchProducerIDOffset:], uint64(producerID))
+	binary.BigEndian.PutUint16(raw[batchProducerEpochOffset:], uint16(producerEpoch))
+	binary.BigEndian.PutUint32(raw[batchBaseSequenceOffset:], ^uint32(0))
+	binary.BigEndian.PutUint32(raw[batchRecordCountOffset:], uint32(len(records)))
+	raw = append(raw, body...)
+
+	// The checksum covers everything from the attributes to the end of the batch
+	binary.BigEndian.PutUint32(raw[batchCRCOffset:], crc32.Checksum(raw[batchAttributesOffset:], crc32cTable))
+
+	batch := decodeBatchHeader(raw)
+	batch.Raw = raw
+	return batch
+}
+
+// WithRecords returns a copy of the batch holding only records, which must be taken from the
+// batch. The header is kept as is apart from the length, record count and CRC: the base and last
+// offsets, timestamps and producer fields are unchanged, so that a batch left with fewer records,
+// or none, still accounts for every offset and sequence number of the original.
+// The records are compressed with the batch's codec.
+func (b *RecordBatch) WithRecords(records []Record) (*RecordBatch, error) {
+	return b.rebuild(b.Attributes, records)
+}
+
+// WithCompression returns a copy of the batch with its records compressed with the codec
+// compression, or left uncompressed for CompressionNone. Only the attributes, length and CRC of
+// the header change.
+func (b *RecordBatch) WithCompression(compression int) (*RecordBatch, error) {
+	records, err := b.Records()
+	if err != nil {
+		return nil, err
+	}
+	return b.rebuild(b.Attributes&^batchCompressionMask|int16(compression), records)
+}
+
+// rebuild encodes records, compressed with the codec selected by attributes, under a copy of
+// the batch header carrying attributes
+func (b *RecordBatch) rebuild(attributes int16, records []Record) (*RecordBatch, error) {
+	body := make([]byte, 0, len(b.Raw)-RecordBatchHeaderSize)
+	for _, record := range records {
+		body = appendRecord(body, record)
+	}
+	if compression := int(attributes & batchCompressionMask); compression != CompressionNone {
+		codec, err := LookupCompressionCodec(compression)
+		if err != nil {
+			return nil, err
+		}
+		if body, err = codec.Compress(body); err != nil {
+			return nil, err
+		}
+	}
+
+	raw := make([]byte, RecordBatchHeaderSize, RecordBatchHeaderSize+len(body))
+	copy(raw, b.Raw[:RecordBatchHeaderSize])
+	binary.BigEndian.PutUint32(raw[BatchLengthOffset:], uint32(RecordBatchHeaderSize-BatchHeaderSize+len(body)))
+	binary.BigEndian.PutUint16(raw[batchAttributesOffset:], uint16(attributes))
+	binary.BigEndian.PutUint32(raw[batchRecordCountOffset:], uint32(len(records)))
+	raw = append(raw, body...)
+	binary.BigEndian.PutUint32(raw[batchCRCOffset:], crc32.Checksum(raw[batchAttributesOffset:], crc32cTable))
+
+	batch := decodeBatchHeader(raw)
+	batch.Raw = raw
+	return batch, nil
+}
+
+// appendRecord encodes record with its offset and timestamp deltas and appends it to buf
+func appendRecord(buf []byte, record Record) []byte {
+	body := make([]byte, 0, len(record.Key)+len(record.Value)+16)
+	body = append(body, byte(record.Attributes))
+	body = binary.AppendVarint(body, record.TimestampDelta)
+	body = binary.AppendVarint(body, int64(record.OffsetDelta))
+	body = appendVarintBytes(body, record.Key)
+	body = appendVarintBytes(body, record.Value)
+	body = binary.AppendVarint(body, int64(len(record.Headers)))
+	for _, header := range record.Headers {
+		body = appendVarintBytes(body, []byte(header.Key))
+		body = appendVarintBytes(body, header.Value)
+	}
+
+	buf = binary.AppendVarint(buf, int64(len(body)))
+	return append(buf, body...)
+}
+
+// appendVarintBytes appends a varint length-prefixed byte array; nil is encoded as null (-1)
+func appendVarintBytes(buf []byte, data []byte) []byte {
+	if data == nil {
+		return binary.AppendVarint(buf, -1)
+	}
+	buf = binary.AppendVarint(buf, int64(len(data)))
+	return append(buf, data...)
+}
+
+// ParseRecordBatchHeader decodes the batch header at the start of data and verifies the
+// batch's CRC. data must contain the complete batch; the returned batch's Raw aliases data.
+func ParseRecordBatchHeader(data []byte) (*RecordBatch, error) {
+	if len(data) < BatchHeaderSize {
+		return nil, fmt.Errorf("record batch too short: %d bytes", len(data))
+	}
+
+	batchLength := int32(binary.BigEndian.Uint32(data[BatchLengthOffset:BatchHeaderSize]))
+	totalSize := BatchHeaderSize + int(batchLength)
+	if batchLength < 0 || len(data) < totalSize {
+		return nil, fmt.Errorf("incomplete record batch: expected %d bytes, got %d", totalSize, len(data))
+	}
+	// The magic byte sits at the same position in every message format version
+	if totalSize > batchMagicOffset && data[batchMagicOffset] != RecordBatchMagic {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedMagic, int8(data[batchMagicOffset]))
+	}
+	if totalSize < RecordBatchHeaderSize {
+		return nil, fmt.Errorf("invalid record batch length: %d", batchLength)
+	}
+
+	batch := decodeBatchHeader(data)
+	batch.Raw = data[:totalSize]
+	if err := batch.VerifyChecksum(); err != nil {
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// VerifyChecksum checks the batch's CRC-32C, which covers everything from the attributes to
+// the end of the batch
+func (b *RecordBatch) VerifyChecksum() error {
+	if computed := crc32.Checksum(b.Raw[batchAttributesOffset:], crc32cTable); computed != b.CRC {
+		return fmt.Errorf("%w: stored CRC %08x does not match computed CRC %08x", ErrCorruptBatch, b.CRC, computed)
+	}
+	return nil
+}
+
+// decodeBatchHeader decodes the fixed header fields; data must hold at least RecordBatchHeaderSize bytes
+func decodeBatchHeader(data []byte) *RecordBatch {
+	return &RecordBatch{
+		BaseOffset:           int64(binary.BigEndian.Uint64(data[batchBaseOffsetOffset:])),
+		BatchLength:          int32(binary.BigEndian.Uint32(data[BatchLengthOffset:])),
+		PartitionLeaderEpoch: int32(binary.BigEndian.Uint32(data[batchLeaderEpochOffset:])),
+		Magic:                int8(data[batchMagicOffset]),
+		CRC:                  binary.BigEndian.Uint32(data[batchCRCOffset:]),
+		Attributes:           int16(binary.BigEndian.Uint16(data[batchAttributesOffset:])),
+		LastOffsetDelta:      int32(binary.BigEndian.Uint32(data[batchLastOffsetDeltaOffset:])),
+		BaseTimestamp:        int64(binary.BigEndian.Uint64(data[batchBaseTimestampOffset:])),
+		MaxTimestamp:         int64(binary.BigEndian.Uint64(data[batchMaxTimestampOffset:])),
+		ProducerID:           int64(binary.BigEndian.Uint64(data[batchProducerIDOffset:])),
+		ProducerEpoch:        int16(binary.BigEndian.Uint16(data[batchProducerEpochOffset:])),
+		BaseSequence:         int32(binary.BigEndian.Uint32(data[batchBaseSequenceOffset:])),
+		RecordCount:          int32(binary.BigEndian.Uint32(data[batchRecordCountOffset:])),
+	}
+}
+
+// ParseRecordBatches splits a records payload into its individual batches
+func ParseRecordBatches(data []byte) ([]*RecordBatch, error) {
+	batches := make([]*RecordBatch, 0)
+
+	offset := 0
+	for offset < len(data) {
+		batch, err := ParseRecordBatchHeader(data[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("batch at position %d: %w", offset, err)
+		}
+		batches = append(batches, batch)
+		offset += batch.Size()
+	}
+
+	return batches, nil
+}
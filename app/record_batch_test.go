@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+// withRecordsSection returns a copy of batch holding body as its records section, claiming
+// count records, with the attributes, length and CRC updated to match
+func withRecordsSection(batch *RecordBatch, attributes int16, count int32, body []byte) *RecordBatch {
+	raw := append(bytes.Clone(batch.Raw[:RecordBatchHeaderSize]), body...)
+	binary.BigEndian.PutUint32(raw[BatchLengthOffset:], uint32(len(raw)-BatchHeaderSize))
+	binary.BigEndian.PutUint16(raw[batchAttributesOffset:], uint16(attributes))
+	binary.BigEndian.PutUint32(raw[batchRecordCountOffset:], uint32(count))
+	binary.BigEndian.PutUint32(raw[batchCRCOffset:], crc32.Checksum(raw[batchAttributesOffset:], crc32cTable))
+
+	rebuilt := decodeBatchHeader(raw)
+	rebuilt.Raw = raw
+	return rebuilt
+}
+
+func testRecordBatch() *RecordBatch {
+	return BuildRecordBatch(0, 1700000000000, []Record{
+		{Key: []byte("k0"), Value: []byte("v0")},
+		{Key: []byte("k1"), Value: []byte("v1"), Headers: []RecordHeader{{Key: "h", Value: []byte("x")}}},
+		{Key: nil, Value: nil},
+	})
+}
+
+func TestParseRecordBatches(t *testing.T) {
+	valid := testRecordBatch()
+	tests := []struct {
+		name    string
+		data    func() []byte
+		want    int
+		wantErr error
+	}{
+		{
+			name: "two batches",
+			data: func() []byte { return append(bytes.Clone(valid.Raw), valid.Raw...) },
+			want: 2,
+		},
+		{
+			name:    "bad CRC",
+			data:    func() []byte { data := bytes.Clone(valid.Raw); data[len(data)-1] ^= 0xff; return data },
+			wantErr: ErrCorruptBatch,
+		},
+		{
+			name:    "old magic",
+			data:    func() []byte { data := bytes.Clone(valid.Raw); data[batchMagicOffset] = 1; return data },
+			wantErr: ErrUnsupportedMagic,
+		},
+		{
+			name: "truncated batch",
+			data: func() []byte { return valid.Raw[:len(valid.Raw)-1] },
+		},
+		{
+			name: "truncated length",
+			data: func() []byte { return valid.Raw[:BatchHeaderSize-1] },
+		},
+		{
+			name: "length shorter than the header",
+			data: func() []byte {
+				data := bytes.Clone(valid.Raw)
+				binary.BigEndian.PutUint32(data[BatchLengthOffset:], RecordBatchHeaderSize-BatchHeaderSize-1)
+				return data
+			},
+		},
+		{
+			name: "negative length",
+			data: func() []byte {
+				data := bytes.Clone(valid.Raw)
+				binary.BigEndian.PutUint32(data[BatchLengthOffset:], 0xffffffff)
+				return data
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches, err := ParseRecordBatches(tt.data())
+			if tt.want > 0 {
+				if err != nil {
+					t.Fatalf("ParseRecordBatches: %v", err)
+				}
+				if len(batches) != tt.want {
+					t.Fatalf("parsed %d batches, want %d", len(batches), tt.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("ParseRecordBatches succeeded, want an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseRecordBatches error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRecordsRoundTrip(t *testing.T) {
+	batch := testRecordBatch()
+	compressed, err := batch.WithCompression(CompressionGzip)
+	if err != nil {
+		t.Fatalf("WithCompression: %v", err)
+	}
+	want, err := batch.Records()
+	if err != nil {
+		t.Fatalf("Records: %v", err)
+	}
+	got, err := compressed.Records()
+	if err != nil {
+		t.Fatalf("Records of the compressed batch: %v", err)
+	}
+	if len(got) != 3 || len(want) != 3 {
+		t.Fatalf("decoded %d and %d records, want 3", len(want), len(got))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i].Key, want[i].Key) || !bytes.Equal(got[i].Value, want[i].Value) ||
+			got[i].OffsetDelta != want[i].OffsetDelta || len(got[i].Headers) != len(want[i].Headers) {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if want[2].Key != nil || want[2].Value != nil {
+		t.Errorf("null key and value decoded as %q and %q", want[2].Key, want[2].Value)
+	}
+}
+
+func TestRecordsMalformed(t *testing.T) {
+	valid := testRecordBatch()
+	body := valid.Raw[RecordBatchHeaderSize:]
+
+	// A record whose key claims far more bytes than the batch holds
+	hugeKey := binary.AppendVarint(nil, 5)
+	hugeKey = append(hugeKey, 0)
+	hugeKey = binary.AppendVarint(hugeKey, 0)
+	hugeKey = binary.AppendVarint(hugeKey, 0)
+	hugeKey = binary.AppendVarint(hugeKey, 1<<62)
+
+	tests := []struct {
+		name  string
+		count int32
+		body  []byte
+	}{
+		{name: "count past the records", count: 4, body: body},
+		{name: "count past any batch", count: 0x7fffffff, body: body},
+		{name: "count short of the records", count: 2, body: body},
+		{name: "negative count", count: -1, body: body},
+		{name: "count without records", count: 1, body: nil},
+		{name: "truncated record", count: 3, body: body[:len(body)-1]},
+		{name: "huge key length", count: 1, body: hugeKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch := withRecordsSection(valid, 0, tt.count, tt.body)
+			batches, err := ParseRecordBatches(batch.Raw)
+			if err != nil {
+				t.Fatalf("ParseRecordBatches: %v", err)
+			}
+			if records, err := batches[0].Records(); err == nil {
+				t.Errorf("Records decoded %d records, want an error", len(records))
+			}
+		})
+	}
+}
+
+func TestRecordsDecompressionLimit(t *testing.T) {
+	limit := MaxDecompressedRecordsBytes
+	t.Cleanup(func() { MaxDecompressedRecordsBytes = limit })
+	MaxDecompressedRecordsBytes = 64 * 1024
+
+	valid := testRecordBatch()
+	tests := []struct {
+		name    string
+		size    int
+		wantErr error
+	}{
+		{name: "at the limit", size: 64 * 1024},
+		{name: "past the limit", size: 64*1024 + 1, wantErr: ErrMessageTooLarge},
+		{name: "bomb", size: 64 * 1024 * 1024, wantErr: ErrMessageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, err := GzipCodec{}.Compress(make([]byte, tt.size))
+			if err != nil {
+				t.Fatalf("Compress: %v", err)
+			}
+			batch := withRecordsSection(valid, CompressionGzip, 1, compressed)
+
+			_, err = batch.Records()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Records error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			// The zeroes decompress within the limit but are no valid record
+			if err == nil || errors.Is(err, ErrMessageTooLarge) {
+				t.Errorf("Records error = %v, want a decoding error", err)
+			}
+		})
+	}
+}
@@ -19,16 +19,6 @@ type SwiftQueueRequest struct {
 	RequestOffset         int
 }
 
-// DescribeTopicRequest represents a DescribeTopicPartitions request for a single topic
-type FetchRequest struct {
-	MaxWaitMs      int32
-	MinBytes       int32
-	MaxBytes       int32
-	IsolationLevel int
-	SessionID      int32
-	SessionEpoch   int32
-}
-
 // DescribeTopicRequest represents a DescribeTopicPartitions request for a single topic
 type DescribeTopicRequest struct {
 	TopicName       string
@@ -93,11 +83,15 @@ func ParseApiVersionRequest(data []byte) (*SwiftQueueRequest, error) {
 		offset += int(clientIDLength)
 	}
 
-	// Tagged fields (1 byte indicating empty)
-	if offset+SizeUInt8 > len(data) {
-		return nil, fmt.Errorf("request too short: cannot read tagged fields")
+	// Tagged fields (only present in the flexible request header)
+	if IsFlexibleVersion(req.APIKey, req.APIVersion) {
+		decoder := NewDecoder(data[offset:])
+		decoder.SkipTaggedFields(true)
+		if err := decoder.Err(); err != nil {
+			return nil, fmt.Errorf("request too short: cannot read tagged fields: %w", err)
+		}
+		offset += decoder.Offset()
 	}
-	offset++ // Skip tagged fields
 
 	// Remaining data is the body
 	req.Body = data[offset:]
@@ -151,17 +145,3 @@ func ParseDescribeTopicRequest(baseReq *SwiftQueueRequest, data []byte) (*SwiftQ
 
 	return baseReq, nil
 }
-
-func ParseFetchRequest(data []byte) (*FetchRequest, error) {
-	// Calculate offset: skip the header we already parsed
-	fetchRequest := &FetchRequest{
-		MaxWaitMs:      int32(binary.BigEndian.Uint32(data[0:4])),
-		MinBytes:       int32(binary.BigEndian.Uint32(data[4:8])),
-		MaxBytes:       int32(binary.BigEndian.Uint32(data[8:12])),
-		IsolationLevel: int(data[12]),
-		SessionID:      int32(binary.BigEndian.Uint32(data[13:17])),
-		SessionEpoch:   int32(binary.BigEndian.Uint32(data[17:21])),
-	}
-	return fetchRequest, nil
-
-}
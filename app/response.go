@@ -66,12 +66,106 @@ func (rb *ResponseBuilder) WriteBytes(data []byte) {
 	rb.buffer = append(rb.buffer, data...)
 }
 
+// WriteInt8 writes an 8-bit integer
+func (rb *ResponseBuilder) WriteInt8(val int8) {
+	rb.buffer = append(rb.buffer, byte(val))
+}
+
+// WriteBool writes a boolean as a single byte
+func (rb *ResponseBuilder) WriteBool(val bool) {
+	if val {
+		rb.WriteUInt8(1)
+	} else {
+		rb.WriteUInt8(0)
+	}
+}
+
+// WriteInt64 writes a 64-bit integer
+func (rb *ResponseBuilder) WriteInt64(val int64) {
+	rb.buffer = binary.BigEndian.AppendUint64(rb.buffer, uint64(val))
+}
+
+// WriteUVarint writes an unsigned variable-length integer
+func (rb *ResponseBuilder) WriteUVarint(val uint64) {
+	rb.buffer = binary.AppendUvarint(rb.buffer, val)
+}
+
+// WriteVarint writes a zigzag-encoded signed variable-length integer
+func (rb *ResponseBuilder) WriteVarint(val int64) {
+	rb.buffer = binary.AppendVarint(rb.buffer, val)
+}
+
 // WriteString writes a compact string (length + content)
 func (rb *ResponseBuilder) WriteString(s string) {
-	rb.WriteUInt8(uint8(len(s) + 1))
+	rb.WriteUVarint(uint64(len(s) + 1))
 	rb.WriteBytes([]byte(s))
 }
 
+// WriteStringField writes a string as a compact string in flexible versions
+// and as an int16-length string otherwise
+func (rb *ResponseBuilder) WriteStringField(s string, flexible bool) {
+	if flexible {
+		rb.WriteString(s)
+		return
+	}
+	rb.WriteInt16(int16(len(s)))
+	rb.WriteBytes([]byte(s))
+}
+
+// WriteNullableString writes a string that may be null
+func (rb *ResponseBuilder) WriteNullableString(s *string, flexible bool) {
+	if s != nil {
+		rb.WriteStringField(*s, flexible)
+		return
+	}
+	if flexible {
+		rb.WriteUVarint(0)
+	} else {
+		rb.WriteInt16(-1)
+	}
+}
+
+// WriteBytesField writes a nullable byte array; nil is written as null
+func (rb *ResponseBuilder) WriteBytesField(data []byte, flexible bool) {
+	if data == nil {
+		rb.WriteArrayLength(-1, flexible)
+		return
+	}
+	rb.WriteArrayLength(len(data), flexible)
+	rb.WriteBytes(data)
+}
+
+// WriteArrayLength writes an array length; a negative length is written as null
+func (rb *ResponseBuilder) WriteArrayLength(length int, flexible bool) {
+	if flexible {
+		rb.WriteUVarint(uint64(length + 1))
+		return
+	}
+	rb.WriteInt32(int32(length))
+}
+
+// WriteUUID writes a hex-encoded UUID as 16 raw bytes; invalid input is written as the zero UUID
+func (rb *ResponseBuilder) WriteUUID(uuid string) {
+	raw, err := hex.DecodeString(uuid)
+	if err != nil || len(raw) != UUIDSize {
+		raw = make([]byte, UUIDSize)
+	}
+	rb.WriteBytes(raw)
+}
+
+// WriteTaggedFields writes an empty tagged field section; it is a no-op for non-flexible versions
+func (rb *ResponseBuilder) WriteTaggedFields(flexible bool) {
+	if flexible {
+		rb.WriteUVarint(0)
+	}
+}
+
+// WriteResponseHeader writes the correlation ID and, for flexible versions, the header tag buffer
+func (rb *ResponseBuilder) WriteResponseHeader(correlationID int32, flexible bool) {
+	rb.WriteInt32(correlationID)
+	rb.WriteTaggedFields(flexible)
+}
+
 // PrependMessageSize prepends the message size to the beginning
 func (rb *ResponseBuilder) PrependMessageSize() {
 	messageSize := len(rb.buffer)
@@ -118,7 +212,7 @@ func BuildApiVersionsResponse(correlationID int32, apiVersion int16, minVersion
 }
 
 // BuildDescribeTopicResponse creates a response for DescribeTopicPartitions request
-func BuildDescribeTopicResponse(req *SwiftQueueRequest, requestBytes []byte, config *Config) []byte {
+func BuildDescribeTopicResponse(req *SwiftQueueRequest, requestBytes []byte, broker *Broker) []byte {
 	rb := NewResponseBuilder()
 
 	if len(req.DescribeTopicRequests) == 0 {
@@ -138,7 +232,7 @@ func BuildDescribeTopicResponse(req *SwiftQueueRequest, requestBytes []byte, con
 	rb.WriteUInt8(uint8(req.TopicArrayLength))
 
 	// Build topic responses
-	buildTopicArray(rb, requestBytes, req, config)
+	buildTopicArray(rb, requestBytes, req, broker)
 
 	// Cursor (next continuation point) - indicates no more data
 	rb.WriteUInt8(CursorNoMoreData)
@@ -154,8 +248,8 @@ func BuildDescribeTopicResponse(req *SwiftQueueRequest, requestBytes []byte, con
 }
 
 // buildTopicArray builds the topic array portion of the response
-func buildTopicArray(rb *ResponseBuilder, requestBytes []byte, req *SwiftQueueRequest, config *Config) {
-	topics, partitions, _ := getMetadataFromConfig(config)
+func buildTopicArray(rb *ResponseBuilder, requestBytes []byte, req *SwiftQueueRequest, broker *Broker) {
+	topics, partitions := broker.TopicsAndPartitions()
 
 	describeTopicRequest := req.DescribeTopicRequests
 	for i := 0; i < req.TopicArrayLength-1; i++ {
@@ -167,7 +261,7 @@ func buildTopicArray(rb *ResponseBuilder, requestBytes []byte, req *SwiftQueueRe
 		matchedTopic := findTopicByName(topics, string(topicName))
 
 		if matchedTopic != nil {
-			buildTopicResponse(rb, topicName, topicNameLength, matchedTopic, partitions, config)
+			buildTopicResponse(rb, topicName, topicNameLength, matchedTopic, partitions, broker.config)
 		} else {
 			buildTopicNotFoundResponse(rb, topicName, topicNameLength)
 		}
@@ -184,6 +278,16 @@ func findTopicByName(topics []Topic, name string) *Topic {
 	return nil
 }
 
+// findTopicByUUID searches for a topic by its hex-encoded UUID and returns it if found
+func findTopicByUUID(topics []Topic, uuid string) *Topic {
+	for i := range topics {
+		if topics[i].UUID == uuid {
+			return &topics[i]
+		}
+	}
+	return nil
+}
+
 // buildTopicResponse builds a response for a found topic
 func buildTopicResponse(rb *ResponseBuilder, topicName []byte, topicNameLength int, topic *Topic, partitions []Partition, config *Config) {
 	// Error code (NONE - success)
@@ -235,7 +339,7 @@ func buildPartitionArray(rb *ResponseBuilder, partitions []Partition, config *Co
 	// Filter partitions that belong to this topic
 	topicPartitions := filterPartitionsByTopicUUID(partitions, topic.UUID)
 	// Write partition count (compact array encoding)
-	rb.WriteUInt8(uint8(len(topicPartitions) + 1))
+	rb.WriteArrayLength(len(topicPartitions), true)
 
 	// Write each partition
 	for _, partition := range topicPartitions {
@@ -264,13 +368,9 @@ func buildPartitionResponse(rb *ResponseBuilder, partition *Partition) {
 	rb.WriteUInt32(partition.LeaderID)
 	rb.WriteUInt32(partition.LeaderEpoch)
 
-	// Replica information
-	rb.WriteUInt8(uint8(partition.ReplicaLength))
-	rb.WriteUInt32(partition.ReplicaID)
-
-	// In-sync replica information
-	rb.WriteUInt8(uint8(partition.LengthSyncReplica))
-	rb.WriteUInt32(partition.InSyncReplica)
+	// Replica and in-sync replica information
+	writeInt32Array(rb, partition.Replicas(), true)
+	writeInt32Array(rb, partition.InSyncReplicas(), true)
 
 	// Eligible leader replicas
 	rb.WriteUInt8(EligibleLeaderReplicasCount)
@@ -283,17 +383,13 @@ func buildPartitionResponse(rb *ResponseBuilder, partition *Partition) {
 	rb.WriteUInt8(0)
 }
 
-// getMetadataFromConfig retrieves topics and partitions using the metadata service
-func getMetadataFromConfig(config *Config) ([]Topic, []Partition, error) {
+// getMetadataImage loads the current cluster metadata image using the metadata service
+func getMetadataImage(config *Config) (*MetadataImage, error) {
 	metadataService, err := NewMetadataService(config)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create metadata service: %w", err)
+		return nil, fmt.Errorf("failed to create metadata service: %w", err)
 	}
 	defer metadataService.Close()
 
-	topics, partitions, err := metadataService.GetTopicsAndPartitions()
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get topics and partitions: %w", err)
-	}
-	return topics, partitions, nil
+	return metadataService.LoadImage()
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -15,6 +16,7 @@ import (
 // Server represents the SwiftQueue protocol server
 type Server struct {
 	config   *Config
+	broker   *Broker
 	listener net.Listener
 	logger   *log.Logger
 	wg       sync.WaitGroup
@@ -29,8 +31,14 @@ func NewServer(config *Config) (*Server, error) {
 
 	logger := log.New(os.Stdout, "[swiftqueue-server] ", log.LstdFlags|log.Lmsgprefix)
 
+	broker, err := NewBroker(config, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize broker: %w", err)
+	}
+
 	return &Server{
 		config:   config,
+		broker:   broker,
 		logger:   logger,
 		shutdown: make(chan struct{}),
 	}, nil
@@ -49,30 +57,29 @@ func (s *Server) Start() error {
 	return nil
 }
 
-// Serve accepts and handles incoming connections
+// Serve accepts and handles incoming connections until ctx is cancelled, then shuts down
+// gracefully: it stops accepting connections and waits for the open ones to finish
 func (s *Server) Serve(ctx context.Context) error {
 	// Create a context that can be cancelled
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	// Handle graceful shutdown
-	// go s.handleShutdown(cancel)
+	// Closing the listener stops accepting new connections and unblocks Accept
+	go func() {
+		<-ctx.Done()
+		if err := s.listener.Close(); err != nil {
+			s.logger.Printf("Error closing listener: %v", err)
+		}
+	}()
 
 	for {
-		// select {
-		// case <-ctx.Done():
-		// 	s.logger.Println("Server shutting down...")
-		// 	return s.gracefulShutdown()
-		// default:
-		// }
-
 		// Accept new connection
 		conn, err := s.listener.Accept()
 		if err != nil {
 			select {
 			case <-ctx.Done():
-				// Shutdown in progress
-				return nil
+				s.logger.Println("Server shutting down...")
+				return s.gracefulShutdown()
 			default:
 				s.logger.Printf("Error accepting connection: %v", err)
 				continue
@@ -83,7 +90,7 @@ func (s *Server) Serve(ctx context.Context) error {
 		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
-			handler := NewConnectionHandler(conn, s.config, s.logger)
+			handler := NewConnectionHandler(conn, s.config, s.logger, s.broker)
 			if err := handler.Handle(ctx); err != nil {
 				s.logger.Printf("Connection handler error: %v", err)
 			}
@@ -91,27 +98,25 @@ func (s *Server) Serve(ctx context.Context) error {
 	}
 }
 
-// handleShutdown listens for shutdown signals
-func (s *Server) handleShutdown(cancel context.CancelFunc) {
+// handleShutdown cancels the server on the first shutdown signal. Later signals get their
+// default action again, so that a second one still kills a server stuck shutting down.
+func (s *Server) handleShutdown(ctx context.Context, cancel context.CancelFunc) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
-	sig := <-sigChan
-	s.logger.Printf("Received signal: %v", sig)
-	cancel()
+	select {
+	case sig := <-sigChan:
+		s.logger.Printf("Received signal: %v", sig)
+		cancel()
+	case <-ctx.Done():
+	}
 }
 
-// gracefulShutdown performs a graceful shutdown
+// gracefulShutdown waits for the open connections to finish, once the listener is closed
 func (s *Server) gracefulShutdown() error {
 	s.logger.Println("Starting graceful shutdown...")
 
-	// Close the listener to stop accepting new connections
-	if s.listener != nil {
-		if err := s.listener.Close(); err != nil {
-			s.logger.Printf("Error closing listener: %v", err)
-		}
-	}
-
 	// Wait for existing connections to finish with timeout
 	done := make(chan struct{})
 	go func() {
@@ -129,11 +134,21 @@ func (s *Server) gracefulShutdown() error {
 	return nil
 }
 
-// Run starts the server and blocks until shutdown
+// Run starts the server and blocks until SIGINT or SIGTERM shuts it down. The broker is then
+// closed, flushing its logs and marking the shutdown clean.
 func (s *Server) Run() error {
 	if err := s.Start(); err != nil {
+		s.broker.Close()
 		return err
 	}
 
-	return s.Serve(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.handleShutdown(ctx, cancel)
+
+	serveErr := s.Serve(ctx)
+	if err := s.broker.Close(); err != nil {
+		return errors.Join(serveErr, fmt.Errorf("failed to close broker: %w", err))
+	}
+	return serveErr
 }
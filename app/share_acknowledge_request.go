@@ -0,0 +1,62 @@
+package main
+
+import "fmt"
+
+// ShareAcknowledgeRequest represents a parsed ShareAcknowledge request
+type ShareAcknowledgeRequest struct {
+	GroupID           *string
+	MemberID          *string
+	ShareSessionEpoch int32
+	Topics            []ShareAcknowledgeTopic
+}
+
+// ShareAcknowledgeTopic lists the partitions of one topic with acknowledgements
+type ShareAcknowledgeTopic struct {
+	TopicID    string
+	Partitions []ShareAcknowledgePartition
+}
+
+// ShareAcknowledgePartition holds the acknowledgements for one partition
+type ShareAcknowledgePartition struct {
+	Index                  int32
+	AcknowledgementBatches []AcknowledgementBatch
+}
+
+// ParseShareAcknowledgeRequest parses the body of a ShareAcknowledge request (v0-v1)
+func ParseShareAcknowledgeRequest(baseReq *SwiftQueueRequest) (*ShareAcknowledgeRequest, error) {
+	version := baseReq.APIVersion
+	if version < ShareAcknowledgeMinVersion || version > ShareAcknowledgeMaxVersion {
+		return nil, fmt.Errorf("unsupported share acknowledge version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &ShareAcknowledgeRequest{}
+	req.GroupID = d.ReadNullableString(flexible)
+	req.MemberID = d.ReadNullableString(flexible)
+	req.ShareSessionEpoch = d.ReadInt32()
+
+	topicCount := d.ReadArrayLength(flexible)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := ShareAcknowledgeTopic{}
+		topic.TopicID = d.ReadUUID()
+		partitionCount := d.ReadArrayLength(flexible)
+		for j := 0; j < partitionCount && d.Err() == nil; j++ {
+			partition := ShareAcknowledgePartition{}
+			partition.Index = d.ReadInt32()
+			partition.AcknowledgementBatches = readAcknowledgementBatches(d, flexible)
+			d.SkipTaggedFields(flexible)
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+		d.SkipTaggedFields(flexible)
+		req.Topics = append(req.Topics, topic)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse share acknowledge request: %w", err)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import "fmt"
+
+// ShareAcknowledgeTopicResult holds the partition results for one topic of a ShareAcknowledge response
+type ShareAcknowledgeTopicResult struct {
+	TopicID    string
+	Partitions []ShareAcknowledgePartitionResult
+}
+
+// ShareAcknowledgePartitionResult holds the outcome of the acknowledgements for one partition
+type ShareAcknowledgePartitionResult struct {
+	Index     int32
+	ErrorCode int16
+}
+
+// BuildShareAcknowledgeResponse applies the acknowledgements of a ShareAcknowledge request.
+// The request cannot open a share session; the final session epoch closes the session after
+// acknowledging and releases whatever the member still holds.
+func BuildShareAcknowledgeResponse(baseReq *SwiftQueueRequest, req *ShareAcknowledgeRequest, broker *Broker) []byte {
+	fail := func(errorCode int16, message string) []byte {
+		var errorMessage *string
+		if message != "" {
+			errorMessage = stringPtr(message)
+		}
+		return encodeShareAcknowledgeResponse(baseReq, broker, errorCode, errorMessage, nil)
+	}
+
+	if req.GroupID == nil || *req.GroupID == "" {
+		return fail(ErrorCodeInvalidRequest, "GroupId must be set")
+	}
+	if req.MemberID == nil || *req.MemberID == "" {
+		return fail(ErrorCodeInvalidRequest, "MemberId must be set")
+	}
+	groupID, memberID := *req.GroupID, *req.MemberID
+	if req.ShareSessionEpoch == ShareSessionEpochInitial {
+		return fail(ErrorCodeInvalidShareSessionEpoch, "ShareAcknowledge can't open a share session")
+	}
+	if req.ShareSessionEpoch != ShareSessionEpochFinal && !broker.groupCoordinator.IsShareGroupMember(groupID, memberID) {
+		return fail(ErrorCodeUnknownMemberID, fmt.Sprintf("Member %s is not a member of share group %s", memberID, groupID))
+	}
+
+	if _, errorCode := broker.sharePartitions.sessions.Update(groupID, memberID, req.ShareSessionEpoch, nil, nil); errorCode != ErrorCodeNone {
+		return fail(errorCode, "")
+	}
+
+	topics, partitions := broker.TopicsAndPartitions()
+
+	results := make([]ShareAcknowledgeTopicResult, 0, len(req.Topics))
+	for _, topic := range req.Topics {
+		topicResult := ShareAcknowledgeTopicResult{TopicID: topic.TopicID}
+		for _, partition := range topic.Partitions {
+			tp := TopicIDPartition{TopicID: topic.TopicID, Partition: partition.Index}
+			sharePartition, errorCode := sharePartitionFor(broker, groupID, topics, partitions, tp)
+			if errorCode == ErrorCodeNone {
+				errorCode = sharePartition.Acknowledge(memberID, partition.AcknowledgementBatches)
+			}
+			topicResult.Partitions = append(topicResult.Partitions, ShareAcknowledgePartitionResult{
+				Index:     partition.Index,
+				ErrorCode: errorCode,
+			})
+		}
+		results = append(results, topicResult)
+	}
+
+	if req.ShareSessionEpoch == ShareSessionEpochFinal {
+		broker.sharePartitions.ReleaseMember(groupID, memberID)
+	}
+
+	return encodeShareAcknowledgeResponse(baseReq, broker, ErrorCodeNone, nil, results)
+}
+
+// encodeShareAcknowledgeResponse serializes the ShareAcknowledge response
+func encodeShareAcknowledgeResponse(baseReq *SwiftQueueRequest, broker *Broker, errorCode int16, errorMessage *string, results []ShareAcknowledgeTopicResult) []byte {
+	flexible := IsFlexibleVersion(baseReq.APIKey, baseReq.APIVersion)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Throttle time
+	rb.WriteInt32(0)
+	rb.WriteInt16(errorCode)
+	rb.WriteNullableString(errorMessage, flexible)
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, topic := range results {
+		rb.WriteUUID(topic.TopicID)
+		rb.WriteArrayLength(len(topic.Partitions), flexible)
+		for _, partition := range topic.Partitions {
+			rb.WriteInt32(partition.Index)
+			rb.WriteInt16(partition.ErrorCode)
+			// Error message
+			rb.WriteNullableString(nil, flexible)
+			writeShareCurrentLeader(rb, broker, flexible)
+			rb.WriteTaggedFields(flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	// Node endpoints, only sent when the leader changed
+	rb.WriteArrayLength(0, flexible)
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
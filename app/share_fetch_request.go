@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ShareFetchRequest represents a parsed ShareFetch request
+type ShareFetchRequest struct {
+	GroupID           *string
+	MemberID          *string
+	ShareSessionEpoch int32
+	MaxWaitMs         int32
+	MinBytes          int32
+	MaxBytes          int32
+	MaxRecords        int32
+	BatchSize         int32
+	Topics            []ShareFetchTopic
+	ForgottenTopics   []ShareForgottenTopic
+}
+
+// ShareFetchTopic lists the partitions of one topic to fetch from or acknowledge
+type ShareFetchTopic struct {
+	TopicID    string
+	Partitions []ShareFetchPartition
+}
+
+// ShareFetchPartition is a partition to fetch from, with the acknowledgements of records
+// fetched from it before
+type ShareFetchPartition struct {
+	Index                  int32
+	PartitionMaxBytes      int32
+	AcknowledgementBatches []AcknowledgementBatch
+}
+
+// ShareForgottenTopic lists partitions to remove from the share session
+type ShareForgottenTopic struct {
+	TopicID    string
+	Partitions []int32
+}
+
+// ParseShareFetchRequest parses the body of a ShareFetch request (v0-v1)
+func ParseShareFetchRequest(baseReq *SwiftQueueRequest) (*ShareFetchRequest, error) {
+	version := baseReq.APIVersion
+	if version < ShareFetchMinVersion || version > ShareFetchMaxVersion {
+		return nil, fmt.Errorf("unsupported share fetch version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	// Version 0 does not limit the number of records
+	req := &ShareFetchRequest{MaxRecords: math.MaxInt32}
+	req.GroupID = d.ReadNullableString(flexible)
+	req.MemberID = d.ReadNullableString(flexible)
+	req.ShareSessionEpoch = d.ReadInt32()
+	req.MaxWaitMs = d.ReadInt32()
+	req.MinBytes = d.ReadInt32()
+	req.MaxBytes = d.ReadInt32()
+	if version >= 1 {
+		req.MaxRecords = d.ReadInt32()
+		req.BatchSize = d.ReadInt32()
+	}
+
+	topicCount := d.ReadArrayLength(flexible)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := ShareFetchTopic{}
+		topic.TopicID = d.ReadUUID()
+		partitionCount := d.ReadArrayLength(flexible)
+		for j := 0; j < partitionCount && d.Err() == nil; j++ {
+			partition := ShareFetchPartition{}
+			partition.Index = d.ReadInt32()
+			if version == 0 {
+				partition.PartitionMaxBytes = d.ReadInt32()
+			}
+			partition.AcknowledgementBatches = readAcknowledgementBatches(d, flexible)
+			d.SkipTaggedFields(flexible)
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+		d.SkipTaggedFields(flexible)
+		req.Topics = append(req.Topics, topic)
+	}
+
+	forgottenCount := d.ReadArrayLength(flexible)
+	for i := 0; i < forgottenCount && d.Err() == nil; i++ {
+		topic := ShareForgottenTopic{}
+		topic.TopicID = d.ReadUUID()
+		partitionCount := d.ReadArrayLength(flexible)
+		for j := 0; j < partitionCount && d.Err() == nil; j++ {
+			topic.Partitions = append(topic.Partitions, d.ReadInt32())
+		}
+		d.SkipTaggedFields(flexible)
+		req.ForgottenTopics = append(req.ForgottenTopics, topic)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse share fetch request: %w", err)
+	}
+
+	return req, nil
+}
+
+// readAcknowledgementBatches reads the acknowledgement batches of a ShareFetch or
+// ShareAcknowledge partition
+func readAcknowledgementBatches(d *Decoder, flexible bool) []AcknowledgementBatch {
+	var batches []AcknowledgementBatch
+	count := d.ReadArrayLength(flexible)
+	for i := 0; i < count && d.Err() == nil; i++ {
+		batch := AcknowledgementBatch{}
+		batch.FirstOffset = d.ReadInt64()
+		batch.LastOffset = d.ReadInt64()
+		typeCount := d.ReadArrayLength(flexible)
+		for j := 0; j < typeCount && d.Err() == nil; j++ {
+			batch.AcknowledgeTypes = append(batch.AcknowledgeTypes, d.ReadInt8())
+		}
+		d.SkipTaggedFields(flexible)
+		batches = append(batches, batch)
+	}
+	return batches
+}
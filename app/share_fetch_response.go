@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ShareFetchTopicResult holds the partition results for one topic of a ShareFetch response
+type ShareFetchTopicResult struct {
+	TopicID    string
+	Partitions []*ShareFetchPartitionResult
+}
+
+// ShareFetchPartitionResult holds the records acquired from one partition together with the
+// outcome of the acknowledgements sent for it
+type ShareFetchPartitionResult struct {
+	Index                int32
+	ErrorCode            int16
+	AcknowledgeErrorCode int16
+	Records              []byte
+	AcquiredRecords      []AcquiredRecords
+}
+
+// shareFetchResults collects the partition results of a ShareFetch, keeping the order in
+// which partitions were first seen
+type shareFetchResults struct {
+	order      []TopicIDPartition
+	partitions map[TopicIDPartition]*ShareFetchPartitionResult
+}
+
+// newShareFetchResults creates an empty result set
+func newShareFetchResults() *shareFetchResults {
+	return &shareFetchResults{partitions: make(map[TopicIDPartition]*ShareFetchPartitionResult)}
+}
+
+// get returns the result of a partition, adding it if needed
+func (r *shareFetchResults) get(tp TopicIDPartition) *ShareFetchPartitionResult {
+	result, ok := r.partitions[tp]
+	if !ok {
+		result = &ShareFetchPartitionResult{Index: tp.Partition}
+		r.partitions[tp] = result
+		r.order = append(r.order, tp)
+	}
+	return result
+}
+
+// topics groups the partition results by topic
+func (r *shareFetchResults) topics() []ShareFetchTopicResult {
+	var topics []ShareFetchTopicResult
+	index := make(map[string]int)
+	for _, tp := range r.order {
+		i, ok := index[tp.TopicID]
+		if !ok {
+			i = len(topics)
+			index[tp.TopicID] = i
+			topics = append(topics, ShareFetchTopicResult{TopicID: tp.TopicID})
+		}
+		topics[i].Partitions = append(topics[i].Partitions, r.partitions[tp])
+	}
+	return topics
+}
+
+// HandleShareFetch answers a ShareFetch request.
+// The acknowledgements in the request are applied first, so released records can be acquired
+// again right away. Records are then acquired from the partitions of the member's share
+// session; when none are available the fetch is parked in the fetch purgatory until records
+// are produced or released, or MaxWaitMs expires. The final session epoch only acknowledges,
+// closes the session and releases whatever the member still holds.
+func HandleShareFetch(baseReq *SwiftQueueRequest, req *ShareFetchRequest, broker *Broker, respond func([]byte)) {
+	fail := func(errorCode int16, message string) {
+		var errorMessage *string
+		if message != "" {
+			errorMessage = stringPtr(message)
+		}
+		respond(encodeShareFetchResponse(baseReq, broker, errorCode, errorMessage, nil))
+	}
+
+	if req.GroupID == nil || *req.GroupID == "" {
+		fail(ErrorCodeInvalidRequest, "GroupId must be set")
+		return
+	}
+	if req.MemberID == nil || *req.MemberID == "" {
+		fail(ErrorCodeInvalidRequest, "MemberId must be set")
+		return
+	}
+	groupID, memberID := *req.GroupID, *req.MemberID
+	if req.ShareSessionEpoch == ShareSessionEpochInitial && hasShareFetchAcknowledgements(req) {
+		fail(ErrorCodeInvalidRequest, "Acknowledgements can't be sent when opening a share session")
+		return
+	}
+	if req.ShareSessionEpoch != ShareSessionEpochFinal && !broker.groupCoordinator.IsShareGroupMember(groupID, memberID) {
+		fail(ErrorCodeUnknownMemberID, fmt.Sprintf("Member %s is not a member of share group %s", memberID, groupID))
+		return
+	}
+
+	topics, partitions := broker.TopicsAndPartitions()
+
+	added := make(PartitionSet)
+	for _, topic := range req.Topics {
+		for _, partition := range topic.Partitions {
+			added.Add(TopicIDPartition{TopicID: topic.TopicID, Partition: partition.Index})
+		}
+	}
+	forgotten := make(PartitionSet)
+	for _, topic := range req.ForgottenTopics {
+		for _, partition := range topic.Partitions {
+			forgotten.Add(TopicIDPartition{TopicID: topic.TopicID, Partition: partition})
+		}
+	}
+	session, errorCode := broker.sharePartitions.sessions.Update(groupID, memberID, req.ShareSessionEpoch, added, forgotten)
+	if errorCode != ErrorCodeNone {
+		fail(errorCode, "")
+		return
+	}
+
+	results := newShareFetchResults()
+	for _, topic := range req.Topics {
+		for _, partition := range topic.Partitions {
+			if len(partition.AcknowledgementBatches) == 0 {
+				continue
+			}
+			tp := TopicIDPartition{TopicID: topic.TopicID, Partition: partition.Index}
+			result := results.get(tp)
+			sharePartition, errorCode := sharePartitionFor(broker, groupID, topics, partitions, tp)
+			if errorCode != ErrorCodeNone {
+				result.AcknowledgeErrorCode = errorCode
+				continue
+			}
+			result.AcknowledgeErrorCode = sharePartition.Acknowledge(memberID, partition.AcknowledgementBatches)
+		}
+	}
+
+	if req.ShareSessionEpoch == ShareSessionEpochFinal {
+		broker.sharePartitions.ReleaseMember(groupID, memberID)
+		respond(encodeShareFetchResponse(baseReq, broker, ErrorCodeNone, nil, results.topics()))
+		return
+	}
+
+	acquire := func() bool {
+		return acquireShareRecords(broker, groupID, memberID, req, session, topics, partitions, results)
+	}
+	if req.MaxWaitMs <= 0 {
+		acquire()
+		respond(encodeShareFetchResponse(baseReq, broker, ErrorCodeNone, nil, results.topics()))
+		return
+	}
+
+	// Acquiring records has side effects, so attempts are serialized and stop once one has
+	// acquired records or the operation has completed
+	var mu sync.Mutex
+	acquired, completed := false, false
+
+	tryComplete := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if !acquired && !completed {
+			acquired = acquire()
+		}
+		return acquired
+	}
+
+	onComplete := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !acquired {
+			// Expired: acquire whatever is available now
+			acquire()
+		}
+		completed = true
+		respond(encodeShareFetchResponse(baseReq, broker, ErrorCodeNone, nil, results.topics()))
+	}
+
+	keys := make([]string, 0, len(session))
+	for tp := range session {
+		if topic := findTopicByUUID(topics, tp.TopicID); topic != nil {
+			keys = append(keys, TopicPartition{Topic: topic.Name, Partition: tp.Partition}.String())
+		}
+	}
+
+	operation := NewDelayedOperation(time.Duration(req.MaxWaitMs)*time.Millisecond, tryComplete, onComplete)
+	broker.fetchPurgatory.TryCompleteElseWatch(operation, keys)
+}
+
+// hasShareFetchAcknowledgements reports whether a ShareFetch request acknowledges any records
+func hasShareFetchAcknowledgements(req *ShareFetchRequest) bool {
+	for _, topic := range req.Topics {
+		for _, partition := range topic.Partitions {
+			if len(partition.AcknowledgementBatches) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// acquireShareRecords acquires records for a member from the partitions of its share session,
+// honoring the request-level MaxBytes and MaxRecords. Partitions that acquired records or
+// failed are added to results; the return value reports whether there were any.
+func acquireShareRecords(broker *Broker, groupID string, memberID string, req *ShareFetchRequest, session PartitionSet, topics []Topic, partitions []Partition, results *shareFetchResults) bool {
+	progress := false
+	bytesRead, recordsAcquired := 0, 0
+
+	topicIDs, sessionPartitions := session.ByTopic()
+	for _, topicID := range topicIDs {
+		for _, partition := range sessionPartitions[topicID] {
+			if bytesRead >= int(req.MaxBytes) || recordsAcquired >= int(req.MaxRecords) {
+				return progress
+			}
+
+			tp := TopicIDPartition{TopicID: topicID, Partition: partition}
+			sharePartition, errorCode := sharePartitionFor(broker, groupID, topics, partitions, tp)
+			if errorCode != ErrorCodeNone {
+				results.get(tp).ErrorCode = errorCode
+				progress = true
+				continue
+			}
+
+			records, acquired, err := sharePartition.Acquire(memberID, int(req.MaxRecords)-recordsAcquired, int(req.MaxBytes)-bytesRead, bytesRead == 0)
+			if err != nil {
+				broker.logger.Printf("ShareFetch: %v", err)
+				results.get(tp).ErrorCode = ErrorCodeStorageError
+				progress = true
+				continue
+			}
+			if len(acquired) == 0 {
+				continue
+			}
+
+			result := results.get(tp)
+			result.Records = records
+			result.AcquiredRecords = acquired
+			bytesRead += len(records)
+			for _, r := range acquired {
+				recordsAcquired += int(r.LastOffset - r.FirstOffset + 1)
+			}
+			progress = true
+		}
+	}
+	return progress
+}
+
+// sharePartitionFor resolves a partition named in a ShareFetch or ShareAcknowledge request to
+// the group's share partition
+func sharePartitionFor(broker *Broker, groupID string, topics []Topic, partitions []Partition, tp TopicIDPartition) (*SharePartition, int16) {
+	topic := findTopicByUUID(topics, tp.TopicID)
+	if topic == nil {
+		return nil, ErrorCodeUnknownTopicID
+	}
+	if !hasPartition(partitions, topic.UUID, tp.Partition) {
+		return nil, ErrorCodeUnknownTopicOrPart
+	}
+
+	sharePartition, err := broker.sharePartitions.Partition(groupID, topic, tp.Partition)
+	if err != nil {
+		broker.logger.Printf("Share group %s: failed to load share partition %s[%d]: %v", groupID, topic.Name, tp.Partition, err)
+		return nil, ErrorCodeStorageError
+	}
+	return sharePartition, ErrorCodeNone
+}
+
+// encodeShareFetchResponse serializes the ShareFetch response for the request's version
+func encodeShareFetchResponse(baseReq *SwiftQueueRequest, broker *Broker, errorCode int16, errorMessage *string, results []ShareFetchTopicResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	// Throttle time
+	rb.WriteInt32(0)
+	rb.WriteInt16(errorCode)
+	rb.WriteNullableString(errorMessage, flexible)
+	if version >= 1 {
+		rb.WriteInt32(int32(broker.config.GroupShareRecordLockDurationMs))
+	}
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, topic := range results {
+		rb.WriteUUID(topic.TopicID)
+		rb.WriteArrayLength(len(topic.Partitions), flexible)
+		for _, partition := range topic.Partitions {
+			rb.WriteInt32(partition.Index)
+			rb.WriteInt16(partition.ErrorCode)
+			// Error message
+			rb.WriteNullableString(nil, flexible)
+			rb.WriteInt16(partition.AcknowledgeErrorCode)
+			// Acknowledge error message
+			rb.WriteNullableString(nil, flexible)
+			writeShareCurrentLeader(rb, broker, flexible)
+			records := partition.Records
+			if records == nil {
+				records = []byte{}
+			}
+			rb.WriteBytesField(records, flexible)
+			rb.WriteArrayLength(len(partition.AcquiredRecords), flexible)
+			for _, acquired := range partition.AcquiredRecords {
+				rb.WriteInt64(acquired.FirstOffset)
+				rb.WriteInt64(acquired.LastOffset)
+				rb.WriteInt16(acquired.DeliveryCount)
+				rb.WriteTaggedFields(flexible)
+			}
+			rb.WriteTaggedFields(flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	// Node endpoints, only sent when the leader changed
+	rb.WriteArrayLength(0, flexible)
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
+
+// writeShareCurrentLeader writes the CurrentLeader struct of ShareFetch and ShareAcknowledge
+// partitions: this broker, which leads every partition
+func writeShareCurrentLeader(rb *ResponseBuilder, broker *Broker, flexible bool) {
+	rb.WriteInt32(int32(broker.config.NodeID))
+	// Leader epoch
+	rb.WriteInt32(0)
+	rb.WriteTaggedFields(flexible)
+}
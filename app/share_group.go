@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// ShareProtocolType is the protocol type ListGroups reports for share groups
+const ShareProtocolType = "share"
+
+// ShareGroupMember is a member of a share group
+type ShareGroupMember struct {
+	ID                   string
+	RackID               *string
+	ClientID             string
+	ClientHost           string
+	SubscribedTopicNames []string
+
+	epoch int32
+	// assignment holds the partitions the member fetches from
+	assignment PartitionSet
+	// sendAssignment is set until the member has been sent its latest assignment
+	sendAssignment bool
+	sessionTimer   *time.Timer
+}
+
+// ShareGroupHeartbeat runs the share group protocol (KIP-932) for one member.
+//
+// Members of a share group do not own partitions: records are handed out one acquisition at a
+// time by the share partitions, so every member is assigned every partition of the topics it
+// subscribes to and no partition ever has to be revoked. The member epoch follows the group
+// epoch, which moves when members join or leave or when the subscribed topics change.
+// Share group heartbeats are answered with the same fields as consumer group heartbeats.
+func (c *GroupCoordinator) ShareGroupHeartbeat(version int16, clientID string, clientHost string, req *ShareGroupHeartbeatRequest, topics []Topic, partitions []Partition) ConsumerGroupHeartbeatResult {
+	if message := validateShareGroupHeartbeat(version, req); message != "" {
+		return consumerHeartbeatError(ErrorCodeInvalidRequest, message)
+	}
+
+	g := c.group(req.GroupID, req.MemberEpoch == JoinGroupMemberEpoch)
+	if g == nil {
+		return consumerHeartbeatError(ErrorCodeGroupIDNotFound, fmt.Sprintf("Group %s not found", req.GroupID))
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == GroupDead {
+		return consumerHeartbeatError(ErrorCodeCoordinatorNotAvailable, "")
+	}
+	if g.groupType != GroupTypeShare {
+		// Only a group that holds nothing may become a share group
+		if g.state != GroupEmpty || len(g.pendingMembers) > 0 || len(g.offsets) > 0 {
+			return consumerHeartbeatError(ErrorCodeGroupIDNotFound, fmt.Sprintf("Group %s is not a share group", g.ID))
+		}
+		g.convertToShareGroup()
+	}
+
+	if req.MemberEpoch == LeaveGroupMemberEpoch {
+		member := g.shareMembers[req.MemberID]
+		if member == nil {
+			return consumerHeartbeatError(ErrorCodeUnknownMemberID, fmt.Sprintf("Member %s is not a member of group %s", req.MemberID, g.ID))
+		}
+		c.removeShareMember(g, member, fmt.Sprintf("member %s left the group", member.ID))
+		return ConsumerGroupHeartbeatResult{
+			ErrorCode:           ErrorCodeNone,
+			MemberID:            stringPtr(member.ID),
+			MemberEpoch:         LeaveGroupMemberEpoch,
+			HeartbeatIntervalMs: int32(c.config.GroupShareHeartbeatIntervalMs),
+		}
+	}
+
+	var member *ShareGroupMember
+	joined := false
+	if req.MemberEpoch == JoinGroupMemberEpoch {
+		var errorCode int16
+		var message string
+		if member, joined, errorCode, message = c.joinShareGroup(g, req); errorCode != ErrorCodeNone {
+			return consumerHeartbeatError(errorCode, message)
+		}
+	} else {
+		member = g.shareMembers[req.MemberID]
+		if member == nil {
+			return consumerHeartbeatError(ErrorCodeUnknownMemberID, fmt.Sprintf("Member %s is not a member of group %s", req.MemberID, g.ID))
+		}
+		if req.MemberEpoch != member.epoch {
+			return consumerHeartbeatError(ErrorCodeFencedMemberEpoch,
+				fmt.Sprintf("Member epoch %d does not match the expected epoch %d", req.MemberEpoch, member.epoch))
+		}
+	}
+
+	if changed := member.update(clientID, clientHost, req); joined {
+		c.bumpGroupEpoch(g, fmt.Sprintf("member %s joined", member.ID))
+	} else if changed {
+		c.bumpGroupEpoch(g, fmt.Sprintf("member %s updated its subscription", member.ID))
+	}
+	c.refreshSubscriptionMetadata(g, topics, partitions)
+	g.assignmentEpoch = g.groupEpoch
+
+	if assignment := g.shareAssignment(member); !assignment.Equal(member.assignment) {
+		member.assignment = assignment
+		member.sendAssignment = true
+	}
+	member.epoch = g.groupEpoch
+	c.scheduleShareSessionTimeout(g, member)
+
+	result := ConsumerGroupHeartbeatResult{
+		ErrorCode:           ErrorCodeNone,
+		MemberID:            stringPtr(member.ID),
+		MemberEpoch:         member.epoch,
+		HeartbeatIntervalMs: int32(c.config.GroupShareHeartbeatIntervalMs),
+	}
+	if member.sendAssignment {
+		result.Assignment = maps.Clone(member.assignment)
+		member.sendAssignment = false
+	}
+	return result
+}
+
+// validateShareGroupHeartbeat checks the fields required for the member epoch of a
+// ShareGroupHeartbeat request, returning a message describing the first problem found
+func validateShareGroupHeartbeat(version int16, req *ShareGroupHeartbeatRequest) string {
+	switch {
+	case req.GroupID == "":
+		return "GroupId can't be empty"
+	case req.RackID != nil && *req.RackID == "":
+		return "RackId can't be empty"
+	case req.MemberEpoch < LeaveGroupMemberEpoch:
+		return fmt.Sprintf("MemberEpoch %d is invalid", req.MemberEpoch)
+	case req.MemberID == "" && (version >= 1 || req.MemberEpoch != JoinGroupMemberEpoch):
+		return "MemberId can't be empty"
+	case req.MemberEpoch == JoinGroupMemberEpoch && len(req.SubscribedTopicNames) == 0:
+		return "SubscribedTopicNames must be set in first request"
+	}
+	return ""
+}
+
+// joinShareGroup adds a member joining with epoch 0, or resends the assignment of a member
+// rejoining with its existing ID. joined reports whether a member was added to the group.
+func (c *GroupCoordinator) joinShareGroup(g *ConsumerGroup, req *ShareGroupHeartbeatRequest) (member *ShareGroupMember, joined bool, errorCode int16, message string) {
+	memberID := req.MemberID
+	if memberID == "" {
+		memberID = newMemberID(g.ID)
+	}
+
+	if member = g.shareMembers[memberID]; member != nil {
+		member.sendAssignment = true
+		return member, false, ErrorCodeNone, ""
+	}
+
+	if len(g.shareMembers) >= c.config.GroupMaxSize {
+		return nil, false, ErrorCodeGroupMaxSizeReached, fmt.Sprintf("Group %s has reached its maximum size", g.ID)
+	}
+
+	member = &ShareGroupMember{
+		ID:             memberID,
+		assignment:     make(PartitionSet),
+		sendAssignment: true,
+	}
+	g.shareMembers[memberID] = member
+	g.state = GroupStable
+	return member, true, ErrorCodeNone, ""
+}
+
+// update applies the fields of a heartbeat to the member and reports whether its subscription
+// changed. Null fields leave the member unchanged.
+func (m *ShareGroupMember) update(clientID string, clientHost string, req *ShareGroupHeartbeatRequest) bool {
+	m.ClientID = clientID
+	m.ClientHost = clientHost
+	if req.RackID != nil {
+		m.RackID = req.RackID
+	}
+
+	if req.SubscribedTopicNames == nil {
+		return false
+	}
+	names := slices.Compact(slices.Sorted(slices.Values(req.SubscribedTopicNames)))
+	if slices.Equal(names, m.SubscribedTopicNames) {
+		return false
+	}
+	m.SubscribedTopicNames = names
+	return true
+}
+
+// shareAssignment returns every partition of the subscribed topics the member subscribes to
+func (g *ConsumerGroup) shareAssignment(member *ShareGroupMember) PartitionSet {
+	assignment := make(PartitionSet)
+	for id, topic := range g.subscriptionMetadata {
+		if !slices.Contains(member.SubscribedTopicNames, topic.Name) {
+			continue
+		}
+		for partition := range topic.Partitions {
+			assignment.Add(TopicIDPartition{TopicID: id, Partition: partition})
+		}
+	}
+	return assignment
+}
+
+// scheduleShareSessionTimeout (re)starts a member's session timer; members that miss it
+// are removed from the group
+func (c *GroupCoordinator) scheduleShareSessionTimeout(g *ConsumerGroup, member *ShareGroupMember) {
+	if member.sessionTimer != nil {
+		member.sessionTimer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Duration(c.config.GroupShareSessionTimeoutMs)*time.Millisecond, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if member.sessionTimer != timer || g.shareMembers[member.ID] != member {
+			return
+		}
+		c.removeShareMember(g, member, fmt.Sprintf("session of member %s timed out", member.ID))
+	})
+	member.sessionTimer = timer
+}
+
+// removeShareMember removes a member from a share group, closing its share session and
+// releasing the records it acquired
+func (c *GroupCoordinator) removeShareMember(g *ConsumerGroup, member *ShareGroupMember, reason string) {
+	if member.sessionTimer != nil {
+		member.sessionTimer.Stop()
+	}
+	delete(g.shareMembers, member.ID)
+	if len(g.shareMembers) == 0 {
+		g.state = GroupEmpty
+		g.emptySince = time.Now()
+	}
+	c.bumpGroupEpoch(g, reason)
+	c.sharePartitions.RemoveMember(g.ID, member.ID)
+}
+
+// IsShareGroupMember reports whether a member belongs to a share group
+func (c *GroupCoordinator) IsShareGroupMember(groupID string, memberID string) bool {
+	g := c.group(groupID, false)
+	if g == nil {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.groupType == GroupTypeShare && g.shareMembers[memberID] != nil
+}
+
+// convertToShareGroup turns an empty group without committed offsets into a share group
+func (g *ConsumerGroup) convertToShareGroup() {
+	g.groupType = GroupTypeShare
+	g.protocolType = ShareProtocolType
+	g.protocolName = ""
+	g.assignorName = ""
+	g.consumerMembers = nil
+	g.targetAssignment = nil
+	g.shareMembers = make(map[string]*ShareGroupMember)
+	g.subscriptionMetadata = make(map[string]AssignorTopic)
+	g.staticMembers = make(map[string]string)
+}
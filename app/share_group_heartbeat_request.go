@@ -0,0 +1,38 @@
+package main
+
+import "fmt"
+
+// ShareGroupHeartbeatRequest represents a parsed ShareGroupHeartbeat request.
+// Nullable fields are null when unchanged since the member's previous heartbeat.
+type ShareGroupHeartbeatRequest struct {
+	GroupID              string
+	MemberID             string
+	MemberEpoch          int32
+	RackID               *string
+	SubscribedTopicNames []string
+}
+
+// ParseShareGroupHeartbeatRequest parses the body of a ShareGroupHeartbeat request (v0-v1)
+func ParseShareGroupHeartbeatRequest(baseReq *SwiftQueueRequest) (*ShareGroupHeartbeatRequest, error) {
+	version := baseReq.APIVersion
+	if version < ShareGroupHeartbeatMinVersion || version > ShareGroupHeartbeatMaxVersion {
+		return nil, fmt.Errorf("unsupported share group heartbeat version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &ShareGroupHeartbeatRequest{}
+	req.GroupID = d.ReadString(flexible)
+	req.MemberID = d.ReadString(flexible)
+	req.MemberEpoch = d.ReadInt32()
+	req.RackID = d.ReadNullableString(flexible)
+	req.SubscribedTopicNames = d.ReadStringArray(flexible)
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse share group heartbeat request: %w", err)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,10 @@
+package main
+
+// BuildShareGroupHeartbeatResponse runs the member's heartbeat through the group coordinator
+// and builds the response, which has the same layout as a ConsumerGroupHeartbeat response
+func BuildShareGroupHeartbeatResponse(baseReq *SwiftQueueRequest, req *ShareGroupHeartbeatRequest, broker *Broker, clientHost string) []byte {
+	topics, partitions := broker.TopicsAndPartitions()
+
+	result := broker.groupCoordinator.ShareGroupHeartbeat(baseReq.APIVersion, baseReq.ClientID, clientHost, req, topics, partitions)
+	return encodeConsumerGroupHeartbeatResponse(baseReq, result)
+}
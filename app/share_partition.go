@@ -0,0 +1,406 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RecordState is the delivery state of an in-flight record of a share partition
+type RecordState int8
+
+const (
+	// RecordAvailable may be acquired by any member of the share group
+	RecordAvailable RecordState = 0
+	// RecordAcquired is locked by one member until it acknowledges it or its lock expires
+	RecordAcquired RecordState = 1
+	// RecordAcknowledged was processed successfully
+	RecordAcknowledged RecordState = 2
+	// RecordArchived was rejected or reached the delivery count limit and is never delivered again
+	RecordArchived RecordState = 4
+)
+
+// Acknowledgement types of ShareFetch and ShareAcknowledge requests
+const (
+	// AcknowledgeGap marks an offset without a record, such as one removed by compaction
+	AcknowledgeGap = 0
+	// AcknowledgeAccept marks a record as processed
+	AcknowledgeAccept = 1
+	// AcknowledgeRelease makes a record available for another delivery attempt
+	AcknowledgeRelease = 2
+	// AcknowledgeReject marks a record as unprocessable
+	AcknowledgeReject = 3
+)
+
+// AcknowledgementBatch acknowledges the offsets from FirstOffset to LastOffset inclusive, with
+// either a single type for the whole range or one type per offset
+type AcknowledgementBatch struct {
+	FirstOffset      int64
+	LastOffset       int64
+	AcknowledgeTypes []int8
+}
+
+// AcquiredRecords is a range of records acquired by a member, all delivered the same number of times
+type AcquiredRecords struct {
+	FirstOffset   int64
+	LastOffset    int64
+	DeliveryCount int16
+}
+
+// inFlightRecord is the delivery state of one record between the start and end offsets
+type inFlightRecord struct {
+	state         RecordState
+	deliveryCount int16
+	// memberID and lock are set while the record is acquired
+	memberID string
+	lock     *acquisitionLock
+}
+
+// acquisitionLock holds the records acquired by one fetch; those still acquired when it
+// expires become available again
+type acquisitionLock struct {
+	offsets []int64
+	timer   *time.Timer
+}
+
+// SharePartition tracks which records of a partition the members of a share group may
+// consume, letting many consumers share one partition.
+//
+// Records before the start offset have all been acknowledged or archived. Records from the
+// start offset up to the end offset are in flight: each is available, acquired by a member,
+// acknowledged or archived. Records from the end offset on have never been delivered. A member
+// acquires available records for the lock duration, during which it must acknowledge them;
+// a released or expired record becomes available for redelivery until it reaches the delivery
+// count limit, after which it is archived. The start offset advances past the completed records
+// at its head, and the number of in-flight records is bounded by the partition's record locks.
+type SharePartition struct {
+	GroupID        string
+	TopicID        string
+	TopicPartition TopicPartition
+
+	manager *SharePartitionManager
+
+	mu          sync.Mutex
+	startOffset int64
+	endOffset   int64
+	// records holds the in-flight records; offsets missing from a batch have no entry
+	records map[int64]*inFlightRecord
+}
+
+// key identifies the share partition in the share group state log
+func (p *SharePartition) key() sharePartitionKey {
+	return sharePartitionKey{
+		GroupID:          p.GroupID,
+		TopicIDPartition: TopicIDPartition{TopicID: p.TopicID, Partition: p.TopicPartition.Partition},
+	}
+}
+
+// restore loads the partition's state from a snapshot
+func (p *SharePartition) restore(snapshot ShareSnapshot) {
+	p.startOffset = snapshot.StartOffset
+	p.endOffset = snapshot.StartOffset
+	for _, batch := range snapshot.Batches {
+		for offset := batch.FirstOffset; offset <= batch.LastOffset; offset++ {
+			p.records[offset] = &inFlightRecord{state: batch.DeliveryState, deliveryCount: batch.DeliveryCount}
+		}
+		p.endOffset = max(p.endOffset, batch.LastOffset+1)
+	}
+}
+
+// Acquire locks up to maxRecords available records for a member and returns the batches
+// holding them, reading at most maxBytes unless minOneBatch is set. Records are acquired in
+// offset order, so records available for redelivery come before records never delivered.
+func (p *SharePartition) Acquire(memberID string, maxRecords int, maxBytes int, minOneBatch bool) ([]byte, []AcquiredRecords, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	partitionLog, err := p.manager.logManager.GetOrCreateLog(p.TopicPartition)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open log for %s: %w", p.TopicPartition, err)
+	}
+	p.skipTo(partitionLog.LogStartOffset())
+
+	fetchOffset := p.firstAvailable()
+	maxLocks := int64(p.manager.config.GroupSharePartitionMaxRecordLocks)
+	if fetchOffset >= partitionLog.LogEndOffset() || fetchOffset == p.endOffset && p.endOffset-p.startOffset >= maxLocks {
+		return nil, nil, nil
+	}
+
+	data, err := partitionLog.Read(fetchOffset, maxBytes, minOneBatch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s at offset %d: %w", p.TopicPartition, fetchOffset, err)
+	}
+	batches, err := ParseRecordBatches(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s at offset %d: %w", p.TopicPartition, fetchOffset, err)
+	}
+
+	lock := &acquisitionLock{}
+	var records []byte
+batches:
+	for _, batch := range batches {
+		acquired := false
+		for offset := max(batch.BaseOffset, p.startOffset); offset <= batch.LastOffset(); offset++ {
+			if len(lock.offsets) >= maxRecords {
+				break batches
+			}
+			record := p.records[offset]
+			if offset >= p.endOffset {
+				if offset-p.startOffset >= maxLocks {
+					break batches
+				}
+				record = &inFlightRecord{state: RecordAvailable}
+				if batch.IsControl() {
+					// Transaction markers are never delivered to consumers
+					record.state = RecordArchived
+				}
+				p.records[offset] = record
+				p.endOffset = offset + 1
+			}
+			if record == nil || record.state != RecordAvailable {
+				continue
+			}
+
+			record.state = RecordAcquired
+			record.deliveryCount++
+			record.memberID = memberID
+			record.lock = lock
+			lock.offsets = append(lock.offsets, offset)
+			acquired = true
+		}
+		if acquired {
+			records = append(records, batch.Raw...)
+		}
+	}
+	p.advanceStart()
+
+	if len(lock.offsets) == 0 {
+		return nil, nil, nil
+	}
+	lock.timer = time.AfterFunc(time.Duration(p.manager.config.GroupShareRecordLockDurationMs)*time.Millisecond, func() {
+		p.expire(lock)
+	})
+
+	return records, p.acquiredRanges(lock.offsets), nil
+}
+
+// acquiredRanges groups acquired offsets into contiguous ranges with the same delivery count
+func (p *SharePartition) acquiredRanges(offsets []int64) []AcquiredRecords {
+	var ranges []AcquiredRecords
+	for _, offset := range offsets {
+		count := p.records[offset].deliveryCount
+		if n := len(ranges); n > 0 && ranges[n-1].LastOffset == offset-1 && ranges[n-1].DeliveryCount == count {
+			ranges[n-1].LastOffset = offset
+			continue
+		}
+		ranges = append(ranges, AcquiredRecords{FirstOffset: offset, LastOffset: offset, DeliveryCount: count})
+	}
+	return ranges
+}
+
+// Acknowledge applies a member's acknowledgements. Every acknowledged offset must be acquired
+// by the member; otherwise nothing is applied and INVALID_RECORD_STATE is returned.
+func (p *SharePartition) Acknowledge(memberID string, batches []AcknowledgementBatch) int16 {
+	errorCode, released := p.acknowledge(memberID, batches)
+	if released {
+		p.manager.notify(p.TopicPartition)
+	}
+	return errorCode
+}
+
+// acknowledge applies acknowledgements and reports whether records became available again
+func (p *SharePartition) acknowledge(memberID string, batches []AcknowledgementBatch) (int16, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, batch := range batches {
+		count := batch.LastOffset - batch.FirstOffset + 1
+		if count < 1 || len(batch.AcknowledgeTypes) != 1 && int64(len(batch.AcknowledgeTypes)) != count {
+			return ErrorCodeInvalidRequest, false
+		}
+		for _, ackType := range batch.AcknowledgeTypes {
+			if ackType < AcknowledgeGap || ackType > AcknowledgeReject {
+				return ErrorCodeInvalidRequest, false
+			}
+		}
+		for offset := batch.FirstOffset; offset <= batch.LastOffset; offset++ {
+			record := p.records[offset]
+			if record == nil || record.state != RecordAcquired || record.memberID != memberID {
+				return ErrorCodeInvalidRecordState, false
+			}
+		}
+	}
+
+	released := false
+	for _, batch := range batches {
+		for offset := batch.FirstOffset; offset <= batch.LastOffset; offset++ {
+			ackType := batch.AcknowledgeTypes[0]
+			if len(batch.AcknowledgeTypes) > 1 {
+				ackType = batch.AcknowledgeTypes[offset-batch.FirstOffset]
+			}
+
+			record := p.records[offset]
+			switch ackType {
+			case AcknowledgeAccept:
+				record.complete(RecordAcknowledged)
+			case AcknowledgeRelease:
+				released = p.release(record) || released
+			default:
+				record.complete(RecordArchived)
+			}
+		}
+	}
+
+	p.advanceStart()
+	p.persist()
+	return ErrorCodeNone, released
+}
+
+// ReleaseMember makes the records acquired by a member available again, as when it closes
+// its share session or leaves the group
+func (p *SharePartition) ReleaseMember(memberID string) {
+	p.mu.Lock()
+	released := 0
+	for _, record := range p.records {
+		if record.state == RecordAcquired && record.memberID == memberID {
+			p.release(record)
+			released++
+		}
+	}
+	if released > 0 {
+		p.advanceStart()
+		p.persist()
+	}
+	p.mu.Unlock()
+
+	if released > 0 {
+		p.manager.logger.Printf("Share group %s: released %d records of %s acquired by member %s", p.GroupID, released, p.TopicPartition, memberID)
+		p.manager.notify(p.TopicPartition)
+	}
+}
+
+// expire releases the records of an acquisition lock that are still acquired
+func (p *SharePartition) expire(lock *acquisitionLock) {
+	p.mu.Lock()
+	expired := 0
+	for _, offset := range lock.offsets {
+		if record := p.records[offset]; record != nil && record.lock == lock && record.state == RecordAcquired {
+			p.release(record)
+			expired++
+		}
+	}
+	if expired > 0 {
+		p.advanceStart()
+		p.persist()
+	}
+	p.mu.Unlock()
+
+	if expired > 0 {
+		p.manager.logger.Printf("Share group %s: acquisition lock of %d records of %s expired", p.GroupID, expired, p.TopicPartition)
+		p.manager.notify(p.TopicPartition)
+	}
+}
+
+// stopLocks cancels the acquisition lock timers of the acquired records
+func (p *SharePartition) stopLocks() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, record := range p.records {
+		if record.lock != nil {
+			record.lock.timer.Stop()
+		}
+	}
+}
+
+// release returns an acquired record for redelivery, or archives it once it has been delivered
+// as often as the delivery count limit allows. It reports whether the record became available.
+func (p *SharePartition) release(record *inFlightRecord) bool {
+	if int(record.deliveryCount) >= p.manager.config.GroupShareDeliveryCountLimit {
+		record.complete(RecordArchived)
+		return false
+	}
+	record.complete(RecordAvailable)
+	return true
+}
+
+// complete moves an acquired record to a new state, dropping its lock
+func (r *inFlightRecord) complete(state RecordState) {
+	r.state = state
+	r.memberID = ""
+	r.lock = nil
+}
+
+// firstAvailable returns the first in-flight offset available for delivery, or the end offset
+func (p *SharePartition) firstAvailable() int64 {
+	for offset := p.startOffset; offset < p.endOffset; offset++ {
+		if record := p.records[offset]; record != nil && record.state == RecordAvailable {
+			return offset
+		}
+	}
+	return p.endOffset
+}
+
+// advanceStart moves the start offset past the acknowledged and archived records at its head
+func (p *SharePartition) advanceStart() {
+	for p.startOffset < p.endOffset {
+		record := p.records[p.startOffset]
+		if record != nil && (record.state == RecordAvailable || record.state == RecordAcquired) {
+			return
+		}
+		delete(p.records, p.startOffset)
+		p.startOffset++
+	}
+}
+
+// skipTo moves the start offset to the log start offset when older records have been deleted
+func (p *SharePartition) skipTo(logStartOffset int64) {
+	if p.startOffset >= logStartOffset {
+		return
+	}
+	for offset := p.startOffset; offset < min(logStartOffset, p.endOffset); offset++ {
+		delete(p.records, offset)
+	}
+	p.startOffset = logStartOffset
+	p.endOffset = max(p.endOffset, logStartOffset)
+	p.advanceStart()
+}
+
+// snapshot captures the partition's state. Acquired records are persisted as available, as
+// their locks do not survive a restart, but keep the delivery they count.
+func (p *SharePartition) snapshot() ShareSnapshot {
+	snapshot := ShareSnapshot{StartOffset: p.startOffset}
+	for offset := p.startOffset; offset < p.endOffset; offset++ {
+		record := p.records[offset]
+		if record == nil {
+			continue
+		}
+		state := record.state
+		if state == RecordAcquired {
+			state = RecordAvailable
+		}
+
+		n := len(snapshot.Batches)
+		if n > 0 {
+			last := &snapshot.Batches[n-1]
+			if last.LastOffset == offset-1 && last.DeliveryState == state && last.DeliveryCount == record.deliveryCount {
+				last.LastOffset = offset
+				continue
+			}
+		}
+		snapshot.Batches = append(snapshot.Batches, ShareStateBatch{
+			FirstOffset:   offset,
+			LastOffset:    offset,
+			DeliveryState: state,
+			DeliveryCount: record.deliveryCount,
+		})
+	}
+	return snapshot
+}
+
+// persist writes the partition's snapshot to the share group state log
+func (p *SharePartition) persist() {
+	if err := p.manager.store.Write(p.key(), p.snapshot()); err != nil {
+		p.manager.logger.Printf("Share group %s: failed to persist state of %s: %v", p.GroupID, p.TopicPartition, err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Values of share.auto.offset.reset
+const (
+	// ShareAutoOffsetResetEarliest starts new share partitions at the log start offset
+	ShareAutoOffsetResetEarliest = "earliest"
+	// ShareAutoOffsetResetLatest starts new share partitions at the log end offset
+	ShareAutoOffsetResetLatest = "latest"
+)
+
+// SharePartitionManager holds the share partitions of every share group and the share
+// sessions of their members. Share partitions are created when a group first fetches from
+// a partition, from the state persisted in the share group state log if there is any.
+type SharePartitionManager struct {
+	config     *Config
+	logger     *log.Logger
+	logManager *LogManager
+	store      *ShareStateStore
+	sessions   *ShareSessionCache
+	// notify wakes share fetches waiting for records of a partition; it is set by the broker
+	notify func(tp TopicPartition)
+
+	mu         sync.Mutex
+	partitions map[sharePartitionKey]*SharePartition
+}
+
+// NewSharePartitionManager opens the share group state log
+func NewSharePartitionManager(config *Config, logger *log.Logger, logManager *LogManager) (*SharePartitionManager, error) {
+	store, err := OpenShareStateStore(logManager)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SharePartitionManager{
+		config:     config,
+		logger:     logger,
+		logManager: logManager,
+		store:      store,
+		sessions:   NewShareSessionCache(),
+		notify:     func(TopicPartition) {},
+		partitions: make(map[sharePartitionKey]*SharePartition),
+	}, nil
+}
+
+// Partition returns a group's share partition, loading or initializing its state on first use
+func (m *SharePartitionManager) Partition(groupID string, topic *Topic, partition int32) (*SharePartition, error) {
+	key := sharePartitionKey{
+		GroupID:          groupID,
+		TopicIDPartition: TopicIDPartition{TopicID: topic.UUID, Partition: partition},
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if p, ok := m.partitions[key]; ok {
+		return p, nil
+	}
+
+	p := &SharePartition{
+		GroupID:        groupID,
+		TopicID:        topic.UUID,
+		TopicPartition: TopicPartition{Topic: topic.Name, Partition: partition},
+		manager:        m,
+		records:        make(map[int64]*inFlightRecord),
+	}
+
+	snapshot, found, err := m.store.Snapshot(key)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		p.restore(snapshot)
+	} else {
+		partitionLog, err := m.logManager.GetOrCreateLog(p.TopicPartition)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log for %s: %w", p.TopicPartition, err)
+		}
+		p.startOffset = partitionLog.LogEndOffset()
+		if m.config.ShareAutoOffsetReset == ShareAutoOffsetResetEarliest {
+			p.startOffset = partitionLog.LogStartOffset()
+		}
+		p.endOffset = p.startOffset
+		// Persist the start offset right away so that it does not move with the log end
+		p.persist()
+	}
+
+	m.logger.Printf("Share group %s: loaded share partition %s at start offset %d with %d in-flight records",
+		groupID, p.TopicPartition, p.startOffset, len(p.records))
+	m.partitions[key] = p
+	return p, nil
+}
+
+// RemoveMember closes a member's share session and releases the records it acquired
+func (m *SharePartitionManager) RemoveMember(groupID string, memberID string) {
+	m.sessions.Remove(groupID, memberID)
+	m.ReleaseMember(groupID, memberID)
+}
+
+// ReleaseMember releases the records a member acquired in any partition of its group
+func (m *SharePartitionManager) ReleaseMember(groupID string, memberID string) {
+	for _, p := range m.groupPartitions(groupID) {
+		p.ReleaseMember(memberID)
+	}
+}
+
+// DeleteGroup removes the share partitions of a group together with their persisted state
+func (m *SharePartitionManager) DeleteGroup(groupID string) error {
+	for _, p := range m.groupPartitions(groupID) {
+		p.stopLocks()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.store.Delete(m.store.Keys(groupID)); err != nil {
+		return err
+	}
+	for key := range m.partitions {
+		if key.GroupID == groupID {
+			delete(m.partitions, key)
+		}
+	}
+	return nil
+}
+
+// groupPartitions returns the share partitions of a group
+func (m *SharePartitionManager) groupPartitions(groupID string) []*SharePartition {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var partitions []*SharePartition
+	for key, p := range m.partitions {
+		if key.GroupID == groupID {
+			partitions = append(partitions, p)
+		}
+	}
+	return partitions
+}
+
+// Shutdown stops the acquisition lock timers
+func (m *SharePartitionManager) Shutdown() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.partitions {
+		p.stopLocks()
+	}
+}
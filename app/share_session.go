@@ -0,0 +1,82 @@
+package main
+
+import (
+	"maps"
+	"sync"
+)
+
+// Special share session epochs
+const (
+	// ShareSessionEpochInitial opens a new share session
+	ShareSessionEpochInitial = 0
+	// ShareSessionEpochFinal closes the share session
+	ShareSessionEpochFinal = -1
+)
+
+// shareSessionKey identifies the share session of a member; a member has at most one
+type shareSessionKey struct {
+	GroupID  string
+	MemberID string
+}
+
+// ShareSession remembers the partitions a member fetches from, so later requests only need
+// to list what changed
+type ShareSession struct {
+	epoch      int32
+	partitions PartitionSet
+}
+
+// ShareSessionCache holds the share sessions of the members of every share group
+type ShareSessionCache struct {
+	mu       sync.Mutex
+	sessions map[shareSessionKey]*ShareSession
+}
+
+// NewShareSessionCache creates an empty cache
+func NewShareSessionCache() *ShareSessionCache {
+	return &ShareSessionCache{
+		sessions: make(map[shareSessionKey]*ShareSession),
+	}
+}
+
+// Update applies the session fields of a ShareFetch or ShareAcknowledge request and returns
+// the partitions of the session.
+//
+// The initial epoch replaces any existing session with one holding added. Other epochs must
+// match the session's epoch, which then moves on; the final epoch closes the session.
+func (c *ShareSessionCache) Update(groupID string, memberID string, epoch int32, added PartitionSet, forgotten PartitionSet) (PartitionSet, int16) {
+	key := shareSessionKey{GroupID: groupID, MemberID: memberID}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if epoch == ShareSessionEpochInitial {
+		session := &ShareSession{epoch: nextSessionEpoch(ShareSessionEpochInitial), partitions: maps.Clone(added)}
+		c.sessions[key] = session
+		return maps.Clone(session.partitions), ErrorCodeNone
+	}
+
+	session, ok := c.sessions[key]
+	if !ok {
+		return nil, ErrorCodeShareSessionNotFound
+	}
+	if epoch == ShareSessionEpochFinal {
+		delete(c.sessions, key)
+		return session.partitions, ErrorCodeNone
+	}
+	if epoch != session.epoch {
+		return nil, ErrorCodeInvalidShareSessionEpoch
+	}
+
+	session.partitions = session.partitions.Union(added).Minus(forgotten)
+	session.epoch = nextSessionEpoch(session.epoch)
+	return maps.Clone(session.partitions), ErrorCodeNone
+}
+
+// Remove closes a member's share session, if any
+func (c *ShareSessionCache) Remove(groupID string, memberID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.sessions, shareSessionKey{GroupID: groupID, MemberID: memberID})
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"cmp"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ShareGroupStateTopic is the internal topic holding the state of share partitions
+const ShareGroupStateTopic = "__share_group_state"
+
+// Record versions of the share group state log
+const (
+	shareSnapshotKeyVersion   = 0
+	shareSnapshotValueVersion = 0
+)
+
+// shareStatePartition is the partition of the share group state topic used by this broker
+var shareStatePartition = TopicPartition{Topic: ShareGroupStateTopic, Partition: 0}
+
+// shareStateMinCompactRecords is how many records the share group state log holds before
+// it is considered for compaction; snapshots are written often, so small logs are left alone
+const shareStateMinCompactRecords = 1000
+
+// sharePartitionKey identifies the share partition of a group
+type sharePartitionKey struct {
+	GroupID string
+	TopicIDPartition
+}
+
+// ShareStateBatch is a run of in-flight records with the same state and delivery count
+type ShareStateBatch struct {
+	FirstOffset   int64
+	LastOffset    int64
+	DeliveryState RecordState
+	DeliveryCount int16
+}
+
+// ShareSnapshot is the persisted state of a share partition: every record before StartOffset
+// has been acknowledged or archived, and Batches describe the in-flight records after it
+type ShareSnapshot struct {
+	StartOffset int64
+	Batches     []ShareStateBatch
+}
+
+// ShareStateStore persists share partition snapshots in the internal, compacted
+// __share_group_state log.
+//
+// Every state change appends a snapshot keyed by group, topic ID and partition; deleting a
+// share partition appends a tombstone. As with the offsets log, only the latest record of
+// each key matters, and the log is rewritten once superseded records make up half of it.
+type ShareStateStore struct {
+	mu         sync.Mutex
+	logManager *LogManager
+	log        *PartitionLog
+	// latest holds the encoded value of the newest snapshot for each live key
+	latest map[sharePartitionKey][]byte
+	// records counts the records in the log, including superseded ones and tombstones
+	records int
+}
+
+// OpenShareStateStore opens the share group state log and loads the latest snapshots
+func OpenShareStateStore(logManager *LogManager) (*ShareStateStore, error) {
+	partitionLog, err := logManager.GetOrCreateLog(shareStatePartition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open share group state log: %w", err)
+	}
+
+	store := &ShareStateStore{
+		logManager: logManager,
+		log:        partitionLog,
+		latest:     make(map[sharePartitionKey][]byte),
+	}
+	err = replayRecords(partitionLog, func(record Record) {
+		store.records++
+		key, ok := decodeShareSnapshotKey(record.Key)
+		if !ok {
+			return
+		}
+		if record.Value == nil {
+			delete(store.latest, key)
+		} else {
+			store.latest[key] = record.Value
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.maybeCompact(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Snapshot returns the latest snapshot of a share partition, if any
+func (s *ShareStateStore) Snapshot(key sharePartitionKey) (ShareSnapshot, bool, error) {
+	s.mu.Lock()
+	value, ok := s.latest[key]
+	s.mu.Unlock()
+	if !ok {
+		return ShareSnapshot{}, false, nil
+	}
+
+	snapshot, err := decodeShareSnapshotValue(value)
+	if err != nil {
+		return ShareSnapshot{}, false, fmt.Errorf("failed to decode share state of %s[%d] for group %s: %w", key.TopicID, key.Partition, key.GroupID, err)
+	}
+	return snapshot, true, nil
+}
+
+// Keys returns the keys of the share partitions holding state for a group
+func (s *ShareStateStore) Keys(groupID string) []sharePartitionKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []sharePartitionKey
+	for key := range s.latest {
+		if key.GroupID == groupID {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Write persists the snapshot of a share partition
+func (s *ShareStateStore) Write(key sharePartitionKey, snapshot ShareSnapshot) error {
+	value := encodeShareSnapshotValue(snapshot)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append([]Record{{Key: encodeShareSnapshotKey(key), Value: value}}); err != nil {
+		return err
+	}
+	s.latest[key] = value
+	return s.maybeCompact()
+}
+
+// Delete writes tombstones removing the state of share partitions
+func (s *ShareStateStore) Delete(keys []sharePartitionKey) error {
+	records := make([]Record, 0, len(keys))
+	for _, key := range keys {
+		records = append(records, Record{Key: encodeShareSnapshotKey(key)})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(records); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		delete(s.latest, key)
+	}
+	return nil
+}
+
+// append writes records to the share group state log as a single batch
+func (s *ShareStateStore) append(records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	batch := BuildRecordBatch(0, time.Now().UnixMilli(), records)
+	if _, err := s.log.Append([]*RecordBatch{batch}); err != nil {
+		return fmt.Errorf("failed to append to share group state log: %w", err)
+	}
+	s.records += len(records)
+	return nil
+}
+
+// maybeCompact rewrites the log with the latest snapshot of each key once superseded
+// records make up at least half of it. The caller holds s.mu.
+func (s *ShareStateStore) maybeCompact() error {
+	superseded := s.records - len(s.latest)
+	if s.records < shareStateMinCompactRecords || superseded*2 < s.records {
+		return nil
+	}
+
+	keys := make([]sharePartitionKey, 0, len(s.latest))
+	for key := range s.latest {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b sharePartitionKey) int {
+		return cmp.Or(strings.Compare(a.GroupID, b.GroupID), strings.Compare(a.TopicID, b.TopicID), cmp.Compare(a.Partition, b.Partition))
+	})
+
+	records := make([]Record, 0, len(keys))
+	for _, key := range keys {
+		records = append(records, Record{Key: encodeShareSnapshotKey(key), Value: s.latest[key]})
+	}
+	partitionLog, err := rewriteRecords(s.logManager, shareStatePartition, records)
+	if err != nil {
+		return fmt.Errorf("failed to compact share group state log: %w", err)
+	}
+	s.log = partitionLog
+	s.records = len(keys)
+
+	return nil
+}
+
+// encodeShareSnapshotKey encodes a ShareSnapshotKey: version, group, topic ID and partition
+func encodeShareSnapshotKey(key sharePartitionKey) []byte {
+	topicID, _ := hex.DecodeString(key.TopicID)
+
+	buf := binary.BigEndian.AppendUint16(nil, shareSnapshotKeyVersion)
+	buf = appendString16(buf, key.GroupID)
+	buf = append(buf, topicID...)
+	return binary.BigEndian.AppendUint32(buf, uint32(key.Partition))
+}
+
+// decodeShareSnapshotKey decodes a ShareSnapshotKey; ok is false for other record keys
+func decodeShareSnapshotKey(data []byte) (key sharePartitionKey, ok bool) {
+	d := NewDecoder(data)
+	if version := d.ReadInt16(); d.Err() != nil || version != shareSnapshotKeyVersion {
+		return sharePartitionKey{}, false
+	}
+	key.GroupID = d.ReadString(false)
+	key.TopicID = d.ReadUUID()
+	key.Partition = d.ReadInt32()
+	return key, d.Err() == nil
+}
+
+// encodeShareSnapshotValue encodes a ShareSnapshotValue: version, start offset and state batches
+func encodeShareSnapshotValue(snapshot ShareSnapshot) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, shareSnapshotValueVersion)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(snapshot.StartOffset))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(snapshot.Batches)))
+	for _, batch := range snapshot.Batches {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(batch.FirstOffset))
+		buf = binary.BigEndian.AppendUint64(buf, uint64(batch.LastOffset))
+		buf = append(buf, byte(batch.DeliveryState))
+		buf = binary.BigEndian.AppendUint16(buf, uint16(batch.DeliveryCount))
+	}
+	return buf
+}
+
+// decodeShareSnapshotValue decodes a ShareSnapshotValue
+func decodeShareSnapshotValue(data []byte) (ShareSnapshot, error) {
+	d := NewDecoder(data)
+	if version := d.ReadInt16(); version != shareSnapshotValueVersion {
+		return ShareSnapshot{}, fmt.Errorf("unsupported share snapshot value version %d", version)
+	}
+
+	snapshot := ShareSnapshot{StartOffset: d.ReadInt64()}
+	count := int(d.ReadInt32())
+	for i := 0; i < count && d.Err() == nil; i++ {
+		snapshot.Batches = append(snapshot.Batches, ShareStateBatch{
+			FirstOffset:   d.ReadInt64(),
+			LastOffset:    d.ReadInt64(),
+			DeliveryState: RecordState(d.ReadInt8()),
+			DeliveryCount: d.ReadInt16(),
+		})
+	}
+	return snapshot, d.Err()
+}
@@ -0,0 +1,59 @@
+package main
+
+import "fmt"
+
+// SyncGroupRequest represents a parsed SyncGroup request
+type SyncGroupRequest struct {
+	GroupID         string
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID *string
+	ProtocolType    *string
+	ProtocolName    *string
+	Assignments     []SyncGroupAssignment
+}
+
+// SyncGroupAssignment is the leader's assignment for one member
+type SyncGroupAssignment struct {
+	MemberID   string
+	Assignment []byte
+}
+
+// ParseSyncGroupRequest parses the body of a SyncGroup request (v0-v5)
+func ParseSyncGroupRequest(baseReq *SwiftQueueRequest) (*SyncGroupRequest, error) {
+	version := baseReq.APIVersion
+	if version < SyncGroupMinVersion || version > SyncGroupMaxVersion {
+		return nil, fmt.Errorf("unsupported sync group version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &SyncGroupRequest{}
+	req.GroupID = d.ReadString(flexible)
+	req.GenerationID = d.ReadInt32()
+	req.MemberID = d.ReadString(flexible)
+	if version >= 3 {
+		req.GroupInstanceID = d.ReadNullableString(flexible)
+	}
+	if version >= 5 {
+		req.ProtocolType = d.ReadNullableString(flexible)
+		req.ProtocolName = d.ReadNullableString(flexible)
+	}
+
+	assignmentCount := d.ReadArrayLength(flexible)
+	for i := 0; i < assignmentCount && d.Err() == nil; i++ {
+		assignment := SyncGroupAssignment{}
+		assignment.MemberID = d.ReadString(flexible)
+		assignment.Assignment = d.ReadBytes(flexible)
+		d.SkipTaggedFields(flexible)
+		req.Assignments = append(req.Assignments, assignment)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse sync group request: %w", err)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+// HandleSyncGroup passes a SyncGroup request to the group coordinator and responds once
+// the leader has sent the group's assignment
+func HandleSyncGroup(baseReq *SwiftQueueRequest, req *SyncGroupRequest, broker *Broker, respond func([]byte)) {
+	broker.groupCoordinator.SyncGroup(req, func(result SyncGroupResult) {
+		respond(encodeSyncGroupResponse(baseReq, result))
+	})
+}
+
+// encodeSyncGroupResponse serializes the SyncGroup response for the request's version
+func encodeSyncGroupResponse(baseReq *SwiftQueueRequest, result SyncGroupResult) []byte {
+	version := baseReq.APIVersion
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	if version >= 1 {
+		// Throttle time
+		rb.WriteInt32(0)
+	}
+	rb.WriteInt16(result.ErrorCode)
+	if version >= 5 {
+		rb.WriteNullableString(result.ProtocolType, flexible)
+		rb.WriteNullableString(result.ProtocolName, flexible)
+	}
+
+	assignment := result.Assignment
+	if assignment == nil {
+		assignment = []byte{}
+	}
+	rb.WriteBytesField(assignment, flexible)
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// TimeIndexEntrySize is the size of one time index entry: an 8-byte timestamp and a 4-byte relative offset
+const TimeIndexEntrySize = 12
+
+// TimeIndexFileName returns the name of the time index file for the segment starting at baseOffset
+func TimeIndexFileName(baseOffset int64) string {
+	return fmt.Sprintf("%020d.timeindex", baseOffset)
+}
+
+// TimeIndexEntry maps a timestamp to the offset of the batch holding it
+type TimeIndexEntry struct {
+	Timestamp int64
+	Offset    int64
+}
+
+// TimeIndex maps timestamps to offsets for one log segment.
+//
+// An entry is appended whenever a batch raises the largest timestamp seen in the segment,
+// so timestamps in the index are strictly increasing. Offsets are stored relative to the
+// segment base offset. Looking up the first entry at or after a target timestamp yields
+// the first batch that can contain a record with that timestamp.
+type TimeIndex struct {
+	file       *os.File
+	baseOffset int64
+	entries    []TimeIndexEntry
+}
+
+// OpenTimeIndex opens or creates the time index at path, loading its entries
+func OpenTimeIndex(path string, baseOffset int64) (*TimeIndex, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open time index %s: %w", path, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read time index %s: %w", path, err)
+	}
+
+	index := &TimeIndex{
+		file:       file,
+		baseOffset: baseOffset,
+	}
+	for position := 0; position+TimeIndexEntrySize <= len(data); position += TimeIndexEntrySize {
+		index.entries = append(index.entries, TimeIndexEntry{
+			Timestamp: int64(binary.BigEndian.Uint64(data[position:])),
+			Offset:    baseOffset + int64(binary.BigEndian.Uint32(data[position+SizeInt64:])),
+		})
+	}
+
+	return index, nil
+}
+
+// Entries returns the loaded index entries
+func (ti *TimeIndex) Entries() []TimeIndexEntry {
+	return ti.entries
+}
+
+// MaybeAppend records that the batch at offset holds timestamp, if timestamp is a new maximum
+func (ti *TimeIndex) MaybeAppend(timestamp int64, offset int64) error {
+	if last, ok := ti.Last(); ok && timestamp <= last.Timestamp {
+		return nil
+	}
+
+	entry := make([]byte, TimeIndexEntrySize)
+	binary.BigEndian.PutUint64(entry, uint64(timestamp))
+	binary.BigEndian.PutUint32(entry[SizeInt64:], uint32(offset-ti.baseOffset))
+
+	position := int64(len(ti.entries) * TimeIndexEntrySize)
+	if _, err := ti.file.WriteAt(entry, position); err != nil {
+		return fmt.Errorf("failed to append time index entry: %w", err)
+	}
+	ti.entries = append(ti.entries, TimeIndexEntry{Timestamp: timestamp, Offset: offset})
+
+	return nil
+}
+
+// Lookup returns the first entry whose timestamp is at or after target
+func (ti *TimeIndex) Lookup(target int64) (TimeIndexEntry, bool) {
+	i := sort.Search(len(ti.entries), func(i int) bool {
+		return ti.entries[i].Timestamp >= target
+	})
+	if i == len(ti.entries) {
+		return TimeIndexEntry{}, false
+	}
+	return ti.entries[i], true
+}
+
+// Last returns the entry with the largest timestamp
+func (ti *TimeIndex) Last() (TimeIndexEntry, bool) {
+	if len(ti.entries) == 0 {
+		return TimeIndexEntry{}, false
+	}
+	return ti.entries[len(ti.entries)-1], true
+}
+
+// Reset truncates the index to the given entries and rewrites it
+func (ti *TimeIndex) Reset(entries []TimeIndexEntry) error {
+	data := make([]byte, 0, len(entries)*TimeIndexEntrySize)
+	for _, entry := range entries {
+		data = binary.BigEndian.AppendUint64(data, uint64(entry.Timestamp))
+		data = binary.BigEndian.AppendUint32(data, uint32(entry.Offset-ti.baseOffset))
+	}
+
+	if err := ti.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate time index: %w", err)
+	}
+	if _, err := ti.file.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("failed to rewrite time index: %w", err)
+	}
+	ti.entries = append([]TimeIndexEntry(nil), entries...)
+
+	return nil
+}
+
+// Validate checks that the index file holds whole entries whose timestamps and offsets are
+// strictly increasing
+func (ti *TimeIndex) Validate() error {
+	info, err := ti.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat time index: %w", err)
+	}
+	if info.Size()%TimeIndexEntrySize != 0 {
+		return fmt.Errorf("time index size %d is not a multiple of %d", info.Size(), TimeIndexEntrySize)
+	}
+	for i, entry := range ti.entries {
+		if i > 0 && (entry.Timestamp <= ti.entries[i-1].Timestamp || entry.Offset <= ti.entries[i-1].Offset) {
+			return fmt.Errorf("time index entry (%d, %d) does not follow (%d, %d)",
+				entry.Timestamp, entry.Offset, ti.entries[i-1].Timestamp, ti.entries[i-1].Offset)
+		}
+	}
+	return nil
+}
+
+// Sync flushes the index file to disk
+func (ti *TimeIndex) Sync() error {
+	return ti.file.Sync()
+}
+
+// Close closes the index file
+func (ti *TimeIndex) Close() error {
+	return ti.file.Close()
+}
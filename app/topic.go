@@ -1,5 +1,24 @@
 package main
 
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxTopicNameLength is the longest topic name SwiftQueue accepts
+const MaxTopicNameLength = 249
+
+// Errors returned when creating and deleting topics
+var (
+	ErrUnknownTopic             = errors.New("unknown topic")
+	ErrInvalidTopicName         = errors.New("invalid topic name")
+	ErrTopicAlreadyExists       = errors.New("topic already exists")
+	ErrInvalidPartitions        = errors.New("invalid partitions")
+	ErrInvalidReplicationFactor = errors.New("invalid replication factor")
+	ErrInvalidReplicaAssignment = errors.New("invalid replica assignment")
+	ErrInvalidRequest           = errors.New("invalid request")
+)
+
 // Topic represents a SwiftQueue topic with its name and UUID
 type Topic struct {
 	Name string
@@ -8,14 +27,66 @@ type Topic struct {
 
 // Partition represents a SwiftQueue topic partition with its metadata
 type Partition struct {
-	ID                    uint32
-	TopicUUID             string
-	ReplicaLength         int
-	ReplicaID             uint32
-	LengthSyncReplica     int
-	InSyncReplica         uint32
-	LengthRemovingReplica int
-	LengthAddingReplica   int
-	LeaderID              uint32
-	LeaderEpoch           uint32
+	ID        uint32
+	TopicUUID string
+	// ReplicaIDs holds the brokers hosting the partition, the preferred leader first
+	ReplicaIDs       []int32
+	ISR              []int32
+	RemovingReplicas []int32
+	AddingReplicas   []int32
+	LeaderID         uint32
+	LeaderEpoch      uint32
+	// PartitionEpoch is bumped by every change of the partition
+	PartitionEpoch      int32
+	LeaderRecoveryState int8
+}
+
+// Replicas returns the broker IDs hosting the partition
+func (p *Partition) Replicas() []int32 {
+	if p.ReplicaIDs == nil {
+		return []int32{}
+	}
+	return p.ReplicaIDs
+}
+
+// InSyncReplicas returns the broker IDs in the partition's in-sync replica set
+func (p *Partition) InSyncReplicas() []int32 {
+	if p.ISR == nil {
+		return []int32{}
+	}
+	return p.ISR
+}
+
+// TopicPartition identifies a single partition of a topic
+type TopicPartition struct {
+	Topic     string
+	Partition int32
+}
+
+// String returns the partition directory name, e.g. "orders-0"
+func (tp TopicPartition) String() string {
+	return fmt.Sprintf("%s-%d", tp.Topic, tp.Partition)
+}
+
+// ValidateTopicName checks that name is a legal topic name: 1-249 ASCII letters, digits, '.', '_' or '-',
+// and neither "." nor ".."
+func ValidateTopicName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("%w: %q", ErrInvalidTopicName, name)
+	}
+	if len(name) > MaxTopicNameLength {
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidTopicName, MaxTopicNameLength)
+	}
+	for _, c := range name {
+		legal := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '.' || c == '_' || c == '-'
+		if !legal {
+			return fmt.Errorf("%w: %q contains illegal character %q", ErrInvalidTopicName, name, c)
+		}
+	}
+	return nil
+}
+
+// IsInternalTopic reports whether name is one of the broker's internal topics
+func IsInternalTopic(name string) bool {
+	return name == OffsetsTopic || name == ShareGroupStateTopic || name == TransactionStateTopic
 }
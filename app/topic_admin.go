@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// ErrTopicDeletionDisabled is returned by DeleteTopic when delete.topic.enable is false
+var ErrTopicDeletionDisabled = errors.New("topic deletion is disabled")
+
+// TopicSpec describes a topic to create
+type TopicSpec struct {
+	Name string
+	// Assignments holds the replica broker IDs of each partition, indexed by partition; the first replica leads
+	Assignments [][]int32
+	Configs     map[string]string
+}
+
+// UniformAssignments places numPartitions partitions with replicationFactor replicas on this broker
+func (b *Broker) UniformAssignments(numPartitions int32, replicationFactor int16) ([][]int32, error) {
+	if numPartitions <= 0 {
+		return nil, fmt.Errorf("%w: number of partitions must be larger than 0", ErrInvalidPartitions)
+	}
+	if replicationFactor <= 0 {
+		return nil, fmt.Errorf("%w: replication factor must be larger than 0", ErrInvalidReplicationFactor)
+	}
+	if replicationFactor > 1 {
+		return nil, fmt.Errorf("%w: replication factor %d larger than available brokers: 1", ErrInvalidReplicationFactor, replicationFactor)
+	}
+
+	assignments := make([][]int32, numPartitions)
+	for i := range assignments {
+		assignments[i] = []int32{int32(b.config.NodeID)}
+	}
+	return assignments, nil
+}
+
+// validateAssignments checks that every partition has replicas and that they are live, distinct brokers
+func (b *Broker) validateAssignments(assignments [][]int32) error {
+	if len(assignments) == 0 {
+		return fmt.Errorf("%w: no partitions", ErrInvalidPartitions)
+	}
+	for partition, replicas := range assignments {
+		if len(replicas) == 0 {
+			return fmt.Errorf("%w: partition %d has no replicas", ErrInvalidReplicaAssignment, partition)
+		}
+		for i, replica := range replicas {
+			if replica != int32(b.config.NodeID) {
+				return fmt.Errorf("%w: partition %d is assigned to unknown broker %d", ErrInvalidReplicaAssignment, partition, replica)
+			}
+			if slices.Contains(replicas[:i], replica) {
+				return fmt.Errorf("%w: partition %d lists broker %d twice", ErrInvalidReplicaAssignment, partition, replica)
+			}
+		}
+	}
+	return nil
+}
+
+// CreateTopic validates spec and, unless validateOnly is set, creates the topic by appending its
+// TopicRecord, ConfigRecords and PartitionRecords to the metadata log as a single batch
+func (b *Broker) CreateTopic(spec TopicSpec, validateOnly bool) (*Topic, error) {
+	if err := ValidateTopicName(spec.Name); err != nil {
+		return nil, err
+	}
+	if err := b.validateAssignments(spec.Assignments); err != nil {
+		return nil, err
+	}
+	if err := ValidateTopicConfigs(spec.Configs); err != nil {
+		return nil, err
+	}
+
+	b.topicsMu.Lock()
+	defer b.topicsMu.Unlock()
+
+	topics, _ := b.TopicsAndPartitions()
+	if findTopicByName(topics, spec.Name) != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTopicAlreadyExists, spec.Name)
+	}
+	if validateOnly {
+		return &Topic{Name: spec.Name, UUID: NoTopicID}, nil
+	}
+
+	uuid, err := NewTopicUUID()
+	if err != nil {
+		return nil, err
+	}
+	topic := Topic{Name: spec.Name, UUID: uuid}
+
+	values := [][]byte{EncodeTopicRecord(topic)}
+	configNames := make([]string, 0, len(spec.Configs))
+	for name := range spec.Configs {
+		configNames = append(configNames, name)
+	}
+	sort.Strings(configNames)
+	for _, name := range configNames {
+		values = append(values, EncodeConfigRecord(ConfigResourceTypeTopic, spec.Name, name, spec.Configs[name]))
+	}
+	for partition, replicas := range spec.Assignments {
+		values = append(values, EncodePartitionRecord(uuid, int32(partition), replicas))
+	}
+	if err := b.metadataWriter.Append(values); err != nil {
+		return nil, fmt.Errorf("failed to write topic %s: %w", spec.Name, err)
+	}
+
+	b.logger.Printf("Created topic %s (%s) with %d partitions", spec.Name, uuid, len(spec.Assignments))
+	return &topic, nil
+}
+
+// DeleteTopic removes a topic by appending a RemoveTopicRecord to the metadata log.
+// The partition data is deleted in the background once the topic is gone from the metadata,
+// together with the offsets groups committed for it.
+func (b *Broker) DeleteTopic(topic Topic) error {
+	if !b.config.DeleteTopics {
+		return ErrTopicDeletionDisabled
+	}
+
+	b.topicsMu.Lock()
+	defer b.topicsMu.Unlock()
+
+	topics, partitions := b.TopicsAndPartitions()
+	if findTopicByUUID(topics, topic.UUID) == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownTopic, topic.Name)
+	}
+
+	if err := b.metadataWriter.Append([][]byte{EncodeRemoveTopicRecord(topic.UUID)}); err != nil {
+		return fmt.Errorf("failed to write removal of topic %s: %w", topic.Name, err)
+	}
+	b.logger.Printf("Deleted topic %s (%s)", topic.Name, topic.UUID)
+
+	topicPartitions := filterPartitionsByTopicUUID(partitions, topic.UUID)
+	indexes := make([]int32, 0, len(topicPartitions))
+	for _, partition := range topicPartitions {
+		indexes = append(indexes, int32(partition.ID))
+	}
+	if err := b.logManager.DeleteLogs(topic, indexes); err != nil {
+		// The topic is already gone; leftover data is harmless and reported only
+		b.logger.Printf("Failed to delete data of topic %s: %v", topic.Name, err)
+	}
+	b.groupCoordinator.DeleteTopicOffsets(topic.Name)
+
+	return nil
+}
+
+// CreatePartitions grows topic to len(existing)+len(assignments) partitions by appending a PartitionRecord
+// for each new partition. With validateOnly set the change is only validated.
+func (b *Broker) CreatePartitions(topicName string, count int32, assignments [][]int32, validateOnly bool) error {
+	b.topicsMu.Lock()
+	defer b.topicsMu.Unlock()
+
+	topics, partitions := b.TopicsAndPartitions()
+	topic := findTopicByName(topics, topicName)
+	if topic == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownTopic, topicName)
+	}
+
+	topicPartitions := filterPartitionsByTopicUUID(partitions, topic.UUID)
+	current := int32(len(topicPartitions))
+	if count < current {
+		return fmt.Errorf("%w: topic currently has %d partitions, which is higher than the requested %d", ErrInvalidPartitions, current, count)
+	}
+	if count == current {
+		return fmt.Errorf("%w: topic already has %d partitions", ErrInvalidPartitions, current)
+	}
+
+	if assignments == nil {
+		replicationFactor := int16(1)
+		if current > 0 {
+			replicationFactor = int16(max(len(topicPartitions[0].Replicas()), 1))
+		}
+		var err error
+		assignments, err = b.UniformAssignments(count-current, replicationFactor)
+		if err != nil {
+			return err
+		}
+	} else if int32(len(assignments)) != count-current {
+		return fmt.Errorf("%w: %d assignments given for %d new partitions", ErrInvalidReplicaAssignment, len(assignments), count-current)
+	}
+	if err := b.validateAssignments(assignments); err != nil {
+		return err
+	}
+	if validateOnly {
+		return nil
+	}
+
+	values := make([][]byte, 0, len(assignments))
+	for i, replicas := range assignments {
+		values = append(values, EncodePartitionRecord(topic.UUID, current+int32(i), replicas))
+	}
+	if err := b.metadataWriter.Append(values); err != nil {
+		return fmt.Errorf("failed to write partitions of topic %s: %w", topicName, err)
+	}
+
+	b.logger.Printf("Increased partitions of topic %s from %d to %d", topicName, current, count)
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidConfig is returned for unknown topic configs and invalid config values
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Cleanup policies accepted by cleanup.policy
+const (
+	CleanupPolicyDelete  = "delete"
+	CleanupPolicyCompact = "compact"
+)
+
+// topicConfigDef describes a per-topic configuration property
+type topicConfigDef struct {
+	defaultValue string
+	validate     func(value string) error
+}
+
+// topicConfigDefs lists the per-topic configs SwiftQueue accepts
+var topicConfigDefs = map[string]topicConfigDef{
+	"cleanup.policy":            {CleanupPolicyDelete, validateCleanupPolicy},
+	"compression.type":          {CompressionTypeProducer, validateCompressionType},
+	"delete.retention.ms":       {"86400000", validateLong(0)},
+	"index.interval.bytes":      {"4096", validateLong(0)},
+	"max.message.bytes":         {"1048588", validateLong(0)},
+	"message.timestamp.type":    {"CreateTime", validateOneOf("CreateTime", "LogAppendTime")},
+	"min.cleanable.dirty.ratio": {"0.5", validateRatio},
+	"min.insync.replicas":       {"1", validateLong(1)},
+	"retention.bytes":           {"-1", validateLong(-1)},
+	"retention.ms":              {"604800000", validateLong(-1)},
+	"segment.bytes":             {"1073741824", validateLong(RecordBatchHeaderSize)},
+	"segment.ms":                {"604800000", validateLong(1)},
+}
+
+// TopicConfigEntry is a topic config value together with whether it was set explicitly
+type TopicConfigEntry struct {
+	Name      string
+	Value     string
+	IsDefault bool
+}
+
+// ValidateTopicConfigs checks that every config is known and has a valid value
+func ValidateTopicConfigs(configs map[string]string) error {
+	for name, value := range configs {
+		def, ok := topicConfigDefs[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown topic config %s", ErrInvalidConfig, name)
+		}
+		if err := def.validate(value); err != nil {
+			return fmt.Errorf("%w: %s=%q: %v", ErrInvalidConfig, name, value, err)
+		}
+	}
+	return nil
+}
+
+// TopicConfigEntries returns every topic config, sorted by name, with overrides applied over the defaults
+func TopicConfigEntries(overrides map[string]string) []TopicConfigEntry {
+	entries := make([]TopicConfigEntry, 0, len(topicConfigDefs))
+	for name, def := range topicConfigDefs {
+		entry := TopicConfigEntry{Name: name, Value: def.defaultValue, IsDefault: true}
+		if value, ok := overrides[name]; ok {
+			entry.Value = value
+			entry.IsDefault = false
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// validateLong accepts integers of at least minimum
+func validateLong(minimum int64) func(string) error {
+	return func(value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("not an integer")
+		}
+		if n < minimum {
+			return fmt.Errorf("must be at least %d", minimum)
+		}
+		return nil
+	}
+}
+
+// validateRatio accepts numbers between 0 and 1
+func validateRatio(value string) error {
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return errors.New("must be a number between 0 and 1")
+	}
+	return nil
+}
+
+// validateOneOf accepts one of the allowed values
+func validateOneOf(allowed ...string) func(string) error {
+	return func(value string) error {
+		if !slices.Contains(allowed, value) {
+			return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+		}
+		return nil
+	}
+}
+
+// validateCleanupPolicy accepts a comma-separated list of delete and compact
+func validateCleanupPolicy(value string) error {
+	for _, policy := range strings.Split(value, ",") {
+		policy = strings.TrimSpace(policy)
+		if policy != CleanupPolicyDelete && policy != CleanupPolicyCompact {
+			return fmt.Errorf("unknown cleanup policy %q", policy)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// TransactionState is the state of a transactional ID's current transaction
+type TransactionState int8
+
+// Transaction states, numbered as in the transaction state log
+const (
+	// TransactionEmpty has no transaction in progress
+	TransactionEmpty TransactionState = iota
+	// TransactionOngoing has added partitions and is neither committing nor aborting
+	TransactionOngoing
+	// TransactionPrepareCommit is writing commit markers to its partitions
+	TransactionPrepareCommit
+	// TransactionPrepareAbort is writing abort markers to its partitions
+	TransactionPrepareAbort
+	// TransactionCompleteCommit has committed; its markers are written
+	TransactionCompleteCommit
+	// TransactionCompleteAbort has aborted; its markers are written
+	TransactionCompleteAbort
+	// TransactionDead has expired; SwiftQueue never expires transactional IDs
+	TransactionDead
+	// TransactionPrepareEpochFence is used by Kafka while fencing a producer; SwiftQueue
+	// fences producers through PrepareAbort
+	TransactionPrepareEpochFence
+)
+
+var transactionStateNames = [...]string{"Empty", "Ongoing", "PrepareCommit", "PrepareAbort", "CompleteCommit", "CompleteAbort", "Dead", "PrepareEpochFence"}
+
+// String returns the state name used by Kafka
+func (s TransactionState) String() string {
+	return transactionStateNames[s]
+}
+
+// TransactionMetadata is what the coordinator knows about one transactional ID
+type TransactionMetadata struct {
+	TransactionalID string
+	ProducerID      int64
+	ProducerEpoch   int16
+	TimeoutMs       int32
+	State           TransactionState
+	// Partitions holds the partitions of the current or last transaction
+	Partitions   map[TopicPartition]bool
+	LastUpdateMs int64
+	// StartMs is when the current transaction added its first partition
+	StartMs int64
+
+	// lastProducerEpoch is the epoch the producer held before the coordinator fenced it by
+	// aborting its transaction, or NoProducerEpoch. It lets that producer reinitialize.
+	lastProducerEpoch int16
+	// writingMarkers is set while the markers of a prepared transaction are being written
+	writingMarkers bool
+}
+
+// clone returns a copy of the metadata to be changed and persisted
+func (t *TransactionMetadata) clone() *TransactionMetadata {
+	clone := *t
+	clone.Partitions = maps.Clone(t.Partitions)
+	return &clone
+}
+
+// sortedPartitions returns the partitions of the transaction ordered by topic and index
+func (t *TransactionMetadata) sortedPartitions() []TopicPartition {
+	return slices.SortedFunc(maps.Keys(t.Partitions), compareTopicPartitions)
+}
+
+// validateProducer checks that a request comes from the producer currently holding the
+// transactional ID. Older versions of the transactional APIs predate PRODUCER_FENCED and are
+// answered with INVALID_PRODUCER_EPOCH instead.
+func (t *TransactionMetadata) validateProducer(producerID int64, producerEpoch int16, fencedSupported bool) int16 {
+	switch {
+	case t == nil || producerID != t.ProducerID:
+		return ErrorCodeInvalidProducerIDMapping
+	case producerEpoch != t.ProducerEpoch && fencedSupported:
+		return ErrorCodeProducerFenced
+	case producerEpoch != t.ProducerEpoch:
+		return ErrorCodeInvalidProducerEpoch
+	}
+	return ErrorCodeNone
+}
+
+// TransactionCoordinator runs the transactions of every transactional ID. Being the only
+// broker, it coordinates them all.
+//
+// A transaction starts when the producer adds its first partition and moves from Ongoing to
+// PrepareCommit or PrepareAbort when the producer ends it, or when it exceeds its timeout.
+// The prepared state is persisted before the commit or abort markers are written to every
+// partition of the transaction, so that markers lost to a crash are written again once the
+// state is loaded back. Once the markers are written the transaction is complete.
+type TransactionCoordinator struct {
+	config      *Config
+	logger      *log.Logger
+	store       *TransactionStateStore
+	producerIDs *ProducerIDManager
+	// writeMarkers writes the markers completing a transaction to its partitions
+	writeMarkers func(producerID int64, producerEpoch int16, commit bool, partitions []TopicPartition) error
+
+	mu           sync.Mutex
+	transactions map[string]*TransactionMetadata
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewTransactionCoordinator creates a coordinator holding the transactional IDs of the
+// transaction state log and starts aborting transactions that exceed their timeout.
+// Transactions found prepared are completed right away.
+func NewTransactionCoordinator(config *Config, logger *log.Logger, logManager *LogManager, producerIDs *ProducerIDManager, writeMarkers func(int64, int16, bool, []TopicPartition) error) (*TransactionCoordinator, error) {
+	store, transactions, err := OpenTransactionStateStore(logManager)
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("Loaded %d transactional IDs", len(transactions))
+
+	c := &TransactionCoordinator{
+		config:       config,
+		logger:       logger,
+		store:        store,
+		producerIDs:  producerIDs,
+		writeMarkers: writeMarkers,
+		transactions: transactions,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go c.runTransactionTimeouts()
+
+	return c, nil
+}
+
+// InitProducerID assigns the producer of a transactional ID, returning its producer ID and
+// epoch. Each call bumps the epoch, fencing previous producers using the same transactional
+// ID; a transaction left in progress by them is aborted first. Producers passing their current
+// producer ID and epoch (version 3 and later) are fenced if another producer took over since.
+func (c *TransactionCoordinator) InitProducerID(transactionalID string, timeoutMs int32, producerID int64, producerEpoch int16, fencedSupported bool) (int64, int16, int16) {
+	if timeoutMs <= 0 || int(timeoutMs) > c.config.TransactionMaxTimeoutMs {
+		return NoProducerID, NoProducerEpoch, ErrorCodeInvalidTransactionTimeout
+	}
+
+	c.mu.Lock()
+	txn := c.transactions[transactionalID]
+	if txn == nil {
+		defer c.mu.Unlock()
+		id, err := c.producerIDs.GenerateProducerID()
+		if err != nil {
+			c.logger.Printf("Transactional ID %s: %v", transactionalID, err)
+			return NoProducerID, NoProducerEpoch, ErrorCodeCoordinatorNotAvailable
+		}
+		now := time.Now().UnixMilli()
+		return c.update(&TransactionMetadata{
+			TransactionalID:   transactionalID,
+			ProducerID:        id,
+			ProducerEpoch:     0,
+			TimeoutMs:         timeoutMs,
+			State:             TransactionEmpty,
+			Partitions:        make(map[TopicPartition]bool),
+			LastUpdateMs:      now,
+			StartMs:           -1,
+			lastProducerEpoch: NoProducerEpoch,
+		})
+	}
+
+	if producerID != NoProducerID {
+		if producerID != txn.ProducerID || (producerEpoch != txn.ProducerEpoch && producerEpoch != txn.lastProducerEpoch) {
+			c.mu.Unlock()
+			if !fencedSupported {
+				return NoProducerID, NoProducerEpoch, ErrorCodeInvalidProducerEpoch
+			}
+			return NoProducerID, NoProducerEpoch, ErrorCodeProducerFenced
+		}
+	}
+
+	if txn.State == TransactionOngoing {
+		// Abort the transaction of the producer being replaced, fencing it with a new epoch
+		prepared, err := c.prepareEnd(txn, false, true)
+		c.mu.Unlock()
+		if err != nil {
+			c.logger.Printf("Transactional ID %s: %v", transactionalID, err)
+			return NoProducerID, NoProducerEpoch, ErrorCodeCoordinatorNotAvailable
+		}
+		if err := c.completeEnd(prepared); err != nil {
+			c.logger.Printf("Transactional ID %s: %v", transactionalID, err)
+			return NoProducerID, NoProducerEpoch, ErrorCodeConcurrentTransactions
+		}
+		c.mu.Lock()
+		txn = c.transactions[transactionalID]
+	}
+	defer c.mu.Unlock()
+
+	if txn.State == TransactionPrepareCommit || txn.State == TransactionPrepareAbort {
+		return NoProducerID, NoProducerEpoch, ErrorCodeConcurrentTransactions
+	}
+
+	updated := txn.clone()
+	if txn.ProducerEpoch >= math.MaxInt16-1 {
+		// The epoch is exhausted, so the transactional ID moves to a new producer ID
+		id, err := c.producerIDs.GenerateProducerID()
+		if err != nil {
+			c.logger.Printf("Transactional ID %s: %v", transactionalID, err)
+			return NoProducerID, NoProducerEpoch, ErrorCodeCoordinatorNotAvailable
+		}
+		updated.ProducerID, updated.ProducerEpoch = id, 0
+	} else {
+		updated.ProducerEpoch++
+	}
+	updated.TimeoutMs = timeoutMs
+	updated.State = TransactionEmpty
+	updated.Partitions = make(map[TopicPartition]bool)
+	updated.LastUpdateMs = time.Now().UnixMilli()
+	updated.lastProducerEpoch = NoProducerEpoch
+	return c.update(updated)
+}
+
+// update persists changed metadata and makes it current, returning the producer ID and epoch
+// for InitProducerID. The caller holds c.mu.
+func (c *TransactionCoordinator) update(txn *TransactionMetadata) (int64, int16, int16) {
+	if err := c.store.Write(txn); err != nil {
+		c.logger.Printf("Transactional ID %s: %v", txn.TransactionalID, err)
+		return NoProducerID, NoProducerEpoch, ErrorCodeCoordinatorNotAvailable
+	}
+	c.transactions[txn.TransactionalID] = txn
+	return txn.ProducerID, txn.ProducerEpoch, ErrorCodeNone
+}
+
+// AddPartitions adds partitions to the producer's transaction, starting the transaction if
+// none is in progress. The producer must then write to these partitions inside the transaction.
+func (c *TransactionCoordinator) AddPartitions(transactionalID string, producerID int64, producerEpoch int16, fencedSupported bool, partitions []TopicPartition) int16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	txn := c.transactions[transactionalID]
+	if errorCode := txn.validateProducer(producerID, producerEpoch, fencedSupported); errorCode != ErrorCodeNone {
+		return errorCode
+	}
+	if txn.State == TransactionPrepareCommit || txn.State == TransactionPrepareAbort {
+		return ErrorCodeConcurrentTransactions
+	}
+	if txn.State == TransactionOngoing && !slices.ContainsFunc(partitions, func(tp TopicPartition) bool { return !txn.Partitions[tp] }) {
+		return ErrorCodeNone
+	}
+
+	now := time.Now().UnixMilli()
+	updated := txn.clone()
+	if txn.State != TransactionOngoing {
+		updated.State = TransactionOngoing
+		updated.Partitions = make(map[TopicPartition]bool)
+		updated.StartMs = now
+	}
+	for _, tp := range partitions {
+		updated.Partitions[tp] = true
+	}
+	updated.LastUpdateMs = now
+
+	_, _, errorCode := c.update(updated)
+	return errorCode
+}
+
+// EndTxn commits or aborts the producer's transaction, writing the markers to its partitions.
+// Retrying a completed EndTxn succeeds; asking to commit an aborted transaction or the
+// reverse fails with INVALID_TXN_STATE.
+func (c *TransactionCoordinator) EndTxn(transactionalID string, producerID int64, producerEpoch int16, fencedSupported bool, commit bool) int16 {
+	c.mu.Lock()
+
+	txn := c.transactions[transactionalID]
+	if errorCode := txn.validateProducer(producerID, producerEpoch, fencedSupported); errorCode != ErrorCodeNone {
+		c.mu.Unlock()
+		return errorCode
+	}
+
+	switch {
+	case txn.State == TransactionOngoing:
+		prepared, err := c.prepareEnd(txn, commit, false)
+		c.mu.Unlock()
+		if err != nil {
+			c.logger.Printf("Transactional ID %s: %v", transactionalID, err)
+			return ErrorCodeCoordinatorNotAvailable
+		}
+		if err := c.completeEnd(prepared); err != nil {
+			// The transaction is prepared, so its markers are written again later
+			c.logger.Printf("Transactional ID %s: %v", transactionalID, err)
+		}
+		return ErrorCodeNone
+	case txn.State == TransactionCompleteCommit && commit, txn.State == TransactionCompleteAbort && !commit:
+		c.mu.Unlock()
+		return ErrorCodeNone
+	case txn.State == TransactionPrepareCommit && commit, txn.State == TransactionPrepareAbort && !commit:
+		c.mu.Unlock()
+		return ErrorCodeConcurrentTransactions
+	default:
+		c.mu.Unlock()
+		return ErrorCodeInvalidTxnState
+	}
+}
+
+// prepareEnd moves an ongoing transaction to PrepareCommit or PrepareAbort and persists it.
+// When fence is set the producer epoch is bumped, so that the producer can no longer write.
+// The caller holds c.mu and must call completeEnd with the result without holding it.
+func (c *TransactionCoordinator) prepareEnd(txn *TransactionMetadata, commit bool, fence bool) (*TransactionMetadata, error) {
+	updated := txn.clone()
+	updated.State = TransactionPrepareAbort
+	if commit {
+		updated.State = TransactionPrepareCommit
+	}
+	if fence && txn.ProducerEpoch < math.MaxInt16 {
+		updated.lastProducerEpoch = txn.ProducerEpoch
+		updated.ProducerEpoch++
+	}
+	updated.LastUpdateMs = time.Now().UnixMilli()
+	updated.writingMarkers = true
+
+	if err := c.store.Write(updated); err != nil {
+		return nil, err
+	}
+	c.transactions[txn.TransactionalID] = updated
+	return updated, nil
+}
+
+// completeEnd writes the markers of a prepared transaction and marks it complete.
+// If the markers cannot be written the transaction stays prepared, and the markers are
+// written again by the next timeout check.
+func (c *TransactionCoordinator) completeEnd(txn *TransactionMetadata) error {
+	commit := txn.State == TransactionPrepareCommit
+	markerErr := c.writeMarkers(txn.ProducerID, txn.ProducerEpoch, commit, txn.sortedPartitions())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := c.transactions[txn.TransactionalID]
+	if markerErr != nil {
+		current.writingMarkers = false
+		return fmt.Errorf("failed to write transaction markers: %w", markerErr)
+	}
+
+	updated := current.clone()
+	updated.State = TransactionCompleteAbort
+	if commit {
+		updated.State = TransactionCompleteCommit
+	}
+	updated.LastUpdateMs = time.Now().UnixMilli()
+	updated.writingMarkers = false
+	if err := c.store.Write(updated); err != nil {
+		current.writingMarkers = false
+		return err
+	}
+	c.transactions[txn.TransactionalID] = updated
+	return nil
+}
+
+// runTransactionTimeouts periodically aborts transactions past their timeout until Shutdown
+func (c *TransactionCoordinator) runTransactionTimeouts() {
+	defer close(c.done)
+
+	// Complete the transactions found prepared at startup
+	c.abortTimedOutTransactions(time.Now())
+
+	ticker := time.NewTicker(time.Duration(c.config.TransactionAbortTimedOutTransactionCleanupIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.abortTimedOutTransactions(time.Now())
+		}
+	}
+}
+
+// abortTimedOutTransactions aborts the ongoing transactions that have exceeded their timeout,
+// fencing their producers, and writes the markers of prepared transactions whose markers
+// could not be written before
+func (c *TransactionCoordinator) abortTimedOutTransactions(now time.Time) {
+	var prepared []*TransactionMetadata
+
+	c.mu.Lock()
+	for _, txn := range c.transactions {
+		switch {
+		case txn.State == TransactionOngoing && now.UnixMilli()-txn.StartMs > int64(txn.TimeoutMs):
+			updated, err := c.prepareEnd(txn, false, true)
+			if err != nil {
+				c.logger.Printf("Transactional ID %s: failed to abort timed out transaction: %v", txn.TransactionalID, err)
+				continue
+			}
+			c.logger.Printf("Transactional ID %s: aborting transaction of producer %d after %d ms timeout",
+				txn.TransactionalID, txn.ProducerID, txn.TimeoutMs)
+			prepared = append(prepared, updated)
+		case (txn.State == TransactionPrepareCommit || txn.State == TransactionPrepareAbort) && !txn.writingMarkers:
+			txn.writingMarkers = true
+			prepared = append(prepared, txn)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, txn := range prepared {
+		if err := c.completeEnd(txn); err != nil {
+			c.logger.Printf("Transactional ID %s: %v", txn.TransactionalID, err)
+		}
+	}
+}
+
+// Shutdown stops aborting timed out transactions
+func (c *TransactionCoordinator) Shutdown() {
+	close(c.stop)
+	<-c.done
+}
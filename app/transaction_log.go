@@ -0,0 +1,214 @@
+package main
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransactionStateTopic is the internal topic holding the state of transactional producers
+const TransactionStateTopic = "__transaction_state"
+
+// Record versions of the transaction state log, as written by Kafka
+const (
+	transactionLogKeyVersion   = 0
+	transactionLogValueVersion = 0
+)
+
+// transactionStatePartition is the partition of the transaction state topic used by this broker
+var transactionStatePartition = TopicPartition{Topic: TransactionStateTopic, Partition: 0}
+
+// transactionStateMinCompactRecords is how many records the transaction state log holds
+// before it is considered for compaction; every transaction writes several records, so
+// small logs are left alone
+const transactionStateMinCompactRecords = 1000
+
+// TransactionStateStore persists the metadata of each transactional ID in the internal,
+// compacted __transaction_state log.
+//
+// Every state change appends a record keyed by transactional ID holding the producer, its
+// epoch, the transaction's state and partitions. As with the offsets log, only the latest
+// record of each key matters, and the log is rewritten once superseded records make up
+// half of it.
+type TransactionStateStore struct {
+	mu         sync.Mutex
+	logManager *LogManager
+	log        *PartitionLog
+	// latest holds the encoded value of the newest record for each transactional ID
+	latest map[string][]byte
+	// records counts the records in the log, including superseded ones
+	records int
+}
+
+// OpenTransactionStateStore opens the transaction state log and loads the latest metadata
+// of each transactional ID
+func OpenTransactionStateStore(logManager *LogManager) (*TransactionStateStore, map[string]*TransactionMetadata, error) {
+	partitionLog, err := logManager.GetOrCreateLog(transactionStatePartition)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open transaction state log: %w", err)
+	}
+
+	store := &TransactionStateStore{
+		logManager: logManager,
+		log:        partitionLog,
+		latest:     make(map[string][]byte),
+	}
+	err = replayRecords(partitionLog, func(record Record) {
+		store.records++
+		transactionalID, ok := decodeTransactionLogKey(record.Key)
+		if !ok {
+			return
+		}
+		if record.Value == nil {
+			delete(store.latest, transactionalID)
+		} else {
+			store.latest[transactionalID] = record.Value
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transactions := make(map[string]*TransactionMetadata, len(store.latest))
+	for transactionalID, value := range store.latest {
+		txn, err := decodeTransactionLogValue(transactionalID, value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode state of transactional ID %s: %w", transactionalID, err)
+		}
+		transactions[transactionalID] = txn
+	}
+
+	if err := store.maybeCompact(); err != nil {
+		return nil, nil, err
+	}
+	return store, transactions, nil
+}
+
+// Write persists the metadata of a transactional ID
+func (s *TransactionStateStore) Write(txn *TransactionMetadata) error {
+	value := encodeTransactionLogValue(txn)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := BuildRecordBatch(0, time.Now().UnixMilli(), []Record{{Key: encodeTransactionLogKey(txn.TransactionalID), Value: value}})
+	if _, err := s.log.Append([]*RecordBatch{batch}); err != nil {
+		return fmt.Errorf("failed to append to transaction state log: %w", err)
+	}
+	s.records++
+	s.latest[txn.TransactionalID] = value
+	return s.maybeCompact()
+}
+
+// maybeCompact rewrites the log with the latest record of each transactional ID once
+// superseded records make up at least half of it. The caller holds s.mu.
+func (s *TransactionStateStore) maybeCompact() error {
+	superseded := s.records - len(s.latest)
+	if s.records < transactionStateMinCompactRecords || superseded*2 < s.records {
+		return nil
+	}
+
+	ids := slices.Sorted(maps.Keys(s.latest))
+	records := make([]Record, 0, len(ids))
+	for _, transactionalID := range ids {
+		records = append(records, Record{Key: encodeTransactionLogKey(transactionalID), Value: s.latest[transactionalID]})
+	}
+	partitionLog, err := rewriteRecords(s.logManager, transactionStatePartition, records)
+	if err != nil {
+		return fmt.Errorf("failed to compact transaction state log: %w", err)
+	}
+	s.log = partitionLog
+	s.records = len(ids)
+
+	return nil
+}
+
+// encodeTransactionLogKey encodes a TransactionLogKey: version and transactional ID
+func encodeTransactionLogKey(transactionalID string) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, transactionLogKeyVersion)
+	return appendString16(buf, transactionalID)
+}
+
+// decodeTransactionLogKey decodes a TransactionLogKey; ok is false for other record keys
+func decodeTransactionLogKey(data []byte) (transactionalID string, ok bool) {
+	d := NewDecoder(data)
+	if version := d.ReadInt16(); d.Err() != nil || version != transactionLogKeyVersion {
+		return "", false
+	}
+	transactionalID = d.ReadString(false)
+	return transactionalID, d.Err() == nil
+}
+
+// encodeTransactionLogValue encodes a TransactionLogValue: producer, epoch, timeout, state,
+// the partitions of the transaction grouped by topic, and the update and start times
+func encodeTransactionLogValue(txn *TransactionMetadata) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, transactionLogValueVersion)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(txn.ProducerID))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(txn.ProducerEpoch))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(txn.TimeoutMs))
+	buf = append(buf, byte(txn.State))
+
+	partitions := txn.sortedPartitions()
+	var topics [][]TopicPartition
+	for _, tp := range partitions {
+		if n := len(topics); n > 0 && topics[n-1][0].Topic == tp.Topic {
+			topics[n-1] = append(topics[n-1], tp)
+		} else {
+			topics = append(topics, []TopicPartition{tp})
+		}
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(topics)))
+	for _, topic := range topics {
+		buf = appendString16(buf, topic[0].Topic)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(topic)))
+		for _, tp := range topic {
+			buf = binary.BigEndian.AppendUint32(buf, uint32(tp.Partition))
+		}
+	}
+
+	buf = binary.BigEndian.AppendUint64(buf, uint64(txn.LastUpdateMs))
+	return binary.BigEndian.AppendUint64(buf, uint64(txn.StartMs))
+}
+
+// decodeTransactionLogValue decodes a TransactionLogValue
+func decodeTransactionLogValue(transactionalID string, data []byte) (*TransactionMetadata, error) {
+	d := NewDecoder(data)
+	if version := d.ReadInt16(); version != transactionLogValueVersion {
+		return nil, fmt.Errorf("unsupported transaction log value version %d", version)
+	}
+
+	txn := &TransactionMetadata{
+		TransactionalID:   transactionalID,
+		ProducerID:        d.ReadInt64(),
+		ProducerEpoch:     d.ReadInt16(),
+		TimeoutMs:         d.ReadInt32(),
+		State:             TransactionState(d.ReadInt8()),
+		Partitions:        make(map[TopicPartition]bool),
+		lastProducerEpoch: NoProducerEpoch,
+	}
+	topicCount := int(d.ReadInt32())
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := d.ReadString(false)
+		partitionCount := int(d.ReadInt32())
+		for j := 0; j < partitionCount && d.Err() == nil; j++ {
+			txn.Partitions[TopicPartition{Topic: topic, Partition: d.ReadInt32()}] = true
+		}
+	}
+	txn.LastUpdateMs = d.ReadInt64()
+	txn.StartMs = d.ReadInt64()
+
+	if d.Err() == nil && (txn.State < TransactionEmpty || txn.State > TransactionPrepareEpochFence) {
+		return nil, fmt.Errorf("unknown transaction state %d", txn.State)
+	}
+	return txn, d.Err()
+}
+
+// compareTopicPartitions orders partitions by topic and index
+func compareTopicPartitions(a, b TopicPartition) int {
+	return cmp.Or(strings.Compare(a.Topic, b.Topic), cmp.Compare(a.Partition, b.Partition))
+}
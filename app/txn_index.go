@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// TxnIndexEntrySize is the size of one transaction index entry: a 2-byte version, then the
+// producer ID, first offset, last offset and last stable offset as 8-byte integers
+const TxnIndexEntrySize = 34
+
+// txnIndexEntryVersion is the format version of transaction index entries
+const txnIndexEntryVersion = 0
+
+// TxnIndexFileName returns the name of the transaction index file for the segment starting at baseOffset
+func TxnIndexFileName(baseOffset int64) string {
+	return fmt.Sprintf("%020d.txnindex", baseOffset)
+}
+
+// AbortedTxn is a transaction aborted in a partition
+type AbortedTxn struct {
+	ProducerID int64
+	// FirstOffset is the offset of the transaction's first batch in the partition
+	FirstOffset int64
+	// LastOffset is the offset of the abort marker
+	LastOffset int64
+	// LastStableOffset is the partition's last stable offset once the transaction was aborted
+	LastStableOffset int64
+}
+
+// TxnIndex lists the transactions aborted in one log segment, in the order of their markers.
+// Consumers reading committed data use it to skip the records of aborted transactions.
+type TxnIndex struct {
+	file    *os.File
+	entries []AbortedTxn
+}
+
+// OpenTxnIndex opens or creates the transaction index at path, loading its entries
+func OpenTxnIndex(path string) (*TxnIndex, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transaction index %s: %w", path, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read transaction index %s: %w", path, err)
+	}
+
+	index := &TxnIndex{file: file}
+	for position := 0; position+TxnIndexEntrySize <= len(data); position += TxnIndexEntrySize {
+		entry := data[position+SizeInt16:]
+		index.entries = append(index.entries, AbortedTxn{
+			ProducerID:       int64(binary.BigEndian.Uint64(entry)),
+			FirstOffset:      int64(binary.BigEndian.Uint64(entry[SizeInt64:])),
+			LastOffset:       int64(binary.BigEndian.Uint64(entry[2*SizeInt64:])),
+			LastStableOffset: int64(binary.BigEndian.Uint64(entry[3*SizeInt64:])),
+		})
+	}
+
+	return index, nil
+}
+
+// Append records an aborted transaction
+func (ti *TxnIndex) Append(txn AbortedTxn) error {
+	position := int64(len(ti.entries) * TxnIndexEntrySize)
+	if _, err := ti.file.WriteAt(encodeAbortedTxn(nil, txn), position); err != nil {
+		return fmt.Errorf("failed to append transaction index entry: %w", err)
+	}
+	ti.entries = append(ti.entries, txn)
+	return nil
+}
+
+// Collect returns the aborted transactions with records in [startOffset, endOffset)
+func (ti *TxnIndex) Collect(startOffset int64, endOffset int64) []AbortedTxn {
+	var aborted []AbortedTxn
+	for _, txn := range ti.entries {
+		if txn.LastOffset >= startOffset && txn.FirstOffset < endOffset {
+			aborted = append(aborted, txn)
+		}
+	}
+	return aborted
+}
+
+// TruncateFrom removes the transactions whose abort marker is at or after offset
+func (ti *TxnIndex) TruncateFrom(offset int64) error {
+	kept := 0
+	for kept < len(ti.entries) && ti.entries[kept].LastOffset < offset {
+		kept++
+	}
+	if kept == len(ti.entries) {
+		return nil
+	}
+
+	if err := ti.file.Truncate(int64(kept * TxnIndexEntrySize)); err != nil {
+		return fmt.Errorf("failed to truncate transaction index: %w", err)
+	}
+	ti.entries = ti.entries[:kept]
+	return nil
+}
+
+// Sync flushes the index file to disk
+func (ti *TxnIndex) Sync() error {
+	return ti.file.Sync()
+}
+
+// Close closes the index file
+func (ti *TxnIndex) Close() error {
+	return ti.file.Close()
+}
+
+// encodeAbortedTxn appends the index entry of an aborted transaction to buf
+func encodeAbortedTxn(buf []byte, txn AbortedTxn) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, txnIndexEntryVersion)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(txn.ProducerID))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(txn.FirstOffset))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(txn.LastOffset))
+	return binary.BigEndian.AppendUint64(buf, uint64(txn.LastStableOffset))
+}
@@ -0,0 +1,67 @@
+package main
+
+import "fmt"
+
+// TxnOffsetCommitRequest represents a parsed TxnOffsetCommit request
+type TxnOffsetCommitRequest struct {
+	TransactionalID string
+	GroupID         string
+	ProducerID      int64
+	ProducerEpoch   int16
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID *string
+	Topics          []OffsetCommitTopic
+}
+
+// ParseTxnOffsetCommitRequest parses the body of a TxnOffsetCommit request (v0-v3).
+// The committed offsets have the same layout as those of OffsetCommit.
+func ParseTxnOffsetCommitRequest(baseReq *SwiftQueueRequest) (*TxnOffsetCommitRequest, error) {
+	version := baseReq.APIVersion
+	if version < TxnOffsetCommitMinVersion || version > TxnOffsetCommitMaxVersion {
+		return nil, fmt.Errorf("unsupported txn offset commit version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &TxnOffsetCommitRequest{GenerationID: -1}
+	req.TransactionalID = d.ReadString(flexible)
+	req.GroupID = d.ReadString(flexible)
+	req.ProducerID = d.ReadInt64()
+	req.ProducerEpoch = d.ReadInt16()
+	if version >= 3 {
+		req.GenerationID = d.ReadInt32()
+		req.MemberID = d.ReadString(flexible)
+		req.GroupInstanceID = d.ReadNullableString(flexible)
+	}
+
+	topicCount := d.ReadArrayLength(flexible)
+	for i := 0; i < topicCount && d.Err() == nil; i++ {
+		topic := OffsetCommitTopic{}
+		topic.Name = d.ReadString(flexible)
+
+		partitionCount := d.ReadArrayLength(flexible)
+		for j := 0; j < partitionCount && d.Err() == nil; j++ {
+			partition := OffsetCommitPartition{LeaderEpoch: -1}
+			partition.Index = d.ReadInt32()
+			partition.Offset = d.ReadInt64()
+			if version >= 2 {
+				partition.LeaderEpoch = d.ReadInt32()
+			}
+			partition.Metadata = d.ReadNullableString(flexible)
+			d.SkipTaggedFields(flexible)
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+
+		d.SkipTaggedFields(flexible)
+		req.Topics = append(req.Topics, topic)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse txn offset commit request: %w", err)
+	}
+
+	return req, nil
+}
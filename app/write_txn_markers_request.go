@@ -0,0 +1,67 @@
+package main
+
+import "fmt"
+
+// WriteTxnMarkersRequest represents a parsed WriteTxnMarkers request
+type WriteTxnMarkersRequest struct {
+	Markers []WritableTxnMarker
+}
+
+// WritableTxnMarker is a marker completing one producer's transaction in the listed partitions
+type WritableTxnMarker struct {
+	ProducerID    int64
+	ProducerEpoch int16
+	// TransactionResult is true to commit the transaction and false to abort it
+	TransactionResult bool
+	Topics            []WritableTxnMarkerTopic
+	CoordinatorEpoch  int32
+}
+
+// WritableTxnMarkerTopic lists the partitions of a topic to write a marker to
+type WritableTxnMarkerTopic struct {
+	Name             string
+	PartitionIndexes []int32
+}
+
+// ParseWriteTxnMarkersRequest parses the body of a WriteTxnMarkers request (v0-v1)
+func ParseWriteTxnMarkersRequest(baseReq *SwiftQueueRequest) (*WriteTxnMarkersRequest, error) {
+	version := baseReq.APIVersion
+	if version < WriteTxnMarkersMinVersion || version > WriteTxnMarkersMaxVersion {
+		return nil, fmt.Errorf("unsupported write txn markers version: %d", version)
+	}
+
+	flexible := IsFlexibleVersion(baseReq.APIKey, version)
+	d := NewDecoder(baseReq.Body)
+
+	req := &WriteTxnMarkersRequest{}
+	markerCount := d.ReadArrayLength(flexible)
+	for i := 0; i < markerCount && d.Err() == nil; i++ {
+		marker := WritableTxnMarker{}
+		marker.ProducerID = d.ReadInt64()
+		marker.ProducerEpoch = d.ReadInt16()
+		marker.TransactionResult = d.ReadBool()
+
+		topicCount := d.ReadArrayLength(flexible)
+		for j := 0; j < topicCount && d.Err() == nil; j++ {
+			topic := WritableTxnMarkerTopic{}
+			topic.Name = d.ReadString(flexible)
+			partitionCount := d.ReadArrayLength(flexible)
+			for k := 0; k < partitionCount && d.Err() == nil; k++ {
+				topic.PartitionIndexes = append(topic.PartitionIndexes, d.ReadInt32())
+			}
+			d.SkipTaggedFields(flexible)
+			marker.Topics = append(marker.Topics, topic)
+		}
+
+		marker.CoordinatorEpoch = d.ReadInt32()
+		d.SkipTaggedFields(flexible)
+		req.Markers = append(req.Markers, marker)
+	}
+	d.SkipTaggedFields(flexible)
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse write txn markers request: %w", err)
+	}
+
+	return req, nil
+}
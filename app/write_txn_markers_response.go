@@ -0,0 +1,83 @@
+package main
+
+// WriteTxnMarkersResult holds the per-partition results of one marker
+type WriteTxnMarkersResult struct {
+	ProducerID int64
+	Topics     []WriteTxnMarkersTopicResult
+}
+
+// WriteTxnMarkersTopicResult holds the per-partition results for one topic of a marker
+type WriteTxnMarkersTopicResult struct {
+	Name       string
+	Partitions []WriteTxnMarkersPartitionResult
+}
+
+// WriteTxnMarkersPartitionResult is the outcome of writing a marker to one partition
+type WriteTxnMarkersPartitionResult struct {
+	Index     int32
+	ErrorCode int16
+}
+
+// BuildWriteTxnMarkersResponse writes the requested transaction markers and builds the response.
+// Transaction coordinators send this request to the leaders of a transaction's partitions;
+// this broker's own coordinator writes its markers directly, so the request mostly serves
+// tools completing transactions by hand.
+func BuildWriteTxnMarkersResponse(baseReq *SwiftQueueRequest, req *WriteTxnMarkersRequest, broker *Broker) []byte {
+	topics, partitions := broker.TopicsAndPartitions()
+
+	results := make([]WriteTxnMarkersResult, 0, len(req.Markers))
+	for _, marker := range req.Markers {
+		markerResult := WriteTxnMarkersResult{ProducerID: marker.ProducerID}
+		for _, markerTopic := range marker.Topics {
+			topicResult := WriteTxnMarkersTopicResult{Name: markerTopic.Name}
+			topic := findTopicByName(topics, markerTopic.Name)
+
+			for _, index := range markerTopic.PartitionIndexes {
+				tp := TopicPartition{Topic: markerTopic.Name, Partition: index}
+				result := WriteTxnMarkersPartitionResult{Index: index}
+				if tp != offsetsPartition && (topic == nil || !hasPartition(partitions, topic.UUID, index)) {
+					result.ErrorCode = ErrorCodeUnknownTopicOrPart
+				} else {
+					result.ErrorCode = broker.writeTxnMarker(tp, marker.ProducerID, marker.ProducerEpoch, marker.TransactionResult, marker.CoordinatorEpoch)
+				}
+				topicResult.Partitions = append(topicResult.Partitions, result)
+			}
+
+			markerResult.Topics = append(markerResult.Topics, topicResult)
+		}
+		results = append(results, markerResult)
+	}
+
+	return encodeWriteTxnMarkersResponse(baseReq, results)
+}
+
+// encodeWriteTxnMarkersResponse serializes the WriteTxnMarkers response for the request's version
+func encodeWriteTxnMarkersResponse(baseReq *SwiftQueueRequest, results []WriteTxnMarkersResult) []byte {
+	flexible := IsFlexibleVersion(baseReq.APIKey, baseReq.APIVersion)
+	rb := NewResponseBuilder()
+
+	rb.WriteResponseHeader(baseReq.CorrelationID, flexible)
+
+	rb.WriteArrayLength(len(results), flexible)
+	for _, marker := range results {
+		rb.WriteInt64(marker.ProducerID)
+		rb.WriteArrayLength(len(marker.Topics), flexible)
+		for _, topic := range marker.Topics {
+			rb.WriteStringField(topic.Name, flexible)
+			rb.WriteArrayLength(len(topic.Partitions), flexible)
+			for _, partition := range topic.Partitions {
+				rb.WriteInt32(partition.Index)
+				rb.WriteInt16(partition.ErrorCode)
+				rb.WriteTaggedFields(flexible)
+			}
+			rb.WriteTaggedFields(flexible)
+		}
+		rb.WriteTaggedFields(flexible)
+	}
+
+	rb.WriteTaggedFields(flexible)
+
+	rb.PrependMessageSize()
+
+	return rb.Bytes()
+}